@@ -9,8 +9,10 @@ import (
 	"github.com/bitly/go-simplejson"
 )
 
-func Request(req *http.Request) (*simplejson.Json, error) {
-	resp, err := http.DefaultClient.Do(req)
+// Request does req with client and parses its JSON response, which must
+// have a 200 status.
+func Request(client *http.Client, req *http.Request) (*simplejson.Json, error) {
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +32,9 @@ func Request(req *http.Request) (*simplejson.Json, error) {
 	return data, nil
 }
 
-func RequestUnparsedResponse(url string, header http.Header) (
+// RequestUnparsedResponse GETs url with header using client. The caller
+// must close the response body.
+func RequestUnparsedResponse(client *http.Client, url string, header http.Header) (
 	response *http.Response, err error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -39,8 +43,7 @@ func RequestUnparsedResponse(url string, header http.Header) (
 	}
 	req.Header = header
 
-	httpclient := &http.Client{}
-	if response, err = httpclient.Do(req); err != nil {
+	if response, err = client.Do(req); err != nil {
 		return nil, errors.New("request failed for " +
 			url + ": " + err.Error())
 	}
@@ -12,7 +12,7 @@ gpm install
 
 os=$(go env GOOS)
 arch=$(go env GOARCH)
-version=$(cat $DIR/version.go | grep "const VERSION" | awk '{print $NF}' | sed 's/"//g')
+version=$(cat $DIR/proxy/version.go | grep "const VERSION" | awk '{print $NF}' | sed 's/"//g')
 goversion=$(go version | awk '{print $3}')
 
 echo "... running tests"
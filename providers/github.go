@@ -2,6 +2,7 @@ package providers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -11,6 +12,7 @@ type GitHubProvider struct {
 	*ProviderData
 	Org  string
 	Team string
+	Repo string
 }
 
 func NewGitHubProvider(p *ProviderData) *GitHubProvider {
@@ -49,34 +51,66 @@ func (p *GitHubProvider) SetOrgTeam(org, team string) {
 	}
 }
 
-func (p *GitHubProvider) hasOrgAndTeam(accessToken string) (bool, error) {
+// SetRepo restricts logins to collaborators of repo ("owner/name"). A
+// private repository can only be checked with the repo scope, which grants
+// read/write access to all of the user's private repositories, so it is only
+// requested when private is set.
+func (p *GitHubProvider) SetRepo(repo string, private bool) {
+	p.Repo = repo
+	if repo != "" && private {
+		p.Scope += " repo"
+	}
+}
 
-	var teams []struct {
-		Name string `json:"name"`
-		Slug string `json:"slug"`
-		Org  struct {
-			Login string `json:"login"`
-		} `json:"organization"`
+// apiUrl returns the GitHub API URL for path, on the same host as the
+// ValidateUrl.
+func (p *GitHubProvider) apiUrl(path string, params url.Values) string {
+	u := url.URL{
+		Scheme:   p.ValidateUrl.Scheme,
+		Host:     p.ValidateUrl.Host,
+		Path:     path,
+		RawQuery: params.Encode(),
 	}
+	return u.String()
+}
+
+type gitHubTeam struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	Org  struct {
+		Login string `json:"login"`
+	} `json:"organization"`
+}
+
+func (p *GitHubProvider) getTeams(accessToken string) ([]gitHubTeam, error) {
+	var teams []gitHubTeam
 
 	params := url.Values{
 		"access_token": {accessToken},
 	}
 
-	req, _ := http.NewRequest("GET", "https://api.github.com/user/teams?"+params.Encode(), nil)
+	req, _ := http.NewRequest("GET", p.apiUrl("/user/teams", params), nil)
 	req.Header.Set("Accept", "application/vnd.github.moondragon+json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.client().Do(req)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	if err := json.Unmarshal(body, &teams); err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+func (p *GitHubProvider) hasOrgAndTeam(accessToken string) (bool, error) {
+	teams, err := p.getTeams(accessToken)
+	if err != nil {
 		return false, err
 	}
 
@@ -90,11 +124,97 @@ func (p *GitHubProvider) hasOrgAndTeam(accessToken string) (bool, error) {
 	return false, nil
 }
 
+// hasRepo reports whether the user is a collaborator on p.Repo. Anyone can
+// pull from a public repository, so only push access counts for those.
+func (p *GitHubProvider) hasRepo(accessToken string) (bool, error) {
+	var repo struct {
+		Private     bool `json:"private"`
+		Permissions struct {
+			Pull bool `json:"pull"`
+			Push bool `json:"push"`
+		} `json:"permissions"`
+	}
+
+	params := url.Values{
+		"access_token": {accessToken},
+	}
+
+	resp, err := p.client().Get(p.apiUrl("/repos/"+p.Repo, params))
+	if err != nil {
+		return false, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		// private repositories are not found by non-collaborators
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("got %d from %q %s", resp.StatusCode, "/repos/"+p.Repo, body)
+	}
+
+	if err := json.Unmarshal(body, &repo); err != nil {
+		return false, err
+	}
+	return repo.Permissions.Push || (repo.Private && repo.Permissions.Pull), nil
+}
+
+// GetGroups returns the user's teams as "org/team" slugs. Teams are only
+// requested when the read:org scope was granted for an org or team
+// restriction.
+func (p *GitHubProvider) GetGroups(body []byte, access_token string) ([]string, error) {
+	if p.Org == "" && p.Team == "" {
+		return nil, nil
+	}
+	teams, err := p.getTeams(access_token)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(teams))
+	for _, team := range teams {
+		groups = append(groups, team.Org.Login+"/"+team.Slug)
+	}
+	return groups, nil
+}
+
+// GetPreferredUsername returns the user's GitHub login.
+func (p *GitHubProvider) GetPreferredUsername(body []byte, access_token string) (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+
+	params := url.Values{
+		"access_token": {access_token},
+	}
+
+	resp, err := p.client().Get(p.apiUrl("/user", params))
+	if err != nil {
+		return "", err
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("got %d from %q %s", resp.StatusCode, "/user", body)
+	}
+
+	if err := json.Unmarshal(body, &user); err != nil {
+		return "", err
+	}
+	return user.Login, nil
+}
+
 func (p *GitHubProvider) GetEmailAddress(body []byte, access_token string) (string, error) {
 
 	var emails []struct {
-		Email   string `json:"email"`
-		Primary bool   `json:"primary"`
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
 	}
 
 	params := url.Values{
@@ -107,8 +227,13 @@ func (p *GitHubProvider) GetEmailAddress(body []byte, access_token string) (stri
 			return "", err
 		}
 	}
+	if p.Repo != "" {
+		if ok, err := p.hasRepo(access_token); err != nil || !ok {
+			return "", err
+		}
+	}
 
-	resp, err := http.DefaultClient.Get("https://api.github.com/user/emails?" + params.Encode())
+	resp, err := p.client().Get(p.apiUrl("/user/emails", params))
 	if err != nil {
 		return "", err
 	}
@@ -124,6 +249,9 @@ func (p *GitHubProvider) GetEmailAddress(body []byte, access_token string) (stri
 
 	for _, email := range emails {
 		if email.Primary {
+			if p.RequireVerifiedEmail && !email.Verified {
+				return "", ErrEmailNotVerified
+			}
 			return email.Email, nil
 		}
 	}
@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func newGitHubProvider(api *httptest.Server) *GitHubProvider {
+	validateUrl, _ := url.Parse(api.URL + "/user/emails")
+	return NewGitHubProvider(
+		&ProviderData{
+			LoginUrl:    &url.URL{},
+			RedeemUrl:   &url.URL{},
+			ProfileUrl:  &url.URL{},
+			ValidateUrl: validateUrl,
+		})
+}
+
+func newGitHubAPI(repos map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "token" {
+			w.WriteHeader(401)
+			return
+		}
+		if r.URL.Path == "/user/emails" {
+			w.Write([]byte(`[{"email": "michael.bland@gsa.gov", "primary": true, "verified": true}]`))
+			return
+		}
+		if r.URL.Path == "/user" {
+			w.Write([]byte(`{"login": "mbland"}`))
+			return
+		}
+		if repo, ok := repos[r.URL.Path]; ok {
+			w.Write([]byte(repo))
+			return
+		}
+		w.WriteHeader(404)
+	}))
+}
+
+func TestGitHubProviderRepoScope(t *testing.T) {
+	api := newGitHubAPI(nil)
+	defer api.Close()
+	p := newGitHubProvider(api)
+	assert.Equal(t, "user:email", p.Data().Scope)
+	p.SetRepo("bitly/oauth2_proxy", false)
+	assert.Equal(t, "user:email", p.Data().Scope)
+
+	p = newGitHubProvider(api)
+	p.SetRepo("bitly/oauth2_proxy", true)
+	assert.Equal(t, "user:email repo", p.Data().Scope)
+}
+
+func TestGitHubProviderRepoCollaborator(t *testing.T) {
+	api := newGitHubAPI(map[string]string{
+		"/repos/org/private": `{"private": true, "permissions": {"pull": true, "push": false}}`,
+		"/repos/org/public":  `{"private": false, "permissions": {"pull": true, "push": false}}`,
+		"/repos/org/pushed":  `{"private": false, "permissions": {"pull": true, "push": true}}`,
+	})
+	defer api.Close()
+
+	tests := []struct {
+		repo  string
+		email string
+	}{
+		{"org/private", "michael.bland@gsa.gov"},
+		{"org/pushed", "michael.bland@gsa.gov"},
+		// anyone can pull from a public repository
+		{"org/public", ""},
+		{"org/missing", ""},
+	}
+	for _, tt := range tests {
+		p := newGitHubProvider(api)
+		p.SetRepo(tt.repo, true)
+		email, err := p.GetEmailAddress(nil, "token")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, tt.email, email)
+	}
+}
+
+func TestGitHubProviderGetPreferredUsername(t *testing.T) {
+	api := newGitHubAPI(nil)
+	defer api.Close()
+	p := newGitHubProvider(api)
+
+	login, err := p.GetPreferredUsername(nil, "token")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "mbland", login)
+
+	_, err = p.GetPreferredUsername(nil, "wrong token")
+	assert.NotEqual(t, nil, err)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net/url"
 	"strings"
+	"time"
 )
 
 type GoogleProvider struct {
@@ -36,33 +37,92 @@ func NewGoogleProvider(p *ProviderData) *GoogleProvider {
 }
 
 func (s *GoogleProvider) GetEmailAddress(body []byte, access_token string) (string, error) {
+	var email struct {
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+		AMR           []string    `json:"amr"`
+		ACR           string      `json:"acr"`
+	}
+	if err := idTokenClaims(body, &email); err != nil {
+		return "", err
+	}
+	if email.Email == "" {
+		return "", errors.New("missing email")
+	}
+	// email_verified is a boolean, but some tokens encode it as a string
+	verified := email.EmailVerified == true || email.EmailVerified == "true"
+	if s.RequireVerifiedEmail && !verified {
+		return "", ErrEmailNotVerified
+	}
+	if err := s.checkMFA(email.AMR, email.ACR); err != nil {
+		return "", err
+	}
+	return email.Email, nil
+}
+
+// GetGroups returns the "groups" claim of the ID token, which is present
+// when the login and redeem URLs point at an OpenID Connect provider that
+// issues group claims.
+func (s *GoogleProvider) GetGroups(body []byte, access_token string) ([]string, error) {
+	var claims struct {
+		Groups []string `json:"groups"`
+	}
+	if err := idTokenClaims(body, &claims); err != nil {
+		return nil, err
+	}
+	return claims.Groups, nil
+}
+
+// GetAuthTime returns the "auth_time" claim of the ID token, which is
+// included when the login URL asks for a max_age.
+func (s *GoogleProvider) GetAuthTime(body []byte, access_token string) (time.Time, error) {
+	var claims struct {
+		AuthTime int64 `json:"auth_time"`
+	}
+	if err := idTokenClaims(body, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.AuthTime == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(claims.AuthTime, 0), nil
+}
+
+// GetPreferredUsername returns the "preferred_username" claim of the ID
+// token, which OpenID Connect providers such as Keycloak issue; Google
+// itself doesn't.
+func (s *GoogleProvider) GetPreferredUsername(body []byte, access_token string) (string, error) {
+	var claims struct {
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idTokenClaims(body, &claims); err != nil {
+		return "", err
+	}
+	return claims.PreferredUsername, nil
+}
+
+// idTokenClaims decodes the payload of the id_token in a redeem response
+// into v.
+func idTokenClaims(body []byte, v interface{}) error {
 	var response struct {
 		IdToken string `json:"id_token"`
 	}
 
 	if err := json.Unmarshal(body, &response); err != nil {
-		return "", err
+		return err
 	}
 
 	// id_token is a base64 encode ID token payload
 	// https://developers.google.com/accounts/docs/OAuth2Login#obtainuserinfo
 	jwt := strings.Split(response.IdToken, ".")
-	b, err := jwtDecodeSegment(jwt[1])
-	if err != nil {
-		return "", err
+	if len(jwt) < 2 {
+		return errors.New("malformed id_token")
 	}
-
-	var email struct {
-		Email string `json:"email"`
-	}
-	err = json.Unmarshal(b, &email)
+	b, err := jwtDecodeSegment(jwt[1])
 	if err != nil {
-		return "", err
+		return err
 	}
-	if email.Email == "" {
-		return "", errors.New("missing email")
-	}
-	return email.Email, nil
+	return json.Unmarshal(b, v)
 }
 
 func jwtDecodeSegment(seg string) ([]byte, error) {
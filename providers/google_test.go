@@ -6,6 +6,7 @@ import (
 	"github.com/bmizerany/assert"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func newGoogleProvider() *GoogleProvider {
@@ -126,3 +127,85 @@ func TestGoogleProviderGetEmailAddressEmailMissing(t *testing.T) {
 	assert.Equal(t, "", email)
 	assert.NotEqual(t, nil, err)
 }
+
+func TestGoogleProviderGetGroups(t *testing.T) {
+	p := newGoogleProvider()
+	body, err := json.Marshal(
+		struct {
+			IdToken string `json:"id_token"`
+		}{
+			IdToken: "ignored prefix." + base64.URLEncoding.EncodeToString([]byte(`{"email": "michael.bland@gsa.gov", "groups": ["admins", "staff"]}`)),
+		},
+	)
+	assert.Equal(t, nil, err)
+	groups, err := p.GetGroups(body, "ignored access_token")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"admins", "staff"}, groups)
+}
+
+func TestGoogleProviderGetGroupsMissing(t *testing.T) {
+	p := newGoogleProvider()
+	body, err := json.Marshal(
+		struct {
+			IdToken string `json:"id_token"`
+		}{
+			IdToken: "ignored prefix." + base64.URLEncoding.EncodeToString([]byte(`{"email": "michael.bland@gsa.gov"}`)),
+		},
+	)
+	assert.Equal(t, nil, err)
+	groups, err := p.GetGroups(body, "ignored access_token")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string(nil), groups)
+}
+
+func TestGoogleProviderGetAuthTime(t *testing.T) {
+	p := newGoogleProvider()
+	authTime, err := p.GetAuthTime(googleRedeemBody(`{"email": "michael.bland@gsa.gov", "auth_time": 1436000000}`), "ignored access_token")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Unix(1436000000, 0), authTime)
+
+	authTime, err = p.GetAuthTime(googleRedeemBody(`{"email": "michael.bland@gsa.gov"}`), "ignored access_token")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, authTime.IsZero())
+}
+
+func TestGoogleProviderGetPreferredUsername(t *testing.T) {
+	p := newGoogleProvider()
+	username, err := p.GetPreferredUsername(googleRedeemBody(`{"email": "michael.bland@gsa.gov", "preferred_username": "mbland"}`), "ignored access_token")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "mbland", username)
+
+	username, err = p.GetPreferredUsername(googleRedeemBody(`{"email": "michael.bland@gsa.gov"}`), "ignored access_token")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", username)
+}
+
+func googleRedeemBody(claims string) []byte {
+	body, _ := json.Marshal(
+		struct {
+			IdToken string `json:"id_token"`
+		}{
+			IdToken: "ignored prefix." + base64.URLEncoding.EncodeToString([]byte(claims)),
+		},
+	)
+	return body
+}
+
+func TestGoogleProviderRequireVerifiedEmail(t *testing.T) {
+	p := newGoogleProvider()
+	p.RequireVerifiedEmail = true
+
+	email, err := p.GetEmailAddress(googleRedeemBody(`{"email": "michael.bland@gsa.gov", "email_verified": true}`), "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", email)
+
+	email, err = p.GetEmailAddress(googleRedeemBody(`{"email": "michael.bland@gsa.gov", "email_verified": "true"}`), "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", email)
+
+	_, err = p.GetEmailAddress(googleRedeemBody(`{"email": "michael.bland@gsa.gov", "email_verified": false}`), "")
+	assert.Equal(t, ErrEmailNotVerified, err)
+
+	_, err = p.GetEmailAddress(googleRedeemBody(`{"email": "michael.bland@gsa.gov"}`), "")
+	assert.Equal(t, ErrEmailNotVerified, err)
+}
@@ -15,10 +15,11 @@ func validateToken(p Provider, access_token string,
 	if len(header) == 0 {
 		url = url + "?access_token=" + access_token
 	}
-	if resp, err := api.RequestUnparsedResponse(url, header); err != nil {
+	if resp, err := api.RequestUnparsedResponse(p.Data().client(), url, header); err != nil {
 		log.Printf("token validation request failed: %s", err)
 		return false
 	} else {
+		resp.Body.Close()
 		return resp.StatusCode == 200
 	}
 }
@@ -60,7 +60,7 @@ func (p *LinkedInProvider) GetEmailAddress(body []byte, access_token string) (st
 	}
 	req.Header = getLinkedInHeader(access_token)
 
-	json, err := api.Request(req)
+	json, err := api.Request(p.client(), req)
 	if err != nil {
 		log.Printf("failed making request %s", err)
 		return "", err
@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"errors"
+)
+
+// ErrMFARequired is returned by GetEmailAddress when multi-factor
+// authentication is required but the ID token's amr/acr claims show the
+// user signed in with a single factor.
+var ErrMFARequired = errors.New("multi-factor authentication is required")
+
+// factorClasses maps amr values (RFC 8176) to the class of factor they
+// are: something the user knows, has or is. Any one of them can be the
+// only factor used, so multi-factor means the "mfa" value itself or
+// methods of two different classes, such as "pwd" and "otp".
+var factorClasses = map[string]string{
+	"pwd":    "knowledge",
+	"pin":    "knowledge",
+	"kba":    "knowledge",
+	"otp":    "possession",
+	"hwk":    "possession",
+	"swk":    "possession",
+	"sms":    "possession",
+	"tel":    "possession",
+	"sc":     "possession",
+	"fpt":    "inherence",
+	"face":   "inherence",
+	"iris":   "inherence",
+	"retina": "inherence",
+	"vbm":    "inherence",
+}
+
+// checkMFA returns ErrMFARequired if RequireMFA is set and neither the amr
+// claim shows multi-factor authentication nor the acr claim is one of
+// MFAACRValues.
+func (p *ProviderData) checkMFA(amr []string, acr string) error {
+	if !p.RequireMFA {
+		return nil
+	}
+	classes := make(map[string]bool)
+	for _, m := range amr {
+		if m == "mfa" {
+			return nil
+		}
+		if class, ok := factorClasses[m]; ok {
+			classes[class] = true
+		}
+	}
+	if len(classes) >= 2 {
+		return nil
+	}
+	for _, v := range p.MFAACRValues {
+		if acr != "" && acr == v {
+			return nil
+		}
+	}
+	return ErrMFARequired
+}
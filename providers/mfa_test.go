@@ -0,0 +1,39 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestCheckMFA(t *testing.T) {
+	p := &ProviderData{}
+	assert.Equal(t, nil, p.checkMFA(nil, ""))
+
+	p.RequireMFA = true
+	assert.Equal(t, ErrMFARequired, p.checkMFA(nil, ""))
+	assert.Equal(t, ErrMFARequired, p.checkMFA([]string{"pwd"}, ""))
+	assert.Equal(t, nil, p.checkMFA([]string{"pwd", "otp"}, ""))
+	assert.Equal(t, nil, p.checkMFA([]string{"mfa"}, ""))
+	assert.Equal(t, nil, p.checkMFA([]string{"hwk", "pin"}, ""))
+	// a single factor, or two of the same class, isn't enough
+	assert.Equal(t, ErrMFARequired, p.checkMFA([]string{"otp"}, ""))
+	assert.Equal(t, ErrMFARequired, p.checkMFA([]string{"hwk"}, ""))
+	assert.Equal(t, ErrMFARequired, p.checkMFA([]string{"sms", "otp"}, ""))
+
+	p.MFAACRValues = []string{"http://schemas.openid.net/pape/policies/2007/06/multi-factor"}
+	assert.Equal(t, ErrMFARequired, p.checkMFA([]string{"pwd"}, "0"))
+	assert.Equal(t, nil, p.checkMFA(nil, "http://schemas.openid.net/pape/policies/2007/06/multi-factor"))
+}
+
+func TestGoogleProviderRequireMFA(t *testing.T) {
+	p := newGoogleProvider()
+	p.RequireMFA = true
+
+	_, err := p.GetEmailAddress(googleRedeemBody(`{"email": "michael.bland@gsa.gov", "amr": ["pwd"]}`), "")
+	assert.Equal(t, ErrMFARequired, err)
+
+	email, err := p.GetEmailAddress(googleRedeemBody(`{"email": "michael.bland@gsa.gov", "amr": ["pwd", "otp"]}`), "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", email)
+}
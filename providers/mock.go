@@ -0,0 +1,72 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// mockTokenPrefix starts every access token MockProvider issues.
+const mockTokenPrefix = "mock."
+
+// MockProvider signs in whoever presents a code, without contacting a real
+// provider, for load tests and benchmarks. The code is the user: "alice"
+// signs in as alice@example.com, and a code with an "@" as that address.
+// Its answers are deterministic and need no network, so measurements are
+// of the proxy alone. It must never be used to protect anything.
+type MockProvider struct {
+	*ProviderData
+}
+
+func NewMockProvider(p *ProviderData) *MockProvider {
+	p.ProviderName = "Mock"
+	if p.LoginUrl.String() == "" {
+		p.LoginUrl = &url.URL{
+			Scheme: "https",
+			Host:   "mock-provider.invalid",
+			Path:   "/authorize",
+		}
+	}
+	return &MockProvider{ProviderData: p}
+}
+
+func (p *MockProvider) Redeem(redirectUrl, code string) (body []byte, token string, err error) {
+	if code == "" {
+		return nil, "", errors.New("missing code")
+	}
+	email := code
+	if !strings.Contains(email, "@") {
+		email += "@example.com"
+	}
+	token = mockTokenPrefix + email
+	body, err = json.Marshal(map[string]string{"access_token": token, "email": email})
+	return body, token, err
+}
+
+func (p *MockProvider) GetEmailAddress(body []byte, access_token string) (string, error) {
+	var r struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return "", err
+	}
+	return r.Email, nil
+}
+
+// GetAuthTime returns now: every code is a new sign in.
+func (p *MockProvider) GetAuthTime(body []byte, access_token string) (time.Time, error) {
+	return time.Now(), nil
+}
+
+// GetPreferredUsername returns the local part of the email address.
+func (p *MockProvider) GetPreferredUsername(body []byte, access_token string) (string, error) {
+	email, err := p.GetEmailAddress(body, access_token)
+	return strings.Split(email, "@")[0], err
+}
+
+// ValidateToken accepts the tokens Redeem issues.
+func (p *MockProvider) ValidateToken(access_token string) bool {
+	return strings.HasPrefix(access_token, mockTokenPrefix)
+}
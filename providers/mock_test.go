@@ -0,0 +1,29 @@
+package providers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestMockProvider(t *testing.T) {
+	p := NewMockProvider(&ProviderData{LoginUrl: &url.URL{}})
+	assert.Equal(t, "Mock", p.Data().ProviderName)
+
+	for code, want := range map[string]string{
+		"alice":            "alice@example.com",
+		"bob@corp.example": "bob@corp.example",
+	} {
+		body, token, err := p.Redeem("https://proxy/oauth2/callback", code)
+		assert.Equal(t, nil, err)
+		email, err := p.GetEmailAddress(body, token)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, want, email)
+		assert.Equal(t, true, p.ValidateToken(token))
+	}
+
+	_, _, err := p.Redeem("https://proxy/oauth2/callback", "")
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, false, p.ValidateToken("other"))
+}
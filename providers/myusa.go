@@ -49,7 +49,7 @@ func (p *MyUsaProvider) GetEmailAddress(body []byte, access_token string) (strin
 		log.Printf("failed building request %s", err)
 		return "", err
 	}
-	json, err := api.Request(req)
+	json, err := api.Request(p.client(), req)
 	if err != nil {
 		log.Printf("failed making request %s", err)
 		return "", err
@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"net/http"
 	"net/url"
 )
 
@@ -13,6 +14,27 @@ type ProviderData struct {
 	ProfileUrl   *url.URL
 	ValidateUrl  *url.URL
 	Scope        string
+
+	// RequireVerifiedEmail rejects accounts whose email address the
+	// provider reports as unverified.
+	RequireVerifiedEmail bool
+
+	// RequireMFA rejects sign ins whose ID token amr/acr claims don't
+	// indicate multi-factor authentication; MFAACRValues lists the acr
+	// values that count as multi-factor.
+	RequireMFA   bool
+	MFAACRValues []string
+
+	// HTTPClient makes the requests to the provider; http.DefaultClient if
+	// nil.
+	HTTPClient *http.Client
 }
 
 func (p *ProviderData) Data() *ProviderData { return p }
+
+func (p *ProviderData) client() *http.Client {
+	if p.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return p.HTTPClient
+}
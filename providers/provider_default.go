@@ -27,7 +27,7 @@ func (p *ProviderData) Redeem(redirectUrl, code string) (body []byte, token stri
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.client().Do(req)
 	if err != nil {
 		return nil, "", err
 	}
@@ -1,5 +1,15 @@
 package providers
 
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrEmailNotVerified is returned by GetEmailAddress when a verified email
+// is required but the provider reports the address as unverified.
+var ErrEmailNotVerified = errors.New("email address is not verified")
+
 type Provider interface {
 	Data() *ProviderData
 	GetEmailAddress(body []byte, access_token string) (string, error)
@@ -7,15 +17,62 @@ type Provider interface {
 	ValidateToken(access_token string) bool
 }
 
+// GroupsProvider is implemented by providers that can report the groups
+// (teams, organizations) an account belongs to.
+type GroupsProvider interface {
+	GetGroups(body []byte, access_token string) ([]string, error)
+}
+
+// AuthTimeProvider is implemented by providers that report when the user
+// last authenticated with them, such as by the auth_time claim of an ID
+// token. It is zero when the provider didn't say.
+type AuthTimeProvider interface {
+	GetAuthTime(body []byte, access_token string) (time.Time, error)
+}
+
+// UsernameProvider is implemented by providers that know a username or
+// login for an account besides its email address.
+type UsernameProvider interface {
+	GetPreferredUsername(body []byte, access_token string) (string, error)
+}
+
+// A Factory creates a Provider from the OAuth settings common to all
+// providers.
+type Factory func(p *ProviderData) Provider
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{
+		"google":   func(p *ProviderData) Provider { return NewGoogleProvider(p) },
+		"myusa":    func(p *ProviderData) Provider { return NewMyUsaProvider(p) },
+		"linkedin": func(p *ProviderData) Provider { return NewLinkedInProvider(p) },
+		"github":   func(p *ProviderData) Provider { return NewGitHubProvider(p) },
+	}
+)
+
+// Register makes a provider available to New, and so to --provider, by
+// name, for programs that add their own providers. It panics if name is
+// already registered or factory is nil.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("providers: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("providers: Register called twice for provider " + name)
+	}
+	factories[name] = factory
+}
+
+// New creates the provider registered as provider, or Google if there is
+// none.
 func New(provider string, p *ProviderData) Provider {
-	switch provider {
-	case "myusa":
-		return NewMyUsaProvider(p)
-	case "linkedin":
-		return NewLinkedInProvider(p)
-	case "github":
-		return NewGitHubProvider(p)
-	default:
-		return NewGoogleProvider(p)
+	factoriesMu.RLock()
+	factory, ok := factories[provider]
+	if !ok {
+		factory = factories["google"]
 	}
+	factoriesMu.RUnlock()
+	return factory(p)
 }
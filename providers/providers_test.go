@@ -0,0 +1,48 @@
+package providers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+type testRegisteredProvider struct {
+	*GoogleProvider
+}
+
+// newProviderData returns the settings a provider is created with once
+// options are validated, with all of its URLs set.
+func newProviderData() *ProviderData {
+	return &ProviderData{
+		LoginUrl:    &url.URL{},
+		RedeemUrl:   &url.URL{},
+		ProfileUrl:  &url.URL{},
+		ValidateUrl: &url.URL{},
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-registered", func(p *ProviderData) Provider {
+		provider := &testRegisteredProvider{NewGoogleProvider(p)}
+		p.ProviderName = "Registered"
+		return provider
+	})
+
+	p := New("test-registered", newProviderData())
+	_, ok := p.(*testRegisteredProvider)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "Registered", p.Data().ProviderName)
+
+	_, ok = New("github", newProviderData()).(*GitHubProvider)
+	assert.Equal(t, true, ok)
+	_, ok = New("", newProviderData()).(*GoogleProvider)
+	assert.Equal(t, true, ok)
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		assert.NotEqual(t, nil, recover())
+	}()
+	Register("github", func(p *ProviderData) Provider { return NewGitHubProvider(p) })
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ACL restricts which authenticated users may access which paths. Rules
+// are evaluated in order and the first rule matching the request path and
+// method decides; requests that match no rule are allowed.
+//
+// An ACL file is TOML:
+//
+//	[[rule]]
+//	path = "^/admin/"
+//	methods = ["POST", "DELETE"]
+//	emails = ["admin@example.com"]
+//	domains = ["example.com"]
+//	groups = ["example-org/admins"]
+type ACL struct {
+	Rules []*ACLRule `toml:"rule"`
+}
+
+type ACLRule struct {
+	Path    string   `toml:"path"`
+	Methods []string `toml:"methods"`
+	Emails  []string `toml:"emails"`
+	Domains []string `toml:"domains"`
+	Groups  []string `toml:"groups"`
+
+	pathRegex *regexp.Regexp
+	domains   *domainMatcher
+}
+
+func LoadACLFile(path string) (*ACL, error) {
+	acl := &ACL{}
+	if _, err := toml.DecodeFile(path, acl); err != nil {
+		return nil, err
+	}
+	for i, r := range acl.Rules {
+		var err error
+		r.pathRegex, err = regexp.Compile(r.Path)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: error compiling path=%q %s", i+1, r.Path, err)
+		}
+		for j, m := range r.Methods {
+			r.Methods[j] = strings.ToUpper(m)
+		}
+		for j, e := range r.Emails {
+			r.Emails[j] = strings.ToLower(e)
+		}
+		r.domains = newDomainMatcher(r.Domains)
+	}
+	return acl, nil
+}
+
+func (r *ACLRule) Matches(req *http.Request) bool {
+	if !r.pathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if m == req.Method {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits reports whether the rule admits the session. Users authenticated
+// without an email (htpasswd) are matched against the emails list by name.
+func (r *ACLRule) Permits(s *SessionState) bool {
+	identity := strings.ToLower(s.Email)
+	if identity == "" {
+		identity = strings.ToLower(s.User)
+	}
+	for _, e := range r.Emails {
+		if e == identity {
+			return true
+		}
+	}
+	if s.Email != "" && r.domains.Match(identity) {
+		return true
+	}
+	for _, g := range r.Groups {
+		for _, sg := range s.Groups {
+			if g == sg {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Allowed returns whether the session may access the request, and the rule
+// that decided it (nil when no rule matched).
+func (a *ACL) Allowed(req *http.Request, s *SessionState) (bool, *ACLRule) {
+	for _, r := range a.Rules {
+		if r.Matches(req) {
+			return r.Permits(s), r
+		}
+	}
+	return true, nil
+}
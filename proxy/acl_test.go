@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+const testACL = `
+[[rule]]
+path = "^/admin/"
+emails = ["Admin@Example.com"]
+groups = ["org/admins"]
+
+[[rule]]
+path = "^/api/"
+methods = ["post", "delete"]
+domains = ["*.example.com"]
+
+[[rule]]
+path = "^/ops/"
+emails = ["operator"]
+`
+
+func loadTestACL(t *testing.T, contents string) (*ACL, error) {
+	f, err := ioutil.TempFile("", "test_acl_")
+	if err != nil {
+		t.Fatal("failed to create temp file: " + err.Error())
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(contents)
+	f.Close()
+	return LoadACLFile(f.Name())
+}
+
+func aclAllowed(acl *ACL, method, path string, s *SessionState) bool {
+	req, _ := http.NewRequest(method, path, nil)
+	allowed, _ := acl.Allowed(req, s)
+	return allowed
+}
+
+func TestACL(t *testing.T) {
+	acl, err := loadTestACL(t, testACL)
+	assert.Equal(t, nil, err)
+
+	admin := &SessionState{Email: "admin@example.com"}
+	member := &SessionState{Email: "someone@eng.example.com", Groups: []string{"org/admins"}}
+	outsider := &SessionState{Email: "someone@example.org"}
+	operator := &SessionState{User: "operator"}
+
+	assert.Equal(t, true, aclAllowed(acl, "GET", "/", outsider))
+	assert.Equal(t, true, aclAllowed(acl, "GET", "/admin/", admin))
+	assert.Equal(t, true, aclAllowed(acl, "GET", "/admin/", member))
+	assert.Equal(t, false, aclAllowed(acl, "GET", "/admin/", outsider))
+
+	assert.Equal(t, true, aclAllowed(acl, "GET", "/api/", outsider))
+	assert.Equal(t, false, aclAllowed(acl, "POST", "/api/", outsider))
+	assert.Equal(t, false, aclAllowed(acl, "POST", "/api/", admin))
+	assert.Equal(t, true, aclAllowed(acl, "DELETE", "/api/", member))
+
+	assert.Equal(t, true, aclAllowed(acl, "GET", "/ops/", operator))
+	assert.Equal(t, false, aclAllowed(acl, "GET", "/ops/", admin))
+}
+
+func TestACLInvalidRegex(t *testing.T) {
+	_, err := loadTestACL(t, "[[rule]]\npath = \"(\"\n")
+	assert.NotEqual(t, nil, err)
+}
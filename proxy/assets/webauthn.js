@@ -0,0 +1,73 @@
+(function() {
+	var encode = function(buf) {
+		return btoa(String.fromCharCode.apply(null, new Uint8Array(buf)))
+			.replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+	};
+	var decode = function(s) {
+		s = s.replace(/-/g, '+').replace(/_/g, '/');
+		while (s.length % 4) {
+			s += '=';
+		}
+		return Uint8Array.from(atob(s), function(c) { return c.charCodeAt(0); });
+	};
+	var form = document.getElementById('webauthn');
+	var status = document.getElementById('webauthn-status');
+	form.addEventListener('submit', function(e) {
+		e.preventDefault();
+		var d = form.dataset;
+		var credentials = d.credentials ? d.credentials.split(',').map(function(id) {
+			return {type: 'public-key', id: decode(id)};
+		}) : [];
+		var response;
+		if (d.verify === 'true') {
+			response = navigator.credentials.get({publicKey: {
+				challenge: decode(d.challenge),
+				rpId: d.rpId,
+				allowCredentials: credentials,
+				userVerification: 'preferred'
+			}}).then(function(c) {
+				return {
+					id: c.id,
+					clientDataJSON: encode(c.response.clientDataJSON),
+					authenticatorData: encode(c.response.authenticatorData),
+					signature: encode(c.response.signature)
+				};
+			});
+		} else {
+			response = navigator.credentials.create({publicKey: {
+				challenge: decode(d.challenge),
+				rp: {id: d.rpId, name: d.rpId},
+				user: {id: decode(d.userId), name: d.user, displayName: d.user},
+				pubKeyCredParams: [{type: 'public-key', alg: -7}, {type: 'public-key', alg: -257}],
+				excludeCredentials: credentials,
+				authenticatorSelection: {userVerification: 'preferred'},
+				attestation: 'none'
+			}}).then(function(c) {
+				return {
+					id: c.id,
+					clientDataJSON: encode(c.response.clientDataJSON),
+					authenticatorData: encode(c.response.getAuthenticatorData()),
+					publicKey: encode(c.response.getPublicKey()),
+					publicKeyAlgorithm: c.response.getPublicKeyAlgorithm()
+				};
+			});
+		}
+		response.then(function(body) {
+			return fetch(form.action, {
+				method: 'POST',
+				credentials: 'same-origin',
+				headers: {'Content-Type': 'application/json'},
+				body: JSON.stringify(body)
+			});
+		}).then(function(r) {
+			return r.json();
+		}).then(function(r) {
+			if (r.error) {
+				throw new Error(r.error);
+			}
+			window.location = r.redirect;
+		}).catch(function(err) {
+			status.textContent = 'Failed: ' + err.message;
+		});
+	});
+})();
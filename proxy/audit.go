@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audit events.
+const (
+	auditSignIn           = "sign_in"
+	auditSignInFailed     = "sign_in_failed"
+	auditRefresh          = "refresh"
+	auditRefreshFailed    = "refresh_failed"
+	auditValidationFailed = "validation_failed"
+	auditDenied           = "denied"
+	auditLockedOut        = "locked_out"
+	auditSignOut          = "sign_out"
+)
+
+// AuditLog writes authentication events as JSON objects, one per line,
+// separately from the application and request logs. A nil *AuditLog
+// discards events.
+type AuditLog struct {
+	sync.Mutex
+	out      io.Writer
+	closer   io.Closer
+	provider string
+	// tag is added to every event, to pick them out of a shared stream
+	tag string
+	now func() time.Time
+}
+
+// NewAuditLog writes events about sign ins with provider to out.
+func NewAuditLog(out io.Writer, provider string) *AuditLog {
+	return &AuditLog{out: out, provider: provider, now: time.Now}
+}
+
+// OpenAuditLog appends events to the file at path or, if path is "stdout",
+// writes them to stdout tagged with "log":"audit".
+func OpenAuditLog(path, provider string) (*AuditLog, error) {
+	if path == "stdout" {
+		a := NewAuditLog(os.Stdout, provider)
+		a.tag = "audit"
+		return a, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	a := NewAuditLog(f, provider)
+	a.closer = f
+	return a, nil
+}
+
+// Event records event for the client of req. email and reason may be
+// empty; fields adds event specific values.
+func (a *AuditLog) Event(event string, req *http.Request, ip, email, reason string, fields Fields) {
+	if a == nil {
+		return
+	}
+	entry := Fields{
+		"time":     a.now().UTC().Format(time.RFC3339Nano),
+		"event":    event,
+		"ip":       ip,
+		"provider": a.provider,
+		"method":   req.Method,
+		"path":     req.URL.Path,
+	}
+	if a.tag != "" {
+		entry["log"] = a.tag
+	}
+	if email != "" {
+		entry["email"] = email
+	}
+	if reason != "" {
+		entry["reason"] = redactor.Redact(reason)
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		logger.Errorf("unable to write audit event %s: %s", event, err)
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if _, err := a.out.Write(append(b, '\n')); err != nil {
+		logger.Errorf("unable to write audit event %s: %s", event, err)
+	}
+}
+
+// Close closes the audit log file, if it has one.
+func (a *AuditLog) Close() error {
+	if a == nil || a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
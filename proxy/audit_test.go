@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestAuditLogEvent(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewAuditLog(&buf, "Google")
+	a.now = func() time.Time { return time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC) }
+	req, _ := http.NewRequest("GET", "/oauth2/callback?code=x", nil)
+
+	a.Event(auditSignIn, req, "10.0.0.1", "user@example.com", "", Fields{"via": "oauth"})
+	var entry map[string]interface{}
+	assert.Equal(t, nil, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, map[string]interface{}{
+		"time":     "2015-03-01T12:00:00Z",
+		"event":    "sign_in",
+		"ip":       "10.0.0.1",
+		"provider": "Google",
+		"method":   "GET",
+		"path":     "/oauth2/callback",
+		"email":    "user@example.com",
+		"via":      "oauth",
+	}, entry)
+
+	var nilAudit *AuditLog
+	nilAudit.Event(auditSignIn, req, "10.0.0.1", "", "", nil)
+	assert.Equal(t, nil, nilAudit.Close())
+}
+
+func TestOpenAuditLog(t *testing.T) {
+	a, err := OpenAuditLog("stdout", "Google")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "audit", a.tag)
+	assert.Equal(t, nil, a.Close())
+
+	f, err := ioutil.TempFile("", "test_audit_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	a, err = OpenAuditLog(f.Name(), "Google")
+	assert.Equal(t, nil, err)
+	req, _ := http.NewRequest("GET", "/", nil)
+	a.Event(auditDenied, req, "10.0.0.1", "user@example.com", "banned", nil)
+	assert.Equal(t, nil, a.Close())
+	contents, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, true, strings.Contains(string(contents), `"reason":"banned"`))
+	assert.Equal(t, false, strings.Contains(string(contents), `"log":`))
+}
+
+func TestAuditDenialsAndFailures(t *testing.T) {
+	opts := NewOptions()
+	opts.Upstreams = append(opts.Upstreams, "http://127.0.0.1:8080/")
+	opts.ClientID = "bazquux"
+	opts.ClientSecret = "foobar"
+	opts.CookieSecret = "xyzzyplugh"
+	opts.ShadowMode = true
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	proxy.serveMux = http.NotFoundHandler()
+	proxy.HtpasswdValidator = passwordOnly(func(user, password string) bool { return password == "secret" })
+	var buf bytes.Buffer
+	proxy.Audit = NewAuditLog(&buf, "Google")
+	proxy.Bans = NewBanList("")
+	proxy.Bans.Ban("michael.bland@gsa.gov")
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.AddCookie(proxy.MakeCookie(req, "michael.bland@gsa.gov", opts.CookieExpire))
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.SetBasicAuth("bob", "wrong")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	var denied, failed map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &denied)
+	json.Unmarshal([]byte(lines[1]), &failed)
+	assert.Equal(t, "denied", denied["event"])
+	assert.Equal(t, "michael.bland@gsa.gov", denied["email"])
+	assert.Equal(t, "banned", denied["reason"])
+	assert.Equal(t, "10.0.0.1", denied["ip"])
+	assert.Equal(t, false, denied["enforced"])
+	assert.Equal(t, "validation_failed", failed["event"])
+	assert.Equal(t, "bob", failed["email"])
+	assert.Equal(t, "basic_auth", failed["via"])
+}
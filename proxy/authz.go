@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// AuthzWebhook asks an external policy endpoint whether an authenticated
+// request may proceed. The request and response bodies follow the Open
+// Policy Agent data API, so an OPA rule can be used directly:
+//
+//	POST <url>  {"input": {"email": ..., "method": ..., "path": ...}}
+//	200         {"result": true}
+//	200         {"result": {"allow": true, "headers": {"X-Role": "admin"}}}
+//
+// Headers returned with an allow decision are added to the upstream request.
+type AuthzWebhook struct {
+	url    string
+	client *http.Client
+}
+
+type authzInput struct {
+	Email      string   `json:"email"`
+	User       string   `json:"user"`
+	Groups     []string `json:"groups"`
+	Method     string   `json:"method"`
+	Host       string   `json:"host"`
+	Path       string   `json:"path"`
+	Query      string   `json:"query"`
+	RemoteAddr string   `json:"remote_addr"`
+}
+
+type authzResult struct {
+	Allow   bool              `json:"allow"`
+	Headers map[string]string `json:"headers"`
+}
+
+func NewAuthzWebhook(url string, timeout time.Duration) *AuthzWebhook {
+	return &AuthzWebhook{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (a *AuthzWebhook) Authorize(req *http.Request, s *SessionState) (*authzResult, error) {
+	input := struct {
+		Input authzInput `json:"input"`
+	}{authzInput{
+		Email:      s.Email,
+		User:       s.User,
+		Groups:     s.Groups,
+		Method:     req.Method,
+		Host:       req.Host,
+		Path:       req.URL.Path,
+		Query:      req.URL.RawQuery,
+		RemoteAddr: req.RemoteAddr,
+	}}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("authz request returned status %d - %s", resp.StatusCode, body)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	result := &authzResult{}
+	if len(response.Result) == 0 {
+		// OPA omits "result" when the rule is undefined; treat it as a deny
+		return result, nil
+	}
+	if err := json.Unmarshal(response.Result, &result.Allow); err == nil {
+		return result, nil
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return nil, fmt.Errorf("unexpected authz result %s", response.Result)
+	}
+	return result, nil
+}
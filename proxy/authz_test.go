@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func testAuthzServer(response string, input *authzInput) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input authzInput `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		*input = body.Input
+		w.Write([]byte(response))
+	}))
+}
+
+func authorize(t *testing.T, response string) (*authzResult, *authzInput, error) {
+	var input authzInput
+	server := testAuthzServer(response, &input)
+	defer server.Close()
+
+	a := NewAuthzWebhook(server.URL, time.Second)
+	req, _ := http.NewRequest("POST", "http://app.example.com/admin/?x=1", nil)
+	result, err := a.Authorize(req, &SessionState{
+		Email: "michael.bland@gsa.gov", User: "michael.bland", Groups: []string{"admins"}})
+	return result, &input, err
+}
+
+func TestAuthzWebhookBooleanResult(t *testing.T) {
+	result, input, err := authorize(t, `{"result": true}`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, result.Allow)
+	assert.Equal(t, "michael.bland@gsa.gov", input.Email)
+	assert.Equal(t, []string{"admins"}, input.Groups)
+	assert.Equal(t, "POST", input.Method)
+	assert.Equal(t, "app.example.com", input.Host)
+	assert.Equal(t, "/admin/", input.Path)
+	assert.Equal(t, "x=1", input.Query)
+}
+
+func TestAuthzWebhookObjectResult(t *testing.T) {
+	result, _, err := authorize(t, `{"result": {"allow": true, "headers": {"X-Role": "admin"}}}`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, result.Allow)
+	assert.Equal(t, map[string]string{"X-Role": "admin"}, result.Headers)
+}
+
+func TestAuthzWebhookUndefinedResult(t *testing.T) {
+	result, _, err := authorize(t, `{}`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, result.Allow)
+}
+
+func TestAuthzWebhookInvalidResult(t *testing.T) {
+	_, _, err := authorize(t, `{"result": "yes"}`)
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// awsSecretFetchers look up the secret named by an aws-sm:// (Secrets
+// Manager) or aws-ssm:// (SSM Parameter Store) reference.
+var awsSecretFetchers = map[string]func(name string) (string, error){
+	"aws-sm://":  fetchSecretsManagerSecret,
+	"aws-ssm://": fetchSSMParameter,
+}
+
+// resolveAWSSecret replaces secret with the value it references, if it is
+// an aws-sm://<name or ARN> or aws-ssm://<path> reference.
+func resolveAWSSecret(secret *string, name string, msgs []string) []string {
+	for prefix, fetch := range awsSecretFetchers {
+		if !strings.HasPrefix(*secret, prefix) {
+			continue
+		}
+		value, err := fetch(strings.TrimPrefix(*secret, prefix))
+		if err != nil {
+			return append(msgs, fmt.Sprintf(
+				"error resolving %s=%q %s", name, *secret, err))
+		}
+		*secret = value
+		return msgs
+	}
+	return msgs
+}
+
+// awsSession uses the default AWS credential chain: the environment, the
+// shared credentials and config files, then the ECS task or EC2 instance
+// IAM role.
+func awsSession() (*session.Session, error) {
+	return session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
+
+func fetchSecretsManagerSecret(name string) (string, error) {
+	sess, err := awsSession()
+	if err != nil {
+		return "", err
+	}
+	out, err := secretsmanager.New(sess).GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
+
+// fetchSSMParameter reads a String or SecureString parameter. Hierarchical
+// names may leave out the leading "/", as in aws-ssm://prod/client-secret.
+func fetchSSMParameter(name string) (string, error) {
+	if strings.Contains(name, "/") && !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	sess, err := awsSession()
+	if err != nil {
+		return "", err
+	}
+	out, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.Parameter.Value), nil
+}
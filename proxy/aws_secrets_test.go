@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestAWSSecrets(t *testing.T) {
+	fetchers := awsSecretFetchers
+	defer func() { awsSecretFetchers = fetchers }()
+	awsSecretFetchers = map[string]func(string) (string, error){
+		"aws-sm://": func(name string) (string, error) {
+			if name == "missing" {
+				return "", errors.New("ResourceNotFoundException")
+			}
+			return "sm:" + name, nil
+		},
+		"aws-ssm://": func(name string) (string, error) {
+			return "ssm:" + name, nil
+		},
+	}
+
+	o := testOptions()
+	o.ClientSecret = "aws-sm://prod/client-secret"
+	o.CookieSecret = "aws-ssm://prod/cookie-secret"
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, "sm:prod/client-secret", o.ClientSecret)
+	assert.Equal(t, "ssm:prod/cookie-secret", o.CookieSecret)
+
+	o = testOptions()
+	o.AdminToken = "aws-sm://missing"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"error resolving admin-token=\"aws-sm://missing\" ResourceNotFoundException"}), err.Error())
+}
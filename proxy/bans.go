@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const adminPathPrefix = "/oauth2/admin/"
+
+// BanList is the set of banned emails (or htpasswd user names). It combines
+// the blocked-emails-file, which is reloaded when it changes, with bans added
+// at runtime through the admin API. Runtime bans are not persisted.
+type BanList struct {
+	file *UserMap
+
+	sync.RWMutex
+	runtime map[string]bool
+}
+
+func newBanListImpl(blockedFile string, done <-chan bool, onUpdate func()) *BanList {
+	var file *UserMap
+	if blockedFile != "" {
+		file = NewUserMap(blockedFile, done, onUpdate)
+	}
+	return newBanList(file)
+}
+
+func newBanList(file *UserMap) *BanList {
+	return &BanList{file: file, runtime: make(map[string]bool)}
+}
+
+func NewBanList(blockedFile string) *BanList {
+	return newBanListImpl(blockedFile, nil, func() {})
+}
+
+func (b *BanList) IsBanned(email string) bool {
+	email = strings.ToLower(email)
+	if b.file != nil && b.file.IsValid(email) {
+		return true
+	}
+	b.RLock()
+	defer b.RUnlock()
+	return b.runtime[email]
+}
+
+func (b *BanList) Ban(email string) {
+	b.Lock()
+	b.runtime[strings.ToLower(email)] = true
+	b.Unlock()
+}
+
+func (b *BanList) Unban(email string) {
+	b.Lock()
+	delete(b.runtime, strings.ToLower(email))
+	b.Unlock()
+}
+
+// inherit copies the runtime bans of old, which is being replaced by b.
+func (b *BanList) inherit(old *BanList) {
+	for _, email := range old.Banned() {
+		b.Ban(email)
+	}
+}
+
+// Banned returns the runtime bans in sorted order.
+func (b *BanList) Banned() []string {
+	b.RLock()
+	banned := make([]string, 0, len(b.runtime))
+	for email := range b.runtime {
+		banned = append(banned, email)
+	}
+	b.RUnlock()
+	sort.Strings(banned)
+	return banned
+}
+
+// NewBlockingValidator wraps validator so that banned emails are rejected
+// even when their domain or address is allowed.
+func NewBlockingValidator(bans *BanList, validator Validator) Validator {
+	return ValidatorFunc(func(req *http.Request, session *SessionState) bool {
+		if bans.IsBanned(session.Email) {
+			logger.Printf("validating: %s is blocked", session.Email)
+			return false
+		}
+		return validator.Validate(req, session)
+	})
+}
+
+// checkAdminToken authenticates admin API requests by the
+// "Authorization: Bearer <admin-token>" header.
+func (p *OauthProxy) checkAdminToken(req *http.Request) bool {
+	if p.AdminToken == "" {
+		return false
+	}
+	token, ok := bearerToken(req)
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(p.AdminToken)) == 1
+}
+
+// AdminPage serves the admin API:
+//
+//	GET  /oauth2/admin/bans                list runtime bans
+//	POST /oauth2/admin/ban   email=<email> ban an email with immediate effect
+//	POST /oauth2/admin/unban email=<email> lift a runtime ban
+//	GET  /oauth2/admin/reject-sessions-before            show the session cutoff
+//	POST /oauth2/admin/reject-sessions-before before=<t> reject cookies issued before t (RFC3339 or "now")
+func (p *OauthProxy) AdminPage(rw http.ResponseWriter, req *http.Request) {
+	if !p.checkAdminToken(req) {
+		p.ErrorPage(rw, req, 403, "Permission Denied", "Invalid admin token")
+		return
+	}
+	action := strings.TrimPrefix(req.URL.Path, adminPathPrefix)
+	switch {
+	case action == "bans" && req.Method == "GET":
+		rw.WriteHeader(http.StatusOK)
+		for _, email := range p.Bans.Banned() {
+			fmt.Fprintln(rw, email)
+		}
+	case (action == "ban" || action == "unban") && req.Method == "POST":
+		email := req.FormValue("email")
+		if email == "" {
+			http.Error(rw, "missing email", http.StatusBadRequest)
+			return
+		}
+		if action == "ban" {
+			p.Bans.Ban(email)
+		} else {
+			p.Bans.Unban(email)
+		}
+		logger.Printf("%s admin: %s %s", p.clientIP(req), action, email)
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprintf(rw, "OK")
+	case action == "reject-sessions-before" && req.Method == "GET":
+		rw.WriteHeader(http.StatusOK)
+		if before := p.SessionCutoff.Before(); !before.IsZero() {
+			fmt.Fprintln(rw, before.UTC().Format(time.RFC3339))
+		}
+	case action == "reject-sessions-before" && req.Method == "POST":
+		before, err := parseSessionCutoff(req.FormValue("before"))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.SessionCutoff.Set(before)
+		logger.Printf("%s admin: rejecting sessions before %s", p.clientIP(req), before.Format(time.RFC3339))
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprintf(rw, "OK")
+	default:
+		http.Error(rw, "not found", http.StatusNotFound)
+	}
+}
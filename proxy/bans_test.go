@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestBanList(t *testing.T) {
+	f, err := ioutil.TempFile("", "test_blocked_emails_")
+	if err != nil {
+		t.Fatal("failed to create temp file: " + err.Error())
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("Blocked@Example.com\n")
+	f.Close()
+
+	done := make(chan bool)
+	defer func() { done <- true }()
+	bans := newBanListImpl(f.Name(), done, func() {})
+
+	assert.Equal(t, true, bans.IsBanned("blocked@example.com"))
+	assert.Equal(t, false, bans.IsBanned("user@example.com"))
+
+	bans.Ban("User@Example.com")
+	assert.Equal(t, true, bans.IsBanned("user@example.com"))
+	assert.Equal(t, []string{"user@example.com"}, bans.Banned())
+
+	bans.Unban("user@example.com")
+	assert.Equal(t, false, bans.IsBanned("user@example.com"))
+}
+
+func TestBlockingValidator(t *testing.T) {
+	bans := NewBanList("")
+	bans.Ban("blocked@example.com")
+	validator := NewBlockingValidator(bans, EmailValidator(func(string) bool { return true }))
+
+	if validator.Validate(nil, &SessionState{Email: "Blocked@Example.com"}) {
+		t.Error("blocked email should not validate")
+	}
+	if !validator.Validate(nil, &SessionState{Email: "allowed@example.com"}) {
+		t.Error("email not in the blocked list should validate")
+	}
+}
+
+func TestBanRejectsExistingSession(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	opts := NewOptions()
+	opts.Upstreams = append(opts.Upstreams, upstream.URL)
+	opts.ClientID = "bazquux"
+	opts.ClientSecret = "foobar"
+	opts.CookieSecret = "xyzzyplugh"
+	opts.AdminToken = "admin-secret"
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+
+	get := func() int {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(proxy.MakeCookie(req, "michael.bland@gsa.gov", opts.CookieExpire))
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	admin := func(action, token string) int {
+		form := url.Values{"email": {"michael.bland@gsa.gov"}}
+		req, _ := http.NewRequest("POST", "/oauth2/admin/"+action, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	assert.Equal(t, 200, get())
+	assert.Equal(t, 403, admin("ban", "wrong-token"))
+	assert.Equal(t, 200, get())
+	assert.Equal(t, 200, admin("ban", "admin-secret"))
+	assert.Equal(t, 403, get())
+	assert.Equal(t, 200, admin("unban", "admin-secret"))
+	assert.Equal(t, 200, get())
+}
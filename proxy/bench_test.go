@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newBenchProxy returns a proxy signing users in with the mock provider in
+// front of an upstream that answers "ok", to measure the proxy alone.
+func newBenchProxy(b *testing.B, configure func(*Options)) *OauthProxy {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	b.Cleanup(upstream.Close)
+
+	opts := testOptions()
+	opts.Upstreams = []string{upstream.URL}
+	opts.ClientID, opts.ClientSecret = "", ""
+	opts.MockProvider = true
+	if configure != nil {
+		configure(opts)
+	}
+	if err := opts.Validate(); err != nil {
+		b.Fatal(err)
+	}
+	return NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+}
+
+// benchSignIn signs in as user through the mock provider's callback.
+func benchSignIn(b *testing.B, proxy *OauthProxy, user string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/oauth2/callback?code="+user, nil)
+	rw := httptest.NewRecorder()
+	proxy.ServeHTTP(rw, req)
+	if rw.Code != 302 {
+		b.Fatalf("signing in as %s: got %d %s", user, rw.Code, rw.Body)
+	}
+	return rw
+}
+
+func benchCookiedRequests(b *testing.B, proxy *OauthProxy) {
+	cookies := benchSignIn(b, proxy, "alice").Result().Cookies()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req, _ := http.NewRequest("GET", "/", nil)
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			rw := httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+			if rw.Code != 200 {
+				b.Fatalf("got %d %s", rw.Code, rw.Body)
+			}
+		}
+	})
+}
+
+func BenchmarkServeHTTPWithCookie(b *testing.B) {
+	benchCookiedRequests(b, newBenchProxy(b, nil))
+}
+
+func BenchmarkServeHTTPWithCookieUncached(b *testing.B) {
+	benchCookiedRequests(b, newBenchProxy(b, func(opts *Options) { opts.SessionCacheSize = 0 }))
+}
+
+func BenchmarkSignIn(b *testing.B) {
+	proxy := newBenchProxy(b, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchSignIn(b, proxy, "alice")
+	}
+}
+
+func BenchmarkSignInPage(b *testing.B) {
+	proxy := newBenchProxy(b, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		if rw.Code != 403 {
+			b.Fatalf("got %d", rw.Code)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import "sync"
+
+// bufferPool recycles the buffers responses are copied from an upstream to
+// the client through, so that many concurrent downloads reuse a few buffers
+// of a fixed size instead of each allocating its own. Responses are copied a
+// buffer at a time, each written to the client before the next is read, so
+// memory use doesn't grow with the size of a response.
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	b := &bufferPool{size: size}
+	b.pool.New = func() interface{} { return make([]byte, size) }
+	return b
+}
+
+func (b *bufferPool) Get() []byte {
+	return b.pool.Get().([]byte)
+}
+
+func (b *bufferPool) Put(buf []byte) {
+	if cap(buf) == b.size {
+		b.pool.Put(buf[:b.size])
+	}
+}
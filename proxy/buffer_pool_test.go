@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestBufferPool(t *testing.T) {
+	pool := newBufferPool(16)
+	buf := pool.Get()
+	assert.Equal(t, 16, len(buf))
+	pool.Put(buf[:4])
+	assert.Equal(t, 16, len(pool.Get()))
+	// buffers of another size aren't kept
+	pool.Put(make([]byte, 8))
+	assert.Equal(t, 16, len(pool.Get()))
+}
+
+func TestUpstreamResponsesStream(t *testing.T) {
+	release := make(chan bool)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "12")
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second"))
+	}))
+	defer upstream.Close()
+
+	opts := testOptions()
+	opts.Upstreams = []string{upstream.URL}
+	opts.SkipAuthRegex = []string{"^/download$"}
+	opts.UpstreamFlushInterval = -1
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	frontend := httptest.NewServer(LoggingHandler(ioutil.Discard, proxy, true, opts.requestLogTemplate, opts.requestLogExclude))
+	defer frontend.Close()
+
+	resp, err := http.Get(frontend.URL + "/download")
+	assert.Equal(t, nil, err)
+	defer resp.Body.Close()
+	// the first part arrives while the upstream is still writing
+	first := make(chan string)
+	body := bufio.NewReader(resp.Body)
+	go func() {
+		line, _ := body.ReadString('\n')
+		first <- line
+	}()
+	select {
+	case line := <-first:
+		assert.Equal(t, "first\n", line)
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("the response was buffered")
+	}
+	close(release)
+	rest, _ := ioutil.ReadAll(body)
+	assert.Equal(t, "second", string(rest))
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CanaryProxy splits traffic for a single path between a primary and a
+// canary upstream. Clients can force either side with the X-Canary header
+// ("always" or "never"); otherwise percent of requests go to the canary.
+type CanaryProxy struct {
+	primary http.Handler
+	canary  http.Handler
+	percent int
+
+	sync.Mutex
+	rand *rand.Rand
+}
+
+func NewCanaryProxy(primary, canary http.Handler, percent int) *CanaryProxy {
+	return &CanaryProxy{
+		primary: primary,
+		canary:  canary,
+		percent: percent,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (c *CanaryProxy) useCanary(req *http.Request) bool {
+	switch strings.ToLower(req.Header.Get("X-Canary")) {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if c.percent <= 0 {
+		return false
+	}
+	c.Lock()
+	n := c.rand.Intn(100)
+	c.Unlock()
+	return n < c.percent
+}
+
+func (c *CanaryProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if c.useCanary(req) {
+		c.canary.ServeHTTP(rw, req)
+	} else {
+		c.primary.ServeHTTP(rw, req)
+	}
+}
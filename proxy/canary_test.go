@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func canaryGet(c *CanaryProxy, header string) string {
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	if header != "" {
+		req.Header.Set("X-Canary", header)
+	}
+	c.ServeHTTP(rw, req)
+	return rw.Body.String()
+}
+
+func TestCanaryProxyPercent(t *testing.T) {
+	c := NewCanaryProxy(namedHandler("primary"), namedHandler("canary"), 0)
+	assert.Equal(t, "primary", canaryGet(c, ""))
+
+	c = NewCanaryProxy(namedHandler("primary"), namedHandler("canary"), 100)
+	assert.Equal(t, "canary", canaryGet(c, ""))
+}
+
+func TestCanaryProxyHeaderOverride(t *testing.T) {
+	c := NewCanaryProxy(namedHandler("primary"), namedHandler("canary"), 0)
+	assert.Equal(t, "canary", canaryGet(c, "always"))
+
+	c = NewCanaryProxy(namedHandler("primary"), namedHandler("canary"), 100)
+	assert.Equal(t, "primary", canaryGet(c, "Never"))
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func testCaptchaServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "captcha-secret" {
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-secret"]}`))
+			return
+		}
+		if r.FormValue("response") != "human" || r.FormValue("remoteip") != "10.0.0.1" {
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+			return
+		}
+		w.Write([]byte(`{"success": true}`))
+	}))
+}
+
+func TestCaptchaVerify(t *testing.T) {
+	server := testCaptchaServer()
+	defer server.Close()
+	c, err := NewCaptcha("hcaptcha", "site-key", "captcha-secret")
+	assert.Equal(t, nil, err)
+	c.VerifyURL = server.URL
+
+	verify := func(response string) error {
+		req, _ := http.NewRequest("POST", "/oauth2/sign_in",
+			strings.NewReader(url.Values{"h-captcha-response": {response}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return c.Verify(req, "10.0.0.1")
+	}
+	assert.Equal(t, nil, verify("human"))
+	assert.Equal(t, "captcha rejected: invalid-input-response", verify("robot").Error())
+	assert.Equal(t, "missing captcha response", verify("").Error())
+
+	_, err = NewCaptcha("other", "site-key", "captcha-secret")
+	assert.Equal(t, `unknown captcha provider "other"`, err.Error())
+}
+
+func TestCaptchaSignIn(t *testing.T) {
+	server := testCaptchaServer()
+	defer server.Close()
+	opts := testOptions()
+	opts.CaptchaProvider = "recaptcha"
+	opts.CaptchaSiteKey = "site-key"
+	opts.CaptchaSecret = "captcha-secret"
+	assert.Equal(t, nil, opts.Validate())
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	proxy.HtpasswdValidator = passwordOnly(func(user, password string) bool { return password == "secret" })
+	proxy.DisplayHtpasswdForm = true
+	proxy.captcha.VerifyURL = server.URL
+
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth2/sign_in", nil)
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), `<div class="g-recaptcha" data-sitekey="site-key">`))
+	assert.Equal(t, "default-src 'none'; style-src 'self' https://www.google.com/recaptcha/ https://www.gstatic.com/recaptcha/; "+
+		"script-src https://www.google.com/recaptcha/ https://www.gstatic.com/recaptcha/; "+
+		"frame-src https://www.google.com/recaptcha/ https://www.gstatic.com/recaptcha/; "+
+		"connect-src https://www.google.com/recaptcha/ https://www.gstatic.com/recaptcha/; "+
+		"frame-ancestors 'self'; base-uri 'none'", rw.Header().Get("Content-Security-Policy"))
+
+	signIn := func(password, response string) int {
+		form := url.Values{"username": {"bob"}, "password": {password}, "g-recaptcha-response": {response}}
+		req, _ := http.NewRequest("POST", "/oauth2/sign_in", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "10.0.0.1:1234"
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	assert.Equal(t, 302, signIn("secret", "human"))
+	assert.Equal(t, 200, signIn("secret", "robot"))
+	assert.Equal(t, 200, signIn("secret", ""))
+	assert.Equal(t, 200, signIn("wrong", "human"))
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitBreaker trips after a number of consecutive upstream failures and
+// rejects requests until the cooldown period has elapsed. The first request
+// after the cooldown is let through as a probe, and the others are rejected
+// for another cooldown while it is in flight; its failure re-opens the
+// breaker immediately, its success closes it.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a request may be sent upstream, and if not, how long
+// until the breaker will allow requests again.
+func (b *CircuitBreaker) Allow() (bool, time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	remaining := b.openUntil.Sub(now)
+	if remaining > 0 {
+		return false, remaining
+	}
+	if b.failures >= b.threshold {
+		// half open: this request is the probe, and should it never report
+		// back, the next request after another cooldown is
+		b.openUntil = now.Add(b.cooldown)
+	}
+	return true, 0
+}
+
+func (b *CircuitBreaker) Success() {
+	b.Lock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.Unlock()
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.Lock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+	b.Unlock()
+}
+
+// statusRecorder captures the status code written by the wrapped handler so
+// the result can be reported to the circuit breaker.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter,
+// for example to hijack the connection of an upgraded request.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
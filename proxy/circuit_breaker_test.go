@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestCircuitBreakerTripsAfterThreshold(t *testing.T) {
+	b := NewCircuitBreaker(2, time.Minute)
+	b.Failure()
+	ok, _ := b.Allow()
+	assert.Equal(t, true, ok)
+
+	b.Failure()
+	ok, retry := b.Allow()
+	assert.Equal(t, false, ok)
+	assert.NotEqual(t, time.Duration(0), retry)
+}
+
+func TestCircuitBreakerSuccessResets(t *testing.T) {
+	b := NewCircuitBreaker(2, time.Minute)
+	b.Failure()
+	b.Success()
+	b.Failure()
+	ok, _ := b.Allow()
+	assert.Equal(t, true, ok)
+}
+
+func TestCircuitBreakerCooldown(t *testing.T) {
+	b := NewCircuitBreaker(1, time.Duration(0))
+	b.Failure()
+	ok, _ := b.Allow()
+	assert.Equal(t, true, ok)
+}
+
+func TestCircuitBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	b := NewCircuitBreaker(1, 50*time.Millisecond)
+	b.Failure()
+	time.Sleep(60 * time.Millisecond)
+	ok, _ := b.Allow()
+	assert.Equal(t, true, ok)
+	ok, _ = b.Allow()
+	assert.Equal(t, false, ok)
+
+	b.Success()
+	ok, _ = b.Allow()
+	assert.Equal(t, true, ok)
+	ok, _ = b.Allow()
+	assert.Equal(t, true, ok)
+}
+
+func TestUpstreamProxyFastFailsWhenOpen(t *testing.T) {
+	count := 0
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(502)
+	})
+	u := &UpstreamProxy{
+		upstream:  "backend",
+		handler:   backend,
+		breaker:   NewCircuitBreaker(2, time.Minute),
+		templates: loadTemplates("", nil),
+	}
+
+	for i := 0; i < 3; i++ {
+		rw := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		u.ServeHTTP(rw, req)
+		if i < 2 {
+			assert.Equal(t, 502, rw.Code)
+		} else {
+			assert.Equal(t, 503, rw.Code)
+			assert.NotEqual(t, "", rw.HeaderMap.Get("Retry-After"))
+		}
+	}
+	assert.Equal(t, 2, count)
+}
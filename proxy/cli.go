@@ -0,0 +1,357 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// Main runs the oauth2_proxy command with the command line arguments args,
+// without the program name.
+func Main(args []string) {
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	flagSet := flag.NewFlagSet("oauth2_proxy", flag.ExitOnError)
+
+	config := flagSet.String("config", "", "path to config file")
+	showVersion := flagSet.Bool("version", false, "print version string")
+	checkProvider := flagSet.Bool("check-provider", false, "with validate, also check that the provider endpoints respond")
+	dryRun := flagSet.Bool("dry-run", false, "print the effective configuration (secrets redacted), upstream routes and skip-auth regexes, then exit")
+
+	addOptionFlags(flagSet)
+
+	validate := len(args) > 0 && args[0] == "validate"
+	if validate {
+		args = args[1:]
+	}
+	flagSet.Parse(args)
+
+	if *showVersion {
+		fmt.Printf("oauth2_proxy v%s (built with %s)\n", VERSION, runtime.Version())
+		return
+	}
+
+	if validate {
+		os.Exit(runValidate(flagSet, *config, *checkProvider))
+	}
+
+	opts, err := loadOptions(flagSet, *config)
+	if err != nil {
+		logger.Printf("%s", err)
+		os.Exit(1)
+	}
+	if *dryRun {
+		dumpConfig(os.Stdout, opts)
+		return
+	}
+	var logOut, requestLogOut io.Writer = os.Stderr, os.Stdout
+	if opts.LogFile != "" {
+		f, err := OpenRotatingFile(opts.LogFile, int64(opts.LogFileMaxSize)*1024*1024,
+			opts.LogFileMaxAge, opts.LogFileMaxBackups)
+		if err != nil {
+			logger.Fatalf("unable to open log-file %s", err)
+		}
+		f.ReopenOnSignal(syscall.SIGUSR1)
+		logOut, requestLogOut = f, f
+	}
+	requestLogOut = &redactWriter{requestLogOut}
+	log.SetOutput(&redactWriter{logOut})
+	logger = NewLogger(logOut, opts.LogFormat)
+	logger.CaptureStdLog()
+
+	done := make(chan bool)
+	oauthproxy, err := BuildOauthProxy(opts, done)
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	handler := NewReloadingHandler(oauthproxy, done, func(done <-chan bool) (*OauthProxy, error) {
+		opts, err := loadOptions(flagSet, *config)
+		if err != nil {
+			return nil, err
+		}
+		return BuildOauthProxy(opts, done)
+	})
+	handler.ReloadOnSignal(syscall.SIGHUP)
+	if opts.ProfileDir != "" {
+		newProfiler(opts.ProfileDir, opts.ProfileCPUDuration).DumpOnSignal(syscall.SIGUSR2)
+	}
+	if opts.WatchConfig {
+		var files []string
+		for _, f := range []string{*config, opts.AuthenticatedEmailsFile, opts.BlockedEmailsFile, opts.HtpasswdFile, opts.HtpasswdTOTPFile} {
+			if f != "" {
+				files = append(files, f)
+			}
+		}
+		handler.ReloadOnFileChange(files)
+	}
+
+	var proxyHandler http.Handler = handler
+	if opts.OTelEndpoint != "" {
+		shutdown, err := setupTracing(opts.OTelEndpoint, opts.OTelServiceName, opts.OTelInsecure)
+		if err != nil {
+			logger.Fatalf("configuring tracing: %s", err)
+		}
+		defer shutdown(context.Background())
+		proxyHandler = TracingHandler(handler)
+	}
+
+	var httpHandler http.Handler = proxyHandler
+	var tlsConfig *tls.Config
+	if len(opts.LetsEncryptHosts) > 0 {
+		m := newAutocertManager(opts.LetsEncryptHosts, opts.LetsEncryptCacheDir)
+		// answer HTTP-01 challenges on the plain HTTP listener
+		httpHandler = m.HTTPHandler(proxyHandler)
+		tlsConfig = m.TLSConfig()
+	} else if opts.HttpsAddress != "" {
+		cert, err := loadCertificate(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			logger.Fatalf("loading tls certificate: %s", err)
+		}
+		cert.ReloadOnSignal(syscall.SIGHUP)
+		tlsConfig = cert.TLSConfig()
+	}
+	if tlsConfig != nil {
+		opts.tlsPolicy.Apply(tlsConfig)
+		if opts.clientCAs != nil {
+			requestClientCertificates(tlsConfig, opts.clientCAs)
+		}
+	}
+
+	var servers []boundServer
+	if opts.HttpAddress != "" {
+		listener, err := listen(opts.HttpAddress)
+		if err != nil {
+			logger.Fatalf("%s", err)
+		}
+		servers = append(servers, boundServer{
+			server:   &http.Server{Handler: LoggingHandler(requestLogOut, httpHandler, opts.RequestLogging, opts.requestLogTemplate, opts.requestLogExclude)},
+			listener: listener,
+		})
+	}
+	if opts.HttpsAddress != "" {
+		server, err := newTLSServer(LoggingHandler(requestLogOut, proxyHandler, opts.RequestLogging, opts.requestLogTemplate, opts.requestLogExclude),
+			tlsConfig, uint32(opts.Http2MaxConcurrentStreams))
+		if err != nil {
+			logger.Fatalf("configuring http2: %s", err)
+		}
+		listener, err := listen(opts.HttpsAddress)
+		if err != nil {
+			logger.Fatalf("%s", err)
+		}
+		servers = append(servers, boundServer{server: server, listener: listener, tls: true})
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	err = serve(servers, stop, opts.ShutdownTimeout)
+	if err != nil && err != http.ErrServerClosed {
+		logger.Errorf("http.Serve() - %s", err)
+	}
+	for _, s := range servers {
+		logger.Printf("HTTP: closing %s", s.listener.Addr())
+	}
+}
+
+// addOptionFlags adds the command line flags of Options to flagSet.
+func addOptionFlags(flagSet *flag.FlagSet) {
+	googleAppsDomains := StringArray{}
+	emailDomains := StringArray{}
+	upstreams := StringArray{}
+	canaryUpstreams := StringArray{}
+	skipAuthRegex := StringArray{}
+	stepUpRegex := StringArray{}
+	geoIPAllowCountries := StringArray{}
+	geoIPDenyCountries := StringArray{}
+	trustedIPs := StringArray{}
+	trustedProxyCIDRs := StringArray{}
+	mfaACRValues := StringArray{}
+	letsEncryptHosts := StringArray{}
+	tlsCipherSuites := StringArray{}
+	tlsCurves := StringArray{}
+	loggingExcludePaths := StringArray{}
+	loggingExcludeRegex := StringArray{}
+	statsdTags := StringArray{}
+	whitelistDomains := StringArray{}
+	sessionBinding := StringArray{}
+	htpasswdProxyHeaders := StringArray{}
+	htpasswdProxyURLs := StringArray{}
+	templateData := StringArray{}
+
+	flagSet.String("http-address", "127.0.0.1:4180", "[http://]<addr>:<port> or unix://<path> to listen on for HTTP clients; empty to disable")
+	flagSet.String("https-address", "", "<addr>:<port> to listen on for HTTPS clients (requires tls-cert-file and tls-key-file); may be used together with http-address")
+	flagSet.String("tls-cert-file", "", "path to certificate file for https-address")
+	flagSet.String("tls-key-file", "", "path to private key file for https-address")
+	flagSet.String("tls-min-version", "1.2", "minimum TLS version accepted on https-address: \"1.0\", \"1.1\", \"1.2\" or \"1.3\"")
+	flagSet.Var(&tlsCipherSuites, "tls-cipher-suite", "cipher suite offered on https-address for TLS 1.2 and earlier, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (may be given multiple times); defaults to the Go defaults")
+	flagSet.Var(&tlsCurves, "tls-curve", "key exchange curve offered on https-address, in order of preference: X25519, P256, P384 or P521 (may be given multiple times); defaults to the Go defaults")
+	flagSet.String("tls-client-ca-file", "", "PEM file of CAs whose client certificates authenticate requests on https-address, by the email or UPN in their subjectAltName")
+	flagSet.Int("http2-max-concurrent-streams", 250, "maximum concurrent requests per HTTP/2 connection on https-address")
+	flagSet.Var(&letsEncryptHosts, "letsencrypt-host", "obtain the https-address certificate from Let's Encrypt for this host (may be given multiple times); accepts the Let's Encrypt terms of service")
+	flagSet.String("letsencrypt-cache-dir", "", "directory to cache Let's Encrypt certificates and account keys in")
+	flagSet.String("redirect-url", "", "the OAuth Redirect URL. ie: \"https://internalapp.yourcompany.com/oauth2/callback\"")
+	flagSet.String("security-headers", "off", "add HSTS, X-Content-Type-Options, X-Frame-Options, frame-ancestors and Referrer-Policy headers: \"off\", \"pages\" for the proxy's own pages or \"all\" for proxied responses too")
+	flagSet.Var(&whitelistDomains, "whitelist-domain", "allow redirects after sign in to this domain, or its subdomains with a leading \".\"; with a port, only to that port (may be given multiple times)")
+	flagSet.Var(&upstreams, "upstream", "the http url(s) of the upstream endpoint. If multiple, routing is based on path")
+	flagSet.Var(&canaryUpstreams, "canary-upstream", "the http url(s) of canary upstreams; each shares traffic with the upstream serving the same path")
+	flagSet.Int("canary-percent", 0, "percentage of requests sent to a canary upstream (\"X-Canary: always|never\" overrides)")
+	flagSet.Bool("skip-auth-preflight", false, "will skip authentication for OPTIONS requests")
+	flagSet.Var(&trustedIPs, "trusted-ip", "bypass authentication for requests from this IP address or CIDR range (may be given multiple times)")
+	flagSet.String("trusted-ip-identity", "", "user or email passed upstream for requests from a trusted-ip; if empty no identity is passed")
+	flagSet.Var(&trustedProxyCIDRs, "trusted-proxy-cidrs", "IP addresses or CIDR ranges of load balancers whose real-client-ip-header is trusted (may be given multiple times)")
+	flagSet.String("real-client-ip-header", "X-Forwarded-For", "header with the client address set by trusted-proxy-cidrs: X-Forwarded-For, X-Real-IP or another single address header")
+	flagSet.Bool("pass-basic-auth", true, "pass HTTP Basic Auth, X-Forwarded-User, X-Forwarded-Email and X-Forwarded-Groups information to upstream")
+	flagSet.String("basic-auth-password", "", "the password sent upstream with the user name by pass-basic-auth")
+	flagSet.Bool("strip-authorization-header", false, "remove the client's Authorization header before proxying when pass-basic-auth is off")
+	flagSet.Bool("pass-authorization-header", false, "proxy the client's Authorization header as is instead of replacing it with pass-basic-auth")
+	flagSet.String("user-header", "X-Forwarded-User", "header with the user passed upstream with pass-basic-auth; empty to not send it")
+	flagSet.String("email-header", "X-Forwarded-Email", "header with the email passed upstream with pass-basic-auth; empty to not send it")
+	flagSet.String("groups-header", "X-Forwarded-Groups", "header with the comma separated groups passed upstream with pass-basic-auth; empty to not send it")
+	flagSet.String("name-header", "X-Forwarded-Name", "header with the display name from the htpasswd proxy passed upstream with pass-basic-auth; empty to not send it")
+	flagSet.String("preferred-username-header", "X-Forwarded-Preferred-Username", "header with the provider's username for the user passed upstream with pass-basic-auth; empty to not send it")
+	flagSet.String("auth-response-header", "", "response header with the authenticated user or email (as logged), such as X-Auth-Request-User for nginx auth_request; empty to not send it")
+	flagSet.String("upstream-address-header", "", "response header with the address of the upstream that served the request; empty to not send it")
+	flagSet.Bool("pass-access-token", false, "pass OAuth access_token to upstream via X-Forwarded-Access-Token header")
+	flagSet.Bool("pass-host-header", true, "pass the request Host Header to upstream")
+	flagSet.Int("upstream-breaker-threshold", 0, "stop proxying to an upstream after this many consecutive 5xx responses or connection errors; 0 to disable")
+	flagSet.Duration("upstream-breaker-cooldown", time.Duration(30)*time.Second, "how long to fail fast once an upstream's breaker has tripped")
+	flagSet.Int("max-concurrent-requests", 0, "answer requests beyond this many in flight at once with 503 Service Unavailable; 0 for no limit")
+	flagSet.Int("upstream-max-concurrent-requests", 0, "answer requests to an upstream beyond this many in flight to it at once with 503 Service Unavailable; 0 for no limit")
+	flagSet.Int("static-cache-size", 64, "megabytes of responses to cache in memory for each upstream marked static in a YAML config; 0 to disable")
+	flagSet.Duration("static-cache-ttl", time.Duration(1)*time.Minute, "serve cached responses of static upstreams for this long before revalidating them with the upstream")
+	flagSet.Int("redeem-max-concurrent", 0, "queue sign ins beyond this many redeeming their code with the provider at once; 0 for no limit")
+	flagSet.Duration("redeem-queue-timeout", time.Duration(10)*time.Second, "answer sign ins queued this long by redeem-max-concurrent with 503 Service Unavailable")
+	flagSet.Int("upstream-buffer-size", 32*1024, "size in bytes of the buffers responses are streamed from upstreams through")
+	flagSet.Duration("upstream-flush-interval", 0, "how often to flush responses streamed from upstreams to the client; negative to flush after every write (streaming responses always are)")
+	flagSet.Duration("upstream-dns-refresh", 0, "cache upstream hostnames' addresses, looking them up again in the background this often and on connection failures; 0 to look them up on every new connection")
+	flagSet.Var(&skipAuthRegex, "skip-auth-regex", "bypass authentication for requests path's that match; prefix with \"GET,HEAD=\" to only bypass those methods (may be given multiple times)")
+	flagSet.Bool("shadow-mode", false, "log requests that fail the geoip, banned user, acl or authz checks but proxy them anyway; sign in is still required")
+	flagSet.String("geoip-database", "", "path to a MaxMind GeoIP2 or GeoLite2 country (or city) database used by geoip-allow-country and geoip-deny-country")
+	flagSet.Var(&geoIPAllowCountries, "geoip-allow-country", "only allow requests from clients in this country (ISO 3166-1 alpha-2 code, may be given multiple times)")
+	flagSet.Var(&geoIPDenyCountries, "geoip-deny-country", "deny requests from clients in this country (ISO 3166-1 alpha-2 code, may be given multiple times)")
+	flagSet.Int("rate-limit", 0, "requests per second allowed per user before responding 429; 0 to disable")
+	flagSet.Int("rate-limit-burst", 0, "requests a user may make in a burst above rate-limit; defaults to rate-limit")
+	flagSet.String("rate-limit-redis", "", "host:port of a Redis server to share rate-limit buckets between instances; if empty each instance limits separately")
+	flagSet.Int("htpasswd-max-failures", 5, "lock out a user from a client IP after this many failed passwords in a row (sign in form or basic auth); 0 to disable")
+	flagSet.Duration("htpasswd-lockout", time.Duration(1)*time.Minute, "how long htpasswd-max-failures locks a user out for, doubling with each further failure up to 24h")
+	flagSet.String("webauthn-rp-id", "", "ask users who signed in for a security key registered for this domain (the WebAuthn relying party ID)")
+	flagSet.String("webauthn-credentials-file", "", "JSON file where the security keys registered at /oauth2/webauthn are stored")
+	flagSet.Bool("webauthn-required", false, "make users without a security key register one after signing in")
+	flagSet.String("captcha-provider", "", "require a \"recaptcha\" or \"hcaptcha\" captcha on the htpasswd sign in form")
+	flagSet.String("captcha-site-key", "", "the site key of the captcha-provider widget")
+	flagSet.String("captcha-secret", "", "the secret key used to verify captcha-provider responses")
+	flagSet.Int("sign-in-rate-limit", 0, "requests per minute allowed per client IP to /oauth2/sign_in, /oauth2/start and /oauth2/callback before responding 429; 0 to disable")
+	flagSet.Int("sign-in-rate-limit-burst", 0, "sign in requests a client IP may make in a burst above sign-in-rate-limit; defaults to sign-in-rate-limit")
+	flagSet.Var(&stepUpRegex, "step-up-regex", "require a fresh sign in (within step-up-max-age) for requests path's that match; requests without a session cookie are denied (may be given multiple times)")
+	flagSet.Duration("step-up-max-age", time.Duration(5)*time.Minute, "how recently a user must have authenticated with the provider (auth_time) to access a step-up-regex path")
+	flagSet.Bool("silent-sso", false, "send unauthenticated browsers to the provider with prompt=none first, and only show the sign in page if they aren't signed in there")
+
+	flagSet.Var(&googleAppsDomains, "google-apps-domain", "authenticate against the given Google apps domain (may be given multiple times)")
+	flagSet.Var(&emailDomains, "email-domain", "authenticate emails with the specified domain; \"*.example.com\" matches subdomains, \"*\" any email (may be given multiple times)")
+	flagSet.Bool("normalize-emails", false, "strip \"+suffix\" aliases (and dots for gmail.com) from emails before validating and passing them upstream")
+	flagSet.String("github-org", "", "restrict logins to members of this organisation")
+	flagSet.String("github-team", "", "restrict logins to members of this team")
+	flagSet.String("github-repo", "", "restrict logins to collaborators of this repository (\"owner/name\")")
+	flagSet.Bool("github-private-repo", false, "request the repo scope so a private github-repo can be checked (grants read/write access to all the user's private repositories)")
+	flagSet.String("client-id", "", "the OAuth Client ID: ie: \"123456.apps.googleusercontent.com\"")
+	flagSet.String("client-secret", "", "the OAuth Client Secret")
+	flagSet.String("client-secret-file", "", "the file with the OAuth Client Secret")
+	flagSet.String("authenticated-emails-file", "", "authenticate against emails via file (one per line)")
+	flagSet.String("blocked-emails-file", "", "reject emails listed in this file (one per line) even if otherwise authenticated")
+	flagSet.String("admin-token", "", "bearer token for the /oauth2/admin/ API (ban and unban users at runtime); admin API is disabled if empty")
+	flagSet.String("admin-token-file", "", "the file with the bearer token for the /oauth2/admin/ API")
+	flagSet.String("htpasswd-file", "", "additionally authenticate against a htpasswd file. Entries must be created with \"htpasswd -B\" for bcrypt (or \"htpasswd -s\" for SHA) encryption")
+	flagSet.String("htpasswd-totp-file", "", "base32 TOTP secrets (user:secret per line) of htpasswd users who must also give an authenticator code")
+	flagSet.String("htpasswd-proxy", "", "additionally authenticate against basic auth URL. ie: \"https://internalapp.yourcompany.com/basicautharea\"")
+	flagSet.Var(&htpasswdProxyURLs, "htpasswd-proxy-url", "further basic auth URL to ask when htpasswd-proxy fails, tried in order (may be given multiple times)")
+	flagSet.Bool("htpasswd-proxy-parallel", false, "ask all htpasswd-proxy URLs at once and use the first answer, instead of in order")
+	flagSet.Duration("htpasswd-proxy-timeout", time.Duration(5)*time.Second, "timeout for htpasswd-proxy requests")
+	flagSet.Int("htpasswd-proxy-breaker-threshold", 5, "stop asking htpasswd-proxy after this many consecutive 5xx responses, timeouts or connection errors; 0 to disable")
+	flagSet.Duration("htpasswd-proxy-breaker-cooldown", time.Duration(30)*time.Second, "how long to stop asking htpasswd-proxy once its breaker has tripped")
+	flagSet.String("htpasswd-proxy-protocol", "basic", "how to check passwords with htpasswd-proxy: \"basic\" for a GET with basic auth, or \"json\" to POST them as JSON and read the user's groups and name from the response")
+	flagSet.Bool("htpasswd-proxy-fail-open", false, "accept any password while htpasswd-proxy can't be reached, instead of rejecting them")
+	flagSet.String("htpasswd-proxy-ca-file", "", "PEM file of CAs to verify an https htpasswd-proxy with, instead of the system CAs")
+	flagSet.String("htpasswd-proxy-cert-file", "", "PEM client certificate to present to htpasswd-proxy, with htpasswd-proxy-key-file")
+	flagSet.String("htpasswd-proxy-key-file", "", "private key of htpasswd-proxy-cert-file")
+	flagSet.String("htpasswd-proxy-server-name", "", "TLS server name (SNI) to request from and verify htpasswd-proxy with, instead of its URL's host")
+	flagSet.Var(&htpasswdProxyHeaders, "htpasswd-proxy-header", "\"Name: value\" header added to htpasswd-proxy requests (may be given multiple times)")
+	flagSet.Duration("htpasswd-proxy-negative-ttl", time.Duration(5)*time.Second, "cache passwords rejected by htpasswd-proxy for this long; 0 to disable")
+	flagSet.Bool("display-htpasswd-form", true, "display username / password login form if an htpasswd file is provided")
+	flagSet.String("acl-file", "", "path to a TOML file of per-path rules restricting which emails, domains or groups are allowed")
+	flagSet.String("authz-url", "", "POST the identity and request to this OPA-compatible policy endpoint to allow or deny authenticated requests")
+	flagSet.Duration("authz-timeout", time.Duration(5)*time.Second, "timeout for authz-url requests")
+	flagSet.String("custom-templates-dir", "", "path to custom html templates")
+	flagSet.Bool("templates-dev-mode", false, "re-read custom-templates-dir on every request, for developing templates; not for production")
+	flagSet.String("sign-in-message", "", "message shown on the sign in page, a Go template with {{.URL}}, {{.Host}} and {{.ProviderName}}; defaults to the google-apps-domain")
+	flagSet.String("banner", "", "HTML shown on the sign in page above the sign in button, such as a legal notice")
+	flagSet.String("footer", "", "HTML shown in place of the sign in page's default footer; \"-\" hides the footer")
+	flagSet.String("default-locale", "en", "language of the sign in and error pages for clients whose Accept-Language isn't available")
+	flagSet.Var(&templateData, "template-data", "key=value available to the sign_in.html and error.html templates as {{.Data.key}} (may be given multiple times)")
+
+	flagSet.String("cookie-secret", "", "the seed string for secure cookies")
+	flagSet.String("cookie-secret-file", "", "the file with the seed string for secure cookies")
+	flagSet.String("cookie-domain", "", "an optional cookie domain to force cookies to (ie: .yourcompany.com)*")
+	flagSet.Duration("cookie-expire", time.Duration(168)*time.Hour, "expire timeframe for cookie")
+	flagSet.Duration("cookie-refresh", time.Duration(0)*time.Hour, "refresh the cookie when less than this much time remains before expiration; 0 to disable")
+	flagSet.Int("session-cache-size", 1000, "keep the sessions decoded from this many of the most recently used cookies in memory, saving checking and decrypting them on every request; 0 to disable")
+	flagSet.Duration("validate-token-cache-ttl", time.Duration(30)*time.Second, "with cookie-refresh, don't ask the provider to validate an access token again for this long after it was valid; 0 to disable")
+	flagSet.Bool("cookie-https-only", true, "set secure (HTTPS) cookies (deprecated. use --cookie-secure setting)")
+	flagSet.Bool("cookie-secure", true, "set secure (HTTPS) cookie flag")
+	flagSet.Bool("cookie-httponly", true, "set HttpOnly cookie flag")
+	flagSet.Var(&sessionBinding, "session-binding", "only accept session cookies from the client \"ip\" network and/or \"user-agent\" they were issued to (may be given multiple times)")
+	flagSet.Int("session-binding-ipv4-prefix", 24, "with session-binding=ip, the prefix length of the IPv4 network a session is bound to; 32 for the exact address")
+	flagSet.Int("session-binding-ipv6-prefix", 64, "with session-binding=ip, the prefix length of the IPv6 network a session is bound to; 128 for the exact address")
+	flagSet.String("reject-sessions-before", "", "reject session cookies issued before this RFC3339 time, e.g. after a cookie-secret leak; also settable through the admin API")
+
+	flagSet.Bool("request-logging", true, "Log requests to stdout")
+	flagSet.String("log-file", "", "write application and request logs to this file instead of stderr and stdout; reopened on SIGUSR1")
+	flagSet.Int("log-file-max-size", 0, "rotate log-file when it would grow beyond this many megabytes; 0 to disable")
+	flagSet.Duration("log-file-max-age", time.Duration(0), "rotate log-file after it has been open this long; 0 to disable")
+	flagSet.Int("log-file-max-backups", 0, "number of rotated log files to keep; 0 keeps all")
+	flagSet.String("statsd-address", "", "host:port of a statsd server to send auth event counters and upstream latency timers to")
+	flagSet.String("statsd-prefix", "oauth2_proxy.", "prefix for statsd metric names")
+	flagSet.Var(&statsdTags, "statsd-tag", "key:value DogStatsD tag added to every metric (may be given multiple times)")
+	flagSet.String("otel-exporter-endpoint", "", "host:port of an OpenTelemetry collector to export request traces to over OTLP/HTTP")
+	flagSet.Bool("otel-exporter-insecure", false, "export traces over plain HTTP instead of HTTPS")
+	flagSet.String("otel-service-name", "oauth2_proxy", "service.name of exported traces")
+	flagSet.String("audit-log", "", "write sign ins, sign outs, refreshes, validation failures and authorization denials as JSON to this file, or \"stdout\"")
+	flagSet.String("log-format", "text", "log format: \"text\" or \"json\" (one object per line)")
+	flagSet.String("request-logging-format", DefaultRequestLogFormat, "template for text request log lines")
+	flagSet.Var(&loggingExcludePaths, "logging-exclude-paths", "comma separated paths not to log requests for, such as health checks (may be given multiple times)")
+	flagSet.Var(&loggingExcludeRegex, "logging-exclude-regex", "don't log requests whose path matches this regex (may be given multiple times)")
+	flagSet.Bool("watch-config", false, "reload when the config, emails or htpasswd files change, including Kubernetes ConfigMap updates, as well as on SIGHUP")
+	flagSet.Duration("shutdown-timeout", time.Duration(30)*time.Second, "on SIGTERM, how long to wait for in-flight requests to finish before exiting")
+	flagSet.String("profile-dir", "", "on SIGUSR2 (not SIGUSR1, which reopens log-file), write goroutine stacks and heap and CPU profiles to this directory")
+	flagSet.Duration("profile-cpu-duration", time.Duration(30)*time.Second, "how long to profile the CPU for on SIGUSR2; 0 to skip the CPU profile")
+
+	flagSet.String("provider", "", "Oauth provider (defaults to Google)")
+	flagSet.String("login-url", "", "Authentication endpoint")
+	flagSet.String("redeem-url", "", "Token redemption endpoint")
+	flagSet.String("profile-url", "", "Profile access endpoint")
+	flagSet.String("validate-url", "", "Access token validation endpoint")
+	flagSet.String("scope", "", "Oauth scope specification")
+	flagSet.Duration("provider-timeout", time.Duration(10)*time.Second, "give up requests to the provider (redeeming codes, fetching profiles, validating tokens) after this long")
+	flagSet.Int("provider-max-idle-conns", 16, "idle connections to keep open to each provider host for reuse")
+	flagSet.String("provider-proxy", "", "send requests to the provider through this http, https or socks5 proxy URL; defaults to the HTTPS_PROXY environment variable")
+	flagSet.Bool("mock-provider", false, "sign in anyone with a fake provider, as the user named by the code passed to /oauth2/callback, for load tests; never use it to protect anything")
+	flagSet.Bool("require-verified-email", false, "reject accounts whose email address the provider reports as unverified (Google, GitHub, and the email_verified claim of bearer JWTs)")
+
+	flagSet.String("jwt-issuer", "", "accept bearer JWTs from API clients issued by this issuer (iss claim)")
+	flagSet.String("jwt-jwks-url", "", "JWKS URL with the keys used to verify bearer JWTs")
+	flagSet.Duration("jwt-jwks-refresh", time.Duration(1)*time.Hour, "refresh the jwt-jwks-url keys in the background once they are this old (and whenever a token names an unknown key); 0 to only refresh on unknown keys")
+	flagSet.String("jwt-audience", "", "bearer JWTs must include this audience (aud claim); defaults to client-id")
+	flagSet.String("introspection-url", "", "RFC 7662 token introspection endpoint used to validate opaque bearer tokens from API clients")
+	flagSet.String("introspection-audience", "", "introspected bearer tokens must have been issued to this client (client_id or aud); defaults to client-id")
+	flagSet.Duration("introspection-cache-ttl", time.Duration(1)*time.Minute, "how long to cache active introspection results")
+
+	flagSet.Bool("require-mfa", false, "reject sign ins whose ID token amr/acr claims don't indicate multi-factor authentication")
+	flagSet.Var(&mfaACRValues, "mfa-acr-value", "an ID token acr claim value that indicates multi-factor authentication (may be given multiple times)")
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	// oidUPN is the otherName type of a Microsoft User Principal Name, as
+	// found in smart card and machine certificates.
+	oidUPN = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// loadClientCAs reads the PEM certificates that client certificates must be
+// issued by.
+func loadClientCAs(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// requestClientCertificates asks TLS clients for a certificate issued by
+// one of cas. Clients without one can still sign in another way.
+func requestClientCertificates(config *tls.Config, cas *x509.CertPool) {
+	config.ClientCAs = cas
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+}
+
+// certificateIdentity returns the first email address in the
+// subjectAltName of cert, or else its UPN.
+func certificateIdentity(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) != 0 {
+		return cert.EmailAddresses[0]
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSubjectAltName) {
+			return parseUPN(ext.Value)
+		}
+	}
+	return ""
+}
+
+// parseUPN returns the first UPN otherName of a subjectAltName extension.
+func parseUPN(value []byte) string {
+	var names []asn1.RawValue
+	if _, err := asn1.Unmarshal(value, &names); err != nil {
+		return ""
+	}
+	for _, name := range names {
+		// otherName [0] { type-id OBJECT IDENTIFIER, value [0] EXPLICIT ANY }
+		if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+			continue
+		}
+		var other struct {
+			TypeID asn1.ObjectIdentifier
+			Value  asn1.RawValue
+		}
+		if _, err := asn1.UnmarshalWithParams(name.FullBytes, &other, "tag:0"); err != nil {
+			continue
+		}
+		if !other.TypeID.Equal(oidUPN) || other.Value.Tag != 0 {
+			continue
+		}
+		var upn string
+		if _, err := asn1.Unmarshal(other.Value.Bytes, &upn); err == nil {
+			return upn
+		}
+	}
+	return ""
+}
+
+// CheckClientCertificate authenticates a request by the client certificate
+// verified on the TLS listener, for machine clients that can't sign in.
+func (p *OauthProxy) CheckClientCertificate(req *http.Request) (*SessionState, bool) {
+	if !p.clientCertAuth || req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return nil, false
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	email := normalizeEmail(certificateIdentity(cert), p.normalizeEmails)
+	if email == "" {
+		logger.Printf("%s client certificate %q has no email or UPN", p.clientIP(req), cert.Subject.CommonName)
+		p.audit(auditValidationFailed, req, "", "client certificate has no email or UPN", Fields{"via": "certificate"})
+		return nil, false
+	}
+	session := &SessionState{Email: email, User: strings.Split(email, "@")[0]}
+	if !p.Validator.Validate(req, session) {
+		p.audit(auditValidationFailed, req, email, "email not allowed", Fields{"via": "certificate"})
+		return nil, false
+	}
+	logger.Printf("authenticated %q via client certificate", email)
+	return session, true
+}
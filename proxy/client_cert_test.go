@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+// upnExtension builds a subjectAltName holding a single UPN otherName.
+func upnExtension(t *testing.T, upn string) pkix.Extension {
+	value, err := asn1.Marshal(upn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherName, err := asn1.Marshal(struct {
+		TypeID asn1.ObjectIdentifier
+		Value  asn1.RawValue
+	}{oidUPN, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the otherName SEQUENCE is implicitly tagged [0]
+	otherName[0] = 0xa0
+	names, err := asn1.Marshal([]asn1.RawValue{{FullBytes: otherName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: oidSubjectAltName, Value: names}
+}
+
+func newTestClientCertificate(t *testing.T, emails []string, extensions []pkix.Extension) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "machine"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		EmailAddresses:  emails,
+		ExtraExtensions: extensions,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	cert := newTestClientCertificate(t, []string{"batch@example.com"}, nil)
+	assert.Equal(t, "batch@example.com", certificateIdentity(cert))
+
+	cert = newTestClientCertificate(t, nil, []pkix.Extension{upnExtension(t, "svc-backup@corp.example.com")})
+	assert.Equal(t, "svc-backup@corp.example.com", certificateIdentity(cert))
+
+	cert = newTestClientCertificate(t, nil, nil)
+	assert.Equal(t, "", certificateIdentity(cert))
+}
+
+func TestClientCertificateAuthentication(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Forwarded-Email")))
+	}))
+	defer upstream.Close()
+
+	opts := NewOptions()
+	opts.Upstreams = append(opts.Upstreams, upstream.URL)
+	opts.ClientID = "bazquux"
+	opts.ClientSecret = "foobar"
+	opts.CookieSecret = "xyzzyplugh"
+	opts.Validate()
+	opts.clientCAs = x509.NewCertPool()
+	proxy := NewOauthProxy(opts, EmailValidator(func(email string) bool {
+		return email == "batch@example.com"
+	}))
+
+	get := func(cert *x509.Certificate) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := get(newTestClientCertificate(t, []string{"batch@example.com"}, nil))
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "batch@example.com", rw.Body.String())
+
+	assert.Equal(t, 403, get(newTestClientCertificate(t, []string{"intruder@example.com"}, nil)).Code)
+	assert.Equal(t, 403, get(newTestClientCertificate(t, nil, nil)).Code)
+	assert.Equal(t, 403, get(nil).Code)
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ConfigOption customizes how NewOauthProxyFromConfig builds a proxy.
+type ConfigOption func(*configBuilder)
+
+type configBuilder struct {
+	env       bool
+	configure []func(*Options)
+	validator Validator
+	done      <-chan bool
+}
+
+// WithEnvironment also reads the OAUTH2_PROXY_* environment variables,
+// which take precedence over the config as they do for the command.
+func WithEnvironment() ConfigOption {
+	return func(b *configBuilder) { b.env = true }
+}
+
+// WithOptions calls configure with the options read from the config before
+// they are validated, to set or override them in code, such as
+// Options.TemplateFuncs.
+func WithOptions(configure func(*Options)) ConfigOption {
+	return func(b *configBuilder) { b.configure = append(b.configure, configure) }
+}
+
+// WithValidator authorizes users with validator instead of the emails file
+// and domains of the config. Users blocked or banned are still rejected.
+func WithValidator(validator Validator) ConfigOption {
+	return func(b *configBuilder) { b.validator = validator }
+}
+
+// WithDone stops watching the files named in the config, such as the
+// htpasswd file, once done is closed. Without it they are watched for as
+// long as the program runs.
+func WithDone(done <-chan bool) ConfigOption {
+	return func(b *configBuilder) { b.done = done }
+}
+
+// NewOauthProxyFromConfig reads a config in format, "toml", "yaml" or
+// "json", with the same keys as a config file, and builds an OauthProxy
+// from it as the command does, for programs embedding the proxy and tests.
+// Options the config leaves out have their command line defaults.
+func NewOauthProxyFromConfig(config io.Reader, format string, options ...ConfigOption) (*OauthProxy, error) {
+	b := &configBuilder{}
+	for _, option := range options {
+		option(b)
+	}
+	data, err := ioutil.ReadAll(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config - %s", err)
+	}
+
+	opts := NewOptions()
+	cfg := make(EnvOptions)
+	switch strings.ToLower(format) {
+	case "toml":
+		_, err = toml.Decode(string(data), &cfg)
+	case "yaml", "yml", "json":
+		// JSON is read as YAML, of which it is a subset
+		opts.UpstreamConfigs, err = parseYAMLConfig(data, cfg)
+	default:
+		return nil, fmt.Errorf("unknown config format %q, must be \"toml\", \"yaml\" or \"json\"", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config - %s", err)
+	}
+	if b.env {
+		cfg.LoadEnvForStruct(opts)
+	}
+	flagSet := flag.NewFlagSet("oauth2_proxy", flag.ContinueOnError)
+	addOptionFlags(flagSet)
+	cfg.Resolve(opts, flagSet)
+	for _, configure := range b.configure {
+		configure(opts)
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	redactor.AddOptions(opts)
+	return buildOauthProxy(opts, b.validator, b.done)
+}
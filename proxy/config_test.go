@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bitly/oauth2_proxy/providers"
+	"github.com/bmizerany/assert"
+)
+
+// testSignInProvider signs users in as its EmailAddress once the code is
+// redeemed with server.
+func testSignInProvider(server *httptest.Server) *TestProvider {
+	redeemURL, _ := url.Parse(server.URL + "/oauth/token")
+	return &TestProvider{ProviderData: &providers.ProviderData{ProviderName: "Test Provider", RedeemUrl: redeemURL}}
+}
+
+func TestNewOauthProxyFromConfig(t *testing.T) {
+	// the upstream also stands in for the provider's token endpoint
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			w.Write([]byte(`{"access_token": "my_auth_token"}`))
+			return
+		}
+		w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	configs := map[string]string{
+		"toml": `
+upstreams = ["` + upstream.URL + `"]
+client_id = "bazquux"
+client_secret = "xyzzyplugh"
+cookie_secret = "foobar"
+cookie_domain = "from-toml.example"
+email_domains = ["example.com"]
+`,
+		"yaml": `
+upstreams:
+  - ` + upstream.URL + `
+client_id: bazquux
+client_secret: xyzzyplugh
+cookie_secret: foobar
+cookie_domain: from-yaml.example
+email_domains: [example.com]
+`,
+		"json": `{
+	"upstreams": ["` + upstream.URL + `"],
+	"client_id": "bazquux",
+	"client_secret": "xyzzyplugh",
+	"cookie_secret": "foobar",
+	"cookie_domain": "from-json.example",
+	"email_domains": ["example.com"]
+}`,
+	}
+	for format, config := range configs {
+		done := make(chan bool)
+		proxy, err := NewOauthProxyFromConfig(strings.NewReader(config), format, WithDone(done))
+		assert.Equal(t, nil, err, format)
+		assert.Equal(t, "from-"+format+".example", proxy.CookieDomain, format)
+		// unset options have their command line defaults
+		assert.Equal(t, "X-Forwarded-User", proxy.userHeader, format)
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(proxy.MakeCookie(req, "user@example.com", proxy.CookieExpire))
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		assert.Equal(t, "upstream", rw.Body.String(), format)
+
+		// email_domains are checked when users sign in
+		provider := testSignInProvider(upstream)
+		proxy.provider = provider
+		signIn := func(email string) int {
+			provider.EmailAddress = email
+			req, _ := http.NewRequest("GET", "/oauth2/callback?code=callback_code", nil)
+			rw := httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+			return rw.Code
+		}
+		assert.Equal(t, 302, signIn("user@example.com"), format)
+		assert.Equal(t, 403, signIn("user@elsewhere.example"), format)
+		close(done)
+	}
+}
+
+func TestNewOauthProxyFromConfigOptions(t *testing.T) {
+	config := `
+upstreams = ["http://127.0.0.1:8080/"]
+client_id = "bazquux"
+client_secret = "xyzzyplugh"
+`
+	_, err := NewOauthProxyFromConfig(strings.NewReader(config), "toml")
+	assert.Equal(t, errorMsg([]string{"missing setting: cookie-secret"}), err.Error())
+
+	var validated []string
+	proxy, err := NewOauthProxyFromConfig(strings.NewReader(config), "toml",
+		WithOptions(func(opts *Options) { opts.CookieSecret = "foobar" }),
+		WithValidator(EmailValidator(func(email string) bool {
+			validated = append(validated, email)
+			return false
+		})))
+	assert.Equal(t, nil, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token": "my_auth_token"}`))
+	}))
+	defer server.Close()
+	provider := testSignInProvider(server)
+	provider.EmailAddress = "user@example.com"
+	proxy.provider = provider
+	req, _ := http.NewRequest("GET", "/oauth2/callback?code=callback_code", nil)
+	rw := httptest.NewRecorder()
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, 403, rw.Code)
+	assert.Equal(t, []string{"user@example.com"}, validated)
+
+	_, err = NewOauthProxyFromConfig(strings.NewReader(config), "ini")
+	assert.Equal(t, `unknown config format "ini", must be "toml", "yaml" or "json"`, err.Error())
+}
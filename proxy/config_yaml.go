@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Upstream is a structured upstream definition, available in YAML config
+// files as an alternative to an "upstreams" URL string.
+type Upstream struct {
+	// Path is the request path prefix routed to this upstream; it
+	// defaults to the path of URL.
+	Path string `yaml:"path"`
+	URL  string `yaml:"url"`
+	// Rewrite replaces the Path prefix of the request before proxying.
+	Rewrite string `yaml:"rewrite"`
+	// Headers are set on every request sent to the upstream.
+	Headers map[string]string `yaml:"headers"`
+	// SkipAuth bypasses authentication for everything under Path.
+	SkipAuth bool `yaml:"skip_auth"`
+	// Static caches the upstream's GET responses in memory, shared by all
+	// users, as set by static-cache-size and static-cache-ttl.
+	Static bool `yaml:"static"`
+}
+
+// LoadYAMLConfig reads a YAML config file into cfg. Its keys are the same
+// as a TOML config file's, except that "upstreams" entries may be Upstream
+// objects as well as URL strings; the objects are returned separately.
+func LoadYAMLConfig(filename string, cfg EnvOptions) ([]Upstream, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseYAMLConfig(data, cfg)
+}
+
+// yamlUpstream is an "upstreams" entry: a URL string or an Upstream.
+type yamlUpstream struct {
+	url      string
+	upstream *Upstream
+}
+
+func (u *yamlUpstream) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&u.url); err == nil {
+		return nil
+	}
+	u.upstream = &Upstream{}
+	return unmarshal(u.upstream)
+}
+
+func parseYAMLConfig(data []byte, cfg EnvOptions) ([]Upstream, error) {
+	var config struct {
+		Upstreams []yamlUpstream         `yaml:"upstreams"`
+		Options   map[string]interface{} `yaml:",inline"`
+	}
+	// strict decoding reports unknown or mistyped upstream fields; other
+	// options are checked when they are resolved
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	for key, value := range config.Options {
+		cfg[key] = value
+	}
+	var urls []string
+	var upstreams []Upstream
+	for _, u := range config.Upstreams {
+		if u.upstream != nil {
+			upstreams = append(upstreams, *u.upstream)
+		} else {
+			urls = append(urls, u.url)
+		}
+	}
+	if urls != nil {
+		cfg["upstreams"] = urls
+	}
+	return upstreams, nil
+}
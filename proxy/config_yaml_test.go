@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseYAMLConfig(t *testing.T) {
+	cfg := make(EnvOptions)
+	upstreams, err := parseYAMLConfig([]byte(`
+client_id: bazquux
+cookie_expire: 24h
+canary_percent: 10
+email_domains:
+  - example.com
+upstreams:
+  - http://127.0.0.1:8080/
+  - path: /api/
+    url: http://127.0.0.1:8081
+    rewrite: /v1/
+    headers:
+      X-Api-Key: secret
+  - url: http://127.0.0.1:8082/static/
+    skip_auth: true
+`), cfg)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "bazquux", cfg["client_id"])
+	assert.Equal(t, "24h", cfg["cookie_expire"])
+	assert.Equal(t, 10, cfg["canary_percent"])
+	assert.Equal(t, []interface{}{"example.com"}, cfg["email_domains"])
+	assert.Equal(t, []string{"http://127.0.0.1:8080/"}, cfg["upstreams"])
+	assert.Equal(t, []Upstream{
+		{Path: "/api/", URL: "http://127.0.0.1:8081", Rewrite: "/v1/",
+			Headers: map[string]string{"X-Api-Key": "secret"}},
+		{URL: "http://127.0.0.1:8082/static/", SkipAuth: true},
+	}, upstreams)
+}
+
+func TestParseYAMLConfigErrors(t *testing.T) {
+	_, err := parseYAMLConfig([]byte(`
+upstreams:
+  - url: http://127.0.0.1:8080/
+    skip-auth: true
+`), make(EnvOptions))
+	assert.Equal(t, "yaml: unmarshal errors:\n"+
+		"  line 4: field skip-auth not found in type proxy.Upstream", err.Error())
+
+	_, err = parseYAMLConfig([]byte(`upstreams: http://127.0.0.1:8080/`), make(EnvOptions))
+	assert.Equal(t, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!str `http://...` into []proxy.yamlUpstream", err.Error())
+}
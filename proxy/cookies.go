@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func validateCookie(cookie *http.Cookie, seed string) (string, time.Time, bool) {
+	// value, timestamp, sig
+	parts := strings.Split(cookie.Value, "|")
+	if len(parts) != 3 {
+		return "", time.Unix(0, 0), false
+	}
+	sig := cookieSignature(seed, cookie.Name, parts[0], parts[1])
+	if checkHmac(parts[2], sig) {
+		ts, err := strconv.Atoi(parts[1])
+		if err == nil && int64(ts) > time.Now().Add(-sessionCookieMaxAge).Unix() {
+			// it's a valid cookie. now get the contents
+			rawValue, err := base64.URLEncoding.DecodeString(parts[0])
+			if err == nil {
+				return string(rawValue), time.Unix(int64(ts), 0), true
+			}
+		}
+	}
+	return "", time.Unix(0, 0), false
+}
+
+func signedCookieValue(seed string, key string, value string) string {
+	encodedValue := base64.URLEncoding.EncodeToString([]byte(value))
+	timeStr := fmt.Sprintf("%d", time.Now().Unix())
+	sig := cookieSignature(seed, key, encodedValue, timeStr)
+	cookieVal := fmt.Sprintf("%s|%s|%s", encodedValue, timeStr, sig)
+	return cookieVal
+}
+
+func cookieSignature(args ...string) string {
+	h := hmac.New(sha1.New, []byte(args[0]))
+	for _, arg := range args[1:] {
+		h.Write([]byte(arg))
+	}
+	var b []byte
+	b = h.Sum(b)
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+func checkHmac(input, expected string) bool {
+	inputMAC, err1 := base64.URLEncoding.DecodeString(input)
+	if err1 == nil {
+		expectedMAC, err2 := base64.URLEncoding.DecodeString(expected)
+		if err2 == nil {
+			return hmac.Equal(inputMAC, expectedMAC)
+		}
+	}
+	return false
+}
+
+func encodeAccessToken(aes_cipher cipher.Block, access_token string) (string, error) {
+	ciphertext := make([]byte, aes.BlockSize+len(access_token))
+	iv := ciphertext[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", fmt.Errorf("failed to create access code initialization vector")
+	}
+
+	stream := cipher.NewCFBEncrypter(aes_cipher, iv)
+	stream.XORKeyStream(ciphertext[aes.BlockSize:], []byte(access_token))
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func decodeAccessToken(aes_cipher cipher.Block, encoded_access_token string) (string, error) {
+	encrypted_access_token, err := base64.StdEncoding.DecodeString(
+		encoded_access_token)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to decode access token")
+	}
+
+	if len(encrypted_access_token) < aes.BlockSize {
+		return "", fmt.Errorf("encrypted access token should be "+
+			"at least %d bytes, but is only %d bytes",
+			aes.BlockSize, len(encrypted_access_token))
+	}
+
+	iv := encrypted_access_token[:aes.BlockSize]
+	encrypted_access_token = encrypted_access_token[aes.BlockSize:]
+	stream := cipher.NewCFBDecrypter(aes_cipher, iv)
+	stream.XORKeyStream(encrypted_access_token, encrypted_access_token)
+
+	return string(encrypted_access_token), nil
+}
+
+// SessionState is the identity carried in the session cookie.
+type SessionState struct {
+	Email       string
+	User        string
+	AccessToken string
+	Groups      []string
+	// AuthTime is when the user last authenticated: with the provider, as
+	// it reports, or with a password. It is zero when the provider didn't
+	// say and for sessions created before it was recorded.
+	AuthTime time.Time
+	// Binding fingerprints the client the session was issued to, when
+	// session-binding is set.
+	Binding string
+	// SecondFactor is "webauthn" once the user has used a security key
+	// since signing in.
+	SecondFactor string
+	// Name is the display name given by the htpasswd proxy, if any.
+	Name string
+	// PreferredUsername is the provider's username or login for the user,
+	// when it has one distinct from the email address.
+	PreferredUsername string
+	// Claims are the verified claims of a JWT bearer token. They are not
+	// stored in the session cookie.
+	Claims *JWTClaims
+}
+
+// clone returns a copy of s that can be changed without changing s.
+func (s *SessionState) clone() *SessionState {
+	c := *s
+	c.Groups = append([]string(nil), s.Groups...)
+	return &c
+}
+
+// identity returns the email if present, or else the user name.
+func (s *SessionState) identity() string {
+	if s.Email != "" {
+		return s.Email
+	}
+	return s.User
+}
+
+func buildCookieValue(email string, aes_cipher cipher.Block,
+	access_token string) (string, error) {
+	return buildSessionValue(&SessionState{Email: email,
+		AccessToken: access_token}, aes_cipher)
+}
+
+// buildSessionValue serializes a session as
+// "email|access_token|groups|auth_time|binding|second_factor|name|preferred_username",
+// where the access token is only
+// present when an AES cipher is configured and trailing empty components
+// are omitted.
+func buildSessionValue(s *SessionState, aes_cipher cipher.Block) (string, error) {
+	encoded_token := ""
+	if aes_cipher != nil {
+		var err error
+		encoded_token, err = encodeAccessToken(aes_cipher, s.AccessToken)
+		if err != nil {
+			return s.Email, fmt.Errorf(
+				"error encoding access token for %s: %s", s.Email, err)
+		}
+	}
+	auth_time := ""
+	if !s.AuthTime.IsZero() {
+		auth_time = strconv.FormatInt(s.AuthTime.Unix(), 10)
+	}
+	components := []string{s.Email, encoded_token, encodeGroups(s.Groups), auth_time, s.Binding, s.SecondFactor, url.QueryEscape(s.Name), url.QueryEscape(s.PreferredUsername)}
+	for len(components) > 1 && components[len(components)-1] == "" {
+		components = components[:len(components)-1]
+	}
+	return strings.Join(components, "|"), nil
+}
+
+func parseCookieValue(value string, aes_cipher cipher.Block) (email, user,
+	access_token string, err error) {
+	s, err := parseSessionValue(value, aes_cipher)
+	return s.Email, s.User, s.AccessToken, err
+}
+
+func parseSessionValue(value string, aes_cipher cipher.Block) (s *SessionState, err error) {
+	components := strings.Split(value, "|")
+	s = &SessionState{Email: components[0]}
+	s.User = strings.Split(s.Email, "@")[0]
+
+	if aes_cipher != nil && len(components) >= 2 && components[1] != "" {
+		s.AccessToken, err = decodeAccessToken(aes_cipher, components[1])
+		if err != nil {
+			err = fmt.Errorf(
+				"error decoding access token for %s: %s",
+				s.Email, err)
+		}
+	}
+	if len(components) >= 3 {
+		s.Groups = decodeGroups(components[2])
+	}
+	if len(components) >= 4 {
+		if ts, err := strconv.ParseInt(components[3], 10, 64); err == nil {
+			s.AuthTime = time.Unix(ts, 0)
+		}
+	}
+	if len(components) >= 5 {
+		s.Binding = components[4]
+	}
+	if len(components) >= 6 {
+		s.SecondFactor = components[5]
+	}
+	if len(components) >= 7 {
+		s.Name, _ = url.QueryUnescape(components[6])
+	}
+	if len(components) >= 8 {
+		s.PreferredUsername, _ = url.QueryUnescape(components[7])
+	}
+	return s, err
+}
+
+func encodeGroups(groups []string) string {
+	escaped := make([]string, len(groups))
+	for i, g := range groups {
+		escaped[i] = url.QueryEscape(g)
+	}
+	return strings.Join(escaped, ",")
+}
+
+func decodeGroups(value string) []string {
+	var groups []string
+	for _, g := range strings.Split(value, ",") {
+		if g, err := url.QueryUnescape(g); err == nil && g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
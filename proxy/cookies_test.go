@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"crypto/aes"
+	"github.com/bmizerany/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeAndDecodeAccessToken(t *testing.T) {
+	const key = "0123456789abcdefghijklmnopqrstuv"
+	const access_token = "my access token"
+	c, err := aes.NewCipher([]byte(key))
+	assert.Equal(t, nil, err)
+
+	encoded_token, err := encodeAccessToken(c, access_token)
+	assert.Equal(t, nil, err)
+
+	decoded_token, err := decodeAccessToken(c, encoded_token)
+	assert.Equal(t, nil, err)
+
+	assert.NotEqual(t, access_token, encoded_token)
+	assert.Equal(t, access_token, decoded_token)
+}
+
+func TestBuildCookieValueWithoutAccessToken(t *testing.T) {
+	value, err := buildCookieValue("michael.bland@gsa.gov", nil, "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", value)
+}
+
+func TestBuildCookieValueWithAccessTokenAndNilCipher(t *testing.T) {
+	value, err := buildCookieValue("michael.bland@gsa.gov", nil,
+		"access token")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", value)
+}
+
+func TestParseCookieValueWithoutAccessToken(t *testing.T) {
+	email, user, access_token, err := parseCookieValue(
+		"michael.bland@gsa.gov", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", email)
+	assert.Equal(t, "michael.bland", user)
+	assert.Equal(t, "", access_token)
+}
+
+func TestParseCookieValueWithAccessTokenAndNilCipher(t *testing.T) {
+	email, user, access_token, err := parseCookieValue(
+		"michael.bland@gsa.gov|access_token", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", email)
+	assert.Equal(t, "michael.bland", user)
+	assert.Equal(t, "", access_token)
+}
+
+func TestBuildAndParseCookieValueWithAccessToken(t *testing.T) {
+	aes_cipher, err := aes.NewCipher([]byte("0123456789abcdef"))
+	assert.Equal(t, nil, err)
+	value, err := buildCookieValue("michael.bland@gsa.gov", aes_cipher,
+		"access_token")
+	assert.Equal(t, nil, err)
+
+	prefix := "michael.bland@gsa.gov|"
+	if !strings.HasPrefix(value, prefix) {
+		t.Fatal("cookie value does not start with \"%s\": %s",
+			prefix, value)
+	}
+
+	email, user, access_token, err := parseCookieValue(value, aes_cipher)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", email)
+	assert.Equal(t, "michael.bland", user)
+	assert.Equal(t, "access_token", access_token)
+}
+
+func TestBuildAndParseSessionValueWithGroups(t *testing.T) {
+	value, err := buildSessionValue(&SessionState{
+		Email:  "michael.bland@gsa.gov",
+		Groups: []string{"org/team", "a,b|c"},
+	}, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov||org%2Fteam,a%2Cb%7Cc", value)
+
+	session, err := parseSessionValue(value, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", session.Email)
+	assert.Equal(t, "michael.bland", session.User)
+	assert.Equal(t, []string{"org/team", "a,b|c"}, session.Groups)
+}
+
+func TestBuildAndParseSessionValueWithAccessTokenAndGroups(t *testing.T) {
+	aes_cipher, err := aes.NewCipher([]byte("0123456789abcdef"))
+	assert.Equal(t, nil, err)
+	value, err := buildSessionValue(&SessionState{
+		Email:       "michael.bland@gsa.gov",
+		AccessToken: "access_token",
+		Groups:      []string{"admins"},
+	}, aes_cipher)
+	assert.Equal(t, nil, err)
+
+	session, err := parseSessionValue(value, aes_cipher)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "access_token", session.AccessToken)
+	assert.Equal(t, []string{"admins"}, session.Groups)
+}
+
+func TestBuildAndParseSessionValueWithAuthTime(t *testing.T) {
+	authTime := time.Unix(1431007200, 0)
+	value, err := buildSessionValue(&SessionState{
+		Email:    "michael.bland@gsa.gov",
+		AuthTime: authTime,
+	}, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov|||1431007200", value)
+
+	session, err := parseSessionValue(value, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, authTime, session.AuthTime)
+	assert.Equal(t, []string(nil), session.Groups)
+
+	session, err = parseSessionValue("michael.bland@gsa.gov", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, session.AuthTime.IsZero())
+}
+
+func TestBuildAndParseSessionValueWithBinding(t *testing.T) {
+	value, err := buildSessionValue(&SessionState{
+		Email:   "michael.bland@gsa.gov",
+		Binding: "fingerprint",
+	}, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov||||fingerprint", value)
+
+	session, err := parseSessionValue(value, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "fingerprint", session.Binding)
+	assert.Equal(t, true, session.AuthTime.IsZero())
+}
+
+func TestBuildAndParseSessionValueWithSecondFactor(t *testing.T) {
+	value, err := buildSessionValue(&SessionState{
+		Email:        "michael.bland@gsa.gov",
+		SecondFactor: "webauthn",
+	}, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov|||||webauthn", value)
+
+	session, err := parseSessionValue(value, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "webauthn", session.SecondFactor)
+	assert.Equal(t, "", session.Binding)
+}
+
+func TestBuildAndParseSessionValueWithName(t *testing.T) {
+	value, err := buildSessionValue(&SessionState{
+		Email:  "mbland",
+		Groups: []string{"staff"},
+		Name:   "Mike Bland | 18F",
+	}, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "mbland||staff||||Mike+Bland+%7C+18F", value)
+
+	session, err := parseSessionValue(value, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Mike Bland | 18F", session.Name)
+	assert.Equal(t, []string{"staff"}, session.Groups)
+}
+
+func TestBuildAndParseSessionValueWithPreferredUsername(t *testing.T) {
+	value, err := buildSessionValue(&SessionState{
+		Email:             "michael.bland@gsa.gov",
+		PreferredUsername: "mbland",
+	}, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov|||||||mbland", value)
+
+	session, err := parseSessionValue(value, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "mbland", session.PreferredUsername)
+	assert.Equal(t, "", session.Name)
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dnsCache resolves upstream hostnames for the upstream transport, caching
+// their addresses. Once they are older than refresh, connections keep using
+// them while the host is looked up again in the background, so lookups
+// don't delay requests and DNS changes are picked up without a restart. A
+// connection that fails to every cached address looks the host up again
+// straight away.
+type dnsCache struct {
+	refresh time.Duration
+	lookup  func(ctx context.Context, host string) ([]string, error)
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	now     func() time.Time
+	// onChange is called when a host's addresses change
+	onChange func()
+
+	sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	addrs      []string
+	resolved   time.Time
+	refreshing bool
+}
+
+func newDNSCache(refresh time.Duration) *dnsCache {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return &dnsCache{
+		refresh: refresh,
+		lookup:  net.DefaultResolver.LookupHost,
+		dial:    dialer.DialContext,
+		now:     time.Now,
+		entries: make(map[string]*dnsEntry),
+	}
+}
+
+// newUpstreamTransport is http.DefaultTransport, dialing upstreams with the
+// addresses cached for refresh, and dropping idle connections once an
+// upstream's addresses change.
+func newUpstreamTransport(refresh time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	cache := newDNSCache(refresh)
+	cache.onChange = transport.CloseIdleConnections
+	transport.DialContext = cache.DialContext
+	return transport
+}
+
+// DialContext connects to addr, a host:port, at one of the host's cached
+// addresses.
+func (c *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return c.dial(ctx, network, addr)
+	}
+	addrs, err := c.addrs(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dialAny(ctx, network, addrs, port)
+	if err == nil {
+		return conn, nil
+	}
+	// the upstream may have moved
+	fresh, lookupErr := c.resolve(ctx, host)
+	if lookupErr != nil || sameAddrs(fresh, addrs) {
+		return nil, err
+	}
+	return c.dialAny(ctx, network, fresh, port)
+}
+
+func (c *dnsCache) dialAny(ctx context.Context, network string, addrs []string, port string) (conn net.Conn, err error) {
+	for _, a := range addrs {
+		if conn, err = c.dial(ctx, network, net.JoinHostPort(a, port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// addrs returns the cached addresses of host, looking it up if there are
+// none, and again in the background if they are older than refresh.
+func (c *dnsCache) addrs(ctx context.Context, host string) ([]string, error) {
+	c.Lock()
+	e, ok := c.entries[host]
+	if !ok {
+		c.Unlock()
+		return c.resolve(ctx, host)
+	}
+	if !e.refreshing && c.now().Sub(e.resolved) >= c.refresh {
+		e.refreshing = true
+		go c.resolve(context.Background(), host)
+	}
+	addrs := e.addrs
+	c.Unlock()
+	return addrs, nil
+}
+
+// resolve looks host up and caches its addresses. If the lookup fails, the
+// addresses already cached are kept for another refresh period.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	addrs, err := c.lookup(ctx, host)
+	c.Lock()
+	e, ok := c.entries[host]
+	if err != nil {
+		if ok {
+			logger.Printf("looking up upstream %s: %s; keeping %v", host, err, e.addrs)
+			e.resolved, e.refreshing = c.now(), false
+		}
+		c.Unlock()
+		return nil, err
+	}
+	changed := ok && !sameAddrs(e.addrs, addrs)
+	c.entries[host] = &dnsEntry{addrs: addrs, resolved: c.now()}
+	c.Unlock()
+	if changed {
+		logger.Printf("upstream %s moved from %v to %v", host, e.addrs, addrs)
+		if c.onChange != nil {
+			c.onChange()
+		}
+	}
+	return addrs, nil
+}
+
+// sameAddrs reports whether a and b hold the same addresses, in any order.
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int, len(a))
+	for _, addr := range a {
+		seen[addr]++
+	}
+	for _, addr := range b {
+		if seen[addr] == 0 {
+			return false
+		}
+		seen[addr]--
+	}
+	return true
+}
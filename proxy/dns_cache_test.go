@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+type fakeDNS struct {
+	sync.Mutex
+	addrs   map[string][]string
+	lookups int
+	dialed  []string
+	down    map[string]bool
+}
+
+func (f *fakeDNS) lookup(ctx context.Context, host string) ([]string, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.lookups++
+	if addrs, ok := f.addrs[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (f *fakeDNS) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.dialed = append(f.dialed, addr)
+	if f.down[addr] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func (f *fakeDNS) set(host string, addrs ...string) {
+	f.Lock()
+	defer f.Unlock()
+	f.addrs[host] = addrs
+}
+
+func (f *fakeDNS) stats() (int, []string) {
+	f.Lock()
+	defer f.Unlock()
+	dialed := f.dialed
+	f.dialed = nil
+	return f.lookups, dialed
+}
+
+func newTestDNSCache(f *fakeDNS, now *time.Time) *dnsCache {
+	c := newDNSCache(time.Minute)
+	c.lookup, c.dial = f.lookup, f.dial
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+func TestDNSCacheRefreshesInBackground(t *testing.T) {
+	f := &fakeDNS{addrs: map[string][]string{"backend": {"10.0.0.1"}}}
+	now := time.Now()
+	c := newTestDNSCache(f, &now)
+	changed := make(chan bool, 1)
+	c.onChange = func() { changed <- true }
+
+	for i := 0; i < 3; i++ {
+		_, err := c.DialContext(context.Background(), "tcp", "backend:80")
+		assert.Equal(t, nil, err)
+	}
+	lookups, dialed := f.stats()
+	assert.Equal(t, 1, lookups)
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.1:80", "10.0.0.1:80"}, dialed)
+
+	// once stale, the old address is used while the host is looked up again
+	f.set("backend", "10.0.0.2")
+	now = now.Add(time.Minute)
+	c.DialContext(context.Background(), "tcp", "backend:80")
+	_, dialed = f.stats()
+	assert.Equal(t, []string{"10.0.0.1:80"}, dialed)
+	<-changed
+	c.DialContext(context.Background(), "tcp", "backend:80")
+	lookups, dialed = f.stats()
+	assert.Equal(t, 2, lookups)
+	assert.Equal(t, []string{"10.0.0.2:80"}, dialed)
+
+	// IP addresses aren't looked up
+	c.DialContext(context.Background(), "tcp", "127.0.0.1:80")
+	lookups, dialed = f.stats()
+	assert.Equal(t, 2, lookups)
+	assert.Equal(t, []string{"127.0.0.1:80"}, dialed)
+}
+
+func TestDNSCacheResolvesAgainOnConnectionFailure(t *testing.T) {
+	f := &fakeDNS{addrs: map[string][]string{"backend": {"10.0.0.1"}}, down: map[string]bool{}}
+	now := time.Now()
+	c := newTestDNSCache(f, &now)
+	c.DialContext(context.Background(), "tcp", "backend:80")
+	f.stats()
+
+	f.Lock()
+	f.down["10.0.0.1:80"] = true
+	f.Unlock()
+	f.set("backend", "10.0.0.2")
+	_, err := c.DialContext(context.Background(), "tcp", "backend:80")
+	assert.Equal(t, nil, err)
+	lookups, dialed := f.stats()
+	assert.Equal(t, 2, lookups)
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80"}, dialed)
+
+	// a failed lookup keeps the cached addresses
+	f.Lock()
+	delete(f.addrs, "backend")
+	f.Unlock()
+	now = now.Add(time.Minute)
+	_, err = c.DialContext(context.Background(), "tcp", "backend:80")
+	assert.Equal(t, nil, err)
+}
+
+func TestSameAddrs(t *testing.T) {
+	assert.Equal(t, true, sameAddrs([]string{"a", "b"}, []string{"b", "a"}))
+	assert.Equal(t, false, sameAddrs([]string{"a", "a"}, []string{"a", "b"}))
+	assert.Equal(t, false, sameAddrs([]string{"a"}, []string{"a", "b"}))
+}
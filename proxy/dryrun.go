@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// secretOptions are the config keys whose values dumpConfig redacts.
+var secretOptions = map[string]bool{
+	"client_secret": true,
+	"cookie_secret": true,
+	"admin_token":   true,
+
+	"basic_auth_password": true,
+	"captcha_secret":      true,
+}
+
+const redacted = "<redacted>"
+
+// dumpConfig writes the effective configuration of validated opts in config
+// file syntax, with secrets redacted, followed by the upstream routing table
+// and the skip-auth regexes it compiles to.
+func dumpConfig(w io.Writer, opts *Options) {
+	fmt.Fprintln(w, "## effective configuration")
+	v := reflect.ValueOf(opts).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("cfg")
+		if name == "" {
+			continue
+		}
+		value := formatOption(v.Field(i).Interface())
+		if secretOptions[name] && v.Field(i).String() != "" {
+			value = strconv.Quote(redacted)
+		}
+		fmt.Fprintf(w, "%s = %s\n", name, value)
+	}
+
+	fmt.Fprintln(w, "\n## upstreams")
+	canaries := make(map[string]*url.URL)
+	for _, u := range opts.canaryUrls {
+		canaries[u.Path] = u
+	}
+	for _, u := range opts.proxyUrls {
+		fmt.Fprintf(w, "%s => %s", u.Path, upstreamTarget(u))
+		if config := opts.upstreamConfigs[u.Path]; config != nil {
+			if config.Rewrite != "" {
+				fmt.Fprintf(w, " rewrite=%s", config.Rewrite)
+			}
+			if len(config.Headers) != 0 {
+				headers := make([]string, 0, len(config.Headers))
+				for header := range config.Headers {
+					headers = append(headers, header)
+				}
+				sort.Strings(headers)
+				fmt.Fprintf(w, " headers=%s", strings.Join(headers, ","))
+			}
+			if config.SkipAuth {
+				fmt.Fprint(w, " skip_auth")
+			}
+			if config.Static {
+				fmt.Fprint(w, " static")
+			}
+		}
+		if c, ok := canaries[u.Path]; ok {
+			fmt.Fprintf(w, " canary=%s (%d%%)", upstreamTarget(c), opts.CanaryPercent)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "\n## skip-auth regexes")
+	for i, r := range opts.CompiledRegex {
+		fmt.Fprint(w, r)
+		if methods := opts.skipAuthMethods[i]; len(methods) != 0 {
+			fmt.Fprintf(w, " (%s)", strings.Join(methods, ","))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// upstreamTarget is the address requests routed to u are proxied to, with
+// any password redacted.
+func upstreamTarget(u *url.URL) string {
+	target := *u
+	target.Path = ""
+	return redactURL(target.String())
+}
+
+// redactURL hides the password of a URL, such as a redis URL, in s.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return u.String()
+}
+
+// formatOption formats an option value the way it is written in a config
+// file.
+func formatOption(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(redactURL(v))
+	case time.Duration:
+		return strconv.Quote(v.String())
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(redactURL(s))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestDumpConfig(t *testing.T) {
+	o := testOptions()
+	o.EmailDomains = []string{"example.com"}
+	o.RateLimitRedis = "redis://:hunter2@127.0.0.1:6379"
+	o.CanaryUpstreams = []string{"http://127.0.0.1:9090/"}
+	o.CanaryPercent = 5
+	o.SkipAuthRegex = []string{"GET,HEAD=^/health$"}
+	o.UpstreamConfigs = []Upstream{{
+		URL:      "http://127.0.0.1:8081/",
+		Path:     "/api/",
+		Rewrite:  "/v1/",
+		Headers:  map[string]string{"X-Token": "secret", "X-App": "api"},
+		SkipAuth: true,
+	}}
+	assert.Equal(t, nil, o.Validate())
+
+	var buf bytes.Buffer
+	dumpConfig(&buf, o)
+	out := buf.String()
+	for _, line := range []string{
+		`client_id = "bazquux"`,
+		`client_secret = "<redacted>"`,
+		`cookie_secret = "<redacted>"`,
+		`admin_token = ""`,
+		`email_domains = ["example.com"]`,
+		`cookie_expire = "168h0m0s"`,
+		`cookie_secure = true`,
+		`canary_percent = 5`,
+		`rate_limit_redis = "redis://:xxxxx@127.0.0.1:6379"`,
+		"/ => http://127.0.0.1:8080 canary=http://127.0.0.1:9090 (5%)",
+		"/api/ => http://127.0.0.1:8081 rewrite=/v1/ headers=X-App,X-Token skip_auth",
+		"^/health$ (GET,HEAD)",
+		"^/api/",
+	} {
+		assert.Equal(t, true, strings.Contains(out, "\n"+line+"\n"), line)
+	}
+	assert.Equal(t, false, strings.Contains(out, "xyzzyplugh"))
+	assert.Equal(t, false, strings.Contains(out, "hunter2"))
+	assert.Equal(t, false, strings.Contains(out, "secret\n"))
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/mreiferson/go-options"
+)
+
+type EnvOptions map[string]interface{}
+
+func (cfg EnvOptions) LoadEnvForStruct(options interface{}) {
+	val := reflect.ValueOf(options).Elem()
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		// pull out the struct tags:
+		//    flag - the name of the command line flag
+		//    deprecated - (optional) the name of the deprecated command line flag
+		//    cfg - (optional, defaults to underscored flag) the name of the config file option
+		//    env - (optional, defaults to OAUTH2_PROXY_ + upper cased, underscored flag) the environment variable
+		field := typ.Field(i)
+		flagName := field.Tag.Get("flag")
+		envName := field.Tag.Get("env")
+		cfgName := field.Tag.Get("cfg")
+		if cfgName == "" && flagName != "" {
+			cfgName = strings.Replace(flagName, "-", "_", -1)
+		}
+		if envName == "" && flagName != "" {
+			envName = "OAUTH2_PROXY_" + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+		}
+		if envName == "" || cfgName == "" {
+			// resolvable fields must have the `env` (or `flag`) and `cfg` struct tag
+			continue
+		}
+		v := os.Getenv(envName)
+		if v == "" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Slice && strings.Contains(v, "\n") {
+			// lists are comma separated, or newline separated for values
+			// that contain commas
+			cfg[cfgName] = strings.Split(strings.TrimSpace(v), "\n")
+		} else {
+			cfg[cfgName] = v
+		}
+	}
+}
+
+// LoadFlagsForStruct copies the command line flags that were set into cfg,
+// so that they take precedence over config file and environment values.
+func (cfg EnvOptions) LoadFlagsForStruct(options interface{}, flagSet *flag.FlagSet) {
+	cfgNames := make(map[string]string)
+	typ := reflect.ValueOf(options).Elem().Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		flagName := field.Tag.Get("flag")
+		cfgName := field.Tag.Get("cfg")
+		if cfgName == "" {
+			cfgName = strings.Replace(flagName, "-", "_", -1)
+		}
+		if flagName != "" {
+			cfgNames[flagName] = cfgName
+		}
+	}
+	flagSet.Visit(func(f *flag.Flag) {
+		cfgName, ok := cfgNames[f.Name]
+		if !ok {
+			return
+		}
+		if a, ok := f.Value.(*StringArray); ok {
+			// String() joins with commas, which would split values such
+			// as "GET,HEAD=^/public/"
+			cfg[cfgName] = []string(*a)
+		} else {
+			cfg[cfgName] = f.Value.String()
+		}
+	})
+}
+
+// Resolve sets the options from cfg, which must already include the command
+// line flags (see LoadFlagsForStruct). options.Resolve decides whether a flag
+// was set by searching os.Args for its name, which mistakes -trusted-ip for
+// -trusted-ip-identity and -upstream for -canary-upstream, so it is run
+// with os.Args hidden.
+func (cfg EnvOptions) Resolve(opts interface{}, flagSet *flag.FlagSet) {
+	args := os.Args
+	os.Args = nil
+	defer func() { os.Args = args }()
+	options.Resolve(opts, flagSet, cfg)
+}
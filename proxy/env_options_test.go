@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+type envTest struct {
+	testField string `cfg:"target_field" env:"TEST_ENV_FIELD"`
+}
+
+func TestLoadEnvForStruct(t *testing.T) {
+
+	cfg := make(EnvOptions)
+	cfg.LoadEnvForStruct(&envTest{})
+
+	_, ok := cfg["target_field"]
+	assert.Equal(t, ok, false)
+
+	os.Setenv("TEST_ENV_FIELD", "1234abcd")
+	cfg.LoadEnvForStruct(&envTest{})
+	v := cfg["target_field"]
+	assert.Equal(t, v, "1234abcd")
+}
+
+func TestLoadEnvForStructDefaultsToFlagName(t *testing.T) {
+	opts := &struct {
+		Upstreams      []string `flag:"upstream" cfg:"upstreams"`
+		SkipAuthRegex  []string `flag:"skip-auth-regex" cfg:"skip_auth_regex"`
+		PassHostHeader bool     `flag:"pass-host-header" cfg:"pass_host_header"`
+	}{}
+	os.Setenv("OAUTH2_PROXY_UPSTREAM", "http://127.0.0.1:8080/,http://127.0.0.1:8081/api/")
+	os.Setenv("OAUTH2_PROXY_SKIP_AUTH_REGEX", "GET,HEAD=^/public/\n^/ping$\n")
+	os.Setenv("OAUTH2_PROXY_PASS_HOST_HEADER", "false")
+	defer os.Unsetenv("OAUTH2_PROXY_UPSTREAM")
+	defer os.Unsetenv("OAUTH2_PROXY_SKIP_AUTH_REGEX")
+	defer os.Unsetenv("OAUTH2_PROXY_PASS_HOST_HEADER")
+
+	cfg := make(EnvOptions)
+	cfg.LoadEnvForStruct(opts)
+	assert.Equal(t, "http://127.0.0.1:8080/,http://127.0.0.1:8081/api/", cfg["upstreams"])
+	assert.Equal(t, []string{"GET,HEAD=^/public/", "^/ping$"}, cfg["skip_auth_regex"])
+	assert.Equal(t, "false", cfg["pass_host_header"])
+}
+
+func TestFlagsOverrideConfigFile(t *testing.T) {
+	flagSet := flag.NewFlagSet("oauth2_proxy", flag.ContinueOnError)
+	upstreams := StringArray{}
+	canaryUpstreams := StringArray{}
+	skipAuthRegex := StringArray{}
+	trustedIPs := StringArray{}
+	flagSet.Var(&upstreams, "upstream", "")
+	flagSet.Var(&canaryUpstreams, "canary-upstream", "")
+	flagSet.Var(&skipAuthRegex, "skip-auth-regex", "")
+	flagSet.Var(&trustedIPs, "trusted-ip", "")
+	flagSet.String("trusted-ip-identity", "", "")
+	flagSet.Int("canary-percent", 0, "")
+	flagSet.Duration("cookie-expire", 0, "")
+	err := flagSet.Parse([]string{
+		"-canary-upstream=http://127.0.0.1:8081/",
+		"-skip-auth-regex=GET,HEAD=^/public/",
+		"-trusted-ip-identity=robot",
+		"-cookie-expire=1h",
+	})
+	assert.Equal(t, nil, err)
+
+	opts := &struct {
+		Upstreams         []string      `flag:"upstream" cfg:"upstreams"`
+		CanaryUpstreams   []string      `flag:"canary-upstream" cfg:"canary_upstreams"`
+		CanaryPercent     int           `flag:"canary-percent" cfg:"canary_percent"`
+		SkipAuthRegex     []string      `flag:"skip-auth-regex" cfg:"skip_auth_regex"`
+		TrustedIPs        []string      `flag:"trusted-ip" cfg:"trusted_ips"`
+		TrustedIPIdentity string        `flag:"trusted-ip-identity" cfg:"trusted_ip_identity"`
+		CookieExpire      time.Duration `flag:"cookie-expire" cfg:"cookie_expire"`
+	}{}
+	cfg := EnvOptions{
+		"upstreams":      []interface{}{"http://127.0.0.1:8080/"},
+		"canary_percent": int64(10),
+		"trusted_ips":    []interface{}{"10.0.0.0/8"},
+		"cookie_expire":  "168h",
+	}
+	cfg.LoadFlagsForStruct(opts, flagSet)
+	cfg.Resolve(opts, flagSet)
+
+	assert.Equal(t, []string{"http://127.0.0.1:8080/"}, opts.Upstreams)
+	assert.Equal(t, []string{"http://127.0.0.1:8081/"}, opts.CanaryUpstreams)
+	assert.Equal(t, 10, opts.CanaryPercent)
+	assert.Equal(t, []string{"GET,HEAD=^/public/"}, opts.SkipAuthRegex)
+	assert.Equal(t, []string{"10.0.0.0/8"}, opts.TrustedIPs)
+	assert.Equal(t, "robot", opts.TrustedIPIdentity)
+	assert.Equal(t, time.Duration(1)*time.Hour, opts.CookieExpire)
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIPFilter allows or denies requests by the country of their client IP,
+// looked up in a MaxMind format (GeoIP2 or GeoLite2 Country/City) database.
+type GeoIPFilter struct {
+	lookup func(ip net.IP) (string, error)
+	allow  map[string]bool
+	deny   map[string]bool
+}
+
+// NewGeoIPFilter opens dbFile. If allow is non-empty only clients from
+// those countries (ISO 3166-1 alpha-2 codes) are allowed; clients from
+// countries in deny are always rejected.
+func NewGeoIPFilter(dbFile string, allow, deny []string) (*GeoIPFilter, error) {
+	db, err := maxminddb.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(ip net.IP) (string, error) {
+		var record struct {
+			Country struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+		}
+		err := db.Lookup(ip, &record)
+		return record.Country.ISOCode, err
+	}
+	return newGeoIPFilter(lookup, allow, deny), nil
+}
+
+func newGeoIPFilter(lookup func(net.IP) (string, error), allow, deny []string) *GeoIPFilter {
+	f := &GeoIPFilter{
+		lookup: lookup,
+		allow:  make(map[string]bool),
+		deny:   make(map[string]bool),
+	}
+	for _, c := range allow {
+		f.allow[strings.ToUpper(c)] = true
+	}
+	for _, c := range deny {
+		f.deny[strings.ToUpper(c)] = true
+	}
+	return f
+}
+
+// Allowed reports whether ip may make requests, and the country it was
+// found in. Addresses with no country, such as private ranges, are only
+// allowed when there is no allow list.
+func (f *GeoIPFilter) Allowed(ip net.IP) (bool, string, error) {
+	if ip == nil {
+		return len(f.allow) == 0, "", nil
+	}
+	country, err := f.lookup(ip)
+	if err != nil {
+		return false, "", fmt.Errorf("error looking up %s: %s", ip, err)
+	}
+	if f.deny[country] {
+		return false, country, nil
+	}
+	if len(f.allow) != 0 && !f.allow[country] {
+		return false, country, nil
+	}
+	return true, country, nil
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+var testCountries = map[string]string{
+	"192.0.2.1":    "US",
+	"198.51.100.1": "FR",
+	"203.0.113.1":  "KP",
+}
+
+func testCountryLookup(ip net.IP) (string, error) {
+	if ip.String() == "192.0.2.99" {
+		return "", errors.New("corrupt database")
+	}
+	return testCountries[ip.String()], nil
+}
+
+func TestGeoIPFilterDeny(t *testing.T) {
+	f := newGeoIPFilter(testCountryLookup, nil, []string{"kp"})
+	ok, country, err := f.Allowed(net.ParseIP("203.0.113.1"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+	assert.Equal(t, "KP", country)
+
+	ok, _, _ = f.Allowed(net.ParseIP("192.0.2.1"))
+	assert.Equal(t, true, ok)
+	ok, _, _ = f.Allowed(net.ParseIP("10.0.0.1"))
+	assert.Equal(t, true, ok)
+}
+
+func TestGeoIPFilterAllow(t *testing.T) {
+	f := newGeoIPFilter(testCountryLookup, []string{"US", "FR"}, nil)
+	ok, _, _ := f.Allowed(net.ParseIP("192.0.2.1"))
+	assert.Equal(t, true, ok)
+	ok, _, _ = f.Allowed(net.ParseIP("198.51.100.1"))
+	assert.Equal(t, true, ok)
+	ok, _, _ = f.Allowed(net.ParseIP("203.0.113.1"))
+	assert.Equal(t, false, ok)
+	// no country is known for private addresses
+	ok, _, _ = f.Allowed(net.ParseIP("10.0.0.1"))
+	assert.Equal(t, false, ok)
+
+	_, _, err := f.Allowed(net.ParseIP("192.0.2.99"))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestGeoIPFilterBeforeAuthentication(t *testing.T) {
+	opts := NewOptions()
+	opts.Upstreams = append(opts.Upstreams, "http://localhost:8000/")
+	opts.ClientID = "bazquux"
+	opts.ClientSecret = "foobar"
+	opts.CookieSecret = "xyzzyplugh"
+	opts.TrustedProxyCIDRs = []string{"127.0.0.1"}
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	proxy.geoIP = newGeoIPFilter(testCountryLookup, nil, []string{"KP"})
+
+	get := func(forwardedFor string) int {
+		req, _ := http.NewRequest("GET", "/oauth2/sign_in", nil)
+		req.RemoteAddr = "127.0.0.1:4180"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	assert.Equal(t, 200, get("192.0.2.1"))
+	assert.Equal(t, 403, get("203.0.113.1"))
+}
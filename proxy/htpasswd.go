@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HtpasswdUser is what a password backend knows about a user, besides that
+// their password is right.
+type HtpasswdUser struct {
+	Groups []string
+	// Name is the user's display name
+	Name string
+}
+
+// passwordOnly adapts validate, which only checks passwords, to an
+// OauthProxy.HtpasswdValidator.
+func passwordOnly(validate func(user, password string) bool) func(user, password string) (*HtpasswdUser, bool) {
+	return func(user, password string) (*HtpasswdUser, bool) {
+		if !validate(user, password) {
+			return nil, false
+		}
+		return &HtpasswdUser{}, true
+	}
+}
+
+// lookup passwords in a htpasswd file
+// The entries must have been created with -B for bcrypt or -s for SHA
+// encryption
+
+type HtpasswdFile struct {
+	path  string
+	users unsafe.Pointer
+}
+
+func NewHtpasswdFromFile(path string) (*HtpasswdFile, error) {
+	h := &HtpasswdFile{path: path}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// loadHtpasswdFile is NewHtpasswdFromFile, but also watches the file and
+// reloads it when it changes, calling onUpdate after each reload.
+func loadHtpasswdFile(path string, done <-chan bool, onUpdate func()) (*HtpasswdFile, error) {
+	h, err := NewHtpasswdFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	WatchForUpdates(path, done, func() {
+		h.Reload()
+		onUpdate()
+	})
+	return h, nil
+}
+
+func NewHtpasswd(file io.Reader) (*HtpasswdFile, error) {
+	users, err := readHtpasswd(file)
+	if err != nil {
+		return nil, err
+	}
+	h := &HtpasswdFile{}
+	atomic.StorePointer(&h.users, unsafe.Pointer(&users))
+	return h, nil
+}
+
+func readHtpasswd(file io.Reader) (map[string]string, error) {
+	csv_reader := csv.NewReader(file)
+	csv_reader.Comma = ':'
+	csv_reader.Comment = '#'
+	csv_reader.TrimLeadingSpace = true
+
+	records, err := csv_reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]string)
+	for _, record := range records {
+		users[record[0]] = record[1]
+	}
+	return users, nil
+}
+
+// Reload re-reads the htpasswd file and atomically swaps in the new entries,
+// so a changed password or removed user takes effect at once. If the file
+// can't be read the current entries are kept.
+func (h *HtpasswdFile) Reload() {
+	if err := h.load(); err != nil {
+		logger.Errorf("error reloading htpasswd file %q, keeping %d existing entries: %s",
+			h.path, h.Len(), err)
+	}
+}
+
+func (h *HtpasswdFile) load() error {
+	r, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	users, err := readHtpasswd(r)
+	if err != nil {
+		return err
+	}
+	atomic.StorePointer(&h.users, unsafe.Pointer(&users))
+	logger.Printf("loaded %d entries from htpasswd file %q", len(users), h.path)
+	return nil
+}
+
+func (h *HtpasswdFile) Len() int {
+	return len(*(*map[string]string)(atomic.LoadPointer(&h.users)))
+}
+
+func (h *HtpasswdFile) Validate(user string, password string) bool {
+	users := *(*map[string]string)(atomic.LoadPointer(&h.users))
+	realPassword, exists := users[user]
+	if !exists {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(realPassword, "{SHA}"):
+		d := sha1.New()
+		d.Write([]byte(password))
+		if realPassword[5:] == base64.StdEncoding.EncodeToString(d.Sum(nil)) {
+			return true
+		}
+	case strings.HasPrefix(realPassword, "$2a$"), strings.HasPrefix(realPassword, "$2b$"),
+		strings.HasPrefix(realPassword, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(realPassword), []byte(password)) == nil
+	default:
+		logger.Printf("Invalid htpasswd entry for %s. Must be a bcrypt or SHA entry.", user)
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// htpasswdCacheSize is the number of validations HtpasswdProxy keeps.
+const htpasswdCacheSize = 100
+
+type htpasswdCacheEntry struct {
+	key string
+	// user is nil if the password was rejected
+	user    *HtpasswdUser
+	expires time.Time
+}
+
+// htpasswdCache holds the results of recent validations, evicting the least
+// recently used once it holds size entries, so a burst of new users only
+// pushes out the oldest results rather than everyone's.
+type htpasswdCache struct {
+	sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+func newHtpasswdCache(size int) *htpasswdCache {
+	return &htpasswdCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached result for key, if it hasn't expired: the user, or
+// nil if the password was rejected.
+func (c *htpasswdCache) Get(key string) (user *HtpasswdUser, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*htpasswdCacheEntry)
+	if !e.expires.After(c.now()) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.user, true
+}
+
+// Put caches user, or nil for a rejected password, as the result for key
+// for ttl.
+func (c *htpasswdCache) Put(key string, user *HtpasswdUser, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	expires := c.now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*htpasswdCacheEntry)
+		e.user, e.expires = user, expires
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&htpasswdCacheEntry{key: key, user: user, expires: expires})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Len returns the number of cached results, including expired ones not yet
+// evicted.
+func (c *htpasswdCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.lru.Len()
+}
+
+func (c *htpasswdCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*htpasswdCacheEntry).key)
+}
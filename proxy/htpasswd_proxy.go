@@ -0,0 +1,359 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lookup passwords using external basic auth http server
+
+// htpasswdProxyTTL is how long a successful validation is cached.
+const htpasswdProxyTTL = time.Minute
+
+type HtpasswdProxy struct {
+	// backends are asked in order, each only if the ones before it fail,
+	// or all at once if parallel is set.
+	backends []*htpasswdBackend
+	parallel bool
+	client   *http.Client
+	// headers are added to every request, for example an API key
+	headers http.Header
+	// protocol is "basic" to check passwords by basic auth, or "json" to
+	// POST them and read the user's groups and name from the response.
+	protocol string
+	// negativeTTL is how long a rejected password is cached, so a client
+	// retrying it doesn't hit the backend each time; 0 to not cache.
+	negativeTTL time.Duration
+	cache       *htpasswdCache
+	// cacheKey is a random key for hashing credentials into cache keys, so
+	// passwords aren't kept in memory.
+	cacheKey []byte
+	// failOpen accepts any password while no backend can be reached,
+	// rather than rejecting them all.
+	failOpen bool
+	stats    *StatsD
+}
+
+// htpasswdBackend is one of the servers an HtpasswdProxy asks.
+type htpasswdBackend struct {
+	url string
+	// host names the backend in metrics
+	host string
+	// breaker, if set, stops asking the backend for a while after it has
+	// failed repeatedly.
+	breaker *CircuitBreaker
+}
+
+// htpasswdAnswer is a backend's answer about a password.
+type htpasswdAnswer struct {
+	// user is nil if the password was rejected
+	user *HtpasswdUser
+	// cache is set if a rejection may be cached
+	cache bool
+	// failed is set if the backend couldn't be asked
+	failed bool
+}
+
+func NewHtpasswdProxy(urls []string, timeout, negativeTTL time.Duration) (*HtpasswdProxy, error) {
+	h := &HtpasswdProxy{
+		client:      &http.Client{Timeout: timeout},
+		negativeTTL: negativeTTL,
+		cache:       newHtpasswdCache(htpasswdCacheSize),
+		cacheKey:    make([]byte, 32),
+	}
+	for _, urlStr := range urls {
+		u, err := url.Parse(urlStr)
+		if err != nil {
+			return nil, err
+		}
+		h.backends = append(h.backends, &htpasswdBackend{url: urlStr, host: u.Host})
+	}
+	if _, err := rand.Read(h.cacheKey); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// SetBreaker stops asking each backend for cooldown after threshold failed
+// requests in a row.
+func (h *HtpasswdProxy) SetBreaker(threshold int, cooldown time.Duration) {
+	for _, b := range h.backends {
+		b.breaker = NewCircuitBreaker(threshold, cooldown)
+	}
+}
+
+func (h *HtpasswdProxy) Validate(user string, password string) bool {
+	_, ok := h.Authenticate(user, password)
+	return ok
+}
+
+// Authenticate checks user's password with the backends, returning the
+// groups and name given for them with the "json" protocol.
+func (h *HtpasswdProxy) Authenticate(user string, password string) (*HtpasswdUser, bool) {
+	if u, ok := h.cachedValidate(user, password); ok {
+		h.stats.Incr("htpasswd.cache", "result:hit")
+		return u, u != nil
+	}
+	h.stats.Incr("htpasswd.cache", "result:miss")
+	var a htpasswdAnswer
+	if h.parallel {
+		a = h.askAll(user, password)
+	} else {
+		a = h.askInOrder(user, password)
+	}
+	if a.failed {
+		return h.unavailable(user)
+	}
+	if a.user != nil {
+		h.putValidateCache(user, password, a.user, htpasswdProxyTTL)
+		return a.user, true
+	}
+	if a.cache && h.negativeTTL > 0 {
+		h.putValidateCache(user, password, nil, h.negativeTTL)
+	}
+	return nil, false
+}
+
+// askInOrder returns the answer of the first backend that doesn't fail.
+func (h *HtpasswdProxy) askInOrder(user string, password string) htpasswdAnswer {
+	for _, b := range h.backends {
+		if a := h.ask(b, user, password); !a.failed {
+			return a
+		}
+	}
+	return htpasswdAnswer{failed: true}
+}
+
+// askAll asks every backend at once and returns the first answer from one
+// that doesn't fail.
+func (h *HtpasswdProxy) askAll(user string, password string) htpasswdAnswer {
+	answers := make(chan htpasswdAnswer, len(h.backends))
+	for _, b := range h.backends {
+		go func(b *htpasswdBackend) {
+			answers <- h.ask(b, user, password)
+		}(b)
+	}
+	for range h.backends {
+		if a := <-answers; !a.failed {
+			return a
+		}
+	}
+	return htpasswdAnswer{failed: true}
+}
+
+// ask checks user's password with b, recording how long it took and the
+// result.
+func (h *HtpasswdProxy) ask(b *htpasswdBackend, user string, password string) htpasswdAnswer {
+	if b.breaker != nil {
+		if ok, retryIn := b.breaker.Allow(); !ok {
+			logger.Errorf("htpasswd proxy %s is failing, not asking it for %s for another %s", b.url, user, retryIn)
+			h.stats.Incr("htpasswd.unavailable", "backend:"+b.host)
+			return htpasswdAnswer{failed: true}
+		}
+	}
+	start := time.Now()
+	a := h.request(b, user, password)
+	result := "rejected"
+	switch {
+	case a.failed:
+		result = "failed"
+	case a.user != nil:
+		result = "accepted"
+	}
+	h.stats.Timing("htpasswd.latency", time.Since(start), "backend:"+b.host, "result:"+result)
+	return a
+}
+
+// request sends the request checking user's password to b.
+func (h *HtpasswdProxy) request(b *htpasswdBackend, user string, password string) htpasswdAnswer {
+	req, err := h.newRequest(b.url, user, password)
+	if err != nil {
+		logger.Errorf("error building htpasswd proxy request for %s: %s", user, err)
+		return htpasswdAnswer{}
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		logger.Errorf("Invalid htpasswd proxy response for %s. user:%s error:%v", b.url, user, err)
+		b.failure()
+		return htpasswdAnswer{failed: true}
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 500 {
+		logger.Errorf("Invalid htpasswd proxy response for %s. user:%s status:%d", b.url, user, res.StatusCode)
+		b.failure()
+		return htpasswdAnswer{failed: true}
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		u, err := h.readUser(res)
+		if err != nil {
+			logger.Errorf("Invalid htpasswd proxy response for %s. user:%s error:%v", b.url, user, err)
+			b.failure()
+			return htpasswdAnswer{failed: true}
+		}
+		b.success()
+		return htpasswdAnswer{user: u, cache: true}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		b.success()
+		return htpasswdAnswer{cache: true}
+	}
+	// neither a rejection nor a failure, so not cached
+	b.success()
+	return htpasswdAnswer{}
+}
+
+// htpasswdProxyRequest and htpasswdProxyResponse are the bodies of the
+// "json" protocol.
+type htpasswdProxyRequest struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type htpasswdProxyResponse struct {
+	Allow  bool     `json:"allow"`
+	Groups []string `json:"groups"`
+	Name   string   `json:"name"`
+}
+
+// newRequest asks for user's password to be checked: with the "basic"
+// protocol, by a GET with basic auth that succeeds for the right password;
+// with "json", by POSTing the credentials.
+func (h *HtpasswdProxy) newRequest(backendURL string, user string, password string) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if h.protocol == "json" {
+		body, err := json.Marshal(htpasswdProxyRequest{User: user, Password: password})
+		if err != nil {
+			return nil, err
+		}
+		req, err = http.NewRequest("POST", backendURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req, err = http.NewRequest("GET", backendURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(user, password)
+	}
+	for k, v := range h.headers {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+// readUser reads the user from a 200 OK response, or nil if the "json"
+// protocol response denies them.
+func (h *HtpasswdProxy) readUser(res *http.Response) (*HtpasswdUser, error) {
+	if h.protocol != "json" {
+		return &HtpasswdUser{}, nil
+	}
+	var response htpasswdProxyResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&response); err != nil {
+		return nil, err
+	}
+	if !response.Allow {
+		return nil, nil
+	}
+	return &HtpasswdUser{Groups: response.Groups, Name: response.Name}, nil
+}
+
+// SetTLSConfig sets the CAs, client certificate and server name used for
+// https requests to the backend.
+func (h *HtpasswdProxy) SetTLSConfig(config *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	h.client.Transport = transport
+}
+
+// newHtpasswdProxyTLSConfig returns the TLS settings for an htpasswd proxy
+// behind internal PKI, or nil if none of them are set.
+func newHtpasswdProxyTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && serverName == "" {
+		return nil, nil
+	}
+	config := &tls.Config{ServerName: serverName}
+	if caFile != "" {
+		pool, err := loadClientCAs(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// parseHeaders parses "Name: value" headers.
+func parseHeaders(headers []string) (http.Header, error) {
+	h := make(http.Header)
+	for _, header := range headers {
+		i := strings.Index(header, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("%q is not \"Name: value\"", header)
+		}
+		h.Add(strings.TrimSpace(header[:i]), strings.TrimSpace(header[i+1:]))
+	}
+	return h, nil
+}
+
+func (b *htpasswdBackend) success() {
+	if b.breaker != nil {
+		b.breaker.Success()
+	}
+}
+
+func (b *htpasswdBackend) failure() {
+	if b.breaker != nil {
+		b.breaker.Failure()
+	}
+}
+
+// unavailable returns whether to accept user's password when no backend
+// can check it.
+func (h *HtpasswdProxy) unavailable(user string) (*HtpasswdUser, bool) {
+	if !h.failOpen {
+		return nil, false
+	}
+	logger.Printf("no htpasswd proxy available, accepting %s without checking the password", user)
+	return &HtpasswdUser{}, true
+}
+
+// cachedValidate returns the cached result of validating user and password,
+// if there is one: the user, or nil if the password was rejected.
+func (h *HtpasswdProxy) cachedValidate(user string, password string) (*HtpasswdUser, bool) {
+	return h.cache.Get(h.cacheKeyFor(user, password))
+}
+
+func (h *HtpasswdProxy) putValidateCache(user string, password string, u *HtpasswdUser, ttl time.Duration) {
+	h.cache.Put(h.cacheKeyFor(user, password), u, ttl)
+}
+
+// cacheKeyFor returns the HMAC of user and password, so neither can be
+// recovered from the cache without cacheKey.
+func (h *HtpasswdProxy) cacheKeyFor(user string, password string) string {
+	mac := hmac.New(sha256.New, h.cacheKey)
+	// the user is length prefixed, so "a\x00" + "b" and "a" + "\x00b" differ
+	mac.Write([]byte(strconv.Itoa(len(user)) + ":" + user + password))
+	return string(mac.Sum(nil))
+}
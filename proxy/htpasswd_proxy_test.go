@@ -0,0 +1,325 @@
+package proxy
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestHtpasswdProxy(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		count++
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != "testuser" || pass != "asdf" {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	h, err := NewHtpasswdProxy([]string{server.URL}, time.Second, 0)
+	assert.Equal(t, err, nil)
+
+	valid := h.Validate("testuser", "asdf")
+	assert.Equal(t, valid, true)
+
+	valid = h.Validate("notfound", "asdf")
+	assert.Equal(t, valid, false)
+
+	valid = h.Validate("testuser", "asdf")
+	assert.Equal(t, valid, true)
+
+	if count != 2 {
+		t.Fatal("consecutive auth should be cached:", count)
+	}
+}
+
+func TestHtpasswdProxyNegativeCache(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		count++
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != "testuser" || pass != "asdf" {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	h, err := NewHtpasswdProxy([]string{server.URL}, time.Second, time.Minute)
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, false, h.Validate("testuser", "wrong"))
+	assert.Equal(t, false, h.Validate("testuser", "wrong"))
+	assert.Equal(t, 1, count)
+	// only the failed password is cached
+	assert.Equal(t, true, h.Validate("testuser", "asdf"))
+	assert.Equal(t, 2, count)
+
+	// expired failures are checked again
+	h.putValidateCache("testuser", "wrong", nil, -time.Second)
+	assert.Equal(t, false, h.Validate("testuser", "wrong"))
+	assert.Equal(t, 3, count)
+}
+
+func TestHtpasswdCache(t *testing.T) {
+	c := newHtpasswdCache(2)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	user := &HtpasswdUser{Name: "Test User"}
+
+	c.Put("a", user, time.Minute)
+	c.Put("b", nil, time.Minute)
+	u, ok := c.Get("a")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, user, u)
+	// b is now the least recently used
+	c.Put("c", user, time.Minute)
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get("b")
+	assert.Equal(t, false, ok)
+	_, ok = c.Get("a")
+	assert.Equal(t, true, ok)
+	u, ok = c.Get("c")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, user, u)
+
+	now = now.Add(time.Minute)
+	_, ok = c.Get("a")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestHtpasswdProxyUnavailable(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		count++
+		if req.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	h, err := NewHtpasswdProxy([]string{server.URL}, time.Second, time.Minute)
+	assert.Equal(t, err, nil)
+	h.SetBreaker(2, time.Minute)
+
+	// errors aren't cached, but trip the breaker
+	assert.Equal(t, false, h.Validate("testuser", "asdf"))
+	assert.Equal(t, false, h.Validate("testuser", "asdf"))
+	assert.Equal(t, 2, count)
+	assert.Equal(t, false, h.Validate("testuser", "asdf"))
+	assert.Equal(t, 2, count)
+
+	h.failOpen = true
+	assert.Equal(t, true, h.Validate("testuser", "asdf"))
+	assert.Equal(t, 2, count)
+
+	slow, err := NewHtpasswdProxy([]string{server.URL + "/slow"}, 10*time.Millisecond, 0)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, false, slow.Validate("testuser", "asdf"))
+
+	// a connection error doesn't panic
+	server.Close()
+	down, err := NewHtpasswdProxy([]string{server.URL}, time.Second, 0)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, false, down.Validate("testuser", "asdf"))
+}
+
+func TestHtpasswdProxyTLSAndHeaders(t *testing.T) {
+	var serverName string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		serverName = req.TLS.ServerName
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != "testuser" || pass != "asdf" || req.Header.Get("X-Api-Key") != "secret" {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "htpasswd_proxy_ca")
+	assert.Equal(t, nil, err)
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	f.Close()
+
+	opts := testOptions()
+	opts.HtpasswdProxy = server.URL
+	opts.HtpasswdProxyCAFile = f.Name()
+	opts.HtpasswdProxyServerName = "example.com"
+	opts.HtpasswdProxyHeaders = []string{"X-Api-Key: secret"}
+	assert.Equal(t, nil, opts.Validate())
+
+	h, err := NewHtpasswdProxy([]string{server.URL}, time.Second, 0)
+	assert.Equal(t, err, nil)
+	// the test server's certificate isn't trusted by default
+	assert.Equal(t, false, h.Validate("testuser", "asdf"))
+	h.SetTLSConfig(opts.htpasswdProxyTLS)
+	assert.Equal(t, false, h.Validate("testuser", "asdf"))
+	h.headers = opts.htpasswdProxyHeaders
+	assert.Equal(t, true, h.Validate("testuser", "asdf"))
+	assert.Equal(t, "example.com", serverName)
+}
+
+func TestHtpasswdProxyTLSOptions(t *testing.T) {
+	opts := testOptions()
+	opts.HtpasswdProxyCertFile = "cert.pem"
+	opts.HtpasswdProxyHeaders = []string{"X-Api-Key"}
+	err := opts.Validate()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), "htpasswd-proxy-cert-file and htpasswd-proxy-key-file must be set together"))
+	assert.Equal(t, true, strings.Contains(err.Error(), `invalid htpasswd-proxy-header: "X-Api-Key" is not "Name: value"`))
+
+	opts = testOptions()
+	opts.HtpasswdProxyCAFile = "/nonexistent/ca.pem"
+	err = opts.Validate()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), "error loading htpasswd-proxy TLS settings: open /nonexistent/ca.pem"))
+}
+
+func TestHtpasswdProxyCacheKey(t *testing.T) {
+	h, err := NewHtpasswdProxy([]string{"http://localhost/"}, time.Second, 0)
+	assert.Equal(t, err, nil)
+	h.putValidateCache("testuser", "asdf", &HtpasswdUser{}, time.Minute)
+	for key := range h.cache.entries {
+		assert.Equal(t, false, strings.Contains(key, "asdf"))
+		assert.Equal(t, false, strings.Contains(key, "testuser"))
+	}
+	u, ok := h.cachedValidate("testuser", "asdf")
+	assert.Equal(t, true, ok)
+	assert.NotEqual(t, nil, u)
+	_, ok = h.cachedValidate("testuser:", "asdf")
+	assert.Equal(t, false, ok)
+	_, ok = h.cachedValidate("testuser", ":asdf")
+	assert.Equal(t, false, ok)
+	h.putValidateCache("a\x00", "b", &HtpasswdUser{}, time.Minute)
+	_, ok = h.cachedValidate("a", "\x00b")
+	assert.Equal(t, false, ok)
+
+	// each instance has its own key
+	other, err := NewHtpasswdProxy([]string{"http://localhost/"}, time.Second, 0)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, h.cacheKeyFor("testuser", "asdf"), other.cacheKeyFor("testuser", "asdf"))
+}
+
+func TestHtpasswdProxyJSON(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		count++
+		var r htpasswdProxyRequest
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		json.NewDecoder(req.Body).Decode(&r)
+		switch {
+		case r.User == "broken":
+			res.Write([]byte("not json"))
+		case r.User == "testuser" && r.Password == "asdf":
+			json.NewEncoder(res).Encode(htpasswdProxyResponse{Allow: true, Groups: []string{"admins"}, Name: "Test User"})
+		default:
+			json.NewEncoder(res).Encode(htpasswdProxyResponse{Allow: false})
+		}
+	}))
+	defer server.Close()
+	h, err := NewHtpasswdProxy([]string{server.URL}, time.Second, time.Minute)
+	assert.Equal(t, err, nil)
+	h.protocol = "json"
+
+	u, ok := h.Authenticate("testuser", "asdf")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, &HtpasswdUser{Groups: []string{"admins"}, Name: "Test User"}, u)
+	// the groups and name are cached too
+	u, ok = h.Authenticate("testuser", "asdf")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "Test User", u.Name)
+	assert.Equal(t, 1, count)
+
+	// a denial is cached like a 401
+	assert.Equal(t, false, h.Validate("testuser", "wrong"))
+	assert.Equal(t, false, h.Validate("testuser", "wrong"))
+	assert.Equal(t, 2, count)
+
+	// an invalid response is a failure, which isn't cached
+	assert.Equal(t, false, h.Validate("broken", "asdf"))
+	assert.Equal(t, false, h.Validate("broken", "asdf"))
+	assert.Equal(t, 4, count)
+}
+
+func TestHtpasswdProxyIdentityHeaders(t *testing.T) {
+	opts := testOptions()
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	proxy.HtpasswdValidator = func(user, password string) (*HtpasswdUser, bool) {
+		return &HtpasswdUser{Groups: []string{"admins"}, Name: "Test User"}, password == "asdf"
+	}
+	var upstream *http.Request
+	proxy.serveMux = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+	})
+
+	req, _ := http.NewRequest("GET", "/foo", nil)
+	req.SetBasicAuth("testuser", "asdf")
+	req.Header.Set("X-Forwarded-Name", "Someone Else")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "admins", upstream.Header.Get("X-Forwarded-Groups"))
+	assert.Equal(t, "Test User", upstream.Header.Get("X-Forwarded-Name"))
+
+	proxy.nameHeader = "X-Display-Name"
+	req, _ = http.NewRequest("GET", "/foo", nil)
+	req.SetBasicAuth("testuser", "asdf")
+	req.Header.Set("X-Display-Name", "Someone Else")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "Test User", upstream.Header.Get("X-Display-Name"))
+	assert.Equal(t, "", upstream.Header.Get("X-Forwarded-Name"))
+}
+
+func TestHtpasswdProxyFailover(t *testing.T) {
+	var mu sync.Mutex
+	asked := map[string]int{}
+	backend := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			asked[name]++
+			mu.Unlock()
+			res.WriteHeader(status)
+		}))
+	}
+	down := backend("down", http.StatusBadGateway)
+	defer down.Close()
+	up := backend("up", http.StatusOK)
+	defer up.Close()
+	other := backend("other", http.StatusOK)
+	defer other.Close()
+
+	h, err := NewHtpasswdProxy([]string{down.URL, up.URL, other.URL}, time.Second, 0)
+	assert.Equal(t, err, nil)
+	h.SetBreaker(1, time.Minute)
+	assert.Equal(t, true, h.Validate("testuser", "asdf"))
+	assert.Equal(t, map[string]int{"down": 1, "up": 1}, asked)
+	// the failed backend's breaker has tripped, so it's skipped
+	assert.Equal(t, true, h.Validate("testuser", "other"))
+	assert.Equal(t, map[string]int{"down": 1, "up": 2}, asked)
+
+	h, err = NewHtpasswdProxy([]string{down.URL, down.URL}, time.Second, 0)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, false, h.Validate("testuser", "asdf"))
+
+	h, err = NewHtpasswdProxy([]string{down.URL, other.URL}, time.Second, 0)
+	assert.Equal(t, err, nil)
+	h.parallel = true
+	assert.Equal(t, true, h.Validate("testuser", "asdf"))
+	mu.Lock()
+	assert.Equal(t, 1, asked["other"])
+	mu.Unlock()
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestHtpasswd(t *testing.T) {
+	file := bytes.NewBuffer([]byte("testuser:{SHA}PaVBVZkYqAjCQCu6UBL2xgsnZhw=\n"))
+	h, err := NewHtpasswd(file)
+	assert.Equal(t, err, nil)
+
+	valid := h.Validate("testuser", "asdf")
+	assert.Equal(t, valid, true)
+}
+
+func TestHtpasswdBcrypt(t *testing.T) {
+	file := bytes.NewBuffer([]byte("testuser:$2y$04$TfX73zC/MbvxiMpD8zGHseYCIwt91oIlYzM2eAmTu1aWe7AGH4Kta\n" +
+		"legacy:{SHA}PaVBVZkYqAjCQCu6UBL2xgsnZhw=\nplain:asdf\n"))
+	h, err := NewHtpasswd(file)
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, true, h.Validate("testuser", "asdf"))
+	assert.Equal(t, false, h.Validate("testuser", "wrong"))
+	assert.Equal(t, true, h.Validate("legacy", "asdf"))
+	// plain text (and crypt or MD5) entries are rejected
+	assert.Equal(t, false, h.Validate("plain", "asdf"))
+	assert.Equal(t, false, h.Validate("nobody", "asdf"))
+}
+
+func TestHtpasswdReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "test_htpasswd_")
+	assert.Equal(t, nil, err)
+	defer os.Remove(f.Name())
+	f.WriteString("testuser:{SHA}PaVBVZkYqAjCQCu6UBL2xgsnZhw=\n")
+	f.Close()
+
+	h, err := NewHtpasswdFromFile(f.Name())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, h.Validate("testuser", "asdf"))
+
+	ioutil.WriteFile(f.Name(), []byte("otheruser:{SHA}PaVBVZkYqAjCQCu6UBL2xgsnZhw=\n"), 0600)
+	h.Reload()
+	assert.Equal(t, false, h.Validate("testuser", "asdf"))
+	assert.Equal(t, true, h.Validate("otheruser", "asdf"))
+
+	// a file that can't be read keeps the current entries
+	os.Remove(f.Name())
+	h.Reload()
+	assert.Equal(t, 1, h.Len())
+	assert.Equal(t, true, h.Validate("otheruser", "asdf"))
+}
@@ -0,0 +1,50 @@
+// +build go1.3,!plan9,!solaris
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestHtpasswdWatchForUpdates(t *testing.T) {
+	f, err := ioutil.TempFile("", "test_htpasswd_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("testuser:{SHA}PaVBVZkYqAjCQCu6UBL2xgsnZhw=\n")
+	f.Close()
+
+	done := make(chan bool)
+	defer close(done)
+	updated := make(chan bool, 1)
+	h, err := loadHtpasswdFile(f.Name(), done, func() {
+		select {
+		case updated <- true:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Validate("testuser", "asdf") {
+		t.Error("user in file should validate")
+	}
+
+	// replace the file, as editors and htpasswd itself do
+	replacement := f.Name() + "-new"
+	ioutil.WriteFile(replacement, []byte("otheruser:{SHA}PaVBVZkYqAjCQCu6UBL2xgsnZhw=\n"), 0600)
+	if err := os.Rename(replacement, f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	<-updated
+
+	if h.Validate("testuser", "asdf") {
+		t.Error("user removed from file should not validate")
+	}
+	if !h.Validate("otheruser", "asdf") {
+		t.Error("user added to file should validate")
+	}
+}
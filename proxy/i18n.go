@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// translations of the built-in sign in and error page strings, by locale.
+// Strings without a translation, including English ones, are shown as is.
+var translations = map[string]map[string]string{
+	"de": {
+		"Sign In":                          "Anmelden",
+		"Sign in with a %s Account":        "Mit einem %s-Konto anmelden",
+		"Username:":                        "Benutzername:",
+		"Password:":                        "Passwort:",
+		"Authenticator code (if enabled):": "Authenticator-Code (falls aktiviert):",
+		"Secured with":                     "Geschützt mit",
+		"version":                          "Version",
+
+		"Permission Denied":   "Zugriff verweigert",
+		"Internal Error":      "Interner Fehler",
+		"Too Many Requests":   "Zu viele Anfragen",
+		"Service Unavailable": "Dienst nicht verfügbar",
+
+		"Invalid Account":                            "Ungültiges Konto",
+		"Your account has been blocked":              "Ihr Konto wurde gesperrt",
+		"You are not authorized to access this page": "Sie sind nicht berechtigt, diese Seite aufzurufen",
+		"Access is not permitted from your location": "Der Zugriff von Ihrem Standort aus ist nicht gestattet",
+		"Your email address has not been verified":   "Ihre E-Mail-Adresse wurde nicht bestätigt",
+		"Error authorizing request":                  "Fehler bei der Autorisierung der Anfrage",
+		"Error checking client location":             "Fehler beim Prüfen Ihres Standorts",
+		"You are making requests too quickly. Please slow down.": "Sie senden Anfragen zu schnell. " +
+			"Bitte warten Sie einen Moment.",
+		overloadedMessage: "Der Server ist überlastet. Bitte versuchen Sie es später erneut.",
+		mfaRequiredMessage: "Diese Seite erfordert eine Multi-Faktor-Authentifizierung. Bitte aktivieren " +
+			"Sie die Bestätigung in zwei Schritten für Ihr Konto und melden Sie sich erneut an.",
+	},
+	"es": {
+		"Sign In":                          "Iniciar sesión",
+		"Sign in with a %s Account":        "Iniciar sesión con una cuenta de %s",
+		"Username:":                        "Usuario:",
+		"Password:":                        "Contraseña:",
+		"Authenticator code (if enabled):": "Código de autenticación (si está activado):",
+		"Secured with":                     "Protegido con",
+		"version":                          "versión",
+
+		"Permission Denied":   "Permiso denegado",
+		"Internal Error":      "Error interno",
+		"Too Many Requests":   "Demasiadas solicitudes",
+		"Service Unavailable": "Servicio no disponible",
+
+		"Invalid Account":                            "Cuenta no válida",
+		"Your account has been blocked":              "Su cuenta ha sido bloqueada",
+		"You are not authorized to access this page": "No está autorizado para acceder a esta página",
+		"Access is not permitted from your location": "No se permite el acceso desde su ubicación",
+		"Your email address has not been verified":   "Su dirección de correo electrónico no ha sido verificada",
+		"Error authorizing request":                  "Error al autorizar la solicitud",
+		"Error checking client location":             "Error al comprobar su ubicación",
+		"You are making requests too quickly. Please slow down.": "Está realizando solicitudes demasiado " +
+			"rápido. Por favor, espere un momento.",
+		overloadedMessage: "El servidor está sobrecargado. Vuelva a intentarlo más tarde.",
+		mfaRequiredMessage: "Este sitio requiere autenticación multifactor. Active la verificación en dos " +
+			"pasos en su cuenta y vuelva a iniciar sesión.",
+	},
+	"fr": {
+		"Sign In":                          "Se connecter",
+		"Sign in with a %s Account":        "Se connecter avec un compte %s",
+		"Username:":                        "Nom d'utilisateur :",
+		"Password:":                        "Mot de passe :",
+		"Authenticator code (if enabled):": "Code d'authentification (si activé) :",
+		"Secured with":                     "Sécurisé par",
+		"version":                          "version",
+
+		"Permission Denied":   "Accès refusé",
+		"Internal Error":      "Erreur interne",
+		"Too Many Requests":   "Trop de requêtes",
+		"Service Unavailable": "Service indisponible",
+
+		"Invalid Account":                            "Compte non valide",
+		"Your account has been blocked":              "Votre compte a été bloqué",
+		"You are not authorized to access this page": "Vous n'êtes pas autorisé à accéder à cette page",
+		"Access is not permitted from your location": "L'accès n'est pas autorisé depuis votre emplacement",
+		"Your email address has not been verified":   "Votre adresse e-mail n'a pas été vérifiée",
+		"Error authorizing request":                  "Erreur lors de l'autorisation de la requête",
+		"Error checking client location":             "Erreur lors de la vérification de votre emplacement",
+		"You are making requests too quickly. Please slow down.": "Vous envoyez des requêtes trop " +
+			"rapidement. Veuillez ralentir.",
+		overloadedMessage: "Le serveur est surchargé. Veuillez réessayer plus tard.",
+		mfaRequiredMessage: "Ce site exige une authentification multifacteur. Veuillez activer la validation " +
+			"en deux étapes pour votre compte et vous reconnecter.",
+	},
+	"ja": {
+		"Sign In":                          "サインイン",
+		"Sign in with a %s Account":        "%s アカウントでサインイン",
+		"Username:":                        "ユーザー名:",
+		"Password:":                        "パスワード:",
+		"Authenticator code (if enabled):": "認証コード（有効な場合）:",
+		"Secured with":                     "保護:",
+		"version":                          "バージョン",
+
+		"Permission Denied":   "アクセスが拒否されました",
+		"Internal Error":      "内部エラー",
+		"Too Many Requests":   "リクエストが多すぎます",
+		"Service Unavailable": "サービスを利用できません",
+
+		"Invalid Account":                            "無効なアカウントです",
+		"Your account has been blocked":              "このアカウントはブロックされています",
+		"You are not authorized to access this page": "このページへのアクセス権限がありません",
+		"Access is not permitted from your location": "お使いの地域からのアクセスは許可されていません",
+		"Your email address has not been verified":   "メールアドレスが確認されていません",
+		"Error authorizing request":                  "リクエストの認可中にエラーが発生しました",
+		"Error checking client location":             "接続元の確認中にエラーが発生しました",
+		"You are making requests too quickly. Please slow down.": "リクエストの頻度が高すぎます。" +
+			"しばらくしてから再度お試しください。",
+		overloadedMessage: "サーバーが混み合っています。しばらくしてから再度お試しください。",
+		mfaRequiredMessage: "このサイトでは多要素認証が必要です。アカウントで2段階認証を有効にしてから、" +
+			"もう一度サインインしてください。",
+	},
+}
+
+const mfaRequiredMessage = "This site requires multi-factor authentication. " +
+	"Please enable two-step verification for your account and sign in again."
+
+// translate returns locale's translation of s, formatted with args if there
+// are any. It is the "tr" template function: {{tr .Locale "Sign In"}}.
+func translate(locale, s string, args ...interface{}) string {
+	if t, ok := translations[locale][s]; ok {
+		s = t
+	}
+	if len(args) != 0 {
+		return fmt.Sprintf(s, args...)
+	}
+	return s
+}
+
+// localizedTemplateName matches custom templates for a locale, such as
+// sign_in.de.html or error.pt-br.html.
+var localizedTemplateName = regexp.MustCompile(`^(?:sign_in|error)\.([a-z]{2,3}(?:-[a-z0-9]+)*)\.html$`)
+
+// localeSet is the languages the sign in and error pages can be shown in:
+// those with built-in translations or custom templates, and the default.
+type localeSet struct {
+	available map[string]bool
+	fallback  string
+}
+
+func newLocaleSet(templates *template.Template, fallback string) *localeSet {
+	fallback = strings.ToLower(fallback)
+	available := map[string]bool{"en": true, fallback: true}
+	for locale := range translations {
+		available[locale] = true
+	}
+	for _, t := range templates.Templates() {
+		if m := localizedTemplateName.FindStringSubmatch(t.Name()); m != nil {
+			available[m[1]] = true
+		}
+	}
+	return &localeSet{available: available, fallback: fallback}
+}
+
+// negotiate picks the locale for req by its Accept-Language header.
+func (l *localeSet) negotiate(req *http.Request) string {
+	if l == nil {
+		return "en"
+	}
+	return negotiateLocale(req.Header.Get("Accept-Language"), l.available, l.fallback)
+}
+
+// negotiateLocale returns the first available language of an
+// Accept-Language header, in order of preference, matching "de-at" to "de"
+// if need be, or else fallback.
+func negotiateLocale(header string, available map[string]bool, fallback string) string {
+	type preference struct {
+		tag string
+		q   float64
+	}
+	var prefs []preference
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		if q := qValue(fields[1:]); q > 0 {
+			prefs = append(prefs, preference{tag, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	for _, p := range prefs {
+		if available[p.tag] {
+			return p.tag
+		}
+		if i := strings.Index(p.tag, "-"); i > 0 && available[p.tag[:i]] {
+			return p.tag[:i]
+		}
+	}
+	return fallback
+}
+
+// localizedTemplate returns the name of templates' variant of the template
+// name for locale, such as "sign_in.de.html", if there is one, or else name.
+func localizedTemplate(templates *template.Template, name, locale string) string {
+	localized := strings.TrimSuffix(name, ".html") + "." + locale + ".html"
+	if templates.Lookup(localized) != nil {
+		return localized
+	}
+	return name
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestNegotiateLocale(t *testing.T) {
+	available := map[string]bool{"en": true, "de": true, "fr": true}
+	for header, locale := range map[string]string{
+		"":                          "en",
+		"de":                        "de",
+		"de-AT,de;q=0.9":            "de",
+		"nl,fr;q=0.8,de;q=0.9":      "de",
+		"nl, *;q=0.5":               "en",
+		"fr;q=0, de;q=0.1":          "de",
+		"FR-ca;q=0.7, es;q=1, nl":   "fr",
+		"en-US,en;q=0.9,de;q=0.8":   "en",
+		"ja,de;q=invalid,fr;q=0.5":  "de",
+		"pt-br;q=0.9, pt;q=0.8, *;": "en",
+	} {
+		assert.Equal(t, locale, negotiateLocale(header, available, "en"))
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	assert.Equal(t, "Anmelden", translate("de", "Sign In"))
+	assert.Equal(t, "Sign In", translate("en", "Sign In"))
+	assert.Equal(t, "Sign In", translate("xx", "Sign In"))
+	assert.Equal(t, "Se connecter avec un compte Google", translate("fr", "Sign in with a %s Account", "Google"))
+	assert.Equal(t, "no translation", translate("de", "no translation"))
+}
+
+func TestLocalizedPages(t *testing.T) {
+	opts := testOptions()
+	opts.DefaultLocale = "fr"
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	signIn := func(acceptLanguage string) string {
+		req, _ := http.NewRequest("GET", "/oauth2/sign_in", nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Body.String()
+	}
+
+	body := signIn("de-DE,de;q=0.9,en;q=0.8")
+	assert.Equal(t, true, strings.Contains(body, `<html lang="de"`))
+	assert.Equal(t, true, strings.Contains(body, "Mit einem Google-Konto anmelden"))
+	body = signIn("nl")
+	assert.Equal(t, true, strings.Contains(body, "Se connecter avec un compte Google"))
+	body = signIn("en")
+	assert.Equal(t, true, strings.Contains(body, "Sign in with a Google Account"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "es")
+	rw := httptest.NewRecorder()
+	proxy.ErrorPage(rw, req, 403, "Permission Denied", "Invalid Account")
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), "403 Permiso denegado"))
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), "Cuenta no válida"))
+}
+
+func TestLocalizedCustomTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_templates_")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "sign_in.html"), []byte(`{{define "sign_in.html"}}hello{{end}}`), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "sign_in.nl.html"), []byte(`hallo {{tr .Locale "Sign In"}}`), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{define "error.html"}}{{.Title}}{{end}}`), 0600)
+
+	opts := testOptions()
+	opts.CustomTemplatesDir = dir
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	for acceptLanguage, body := range map[string]string{
+		"nl-BE":        "hallo Sign In",
+		"de;q=0.5, nl": "hallo Sign In",
+		"de":           "hello",
+	} {
+		req, _ := http.NewRequest("GET", "/oauth2/sign_in", nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		assert.Equal(t, body, rw.Body.String())
+	}
+}
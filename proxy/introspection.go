@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const maxIntrospectionCacheSize = 10000
+
+// TokenIntrospector validates opaque bearer tokens with an OAuth 2.0 token
+// introspection endpoint (RFC 7662). Only tokens issued to audience, as
+// their client_id or in their aud, count as active, since the endpoint
+// answers for every client of the authorization server. Active tokens are
+// cached for the configured TTL, or until they expire if that is sooner.
+type TokenIntrospector struct {
+	url          string
+	clientID     string
+	clientSecret string
+	audience     string
+	ttl          time.Duration
+	client       *http.Client
+
+	cache struct {
+		sync.Mutex
+		m map[[sha256.Size]byte]*introspectionResult
+	}
+}
+
+type introspectionResult struct {
+	Active   bool        `json:"active"`
+	Subject  string      `json:"sub"`
+	Username string      `json:"username"`
+	Email    string      `json:"email"`
+	Scope    string      `json:"scope"`
+	Expiry   int64       `json:"exp"`
+	Groups   []string    `json:"groups"`
+	ClientID string      `json:"client_id"`
+	Audience interface{} `json:"aud"`
+
+	cachedUntil time.Time
+}
+
+// Identity returns the email claim if present, or else the username or
+// subject.
+func (r *introspectionResult) Identity() string {
+	switch {
+	case r.Email != "":
+		return r.Email
+	case r.Username != "":
+		return r.Username
+	}
+	return r.Subject
+}
+
+func NewTokenIntrospector(url, clientID, clientSecret, audience string, ttl time.Duration) *TokenIntrospector {
+	t := &TokenIntrospector{
+		url:          url,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		audience:     audience,
+		ttl:          ttl,
+		client:       &http.Client{Timeout: time.Duration(10) * time.Second},
+	}
+	t.cache.m = make(map[[sha256.Size]byte]*introspectionResult)
+	return t
+}
+
+func (t *TokenIntrospector) Introspect(token string) (*introspectionResult, error) {
+	key := sha256.Sum256([]byte(token))
+	if r := t.cached(key); r != nil {
+		return r, nil
+	}
+
+	params := url.Values{}
+	params.Add("token", token)
+	params.Add("token_type_hint", "access_token")
+	req, err := http.NewRequest("POST", t.url, bytes.NewBufferString(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(t.clientID, t.clientSecret)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("introspection request returned status %d - %s", resp.StatusCode, body)
+	}
+	r := &introspectionResult{}
+	if err := json.Unmarshal(body, r); err != nil {
+		return nil, err
+	}
+	if r.Active && r.ClientID != t.audience && !audienceIncludes(r.Audience, t.audience) {
+		logger.Printf("bearer token for %q was issued to client %q", r.Identity(), r.ClientID)
+		r.Active = false
+	}
+	if r.Active {
+		t.store(key, r)
+	}
+	return r, nil
+}
+
+func (t *TokenIntrospector) cached(key [sha256.Size]byte) *introspectionResult {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+	r, ok := t.cache.m[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(r.cachedUntil) {
+		delete(t.cache.m, key)
+		return nil
+	}
+	return r
+}
+
+func (t *TokenIntrospector) store(key [sha256.Size]byte, r *introspectionResult) {
+	now := time.Now()
+	r.cachedUntil = now.Add(t.ttl)
+	if r.Expiry != 0 && time.Unix(r.Expiry, 0).Before(r.cachedUntil) {
+		r.cachedUntil = time.Unix(r.Expiry, 0)
+	}
+
+	t.cache.Lock()
+	defer t.cache.Unlock()
+	if len(t.cache.m) >= maxIntrospectionCacheSize {
+		for k, v := range t.cache.m {
+			if now.After(v.cachedUntil) {
+				delete(t.cache.m, k)
+			}
+		}
+		if len(t.cache.m) >= maxIntrospectionCacheSize {
+			t.cache.m = make(map[[sha256.Size]byte]*introspectionResult)
+		}
+	}
+	t.cache.m[key] = r
+}
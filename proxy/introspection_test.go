@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func testIntrospectionServer(count *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*count++
+		user, pass, _ := r.BasicAuth()
+		if user != "client" || pass != "secret" {
+			w.WriteHeader(401)
+			return
+		}
+		switch r.FormValue("token") {
+		case "good":
+			w.Write([]byte(`{"active": true, "client_id": "client", "username": "mbland", "email": "michael.bland@gsa.gov"}`))
+		case "for-aud":
+			w.Write([]byte(`{"active": true, "client_id": "api", "aud": ["client"], "email": "michael.bland@gsa.gov"}`))
+		case "other-client":
+			w.Write([]byte(`{"active": true, "client_id": "other", "aud": "other", "email": "michael.bland@gsa.gov"}`))
+		default:
+			w.Write([]byte(`{"active": false}`))
+		}
+	}))
+}
+
+func TestTokenIntrospector(t *testing.T) {
+	count := 0
+	server := testIntrospectionServer(&count)
+	defer server.Close()
+
+	i := NewTokenIntrospector(server.URL, "client", "secret", "client", time.Minute)
+	r, err := i.Introspect("good")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, r.Active)
+	assert.Equal(t, "michael.bland@gsa.gov", r.Identity())
+
+	r, err = i.Introspect("good")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, r.Active)
+	assert.Equal(t, 1, count)
+
+	r, err = i.Introspect("bad")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, r.Active)
+	r, err = i.Introspect("bad")
+	assert.Equal(t, 3, count)
+}
+
+func TestTokenIntrospectorAudience(t *testing.T) {
+	count := 0
+	server := testIntrospectionServer(&count)
+	defer server.Close()
+
+	i := NewTokenIntrospector(server.URL, "client", "secret", "client", time.Minute)
+	r, err := i.Introspect("for-aud")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, r.Active)
+
+	// active, but for another client of the authorization server
+	r, err = i.Introspect("other-client")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, r.Active)
+	r, err = i.Introspect("other-client")
+	assert.Equal(t, false, r.Active)
+	assert.Equal(t, 3, count)
+}
+
+func TestTokenIntrospectorCacheRespectsExpiry(t *testing.T) {
+	i := NewTokenIntrospector("unused", "client", "secret", "client", time.Hour)
+	key := [32]byte{1}
+	i.store(key, &introspectionResult{Active: true, Expiry: time.Now().Add(-time.Second).Unix()})
+	assert.Equal(t, (*introspectionResult)(nil), i.cached(key))
+}
+
+func TestTokenIntrospectorError(t *testing.T) {
+	count := 0
+	server := testIntrospectionServer(&count)
+	defer server.Close()
+
+	i := NewTokenIntrospector(server.URL, "client", "wrong", "client", time.Minute)
+	_, err := i.Introspect("good")
+	assert.NotEqual(t, nil, err)
+}
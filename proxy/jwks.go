@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JSONWebKeySet holds the public keys of a JWKS document keyed by kid.
+type JSONWebKeySet struct {
+	Keys map[string]crypto.PublicKey
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func FetchJSONWebKeySet(url string) (*JSONWebKeySet, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("jwks request to %s returned status %d", url, resp.StatusCode)
+	}
+	return ParseJSONWebKeySet(body)
+}
+
+func ParseJSONWebKeySet(body []byte) (*JSONWebKeySet, error) {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	set := &JSONWebKeySet{Keys: make(map[string]crypto.PublicKey)}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: %s", k.Kid, err)
+		}
+		set.Keys[k.Kid] = key
+	}
+	return set, nil
+}
+
+// Key returns the key for kid. Tokens without a kid may be verified when
+// the set holds exactly one key.
+func (s *JSONWebKeySet) Key(kid string) (crypto.PublicKey, bool) {
+	if key, ok := s.Keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(s.Keys) == 1 {
+		for _, key := range s.Keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// jwksMinRefetch limits how often a token with an unknown kid makes
+// RemoteKeySet fetch the keys again, so forged kids can't flood the issuer.
+const jwksMinRefetch = time.Minute
+
+// RemoteKeySet is a JSONWebKeySet fetched from a JWKS URL. It is refreshed
+// in the background once it is older than refresh, and straight away when a
+// token names a kid it doesn't hold, so that keys rotated at the issuer are
+// picked up without rejecting tokens. If a fetch fails the current keys are
+// kept.
+type RemoteKeySet struct {
+	url     string
+	refresh time.Duration
+
+	sync.Mutex
+	keys       *JSONWebKeySet
+	fetched    time.Time
+	refreshing bool
+}
+
+// NewRemoteKeySet fetches the keys at url, failing if they can't be
+// fetched.
+func NewRemoteKeySet(url string, refresh time.Duration) (*RemoteKeySet, error) {
+	r := &RemoteKeySet{url: url, refresh: refresh}
+	if err := r.Refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Refresh fetches the keys again.
+func (r *RemoteKeySet) Refresh() error {
+	keys, err := FetchJSONWebKeySet(r.url)
+	r.Lock()
+	defer r.Unlock()
+	r.fetched = time.Now()
+	if err != nil {
+		return err
+	}
+	r.keys = keys
+	return nil
+}
+
+// Key returns the key for kid, as JSONWebKeySet.Key does.
+func (r *RemoteKeySet) Key(kid string) (crypto.PublicKey, bool) {
+	r.Lock()
+	keys := r.keys
+	if r.refresh > 0 && time.Since(r.fetched) > r.refresh && !r.refreshing {
+		r.refreshing = true
+		go r.backgroundRefresh()
+	}
+	r.Unlock()
+	if key, ok := keys.Key(kid); ok {
+		return key, true
+	}
+
+	// an unknown kid may be a key the issuer has just rotated in
+	r.Lock()
+	if time.Since(r.fetched) < jwksMinRefetch {
+		r.Unlock()
+		return nil, false
+	}
+	r.fetched = time.Now()
+	r.Unlock()
+	if err := r.Refresh(); err != nil {
+		logger.Errorf("error refreshing jwks %s for key id %q: %s", r.url, kid, err)
+		return nil, false
+	}
+	r.Lock()
+	keys = r.keys
+	r.Unlock()
+	return keys.Key(kid)
+}
+
+func (r *RemoteKeySet) backgroundRefresh() {
+	if err := r.Refresh(); err != nil {
+		logger.Errorf("error refreshing jwks %s, keeping the current keys: %s", r.url, err)
+	}
+	r.Lock()
+	r.refreshing = false
+	r.Unlock()
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing key parameter")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseJSONWebKeySet(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	set, err := ParseJSONWebKeySet(keys.jwks)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(set.Keys))
+
+	key, ok := set.Key("rsa1")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, keys.rsa.N, key.(*rsa.PublicKey).N)
+	assert.Equal(t, keys.rsa.E, key.(*rsa.PublicKey).E)
+
+	key, ok = set.Key("ec1")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, keys.ec.X, key.(*ecdsa.PublicKey).X)
+
+	_, ok = set.Key("")
+	assert.Equal(t, false, ok)
+}
+
+func TestParseJSONWebKeySetSkipsEncryptionKeys(t *testing.T) {
+	set, err := ParseJSONWebKeySet([]byte(`{"keys": [{"kid": "enc", "kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(set.Keys))
+}
+
+func TestParseJSONWebKeySetUnsupportedKey(t *testing.T) {
+	_, err := ParseJSONWebKeySet([]byte(`{"keys": [{"kid": "oct", "kty": "oct"}]}`))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestFetchJSONWebKeySet(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(keys.jwks)
+	}))
+	defer server.Close()
+
+	set, err := FetchJSONWebKeySet(server.URL)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(set.Keys))
+}
+
+func TestRemoteKeySetRotation(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	var mu sync.Mutex
+	jwks := []byte(`{"keys": []}`)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		w.Write(jwks)
+	}))
+	defer server.Close()
+	fetchCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+
+	set, err := NewRemoteKeySet(server.URL, 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, fetchCount())
+
+	// unknown kids are only fetched again after jwksMinRefetch
+	mu.Lock()
+	jwks = keys.jwks
+	mu.Unlock()
+	_, ok := set.Key("rsa1")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 1, fetchCount())
+
+	set.fetched = time.Now().Add(-jwksMinRefetch)
+	_, ok = set.Key("rsa1")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 2, fetchCount())
+	_, ok = set.Key("ec1")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 2, fetchCount())
+}
+
+func TestRemoteKeySetBackgroundRefresh(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	fetched := make(chan bool, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(keys.jwks)
+		fetched <- true
+	}))
+	defer server.Close()
+
+	set, err := NewRemoteKeySet(server.URL, time.Hour)
+	assert.Equal(t, nil, err)
+	<-fetched
+
+	set.Lock()
+	set.fetched = time.Now().Add(-2 * time.Hour)
+	set.Unlock()
+	_, ok := set.Key("rsa1")
+	assert.Equal(t, true, ok)
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("keys were not refreshed")
+	}
+}
+
+func TestRemoteKeySetKeepsKeysOnError(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	var status int32 = 200
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		w.Write(keys.jwks)
+	}))
+	defer server.Close()
+
+	set, err := NewRemoteKeySet(server.URL, 0)
+	assert.Equal(t, nil, err)
+	atomic.StoreInt32(&status, 500)
+	assert.NotEqual(t, nil, set.Refresh())
+	_, ok := set.Key("rsa1")
+	assert.Equal(t, true, ok)
+}
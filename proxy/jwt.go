@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTClaims are the registered and identity claims used from a bearer token.
+type JWTClaims struct {
+	Issuer            string      `json:"iss"`
+	Subject           string      `json:"sub"`
+	Audience          interface{} `json:"aud"`
+	Expiry            int64       `json:"exp"`
+	NotBefore         int64       `json:"nbf"`
+	IssuedAt          int64       `json:"iat"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"`
+	Groups            []string    `json:"groups"`
+	PreferredUsername string      `json:"preferred_username"`
+}
+
+// emailVerified reports whether the email_verified claim is true. It is a
+// boolean, but some issuers encode it as a string.
+func (c *JWTClaims) emailVerified() bool {
+	return c.EmailVerified == true || c.EmailVerified == "true"
+}
+
+func (c *JWTClaims) hasAudience(aud string) bool {
+	return audienceIncludes(c.Audience, aud)
+}
+
+// audienceIncludes reports whether an aud claim, a string or an array of
+// strings, includes aud.
+func audienceIncludes(claim interface{}, aud string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == aud
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == aud {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// JSONWebKeys looks up the public key a JWT names by kid; it is
+// implemented by JSONWebKeySet and RemoteKeySet.
+type JSONWebKeys interface {
+	Key(kid string) (crypto.PublicKey, bool)
+}
+
+// JWTVerifier checks the signature and claims of JWTs issued by a single
+// issuer.
+type JWTVerifier struct {
+	Issuer   string
+	Audience string
+	Keys     JSONWebKeys
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+func (v *JWTVerifier) Verify(token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed jwt header: %s", err)
+	}
+	hash, ok := jwtHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", header.Alg)
+	}
+	key, ok := v.Keys.Key(header.Kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt key id %q", header.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt signature: %s", err)
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(key, header.Alg, hash, h.Sum(nil), sig); err != nil {
+		return nil, err
+	}
+
+	claims := &JWTClaims{}
+	if err := decodeJWTSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("malformed jwt claims: %s", err)
+	}
+	now := time.Now().Unix()
+	if claims.Expiry == 0 || now >= claims.Expiry {
+		return nil, errors.New("jwt has expired")
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return nil, errors.New("jwt is not valid yet")
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, fmt.Errorf("unexpected jwt issuer %q", claims.Issuer)
+	}
+	if !claims.hasAudience(v.Audience) {
+		return nil, errors.New("jwt audience does not match")
+	}
+	return claims, nil
+}
+
+func verifySignature(key crypto.PublicKey, alg string, hash crypto.Hash, digest, sig []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[:2] != "RS" {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, sig); err != nil {
+			return errors.New("invalid jwt signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" {
+			break
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid jwt signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid jwt signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("jwt algorithm %q does not match key", alg)
+}
+
+func decodeJWTSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(req *http.Request) (string, bool) {
+	s := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(s) != 2 || s[0] != "Bearer" || s[1] == "" {
+		return "", false
+	}
+	return s[1], true
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signTestJWT(key crypto.Signer, alg, kid string, claims interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = append(leftPad(r, 32), leftPad(s, 32)...)
+	}
+	return signed + "." + b64(sig)
+}
+
+func leftPad(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+type testJWTKeys struct {
+	rsa  *rsa.PrivateKey
+	ec   *ecdsa.PrivateKey
+	jwks []byte
+}
+
+func newTestJWTKeys(t *testing.T) *testJWTKeys {
+	k := &testJWTKeys{}
+	var err error
+	if k.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if k.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	k.jwks, _ = json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "rsa1", "kty": "RSA", "use": "sig",
+				"n": b64(k.rsa.N.Bytes()),
+				"e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+			{"kid": "ec1", "kty": "EC", "crv": "P-256",
+				"x": b64(k.ec.X.Bytes()), "y": b64(k.ec.Y.Bytes())},
+		},
+	})
+	return k
+}
+
+func (k *testJWTKeys) verifier(t *testing.T) *JWTVerifier {
+	keys, err := ParseJSONWebKeySet(k.jwks)
+	assert.Equal(t, nil, err)
+	return &JWTVerifier{Issuer: "https://issuer.example.com", Audience: "client", Keys: keys}
+}
+
+func testClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   "https://issuer.example.com",
+		"aud":   []string{"client", "other"},
+		"sub":   "1234",
+		"email": "michael.bland@gsa.gov",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTVerifierRSA(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	claims, err := keys.verifier(t).Verify(signTestJWT(keys.rsa, "RS256", "rsa1", testClaims()))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", claims.Email)
+	assert.Equal(t, "1234", claims.Subject)
+}
+
+func TestJWTVerifierEC(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	claims, err := keys.verifier(t).Verify(signTestJWT(keys.ec, "ES256", "ec1", testClaims()))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "michael.bland@gsa.gov", claims.Email)
+}
+
+func TestJWTVerifierRejects(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	v := keys.verifier(t)
+
+	expired := testClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err := v.Verify(signTestJWT(keys.rsa, "RS256", "rsa1", expired))
+	assert.NotEqual(t, nil, err)
+
+	issuer := testClaims()
+	issuer["iss"] = "https://evil.example.com"
+	_, err = v.Verify(signTestJWT(keys.rsa, "RS256", "rsa1", issuer))
+	assert.NotEqual(t, nil, err)
+
+	audience := testClaims()
+	audience["aud"] = "other"
+	_, err = v.Verify(signTestJWT(keys.rsa, "RS256", "rsa1", audience))
+	assert.NotEqual(t, nil, err)
+	delete(audience, "aud")
+	_, err = v.Verify(signTestJWT(keys.rsa, "RS256", "rsa1", audience))
+	assert.NotEqual(t, nil, err)
+
+	// signed by the EC key but claiming the RSA key id
+	_, err = v.Verify(signTestJWT(keys.ec, "ES256", "rsa1", testClaims()))
+	assert.NotEqual(t, nil, err)
+
+	_, err = v.Verify(signTestJWT(keys.rsa, "RS256", "unknown", testClaims()))
+	assert.NotEqual(t, nil, err)
+
+	token := signTestJWT(keys.rsa, "RS256", "rsa1", testClaims())
+	_, err = v.Verify(token[:len(token)-4] + "AAAA")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	_, ok := bearerToken(req)
+	assert.Equal(t, false, ok)
+
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	_, ok = bearerToken(req)
+	assert.Equal(t, false, ok)
+
+	req.Header.Set("Authorization", "Bearer abc.def.ghi")
+	token, ok := bearerToken(req)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "abc.def.ghi", token)
+}
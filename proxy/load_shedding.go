@@ -0,0 +1,45 @@
+package proxy
+
+import "net/http"
+
+// overloadedMessage is shown to requests shed by max-concurrent-requests,
+// upstream-max-concurrent-requests or redeem-max-concurrent.
+const overloadedMessage = "The server is too busy. Please try again later."
+
+// concurrencyLimit sheds requests beyond a number in flight at once, rather
+// than queueing them, so a burst of traffic gets quick 503 responses instead
+// of piling up on the proxy and its upstreams. A nil limit allows any
+// number.
+type concurrencyLimit chan struct{}
+
+func newConcurrencyLimit(n int) concurrencyLimit {
+	if n <= 0 {
+		return nil
+	}
+	return make(concurrencyLimit, n)
+}
+
+// Acquire reports whether there is room for another request, which must
+// then call Release once it is done.
+func (l concurrencyLimit) Acquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l concurrencyLimit) Release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// shed tells the client to try again in a second.
+func shed(rw http.ResponseWriter) {
+	rw.Header().Set("Retry-After", "1")
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	l := newConcurrencyLimit(2)
+	assert.Equal(t, true, l.Acquire())
+	assert.Equal(t, true, l.Acquire())
+	assert.Equal(t, false, l.Acquire())
+	l.Release()
+	assert.Equal(t, true, l.Acquire())
+
+	var unlimited concurrencyLimit
+	assert.Equal(t, true, unlimited.Acquire())
+	unlimited.Release()
+}
+
+func TestLoadShedding(t *testing.T) {
+	for _, global := range []bool{true, false} {
+		entered, release := make(chan bool), make(chan bool)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entered <- true
+			<-release
+		}))
+		defer upstream.Close()
+
+		opts := testOptions()
+		opts.Upstreams = []string{upstream.URL}
+		opts.SkipAuthRegex = []string{"^/slow$"}
+		if global {
+			opts.MaxConcurrentRequests = 1
+		} else {
+			opts.UpstreamMaxConcurrentRequests = 1
+		}
+		opts.Validate()
+		proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+		get := func(path string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("GET", path, nil)
+			rw := httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+			return rw
+		}
+
+		done := make(chan int)
+		go func() { done <- get("/slow").Code }()
+		<-entered
+		rw := get("/slow")
+		assert.Equal(t, 503, rw.Code)
+		assert.Equal(t, "1", rw.Header().Get("Retry-After"))
+		// health checks aren't shed
+		assert.Equal(t, 200, get("/ping").Code)
+		close(release)
+		assert.Equal(t, 200, <-done)
+	}
+}
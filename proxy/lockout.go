@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// maxLockout caps the exponential backoff of a Lockout.
+const maxLockout = time.Duration(24) * time.Hour
+
+// maxLockoutEntries bounds the memory used by a Lockout; entries that are
+// no longer locked are pruned once it is exceeded.
+const maxLockoutEntries = 10000
+
+type lockoutEntry struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// Lockout counts failed password attempts for each user and client IP.
+// After maxFailures in a row the pair is locked out for the lockout
+// duration, which doubles with each further failure. A nil *Lockout never
+// locks anyone out.
+type Lockout struct {
+	maxFailures int
+	lockout     time.Duration
+	now         func() time.Time
+
+	sync.Mutex
+	entries map[string]*lockoutEntry
+}
+
+func NewLockout(maxFailures int, lockout time.Duration) *Lockout {
+	return &Lockout{
+		maxFailures: maxFailures,
+		lockout:     lockout,
+		now:         time.Now,
+		entries:     make(map[string]*lockoutEntry),
+	}
+}
+
+func lockoutKey(user, ip string) string {
+	return user + "\x00" + ip
+}
+
+// Locked reports whether user is locked out from ip, and for how long.
+func (l *Lockout) Locked(user, ip string) (bool, time.Duration) {
+	if l == nil {
+		return false, 0
+	}
+	l.Lock()
+	defer l.Unlock()
+	e, ok := l.entries[lockoutKey(user, ip)]
+	if !ok {
+		return false, 0
+	}
+	if wait := e.until.Sub(l.now()); wait > 0 {
+		return true, wait
+	}
+	return false, 0
+}
+
+// Failure records a failed attempt, returning how long user is now locked
+// out from ip, or 0.
+func (l *Lockout) Failure(user, ip string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	key := lockoutKey(user, ip)
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.last) > l.forgetAfter(e) {
+		if len(l.entries) >= maxLockoutEntries {
+			l.prune(now)
+		}
+		e = &lockoutEntry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.last = now
+	if e.failures < l.maxFailures {
+		return 0
+	}
+	lockout := l.lockout
+	for i := l.maxFailures; i < e.failures && lockout < maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > maxLockout {
+		lockout = maxLockout
+	}
+	e.until = now.Add(lockout)
+	return lockout
+}
+
+// Success forgets the failed attempts of user from ip.
+func (l *Lockout) Success(user, ip string) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	delete(l.entries, lockoutKey(user, ip))
+	l.Unlock()
+}
+
+// forgetAfter is how long after its last failure an entry is forgotten: the
+// lockout duration once it has expired, so that occasional typos over a
+// long time don't add up to a lockout.
+func (l *Lockout) forgetAfter(e *lockoutEntry) time.Duration {
+	forget := l.lockout
+	if e.until.After(e.last) {
+		forget += e.until.Sub(e.last)
+	}
+	return forget
+}
+
+// prune drops entries that have been forgotten.
+func (l *Lockout) prune(now time.Time) {
+	for key, e := range l.entries {
+		if now.Sub(e.last) > l.forgetAfter(e) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestLockout(t *testing.T) {
+	now := time.Date(2015, 3, 19, 17, 20, 19, 0, time.UTC)
+	l := NewLockout(3, time.Minute)
+	l.now = func() time.Time { return now }
+
+	assert.Equal(t, time.Duration(0), l.Failure("bob", "10.0.0.1"))
+	assert.Equal(t, time.Duration(0), l.Failure("bob", "10.0.0.1"))
+	locked, _ := l.Locked("bob", "10.0.0.1")
+	assert.Equal(t, false, locked)
+	assert.Equal(t, time.Minute, l.Failure("bob", "10.0.0.1"))
+	locked, wait := l.Locked("bob", "10.0.0.1")
+	assert.Equal(t, true, locked)
+	assert.Equal(t, time.Minute, wait)
+
+	// other users and IPs aren't affected
+	locked, _ = l.Locked("bob", "10.0.0.2")
+	assert.Equal(t, false, locked)
+	locked, _ = l.Locked("alice", "10.0.0.1")
+	assert.Equal(t, false, locked)
+
+	// each failure after the lockout doubles it
+	now = now.Add(time.Minute)
+	locked, _ = l.Locked("bob", "10.0.0.1")
+	assert.Equal(t, false, locked)
+	assert.Equal(t, 2*time.Minute, l.Failure("bob", "10.0.0.1"))
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 4*time.Minute, l.Failure("bob", "10.0.0.1"))
+
+	// a success resets the count
+	now = now.Add(4 * time.Minute)
+	l.Success("bob", "10.0.0.1")
+	assert.Equal(t, time.Duration(0), l.Failure("bob", "10.0.0.1"))
+
+	// failures are forgotten once the lockout duration passes
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, time.Duration(0), l.Failure("bob", "10.0.0.1"))
+	assert.Equal(t, time.Duration(0), l.Failure("bob", "10.0.0.1"))
+
+	for i := 0; i < 40; i++ {
+		l.Failure("eve", "10.0.0.1")
+	}
+	_, wait = l.Locked("eve", "10.0.0.1")
+	assert.Equal(t, maxLockout, wait)
+
+	var nilLockout *Lockout
+	assert.Equal(t, time.Duration(0), nilLockout.Failure("bob", "10.0.0.1"))
+	locked, _ = nilLockout.Locked("bob", "10.0.0.1")
+	assert.Equal(t, false, locked)
+}
+
+func TestBasicAuthLockout(t *testing.T) {
+	opts := testOptions()
+	opts.HtpasswdMaxFailures = 2
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	proxy.serveMux = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response"))
+	})
+	proxy.HtpasswdValidator = passwordOnly(func(user, password string) bool { return password == "secret" })
+	var buf bytes.Buffer
+	proxy.Audit = NewAuditLog(&buf, "Google")
+
+	get := func(password string) int {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.SetBasicAuth("bob", password)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	assert.Equal(t, 200, get("secret"))
+	assert.Equal(t, 403, get("wrong"))
+	assert.Equal(t, 403, get("wrong"))
+	// the right password is rejected too while locked out
+	assert.Equal(t, 403, get("secret"))
+	assert.Equal(t, true, strings.Contains(buf.String(), `"event":"locked_out"`))
+	assert.Equal(t, true, strings.Contains(buf.String(), `"reason":"locked out"`))
+}
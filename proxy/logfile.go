@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a log file that is rotated when it grows beyond maxSize
+// bytes or was opened more than maxAge ago; zero disables either limit.
+// Rotated files are renamed with a timestamp suffix and only the newest
+// maxBackups are kept, or all of them if maxBackups is zero.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	now        func() time.Time
+
+	sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.size > 0 && ((f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize) ||
+		(f.maxAge > 0 && f.now().Sub(f.opened) >= f.maxAge)) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: rotating log file %s: %s\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file aside and starts a new one.
+func (f *RotatingFile) rotate() error {
+	backup := f.path + "." + f.now().UTC().Format("20060102T150405.000")
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	old.Close()
+	return f.removeOldBackups()
+}
+
+func (f *RotatingFile) removeOldBackups() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	// the timestamp suffixes sort in the order the files were rotated
+	sort.Strings(backups)
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Reopen closes and reopens the file, so that it can be rotated by an
+// external tool such as logrotate. If that fails the current file is kept.
+func (f *RotatingFile) Reopen() error {
+	f.Lock()
+	defer f.Unlock()
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	old.Close()
+	return nil
+}
+
+// ReopenOnSignal calls Reopen whenever one of sigs is received.
+func (f *RotatingFile) ReopenOnSignal(sigs ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		for range c {
+			if err := f.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: reopening log file %s: %s\n", f.path, err)
+			}
+		}
+	}()
+}
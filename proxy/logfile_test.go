@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRotatingFileMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_logfile_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "oauth2_proxy.log")
+
+	f, err := OpenRotatingFile(path, 10, 0, 2)
+	assert.Equal(t, nil, err)
+	now := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		f.Write([]byte(line))
+	}
+
+	contents, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "fourth\n", string(contents))
+	backups, _ := filepath.Glob(path + ".*")
+	assert.Equal(t, 2, len(backups))
+	contents, _ = ioutil.ReadFile(backups[0])
+	assert.Equal(t, "second\n", string(contents))
+	contents, _ = ioutil.ReadFile(backups[1])
+	assert.Equal(t, "third\n", string(contents))
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_logfile_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "oauth2_proxy.log")
+
+	now := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	f, err := OpenRotatingFile(path, 0, time.Hour, 0)
+	assert.Equal(t, nil, err)
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	f.Write([]byte("first\n"))
+	now = now.Add(30 * time.Minute)
+	f.Write([]byte("second\n"))
+	now = now.Add(30 * time.Minute)
+	f.Write([]byte("third\n"))
+
+	contents, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "third\n", string(contents))
+	backups, _ := filepath.Glob(path + ".*")
+	assert.Equal(t, []string{path + ".20150301T130000.000"}, backups)
+	contents, _ = ioutil.ReadFile(backups[0])
+	assert.Equal(t, "first\nsecond\n", string(contents))
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_logfile_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "oauth2_proxy.log")
+
+	f, err := OpenRotatingFile(path, 0, 0, 0)
+	assert.Equal(t, nil, err)
+	f.Write([]byte("before\n"))
+	os.Rename(path, path+".1")
+	assert.Equal(t, nil, f.Reopen())
+	f.Write([]byte("after\n"))
+
+	contents, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "after\n", string(contents))
+	contents, _ = ioutil.ReadFile(path + ".1")
+	assert.Equal(t, "before\n", string(contents))
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fields are structured values attached to a log entry.
+type Fields map[string]interface{}
+
+// Logger writes leveled log entries, either as text through the standard
+// log package or as one JSON object per line.
+type Logger struct {
+	core   *loggerCore
+	fields Fields
+}
+
+type loggerCore struct {
+	sync.Mutex
+	out  io.Writer
+	json bool
+	now  func() time.Time
+}
+
+// logger is the process wide Logger; main sets its format from -log-format.
+var logger = NewLogger(os.Stderr, "text")
+
+// NewLogger returns a Logger writing format ("text" or "json") entries. Text
+// entries go through the standard log package, so out is only used for
+// JSON.
+func NewLogger(out io.Writer, format string) *Logger {
+	return &Logger{core: &loggerCore{out: out, json: format == "json", now: time.Now}}
+}
+
+// With returns a Logger that adds fields to every entry.
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{core: l.core, fields: merged}
+}
+
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.output(2, "info", fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.output(2, "warning", fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.output(2, "error", fmt.Sprintf(format, args...))
+}
+
+// Fatalf logs like Errorf and exits.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.output(2, "fatal", fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (l *Logger) output(calldepth int, level, msg string) {
+	msg = redactor.Redact(msg)
+	if !l.core.json {
+		if level != "info" {
+			msg = strings.ToUpper(level) + ": " + msg
+		}
+		for _, k := range sortedKeys(l.fields) {
+			msg += redactor.Redact(fmt.Sprintf(" %s=%v", k, l.fields[k]))
+		}
+		log.Output(calldepth+1, msg)
+		return
+	}
+
+	entry := make(Fields, len(l.fields)+4)
+	for k, v := range l.fields {
+		if s, ok := v.(string); ok {
+			v = redactor.Redact(s)
+		}
+		entry[k] = v
+	}
+	entry["time"] = l.core.now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["msg"] = msg
+	if _, file, line, ok := runtime.Caller(calldepth); calldepth >= 0 && ok {
+		entry["caller"] = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	l.core.write(entry)
+}
+
+func (c *loggerCore) write(entry Fields) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(Fields{"level": "error", "msg": fmt.Sprintf("unable to log entry: %s", err)})
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.out.Write(append(b, '\n'))
+}
+
+// Write logs each line of p at info level, so a Logger can be the output of
+// the standard log package (see CaptureStdLog). The caller isn't known.
+func (l *Logger) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		l.output(-1, "info", string(line))
+	}
+	return len(p), nil
+}
+
+// CaptureStdLog sends the standard log package's output, used by the
+// providers and net/http, through l when it writes JSON.
+func (l *Logger) CaptureStdLog() {
+	if l.core.json {
+		log.SetFlags(0)
+		log.SetOutput(l)
+	}
+}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, "json")
+	l.core.now = func() time.Time { return time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	l.With(Fields{"remote_addr": "10.0.0.1"}).Warnf("rejecting %s", "user@example.com")
+	var entry map[string]interface{}
+	assert.Equal(t, nil, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "warning", entry["level"])
+	assert.Equal(t, "rejecting user@example.com", entry["msg"])
+	assert.Equal(t, "10.0.0.1", entry["remote_addr"])
+	assert.Equal(t, "2015-03-01T12:00:00Z", entry["time"])
+	assert.Equal(t, true, strings.HasPrefix(entry["caller"].(string), "logger_test.go:"))
+
+	buf.Reset()
+	l.Write([]byte("first\nsecond\n"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	json.Unmarshal([]byte(lines[1]), &entry)
+	assert.Equal(t, "second", entry["msg"])
+	assert.Equal(t, "info", entry["level"])
+}
+
+func TestLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	l := NewLogger(nil, "text")
+	l.Printf("listening on %s", "127.0.0.1:4180")
+	l.With(Fields{"user": "u", "path": "/"}).Errorf("denied")
+	assert.Equal(t, "listening on 127.0.0.1:4180\nERROR: denied path=/ user=u\n", buf.String())
+}
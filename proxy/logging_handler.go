@@ -0,0 +1,258 @@
+// largely adapted from https://github.com/gorilla/handlers/blob/master/handlers.go
+// to add logging of the upstream and request duration, in a configurable format
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// responseLogger is wrapper of http.ResponseWriter that keeps track of its HTTP status
+// code and body size
+type responseLogger struct {
+	w        http.ResponseWriter
+	status   int
+	size     int
+	upstream string
+	authInfo string
+	clientIP string
+}
+
+func (l *responseLogger) Header() http.Header {
+	return l.w.Header()
+}
+
+func (l *responseLogger) ExtractGAPMetadata() {
+	upstream := l.w.Header().Get("GAP-Upstream-Address")
+	if upstream != "" {
+		l.upstream = upstream
+		l.w.Header().Del("GAP-Upstream-Address")
+	}
+	authInfo := l.w.Header().Get("GAP-Auth")
+	if authInfo != "" {
+		l.authInfo = authInfo
+		l.w.Header().Del("GAP-Auth")
+	}
+	clientIP := l.w.Header().Get("GAP-Client-IP")
+	if clientIP != "" {
+		l.clientIP = clientIP
+		l.w.Header().Del("GAP-Client-IP")
+	}
+}
+
+func (l *responseLogger) Write(b []byte) (int, error) {
+	if l.status == 0 {
+		// The status will be StatusOK if WriteHeader has not been called yet
+		l.status = http.StatusOK
+	}
+	l.ExtractGAPMetadata()
+	size, err := l.w.Write(b)
+	l.size += size
+	return size, err
+}
+
+func (l *responseLogger) WriteHeader(s int) {
+	l.ExtractGAPMetadata()
+	l.w.WriteHeader(s)
+	l.status = s
+}
+
+// Flush sends what has been written so far to the client, so streamed
+// responses aren't held back by logging.
+func (l *responseLogger) Flush() {
+	if l.status == 0 {
+		l.status = http.StatusOK
+	}
+	l.ExtractGAPMetadata()
+	if f, ok := l.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter,
+// for example to hijack the connection of an upgraded request.
+func (l *responseLogger) Unwrap() http.ResponseWriter {
+	return l.w
+}
+
+func (l *responseLogger) Status() int {
+	return l.status
+}
+
+func (l *responseLogger) Size() int {
+	return l.size
+}
+
+// loggingHandler is the http.Handler implementation for LoggingHandlerTo and its friends
+type loggingHandler struct {
+	writer   io.Writer
+	handler  http.Handler
+	enabled  bool
+	template *template.Template
+	exclude  []*regexp.Regexp
+}
+
+// LoggingHandler logs each request to out when enabled, formatted with tmpl
+// (see parseRequestLogFormat) or, if tmpl is nil, as a JSON object.
+// Requests whose path matches one of exclude aren't logged.
+func LoggingHandler(out io.Writer, h http.Handler, v bool, tmpl *template.Template, exclude []*regexp.Regexp) http.Handler {
+	return loggingHandler{out, h, v, tmpl, exclude}
+}
+
+func (h loggingHandler) excluded(req *http.Request) bool {
+	for _, r := range h.exclude {
+		if r.MatchString(req.URL.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	t := time.Now()
+	url := *req.URL
+	rl := &responseLogger{w: w}
+	h.handler.ServeHTTP(rl, req)
+	if !h.enabled || h.excluded(req) {
+		return
+	}
+	var logLine []byte
+	if h.template == nil {
+		logLine = buildJSONLogLine(rl.authInfo, rl.upstream, rl.clientIP, req, url, t, rl.Status(), rl.Size())
+	} else {
+		logLine = buildLogLine(h.template, rl.authInfo, rl.upstream, rl.clientIP, req, url, t, rl.Status(), rl.Size())
+	}
+	h.writer.Write(logLine)
+}
+
+// DefaultRequestLogFormat is Apache Combined Log Format followed by the
+// Host header, the upstream address and the request duration in seconds.
+const DefaultRequestLogFormat = `{{.Client}} - {{.Username}} [{{.Timestamp}}] "{{.Method}} {{.RequestURI}} {{.Protocol}}" ` +
+	`{{.StatusCode}} {{.ResponseSize}} "{{.Referer}}" "{{.UserAgent}}" {{.Host}} {{.Upstream}} {{.RequestDuration}}`
+
+// logMessageData holds the fields available to request log templates.
+type logMessageData struct {
+	Client          string
+	Username        string
+	Timestamp       string
+	Host            string
+	Method          string
+	Upstream        string
+	RequestURI      string
+	Protocol        string
+	Referer         string
+	UserAgent       string
+	StatusCode      int
+	ResponseSize    int
+	RequestDuration string
+}
+
+// parseRequestLogFormat parses a request log template, whose fields are
+// those of logMessageData.
+func parseRequestLogFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("request-log").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, tmpl.Execute(ioutil.Discard, logMessageData{})
+}
+
+// requestClient returns the client address of req: clientIP, as found by
+// the proxy from trusted proxy headers, or else the direct peer.
+func requestClient(req *http.Request, clientIP string) string {
+	if clientIP != "" {
+		return clientIP
+	}
+	client := req.RemoteAddr
+	if c, _, err := net.SplitHostPort(client); err == nil {
+		client = c
+	}
+	return client
+}
+
+// Log entry for req formatted with tmpl.
+// clientIP is the real client address, if known.
+// ts is the timestamp with which the entry should be logged.
+// status, size are used to provide the response HTTP status and size.
+func buildLogLine(tmpl *template.Template, username, upstream, clientIP string, req *http.Request, url url.URL, ts time.Time, status int, size int) []byte {
+	if username == "" {
+		username = "-"
+	}
+	if upstream == "" {
+		upstream = "-"
+	}
+	if url.User != nil && username == "-" {
+		if name := url.User.Username(); name != "" {
+			username = name
+		}
+	}
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		q := strconv.Quote(s)
+		return q[1 : len(q)-1]
+	}
+
+	duration := float64(time.Now().Sub(ts)) / float64(time.Second)
+
+	var buf bytes.Buffer
+	tmpl.Execute(&buf, logMessageData{
+		Client:          requestClient(req, clientIP),
+		Username:        username,
+		Timestamp:       ts.Format("02/Jan/2006:15:04:05 -0700"),
+		Host:            req.Host,
+		Method:          req.Method,
+		Upstream:        upstream,
+		RequestURI:      url.RequestURI(),
+		Protocol:        req.Proto,
+		Referer:         dash(req.Referer()),
+		UserAgent:       dash(req.UserAgent()),
+		StatusCode:      status,
+		ResponseSize:    size,
+		RequestDuration: fmt.Sprintf("%0.3f", duration),
+	})
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// buildJSONLogLine is buildLogLine as a JSON object; empty values are
+// omitted and latency is in seconds.
+func buildJSONLogLine(username, upstream, clientIP string, req *http.Request, url url.URL, ts time.Time, status int, size int) []byte {
+	if url.User != nil && username == "" {
+		username = url.User.Username()
+	}
+	entry := Fields{
+		"time":        ts.UTC().Format(time.RFC3339Nano),
+		"remote_addr": requestClient(req, clientIP),
+		"host":        req.Host,
+		"method":      req.Method,
+		"path":        url.RequestURI(),
+		"proto":       req.Proto,
+		"status":      status,
+		"size":        size,
+		"latency":     float64(time.Now().Sub(ts)) / float64(time.Second),
+	}
+	if username != "" {
+		entry["user"] = username
+	}
+	if upstream != "" {
+		entry["upstream"] = upstream
+	}
+	if ua := req.UserAgent(); ua != "" {
+		entry["user_agent"] = ua
+	}
+	b, _ := json.Marshal(entry)
+	return append(b, '\n')
+}
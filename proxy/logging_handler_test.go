@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestBuildJSONLogLine(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://app.example.com/foo?bar=baz", nil)
+	req.RemoteAddr = "10.0.0.1:4321"
+	req.Header.Set("User-Agent", "test")
+
+	line := buildJSONLogLine("user@example.com", "http://127.0.0.1:8080", "192.168.0.1", req, *req.URL,
+		time.Now(), 200, 42)
+	assert.Equal(t, true, strings.HasSuffix(string(line), "}\n"))
+
+	var entry map[string]interface{}
+	assert.Equal(t, nil, json.Unmarshal(line, &entry))
+	assert.Equal(t, "192.168.0.1", entry["remote_addr"])
+	assert.Equal(t, "user@example.com", entry["user"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/foo?bar=baz", entry["path"])
+	assert.Equal(t, "http://127.0.0.1:8080", entry["upstream"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, float64(42), entry["size"])
+	_, ok := entry["latency"].(float64)
+	assert.Equal(t, true, ok)
+
+	line = buildJSONLogLine("", "", "", req, *req.URL, time.Now(), 403, 0)
+	entry = nil
+	json.Unmarshal(line, &entry)
+	assert.Equal(t, "10.0.0.1", entry["remote_addr"])
+	_, ok = entry["user"]
+	assert.Equal(t, false, ok)
+}
+
+func TestBuildLogLine(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://app.example.com/foo?bar=baz", nil)
+	req.RemoteAddr = "10.0.0.1:4321"
+	req.Header.Set("User-Agent", `test "agent"`)
+	ts := time.Date(2015, 3, 19, 17, 20, 19, 0, time.FixedZone("", -4*60*60))
+
+	tmpl, err := parseRequestLogFormat(DefaultRequestLogFormat)
+	assert.Equal(t, nil, err)
+	line := string(buildLogLine(tmpl, "user@example.com", "http://127.0.0.1:8080", "", req, *req.URL, ts, 200, 42))
+	assert.Equal(t, true, strings.HasPrefix(line, `10.0.0.1 - user@example.com [19/Mar/2015:17:20:19 -0400] `+
+		`"GET /foo?bar=baz HTTP/1.1" 200 42 "-" "test \"agent\"" app.example.com http://127.0.0.1:8080 `))
+	assert.Equal(t, true, strings.HasSuffix(line, "\n"))
+
+	tmpl, err = parseRequestLogFormat("{{.Username}} {{.Upstream}} {{.StatusCode}}")
+	assert.Equal(t, nil, err)
+	line = string(buildLogLine(tmpl, "", "", "", req, *req.URL, ts, 403, 0))
+	assert.Equal(t, "- - 403\n", line)
+}
+
+func TestParseRequestLogFormatErrors(t *testing.T) {
+	_, err := parseRequestLogFormat("{{.Client")
+	assert.NotEqual(t, nil, err)
+	_, err = parseRequestLogFormat("{{.NoSuchField}}")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestLoggingHandlerExclude(t *testing.T) {
+	o := testOptions()
+	o.LoggingExcludePaths = []string{"/ping,/metrics"}
+	o.LoggingExcludeRegex = []string{"^/static/"}
+	assert.Equal(t, nil, o.Validate())
+
+	var buf bytes.Buffer
+	h := LoggingHandler(&buf, http.NotFoundHandler(), true, o.requestLogTemplate, o.requestLogExclude)
+	for _, path := range []string{"/ping", "/metrics", "/static/app.js", "/ping/x", "/app"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, true, strings.Contains(lines[0], "/ping/x"))
+	assert.Equal(t, true, strings.Contains(lines[1], "/app"))
+}
+
+func TestLoggingHandlerClientIP(t *testing.T) {
+	o := testOptions()
+	o.TrustedProxyCIDRs = []string{"10.0.0.0/8"}
+	o.ClientIPHeader = "X-Real-IP"
+	assert.Equal(t, nil, o.Validate())
+	proxy := NewOauthProxy(o, EmailValidator(func(string) bool { return true }))
+
+	var buf bytes.Buffer
+	h := LoggingHandler(&buf, proxy, true, o.requestLogTemplate, o.requestLogExclude)
+	for _, remoteAddr := range []string{"10.0.0.1:1234", "8.8.8.8:1234"} {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Real-IP", "192.168.0.1")
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		assert.Equal(t, "", rw.Header().Get("GAP-Client-IP"))
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, true, strings.HasPrefix(lines[0], "192.168.0.1 - "))
+	assert.Equal(t, true, strings.HasPrefix(lines[1], "8.8.8.8 - "))
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+// sessionContextKey holds the *SessionState of authenticated requests.
+const sessionContextKey contextKey = 0
+
+// Middleware returns a handler that authenticates and authorizes requests
+// like ServeHTTP, but then passes them to next, in process, instead of
+// proxying them to the upstreams. The sign in, callback and other proxy
+// pages are still served by p, so they must be routed to the handler too.
+// next gets the user's session from SessionFromContext, as well as the
+// usual identity headers.
+func (p *OauthProxy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		p.serve(&internalHeadersWriter{ResponseWriter: rw}, req, next)
+	})
+}
+
+// SessionFromContext returns the session of the user that the request with
+// ctx was authenticated as. There is none for requests let through without
+// authentication, such as those matching skip-auth-regex.
+func SessionFromContext(ctx context.Context) (*SessionState, bool) {
+	session, ok := ctx.Value(sessionContextKey).(*SessionState)
+	return session, ok
+}
+
+// internalHeadersWriter removes the GAP-* response headers, which are meant
+// for LoggingHandler, from responses that don't go through it.
+type internalHeadersWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *internalHeadersWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.ResponseWriter.Header()
+		for name := range h {
+			if strings.HasPrefix(name, "Gap-") {
+				h.Del(name)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *internalHeadersWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (w *internalHeadersWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *internalHeadersWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	opts := testOptions()
+	opts.SkipAuthRegex = []string{"^/public"}
+	assert.Equal(t, nil, opts.Validate())
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	upstreamCalled := false
+	proxy.serveMux = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+	})
+	handler := proxy.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if session, ok := SessionFromContext(r.Context()); ok {
+			w.Write([]byte("hello " + session.Email))
+			return
+		}
+		w.Write([]byte("hello anonymous"))
+	}))
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	req, _ := http.NewRequest("GET", "/private", nil)
+	rw := serve(req)
+	assert.Equal(t, 403, rw.Code)
+
+	req, _ = http.NewRequest("GET", "/private", nil)
+	req.AddCookie(proxy.MakeCookie(req, "michael.bland@gsa.gov", opts.CookieExpire))
+	rw = serve(req)
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "hello michael.bland@gsa.gov", rw.Body.String())
+	// the headers for request logging aren't sent to the client
+	assert.Equal(t, "", rw.Header().Get("GAP-Auth"))
+	assert.Equal(t, "", rw.Header().Get("GAP-Client-IP"))
+
+	req, _ = http.NewRequest("GET", "/public", nil)
+	rw = serve(req)
+	assert.Equal(t, "hello anonymous", rw.Body.String())
+
+	req, _ = http.NewRequest("GET", "/ping", nil)
+	rw = serve(req)
+	assert.Equal(t, "OK", rw.Body.String())
+	assert.Equal(t, false, upstreamCalled)
+}
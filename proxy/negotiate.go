@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// wantsJSON reports whether req's Accept header prefers application/json to
+// text/html, as the requests of single page applications do. The proxy then
+// answers with JSON rather than its HTML pages and redirects.
+func wantsJSON(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	return acceptQuality(accept, "application/json") > acceptQuality(accept, "text/html")
+}
+
+// acceptQuality returns the q-value an Accept header gives mediaType, or 0
+// if it isn't listed. Wildcards are ignored, as they don't prefer one type
+// over another.
+func acceptQuality(header, mediaType string) float64 {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		if strings.EqualFold(strings.TrimSpace(fields[0]), mediaType) {
+			return qValue(fields[1:])
+		}
+	}
+	return 0
+}
+
+// qValue returns the q parameter among the params of an Accept or
+// Accept-Language header element, which defaults to 1.
+func qValue(params []string) float64 {
+	for _, f := range params {
+		if f = strings.TrimSpace(f); strings.HasPrefix(f, "q=") {
+			if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+				return v
+			}
+		}
+	}
+	return 1
+}
+
+// writeJSON writes v as a JSON response with the status code.
+func writeJSON(rw http.ResponseWriter, code int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(v)
+}
+
+// jsonError is the JSON form of the error page. Error is a stable code for
+// programs to check, such as "email_not_verified" or the provider's error
+// for a failed callback; Message is shown to the user.
+type jsonError struct {
+	Error   string `json:"error"`
+	Message string `json:"message,omitempty"`
+}
+
+// jsonSignIn is the JSON form of the sign in page: the client should send
+// the user to LoginURL, who then comes back to Redirect once signed in.
+type jsonSignIn struct {
+	LoginURL string `json:"login_url"`
+	Redirect string `json:"redirect"`
+	Provider string `json:"provider"`
+}
+
+// jsonRedirect is the JSON form of a redirect once the user has signed in or
+// out.
+type jsonRedirect struct {
+	Redirect string `json:"redirect"`
+}
+
+// errorCode is the default jsonError code for an HTTP status, such as
+// "forbidden" for 403.
+func errorCode(status int) string {
+	return strings.ToLower(strings.Replace(http.StatusText(status), " ", "_", -1))
+}
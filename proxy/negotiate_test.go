@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestWantsJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":    false,
+		"*/*": false,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": false,
+		"application/json":                  true,
+		"application/json, text/plain, */*": true,
+		"text/html;q=0.5, application/json": true,
+		"application/json;q=0.5, text/html": false,
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		assert.Equal(t, expected, wantsJSON(req), accept)
+	}
+}
+
+func TestControlEndpointsJSON(t *testing.T) {
+	opts := testOptions()
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	do := func(method, path string) (*httptest.ResponseRecorder, map[string]string) {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Accept", "application/json")
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+		var body map[string]string
+		assert.Equal(t, nil, json.Unmarshal(rw.Body.Bytes(), &body))
+		return rw, body
+	}
+	get := func(path string) (*httptest.ResponseRecorder, map[string]string) {
+		return do("GET", path)
+	}
+
+	rw, body := get("/private/page?x=1")
+	assert.Equal(t, 403, rw.Code)
+	assert.Equal(t, "/oauth2/start?rd=%2Fprivate%2Fpage%3Fx%3D1", body["login_url"])
+	assert.Equal(t, "/private/page?x=1", body["redirect"])
+	assert.Equal(t, "Google", body["provider"])
+
+	rw, body = get("/oauth2/start?rd=/private")
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, true, strings.HasPrefix(body["login_url"], "https://accounts.google.com/"))
+	assert.Equal(t, "/private", body["redirect"])
+
+	rw, body = get("/oauth2/callback?error=access_denied")
+	assert.Equal(t, 403, rw.Code)
+	assert.Equal(t, "access_denied", body["error"])
+
+	rw, body = do("POST", "/oauth2/sign_out?rd=/bye")
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "/bye", body["redirect"])
+
+	// browsers still get the pages
+	req, _ := http.NewRequest("GET", "/oauth2/callback?error=access_denied", nil)
+	req.Header.Set("Accept", "text/html,*/*;q=0.8")
+	rw = httptest.NewRecorder()
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, 403, rw.Code)
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), "<html"))
+}
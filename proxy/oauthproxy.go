@@ -0,0 +1,1457 @@
+package proxy
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitly/oauth2_proxy/providers"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const robotsPath = "/robots.txt"
+const pingPath = "/ping"
+const signInPath = "/oauth2/sign_in"
+const signOutPath = "/oauth2/sign_out"
+const oauthStartPath = "/oauth2/start"
+const oauthCallbackPath = "/oauth2/callback"
+
+type OauthProxy struct {
+	CookieSeed     string
+	CookieKey      string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieHttpOnly bool
+	CookieExpire   time.Duration
+	CookieRefresh  time.Duration
+	Validator      Validator
+	Bans           *BanList
+	SessionCutoff  *SessionCutoff
+	AdminToken     string
+	Audit          *AuditLog
+	Stats          *StatsD
+
+	// OnAuthenticated, if set, is called when a user signs in with the
+	// provider or the htpasswd form, before the session cookie is set, so
+	// it may add to the session. OnSessionRefreshed is called when a
+	// session cookie is refreshed, OnAuthorizationDenied when a request is
+	// denied (session is nil if the user isn't known yet) and OnSignOut
+	// when a user signs out. They are called while serving the request.
+	OnAuthenticated       func(req *http.Request, session *SessionState)
+	OnSessionRefreshed    func(req *http.Request, session *SessionState)
+	OnAuthorizationDenied func(req *http.Request, session *SessionState, reason string)
+	OnSignOut             func(req *http.Request, session *SessionState)
+
+	redirectUrl         *url.URL // the url to receive requests at
+	provider            providers.Provider
+	oauthLoginUrl       *url.URL // to redirect the user to
+	oauthValidateUrl    *url.URL // to validate the access token
+	oauthScope          string
+	clientID            string
+	clientSecret        string
+	SignInMessage       string
+	HtpasswdValidator   func(user string, password string) (*HtpasswdUser, bool)
+	HtpasswdTOTP        *TOTPSecrets
+	DisplayHtpasswdForm bool
+	serveMux            http.Handler
+	PassBasicAuth       bool
+	BasicAuthPassword   string
+	PassAccessToken     bool
+	stripAuthHeader     bool
+	passAuthHeader      bool
+	userHeader          string
+	emailHeader         string
+	groupsHeader        string
+	nameHeader          string
+	usernameHeader      string
+	authHeader          string
+	AesCipher           cipher.Block
+	skipAuthRegex       []string
+	skipAuthPreflight   bool
+	trustedIPs          IPRanges
+	trustedIPIdentity   string
+	trustedProxies      IPRanges
+	whitelistDomains    []string
+	clientIPHeader      string
+	skipAuth            *skipAuthRules
+	stepUpRegex         []*regexp.Regexp
+	stepUpMaxAge        time.Duration
+	silentSSO           bool
+	acl                 *ACL
+	authz               *AuthzWebhook
+	rateLimiter         RateLimiter
+	signInLimiter       RateLimiter
+	lockout             *Lockout
+	captcha             *Captcha
+	webauthn            *WebAuthn
+	securityHeaders     string
+	geoIP               *GeoIPFilter
+	shadowMode          bool
+	normalizeEmails     bool
+	clientCertAuth      bool
+	sessionBinding      *SessionBinding
+	jwtVerifier         *JWTVerifier
+	introspector        *TokenIntrospector
+	requireVerified     bool
+	tokenCache          *tokenCache
+	concurrencyLimit    concurrencyLimit
+	sessionCache        *sessionCache
+	redeemQueue         *redeemQueue
+	refreshes           refreshGroup
+	templates           *template.Template
+	style               string
+	templateReloader    *templateReloader
+	templateData        map[string]string
+	locales             *localeSet
+	banner              template.HTML
+	footer              template.HTML
+}
+
+type UpstreamProxy struct {
+	upstream  string
+	handler   http.Handler
+	breaker   *CircuitBreaker
+	templates *template.Template
+	// templateData is given to the error page as .Data
+	templateData map[string]string
+	locales      *localeSet
+	stats        *StatsD
+	// addressHeader, if set, tells the client the upstream address
+	addressHeader string
+	limit         concurrencyLimit
+}
+
+func (u *UpstreamProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("GAP-Upstream-Address", u.upstream)
+	if u.addressHeader != "" {
+		w.Header().Set(u.addressHeader, u.upstream)
+	}
+	r, span := startUpstreamSpan(r, u.upstream)
+	defer span.End()
+	if u.breaker != nil {
+		if ok, retry := u.breaker.Allow(); !ok {
+			u.stats.Incr("upstream.unavailable", "upstream:"+u.upstream)
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retry.Seconds()+1)))
+			renderErrorPage(u.templates, u.templateData, u.locales.negotiate(r), w, http.StatusServiceUnavailable, "Service Unavailable",
+				fmt.Sprintf("The upstream %s is currently unavailable. Please try again later.", u.upstream))
+			return
+		}
+	}
+	if !u.limit.Acquire() {
+		u.stats.Incr("upstream.shed", "upstream:"+u.upstream)
+		shed(w)
+		renderErrorPage(u.templates, u.templateData, u.locales.negotiate(r), w, http.StatusServiceUnavailable, "Service Unavailable", overloadedMessage)
+		return
+	}
+	defer u.limit.Release()
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w}
+	u.handler.ServeHTTP(rec, r)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	endSpanWithStatus(span, rec.status)
+	u.stats.Timing("upstream.latency", time.Since(start),
+		"upstream:"+u.upstream, "status:"+statusClass(rec.status))
+	if u.breaker == nil {
+		return
+	}
+	if rec.status >= 500 {
+		u.breaker.Failure()
+	} else {
+		u.breaker.Success()
+	}
+}
+
+func NewReverseProxy(target *url.URL) (proxy *httputil.ReverseProxy) {
+	return httputil.NewSingleHostReverseProxy(target)
+}
+func setProxyUpstreamHostHeader(proxy *httputil.ReverseProxy, target *url.URL) {
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		// use RequestURI so that we aren't unescaping encoded slashes in the request path
+		req.Host = target.Host
+		req.URL.Opaque = req.RequestURI
+		req.URL.RawQuery = ""
+	}
+}
+func setProxyDirector(proxy *httputil.ReverseProxy) {
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		// use RequestURI so that we aren't unescaping encoded slashes in the request path
+		req.URL.Opaque = req.RequestURI
+		req.URL.RawQuery = ""
+	}
+}
+
+// setUpstreamConfigDirector applies the path rewrite and headers of a
+// structured upstream definition.
+func setUpstreamConfigDirector(proxy *httputil.ReverseProxy, config *Upstream) {
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		if config.Rewrite != "" {
+			req.URL.Opaque = config.Rewrite + strings.TrimPrefix(req.URL.Opaque, config.Path)
+		}
+		for k, v := range config.Headers {
+			req.Header.Set(k, v)
+		}
+	}
+}
+
+func newUpstreamProxy(u *url.URL, opts *Options, templates *template.Template, stats *StatsD, transport http.RoundTripper) *UpstreamProxy {
+	config := opts.upstreamConfigs[u.Path]
+	// copied so that building a proxy leaves the options as they were
+	target := *u
+	target.Path = ""
+	u = &target
+	proxy := NewReverseProxy(u)
+	if transport != nil {
+		proxy.Transport = transport
+	}
+	proxy.BufferPool = newBufferPool(opts.UpstreamBufferSize)
+	proxy.FlushInterval = opts.UpstreamFlushInterval
+	if !opts.PassHostHeader {
+		setProxyUpstreamHostHeader(proxy, u)
+	} else {
+		setProxyDirector(proxy)
+	}
+	if config != nil {
+		setUpstreamConfigDirector(proxy, config)
+	}
+	if config != nil && config.Static && opts.StaticCacheSize > 0 {
+		base := proxy.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		proxy.Transport = newStaticCache(base, int64(opts.StaticCacheSize)*1024*1024, opts.StaticCacheTTL, stats, u.Host)
+	}
+	upstream := &UpstreamProxy{upstream: u.Host, handler: proxy, templates: templates,
+		templateData: opts.templateData, locales: newLocaleSet(templates, opts.DefaultLocale),
+		stats: stats, addressHeader: opts.UpstreamAddressHeader,
+		limit: newConcurrencyLimit(opts.UpstreamMaxConcurrentRequests)}
+	if opts.UpstreamBreakerThreshold > 0 {
+		upstream.breaker = NewCircuitBreaker(opts.UpstreamBreakerThreshold, opts.UpstreamBreakerCooldown)
+	}
+	return upstream
+}
+
+func NewOauthProxy(opts *Options, validator Validator) *OauthProxy {
+	p, err := newOauthProxy(opts, validator)
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	return p
+}
+
+// newOauthProxy is NewOauthProxy, but returns an error rather than exiting
+// so that a configuration reload can fail without stopping the proxy.
+func newOauthProxy(opts *Options, validator Validator) (*OauthProxy, error) {
+	templates := loadTemplates(opts.CustomTemplatesDir, opts.TemplateFuncs)
+	locales := newLocaleSet(templates, opts.DefaultLocale)
+	var reloader *templateReloader
+	if opts.TemplatesDevMode {
+		logger.Printf("templates-dev-mode: reloading templates from %q on every request", opts.CustomTemplatesDir)
+		reloader = newTemplateReloader(opts.CustomTemplatesDir, opts.TemplateFuncs, templates, locales)
+	}
+	var stats *StatsD
+	if opts.StatsDAddress != "" {
+		var err error
+		stats, err = NewStatsD(opts.StatsDAddress, opts.StatsDPrefix, opts.StatsDTags)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to statsd-address %s: %s", opts.StatsDAddress, err)
+		}
+		logger.Printf("sending metrics to statsd %s", opts.StatsDAddress)
+	}
+	var transport http.RoundTripper
+	if opts.UpstreamDNSRefresh > 0 {
+		transport = newUpstreamTransport(opts.UpstreamDNSRefresh)
+	}
+	canaries := make(map[string]*url.URL)
+	for _, u := range opts.canaryUrls {
+		canaries[u.Path] = u
+	}
+	serveMux := http.NewServeMux()
+	for _, u := range opts.proxyUrls {
+		path := u.Path
+		var handler http.Handler = newUpstreamProxy(u, opts, templates, stats, transport)
+		logger.Printf("mapping path %q => upstream %q", path, u)
+		if c, ok := canaries[path]; ok {
+			handler = NewCanaryProxy(handler, newUpstreamProxy(c, opts, templates, stats, transport), opts.CanaryPercent)
+			logger.Printf("mapping path %q => canary upstream %q (%d%%)", path, c, opts.CanaryPercent)
+		}
+		serveMux.Handle(path, handler)
+	}
+	for i, u := range opts.CompiledRegex {
+		if methods := opts.skipAuthMethods[i]; len(methods) != 0 {
+			logger.Printf("compiled skip-auth-regex => %q for %s", u, strings.Join(methods, ","))
+		} else {
+			logger.Printf("compiled skip-auth-regex => %q", u)
+		}
+	}
+
+	redirectUrl := opts.redirectUrl
+	redirectUrl.Path = oauthCallbackPath
+
+	logger.Printf("OauthProxy configured for %s", opts.ClientID)
+	domain := opts.CookieDomain
+	if domain == "" {
+		domain = "<default>"
+	}
+	if !opts.CookieHttpsOnly {
+		logger.Warnf("cookie-https-only setting is deprecated and will be removed in a future version. use cookie-secure")
+		opts.CookieSecure = opts.CookieHttpsOnly
+	}
+
+	logger.Printf("Cookie settings: secure (https):%v httponly:%v expiry:%s domain:%s", opts.CookieSecure, opts.CookieHttpOnly, opts.CookieExpire, domain)
+
+	var aes_cipher cipher.Block
+	if opts.PassAccessToken || (opts.CookieRefresh != time.Duration(0)) {
+		var err error
+		aes_cipher, err = aes.NewCipher([]byte(opts.CookieSecret))
+		if err != nil {
+			return nil, fmt.Errorf("error creating AES cipher with "+
+				"a %d byte cookie-secret: %s", len(opts.CookieSecret), err)
+		}
+	}
+
+	var jwtVerifier *JWTVerifier
+	if opts.JWTJWKSUrl != "" {
+		keys, err := NewRemoteKeySet(opts.JWTJWKSUrl, opts.JWTJWKSRefresh)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching jwt-jwks-url %s: %s", opts.JWTJWKSUrl, err)
+		}
+		logger.Printf("accepting bearer tokens issued by %s", opts.JWTIssuer)
+		jwtVerifier = &JWTVerifier{Issuer: opts.JWTIssuer, Audience: opts.JWTAudience, Keys: keys}
+	}
+
+	var introspector *TokenIntrospector
+	if opts.IntrospectionUrl != "" {
+		logger.Printf("introspecting bearer tokens with %s", opts.IntrospectionUrl)
+		introspector = NewTokenIntrospector(opts.IntrospectionUrl, opts.ClientID, opts.ClientSecret,
+			opts.IntrospectionAudience, opts.IntrospectionCacheTTL)
+	}
+
+	var tokens *tokenCache
+	if opts.ValidateTokenCacheTTL > 0 {
+		tokens = newTokenCache(opts.ValidateTokenCacheTTL)
+	}
+
+	var authz *AuthzWebhook
+	if opts.AuthzUrl != "" {
+		logger.Printf("authorizing requests with %s", opts.AuthzUrl)
+		authz = NewAuthzWebhook(opts.AuthzUrl, opts.AuthzTimeout)
+	}
+
+	var geoIP *GeoIPFilter
+	if opts.GeoIPDatabase != "" {
+		var err error
+		geoIP, err = NewGeoIPFilter(opts.GeoIPDatabase, opts.GeoIPAllowCountries, opts.GeoIPDenyCountries)
+		if err != nil {
+			return nil, fmt.Errorf("error opening geoip-database %s: %s", opts.GeoIPDatabase, err)
+		}
+		logger.Printf("restricting clients by country: allow %v deny %v", opts.GeoIPAllowCountries, opts.GeoIPDenyCountries)
+	}
+
+	if opts.ShadowMode {
+		logger.Warnf("shadow-mode is on; geoip, banned user, acl and authz denials are logged but not enforced")
+	}
+	if opts.MockProvider {
+		logger.Warnf("mock-provider is on; anyone can sign in as any user, for load tests only")
+	}
+
+	var rateLimiter RateLimiter
+	if opts.RateLimit > 0 && opts.RateLimitRedis != "" {
+		logger.Printf("rate limiting users to %d requests/s (burst %d) with redis %s", opts.RateLimit, opts.RateLimitBurst, opts.RateLimitRedis)
+		rateLimiter = NewRedisRateLimiter(opts.RateLimitRedis, float64(opts.RateLimit), opts.RateLimitBurst)
+	} else if opts.RateLimit > 0 {
+		logger.Printf("rate limiting users to %d requests/s (burst %d)", opts.RateLimit, opts.RateLimitBurst)
+		rateLimiter = NewMemoryRateLimiter(float64(opts.RateLimit), opts.RateLimitBurst)
+	}
+	var lockout *Lockout
+	if opts.HtpasswdMaxFailures > 0 {
+		lockout = NewLockout(opts.HtpasswdMaxFailures, opts.HtpasswdLockout)
+	}
+	var captcha *Captcha
+	if opts.CaptchaProvider != "" {
+		var err error
+		captcha, err = NewCaptcha(opts.CaptchaProvider, opts.CaptchaSiteKey, opts.CaptchaSecret)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("requiring a %s captcha on the sign in form", opts.CaptchaProvider)
+	}
+	var webauthn *WebAuthn
+	if opts.WebAuthnRPID != "" {
+		var err error
+		webauthn, err = NewWebAuthn(opts.WebAuthnRPID, opts.WebAuthnCredentialsFile, opts.WebAuthnRequired)
+		if err != nil {
+			return nil, fmt.Errorf("error loading webauthn-credentials-file: %s", err)
+		}
+		logger.Printf("asking for security keys registered for %s", opts.WebAuthnRPID)
+	}
+	var signInRateLimiter RateLimiter
+	if opts.SignInRateLimit > 0 {
+		perSecond := float64(opts.SignInRateLimit) / 60
+		logger.Printf("rate limiting sign ins to %d/minute (burst %d) per client IP", opts.SignInRateLimit, opts.SignInRateLimitBurst)
+		if opts.RateLimitRedis != "" {
+			signInRateLimiter = NewRedisRateLimiter(opts.RateLimitRedis, perSecond, opts.SignInRateLimitBurst)
+		} else {
+			signInRateLimiter = NewMemoryRateLimiter(perSecond, opts.SignInRateLimitBurst)
+		}
+	}
+
+	var sessionBinding *SessionBinding
+	if len(opts.SessionBinding) != 0 {
+		var err error
+		sessionBinding, err = NewSessionBinding(opts.CookieSecret, opts.SessionBinding,
+			opts.SessionBindingIPv4Prefix, opts.SessionBindingIPv6Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring session-binding: %s", err)
+		}
+		logger.Printf("binding sessions to the client %s", strings.Join(opts.SessionBinding, " and "))
+	}
+
+	return &OauthProxy{
+		CookieKey:      "_oauthproxy",
+		CookieSeed:     opts.CookieSecret,
+		CookieDomain:   opts.CookieDomain,
+		CookieSecure:   opts.CookieSecure,
+		CookieHttpOnly: opts.CookieHttpOnly,
+		CookieExpire:   opts.CookieExpire,
+		CookieRefresh:  opts.CookieRefresh,
+		Validator:      validator,
+		Bans:           NewBanList(""),
+		SessionCutoff:  NewSessionCutoff(opts.rejectSessionsBefore),
+		AdminToken:     opts.AdminToken,
+		Stats:          stats,
+
+		clientID:          opts.ClientID,
+		clientSecret:      opts.ClientSecret,
+		oauthScope:        opts.provider.Data().Scope,
+		provider:          opts.provider,
+		oauthLoginUrl:     opts.provider.Data().LoginUrl,
+		oauthValidateUrl:  opts.provider.Data().ValidateUrl,
+		serveMux:          serveMux,
+		redirectUrl:       redirectUrl,
+		skipAuthRegex:     opts.SkipAuthRegex,
+		skipAuthPreflight: opts.SkipAuthPreflight,
+		skipAuth:          newSkipAuthRules(opts.CompiledRegex, opts.skipAuthMethods),
+		stepUpRegex:       opts.stepUpRegex,
+		stepUpMaxAge:      opts.StepUpMaxAge,
+		silentSSO:         opts.SilentSSO,
+		trustedIPs:        opts.trustedIPs,
+		trustedIPIdentity: opts.TrustedIPIdentity,
+		trustedProxies:    opts.trustedProxies,
+		whitelistDomains:  opts.WhitelistDomains,
+		clientIPHeader:    opts.ClientIPHeader,
+		acl:               opts.acl,
+		authz:             authz,
+		rateLimiter:       rateLimiter,
+		signInLimiter:     signInRateLimiter,
+		lockout:           lockout,
+		captcha:           captcha,
+		webauthn:          webauthn,
+		securityHeaders:   opts.SecurityHeaders,
+		geoIP:             geoIP,
+		shadowMode:        opts.ShadowMode,
+		normalizeEmails:   opts.NormalizeEmails,
+		clientCertAuth:    opts.clientCAs != nil,
+		sessionBinding:    sessionBinding,
+		jwtVerifier:       jwtVerifier,
+		introspector:      introspector,
+		requireVerified:   opts.RequireVerifiedEmail,
+		tokenCache:        tokens,
+		concurrencyLimit:  newConcurrencyLimit(opts.MaxConcurrentRequests),
+		sessionCache:      newSessionCache(opts.SessionCacheSize),
+		redeemQueue:       newRedeemQueue(opts.RedeemMaxConcurrent, opts.RedeemQueueTimeout),
+		PassBasicAuth:     opts.PassBasicAuth,
+		BasicAuthPassword: opts.BasicAuthPassword,
+		PassAccessToken:   opts.PassAccessToken,
+		stripAuthHeader:   opts.StripAuthorizationHeader,
+		passAuthHeader:    opts.PassAuthorizationHeader,
+		userHeader:        opts.UserHeader,
+		emailHeader:       opts.EmailHeader,
+		groupsHeader:      opts.GroupsHeader,
+		nameHeader:        opts.NameHeader,
+		usernameHeader:    opts.PreferredUsernameHeader,
+		authHeader:        opts.AuthResponseHeader,
+		AesCipher:         aes_cipher,
+		templates:         templates,
+		style:             loadStyle(opts.CustomTemplatesDir),
+		templateReloader:  reloader,
+		templateData:      opts.templateData,
+		SignInMessage:     opts.SignInMessage,
+		locales:           locales,
+		banner:            template.HTML(opts.Banner),
+		footer:            template.HTML(opts.Footer),
+	}, nil
+}
+
+func (p *OauthProxy) GetRedirectUrl(host string) string {
+	// default to the request Host if not set
+	if p.redirectUrl.Host != "" {
+		return p.redirectUrl.String()
+	}
+	var u url.URL
+	u = *p.redirectUrl
+	if u.Scheme == "" {
+		if p.CookieSecure {
+			u.Scheme = "https"
+		} else {
+			u.Scheme = "http"
+		}
+	}
+	u.Host = host
+	return u.String()
+}
+
+func (p *OauthProxy) GetLoginURL(host, redirect string) string {
+	return p.getLoginURL(host, redirect, "")
+}
+
+// getLoginURL builds the provider login URL. prompt "login" asks the
+// provider to re-authenticate the user rather than reuse their session, and
+// "none" to fail rather than interact with them. With "login", max_age also
+// asks for the auth_time claim that shows whether it did, and the state is
+// signed so the callback knows it was asked for.
+func (p *OauthProxy) getLoginURL(host, redirect, prompt string) string {
+	params := url.Values{}
+	params.Add("redirect_uri", p.GetRedirectUrl(host))
+	if prompt != "" {
+		params.Add("prompt", prompt)
+		if prompt == "login" {
+			params.Add("max_age", strconv.Itoa(int(p.stepUpMaxAge.Seconds())))
+		}
+	} else {
+		params.Add("approval_prompt", "force")
+	}
+	params.Add("scope", p.oauthScope)
+	params.Add("client_id", p.clientID)
+	params.Add("response_type", "code")
+	if redirect != "" {
+		state := validRedirect(redirect, host, p.whitelistDomains)
+		if prompt == "login" {
+			state = p.loginState(state, time.Now())
+		}
+		params.Add("state", state)
+	}
+	return fmt.Sprintf("%s?%s", p.oauthLoginUrl, params.Encode())
+}
+
+// loginStatePrefix starts the state of a prompt=login sign in, followed by
+// when it was started, a signature and the redirect.
+const loginStatePrefix = "login:"
+
+// loginState returns the state of a prompt=login sign in started at now.
+func (p *OauthProxy) loginState(redirect string, now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := cookieSignature(p.CookieSeed, loginStatePrefix, ts, redirect)
+	return loginStatePrefix + ts + ":" + sig + ":" + redirect
+}
+
+// parseState returns the redirect of the state a callback got and whether
+// it is the state of a prompt=login sign in, signed by loginState, started
+// no longer than stepUpMaxAge ago.
+func (p *OauthProxy) parseState(state string) (redirect string, login bool) {
+	if !strings.HasPrefix(state, loginStatePrefix) {
+		return state, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(state, loginStatePrefix), ":", 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || !checkHmac(parts[1], cookieSignature(p.CookieSeed, loginStatePrefix, parts[0], parts[2])) {
+		return parts[2], false
+	}
+	return parts[2], time.Since(time.Unix(ts, 0)) <= p.stepUpMaxAge
+}
+
+func (p *OauthProxy) displayCustomLoginForm() bool {
+	return p.HtpasswdValidator != nil && p.DisplayHtpasswdForm
+}
+
+func (p *OauthProxy) redeemCode(host, code string) (*SessionState, error) {
+	if code == "" {
+		return nil, errors.New("missing code")
+	}
+	redirectUri := p.GetRedirectUrl(host)
+	body, access_token, err := p.provider.Redeem(redirectUri, code)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := p.provider.GetEmailAddress(body, access_token)
+	if err != nil {
+		return nil, err
+	}
+	session := &SessionState{Email: normalizeEmail(email, p.normalizeEmails), AccessToken: access_token}
+
+	if gp, ok := p.provider.(providers.GroupsProvider); ok {
+		session.Groups, err = gp.GetGroups(body, access_token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if up, ok := p.provider.(providers.UsernameProvider); ok {
+		session.PreferredUsername, err = up.GetPreferredUsername(body, access_token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ap, ok := p.provider.(providers.AuthTimeProvider); ok {
+		// a sign in may reuse the user's session with the provider, so
+		// only the provider knows when they last authenticated
+		session.AuthTime, err = ap.GetAuthTime(body, access_token)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		session.AuthTime = time.Now()
+	}
+	return session, nil
+}
+
+func (p *OauthProxy) MakeCookie(req *http.Request, value string, expiration time.Duration) *http.Cookie {
+	domain := req.Host
+	if h, _, err := net.SplitHostPort(domain); err == nil {
+		domain = h
+	}
+	if p.CookieDomain != "" {
+		if !strings.HasSuffix(domain, p.CookieDomain) {
+			logger.Warnf("request host is %q but using configured cookie domain of %q", domain, p.CookieDomain)
+		}
+		domain = p.CookieDomain
+	}
+
+	if value != "" {
+		value = signedCookieValue(p.CookieSeed, p.CookieKey, value)
+	}
+
+	return &http.Cookie{
+		Name:     p.CookieKey,
+		Value:    value,
+		Path:     "/",
+		Domain:   domain,
+		HttpOnly: p.CookieHttpOnly,
+		Secure:   p.CookieSecure,
+		Expires:  time.Now().Add(expiration),
+	}
+}
+
+func (p *OauthProxy) ClearCookie(rw http.ResponseWriter, req *http.Request) {
+	http.SetCookie(rw, p.MakeCookie(req, "", time.Duration(1)*time.Hour*-1))
+}
+
+func (p *OauthProxy) SetCookie(rw http.ResponseWriter, req *http.Request, val string) {
+	http.SetCookie(rw, p.MakeCookie(req, val, p.CookieExpire))
+}
+
+// SignOut clears the session cookie and redirects to the rd parameter, or
+// to /. Only POST requests sign out, so that another site can't sign users
+// out with a link or image.
+func (p *OauthProxy) SignOut(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		rw.Header().Set("Allow", "POST")
+		p.ErrorPage(rw, req, http.StatusMethodNotAllowed, "Method Not Allowed", "Sign out with a POST request")
+		return
+	}
+	var session *SessionState
+	if cookie, err := req.Cookie(p.CookieKey); err == nil {
+		if value, _, ok := validateCookie(cookie, p.CookieSeed); ok {
+			session, _ = parseSessionValue(value, p.AesCipher)
+		}
+	}
+	p.ClearCookie(rw, req)
+	if session != nil {
+		logger.Printf("%s %s signed out", p.clientIP(req), session.identity())
+		p.audit(auditSignOut, req, session.identity(), "", nil)
+		if p.OnSignOut != nil {
+			p.OnSignOut(req, session)
+		}
+	}
+	p.redirect(rw, req, validRedirect(req.FormValue("rd"), req.Host, p.whitelistDomains))
+}
+
+func (p *OauthProxy) ProcessCookie(rw http.ResponseWriter, req *http.Request) (email, user, access_token string, ok bool) {
+	session, ok := p.LoadCookiedSession(rw, req)
+	if session != nil {
+		email, user, access_token = session.Email, session.User, session.AccessToken
+	}
+	return
+}
+
+func (p *OauthProxy) LoadCookiedSession(rw http.ResponseWriter, req *http.Request) (session *SessionState, ok bool) {
+	var value string
+	var timestamp time.Time
+	cookie, err := req.Cookie(p.CookieKey)
+	if err == nil {
+		value, timestamp, session, ok, err = p.decodeSessionCookie(cookie)
+		if ok && p.SessionCutoff.Rejects(timestamp) {
+			logger.Printf("%s rejecting session issued %s, before reject-sessions-before", p.clientIP(req), timestamp.Format(time.RFC3339))
+			session, ok = nil, false
+		}
+		if err == nil && ok && !p.checkSessionBinding(session, req) {
+			logger.Printf("%s rejecting session of %s from a different client", p.clientIP(req), session.identity())
+			p.audit(auditValidationFailed, req, session.identity(), "session used from a different client", Fields{"via": "cookie"})
+			ok = false
+		}
+	}
+	if err != nil {
+		logger.Errorf("%s", err)
+		ok = false
+	} else if ok && p.CookieRefresh != time.Duration(0) {
+		expires := timestamp.Add(p.CookieExpire)
+		refresh_threshold := time.Now().Add(p.CookieRefresh)
+		if refresh_threshold.Unix() > expires.Unix() {
+			// concurrent requests with this cookie share one refresh,
+			// and only the first sets the refreshed cookie
+			var leader bool
+			ok, leader = p.refreshes.Do(value, func() bool {
+				_, span := tracer().Start(req.Context(), "provider.ValidateToken")
+				valid := p.Validator.Validate(req, session) && p.validateToken(session.AccessToken)
+				span.SetAttributes(attribute.Bool("valid", valid))
+				span.End()
+				return valid
+			})
+			if !leader {
+				return
+			}
+			if ok {
+				p.SetCookie(rw, req, value)
+				p.audit(auditRefresh, req, session.Email, "", nil)
+				if p.OnSessionRefreshed != nil {
+					p.OnSessionRefreshed(req, session)
+				}
+			} else {
+				p.audit(auditRefreshFailed, req, session.Email, "session is no longer valid", nil)
+			}
+		}
+	}
+	return
+}
+
+func (p *OauthProxy) RobotsTxt(rw http.ResponseWriter) {
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprintf(rw, "User-agent: *\nDisallow: /")
+}
+
+func (p *OauthProxy) PingPage(rw http.ResponseWriter) {
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprintf(rw, "OK")
+}
+
+// StylePage serves the stylesheet of the built-in templates, or its
+// replacement in custom-templates-dir.
+func (p *OauthProxy) StylePage(rw http.ResponseWriter) {
+	style := p.style
+	rw.Header().Set("Content-Type", "text/css; charset=utf-8")
+	if p.templateReloader != nil {
+		style = loadStyle(p.templateReloader.dir)
+		rw.Header().Set("Cache-Control", "no-cache")
+	} else {
+		rw.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprint(rw, style)
+}
+
+func (p *OauthProxy) ErrorPage(rw http.ResponseWriter, req *http.Request, code int, title string, message string) {
+	p.errorPage(rw, req, code, "", title, message)
+}
+
+// errorPage is ErrorPage, with reason as the error code of its JSON form
+// instead of one for the status code.
+func (p *OauthProxy) errorPage(rw http.ResponseWriter, req *http.Request, code int, reason string, title string, message string) {
+	logger.Printf("ErrorPage %d %s %s", code, title, message)
+	templates, locales := p.pageTemplates()
+	if wantsJSON(req) {
+		if reason == "" {
+			reason = errorCode(code)
+		}
+		writeJSON(rw, code, jsonError{Error: reason, Message: redactor.Redact(translate(locales.negotiate(req), message))})
+		return
+	}
+	renderErrorPage(templates, p.templateData, locales.negotiate(req), rw, code, title, message)
+}
+
+// redirect sends the user to redirect_url, or tells a client that wants JSON
+// to.
+func (p *OauthProxy) redirect(rw http.ResponseWriter, req *http.Request, redirect_url string) {
+	if wantsJSON(req) {
+		writeJSON(rw, http.StatusOK, jsonRedirect{Redirect: redirect_url})
+		return
+	}
+	http.Redirect(rw, req, redirect_url, 302)
+}
+
+// renderErrorPage writes the error page in locale, translating title and
+// message if they are built-in strings.
+func renderErrorPage(templates *template.Template, data map[string]string, locale string, rw http.ResponseWriter, code int, title string, message string) {
+	setTemplateCSP(templates, rw, nil)
+	rw.WriteHeader(code)
+	t := struct {
+		Title   string
+		Message string
+		Data    map[string]string
+		Locale  string
+	}{
+		Title:   fmt.Sprintf("%d %s", code, translate(locale, title)),
+		Message: redactor.Redact(translate(locale, message)),
+		Data:    data,
+		Locale:  locale,
+	}
+	templates.ExecuteTemplate(rw, localizedTemplate(templates, "error.html", locale), t)
+}
+
+func (p *OauthProxy) SignInPage(rw http.ResponseWriter, req *http.Request, code int) {
+	redirect_url := req.URL.RequestURI()
+	if redirect_url == signInPath {
+		redirect_url = "/"
+	}
+	p.signInPage(rw, req, code, redirect_url, "")
+}
+
+// signInPage is SignInPage, returning to redirect_url once signed in, and
+// passing prompt to the provider when the user signs in there.
+func (p *OauthProxy) signInPage(rw http.ResponseWriter, req *http.Request, code int, redirect_url string, prompt string) {
+	p.ClearCookie(rw, req)
+
+	templates, locales := p.pageTemplates()
+	providerName := p.provider.Data().ProviderName
+	if wantsJSON(req) {
+		params := url.Values{"rd": {redirect_url}}
+		if prompt != "" {
+			params.Set("prompt", prompt)
+		}
+		writeJSON(rw, code, jsonSignIn{
+			LoginURL: oauthStartPath + "?" + params.Encode(),
+			Redirect: redirect_url,
+			Provider: providerName,
+		})
+		return
+	}
+	message := renderSignInMessage(p.SignInMessage, signInMessageData{
+		URL: redirect_url, Host: req.Host, ProviderName: providerName})
+	t := struct {
+		ProviderName  string
+		SignInMessage string
+		CustomLogin   bool
+		TOTP          bool
+		Captcha       *Captcha
+		Redirect      string
+		Prompt        string
+		Version       string
+		Data          map[string]string
+		Locale        string
+		Banner        template.HTML
+		Footer        template.HTML
+	}{
+		ProviderName:  providerName,
+		SignInMessage: message,
+		CustomLogin:   p.displayCustomLoginForm(),
+		TOTP:          p.HtpasswdTOTP != nil,
+		Captcha:       p.captcha,
+		Redirect:      redirect_url,
+		Prompt:        prompt,
+		Version:       VERSION,
+		Data:          p.templateData,
+		Locale:        locales.negotiate(req),
+		Banner:        p.banner,
+		Footer:        p.footer,
+	}
+	setTemplateCSP(templates, rw, t)
+	rw.WriteHeader(code)
+	templates.ExecuteTemplate(rw, localizedTemplate(templates, "sign_in.html", t.Locale), t)
+}
+
+func (p *OauthProxy) ManualSignIn(rw http.ResponseWriter, req *http.Request) (*SessionState, bool) {
+	if req.Method != "POST" || p.HtpasswdValidator == nil {
+		return nil, false
+	}
+	user := req.FormValue("username")
+	passwd := req.FormValue("password")
+	if user == "" {
+		return nil, false
+	}
+	if p.captcha != nil {
+		ip := p.clientIP(req).String()
+		if err := p.captcha.Verify(req, ip); err != nil {
+			logger.Printf("%s rejecting sign in of %q: %s", ip, user, err)
+			p.audit(auditSignInFailed, req, user, "captcha failed", Fields{"via": "htpasswd"})
+			return nil, false
+		}
+	}
+	// check auth
+	if u, ok := p.checkPassword(req, user, passwd, req.FormValue("totp"), "htpasswd"); ok {
+		logger.Printf("authenticated %q via manual sign in", user)
+		return &SessionState{Email: user, Groups: u.Groups, Name: u.Name}, true
+	}
+	return nil, false
+}
+
+// checkPassword checks a password against the htpasswd file or proxy, and
+// the TOTP code of users with a secret in HtpasswdTOTP, unless user is locked
+// out from the client's IP after too many failures. via is how the password
+// was given, for the audit log.
+func (p *OauthProxy) checkPassword(req *http.Request, user, passwd, code, via string) (*HtpasswdUser, bool) {
+	event := auditSignInFailed
+	if via == "basic_auth" {
+		event = auditValidationFailed
+	}
+	ip := p.clientIP(req).String()
+	if locked, wait := p.lockout.Locked(user, ip); locked {
+		logger.Printf("%s rejecting %q, locked out for %s", ip, user, wait.Round(time.Second))
+		p.audit(event, req, user, "locked out", Fields{"via": via})
+		return nil, false
+	}
+	reason := "invalid password"
+	if u, ok := p.HtpasswdValidator(user, passwd); ok {
+		if !p.HtpasswdTOTP.Has(user) || p.HtpasswdTOTP.Validate(user, code) {
+			p.lockout.Success(user, ip)
+			return u, true
+		}
+		reason = "invalid totp code"
+	}
+	p.audit(event, req, user, reason, Fields{"via": via})
+	if lockout := p.lockout.Failure(user, ip); lockout > 0 {
+		logger.Printf("%s locking out %q for %s after repeated failures", ip, user, lockout)
+		p.audit(auditLockedOut, req, user, "too many failed attempts", Fields{"via": via, "duration": lockout.Seconds()})
+	}
+	return nil, false
+}
+
+func (p *OauthProxy) GetRedirect(req *http.Request) (string, error) {
+	err := req.ParseForm()
+
+	if err != nil {
+		return "", err
+	}
+
+	redirect := validRedirect(req.FormValue("rd"), req.Host, p.whitelistDomains)
+	return redirect, err
+}
+
+func (p *OauthProxy) isSkipAuth(req *http.Request) bool {
+	return p.skipAuth.Match(req.Method, req.URL.Path)
+}
+
+// enforce renders an error page for a request that failed an access check
+// and returns true. In shadow mode the failure has already been logged, so
+// it only notes that the request is proxied anyway and returns false.
+func (p *OauthProxy) enforce(rw http.ResponseWriter, req *http.Request, code int, title string, message string) bool {
+	if p.shadowMode {
+		logger.Printf("%s shadow mode: proxying %s %s that would get %d %s", p.clientIP(req), req.Method, req.URL.Path, code, title)
+		return false
+	}
+	p.ErrorPage(rw, req, code, title, message)
+	return true
+}
+
+// audit records an authentication event in the audit log and metrics, if
+// enabled.
+func (p *OauthProxy) audit(event string, req *http.Request, email, reason string, fields Fields) {
+	if via, ok := fields["via"]; ok {
+		p.Stats.Incr("auth."+event, fmt.Sprintf("via:%s", via))
+	} else {
+		p.Stats.Incr("auth." + event)
+	}
+	if p.Audit == nil {
+		return
+	}
+	p.Audit.Event(event, req, p.clientIP(req).String(), email, reason, fields)
+}
+
+// auditDenied records an authorization denial, noting whether shadow mode
+// let the request through anyway. session is nil if the user isn't known.
+func (p *OauthProxy) auditDenied(req *http.Request, session *SessionState, reason string) {
+	var identity string
+	if session != nil {
+		identity = session.identity()
+	}
+	p.audit(auditDenied, req, identity, reason, Fields{"enforced": !p.shadowMode})
+	if p.OnAuthorizationDenied != nil {
+		p.OnAuthorizationDenied(req, session, reason)
+	}
+}
+
+// tooManyRequests rejects a rate limited request, telling the client when to
+// retry.
+func (p *OauthProxy) tooManyRequests(rw http.ResponseWriter, req *http.Request, retry time.Duration) {
+	rw.Header().Set("Retry-After", fmt.Sprintf("%d", int(retry.Seconds()+1)))
+	p.ErrorPage(rw, req, http.StatusTooManyRequests, "Too Many Requests", "You are making requests too quickly. Please slow down.")
+}
+
+// requiresStepUp reports whether req is for a path that requires the user
+// to have signed in within stepUpMaxAge.
+func (p *OauthProxy) requiresStepUp(req *http.Request) bool {
+	for _, u := range p.stepUpRegex {
+		if u.MatchString(req.URL.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// stepUp sends a user whose sign in is too old for req to sign in again:
+// to the provider with prompt=login or, as they may have signed in with the
+// htpasswd form, to the sign in page when it shows the form.
+func (p *OauthProxy) stepUp(rw http.ResponseWriter, req *http.Request) {
+	if p.displayCustomLoginForm() {
+		p.signInPage(rw, req, 403, req.URL.RequestURI(), "login")
+		return
+	}
+	params := url.Values{"rd": {req.URL.RequestURI()}, "prompt": {"login"}}
+	http.Redirect(rw, req, oauthStartPath+"?"+params.Encode(), 302)
+}
+
+// SignIn serves the sign in page, and signs users in with the htpasswd
+// form posted from it.
+func (p *OauthProxy) SignIn(rw http.ResponseWriter, req *http.Request) {
+	redirect, err := p.GetRedirect(req)
+	if err != nil {
+		p.ErrorPage(rw, req, 500, "Internal Error", err.Error())
+		return
+	}
+
+	session, ok := p.ManualSignIn(rw, req)
+	if ok {
+		session.AuthTime = time.Now()
+		p.bindSession(session, req)
+		if p.OnAuthenticated != nil {
+			p.OnAuthenticated(req, session)
+		}
+		value, _ := buildSessionValue(session, nil)
+		p.SetCookie(rw, req, value)
+		p.audit(auditSignIn, req, session.Email, "", Fields{"via": "htpasswd"})
+		p.redirect(rw, req, redirect)
+	} else {
+		p.SignInPage(rw, req, 200)
+	}
+}
+
+// OAuthStart sends the user to the provider to sign in.
+func (p *OauthProxy) OAuthStart(rw http.ResponseWriter, req *http.Request) {
+	redirect, err := p.GetRedirect(req)
+	if err != nil {
+		p.ErrorPage(rw, req, 500, "Internal Error", err.Error())
+		return
+	}
+	var prompt string
+	if req.Form.Get("prompt") == "login" {
+		prompt = "login"
+	}
+	loginURL := p.getLoginURL(req.Host, redirect, prompt)
+	if wantsJSON(req) {
+		writeJSON(rw, http.StatusOK, jsonSignIn{
+			LoginURL: loginURL,
+			Redirect: redirect,
+			Provider: p.provider.Data().ProviderName,
+		})
+		return
+	}
+	http.Redirect(rw, req, loginURL, 302)
+}
+
+// OAuthCallback finishes a sign in with the provider, redeeming the code it
+// sends the user back with for a session.
+func (p *OauthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
+	remoteAddr := p.clientIP(req).String()
+	err := req.ParseForm()
+	if err != nil {
+		p.ErrorPage(rw, req, 500, "Internal Error", err.Error())
+		return
+	}
+	redirect, login := p.parseState(req.Form.Get("state"))
+	errorString := req.Form.Get("error")
+	if p.silentSSO && silentSSOFailed(errorString) {
+		// the user has to sign in with the provider themselves
+		p.signInPage(rw, req, 403, validRedirect(redirect, req.Host, p.whitelistDomains), "")
+		return
+	}
+	if errorString != "" {
+		p.audit(auditSignInFailed, req, "", errorString, nil)
+		p.errorPage(rw, req, 403, errorString, "Permission Denied", errorString)
+		return
+	}
+
+	if err := p.redeemQueue.Acquire(req.Context(), p.Stats); err != nil {
+		logger.Printf("%s not redeeming code: %s", remoteAddr, err)
+		shed(rw)
+		p.errorPage(rw, req, http.StatusServiceUnavailable, "redeem_busy", "Service Unavailable", overloadedMessage)
+		return
+	}
+	_, span := tracer().Start(req.Context(), "provider.Redeem")
+	session, err := p.redeemCode(req.Host, req.Form.Get("code"))
+	traceError(span, err)
+	span.End()
+	p.redeemQueue.Release()
+	if err == providers.ErrEmailNotVerified {
+		logger.Printf("%s rejecting unverified email", remoteAddr)
+		p.audit(auditSignInFailed, req, "", "email not verified", nil)
+		p.errorPage(rw, req, 403, "email_not_verified", "Permission Denied", "Your email address has not been verified")
+		return
+	}
+	if err == providers.ErrMFARequired {
+		logger.Printf("%s rejecting sign in without multi-factor authentication", remoteAddr)
+		p.audit(auditSignInFailed, req, "", "multi-factor authentication required", nil)
+		p.errorPage(rw, req, 403, "mfa_required", "Permission Denied", mfaRequiredMessage)
+		return
+	}
+	if err != nil {
+		logger.Errorf("%s error redeeming code %s", remoteAddr, err)
+		p.audit(auditSignInFailed, req, "", "error redeeming code: "+err.Error(), nil)
+		p.errorPage(rw, req, 500, "redeem_failed", "Internal Error", err.Error())
+		return
+	}
+
+	redirect = validRedirect(redirect, req.Host, p.whitelistDomains)
+	if session.AuthTime.IsZero() && login {
+		// the provider didn't say when the user authenticated, but was
+		// just asked to make them do it again
+		session.AuthTime = time.Now()
+	}
+
+	// set cookie, or deny
+	p.bindSession(session, req)
+	if p.Validator.Validate(req, session) {
+		logger.Printf("%s authenticating %s completed", remoteAddr, session.Email)
+		if p.OnAuthenticated != nil {
+			p.OnAuthenticated(req, session)
+		}
+		value, err := buildSessionValue(session, p.AesCipher)
+		if err != nil {
+			logger.Errorf("%s", err)
+		}
+		p.SetCookie(rw, req, value)
+		p.audit(auditSignIn, req, session.Email, "", Fields{"via": "oauth"})
+		p.redirect(rw, req, redirect)
+		return
+	} else {
+		p.audit(auditSignInFailed, req, session.Email, "email not allowed", nil)
+		if p.OnAuthorizationDenied != nil {
+			p.OnAuthorizationDenied(req, session, "email not allowed")
+		}
+		p.errorPage(rw, req, 403, "email_not_allowed", "Permission Denied", "Invalid Account")
+		return
+	}
+}
+
+func (p *OauthProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	p.serve(rw, req, p.serveMux)
+}
+
+// serve handles req, passing it to next once it is authenticated and
+// authorized.
+func (p *OauthProxy) serve(rw http.ResponseWriter, req *http.Request, next http.Handler) {
+	if p.securityHeaders == "pages" || p.securityHeaders == "all" {
+		rw = &securityHeadersWriter{ResponseWriter: rw, upstream: p.securityHeaders == "all"}
+	}
+	stripIdentityHeaders(req, p.trustedProxies, p.userHeader, p.emailHeader, p.groupsHeader, p.nameHeader, p.usernameHeader)
+	remoteAddr := p.clientIP(req).String()
+	rw.Header().Set("GAP-Client-IP", remoteAddr)
+
+	var ok bool
+	var session *SessionState
+
+	route := controlRoutes.match(req.URL.Path)
+	if route.at(stageUnlimited) {
+		route.handler(p, rw, req)
+		return
+	}
+
+	if !p.concurrencyLimit.Acquire() {
+		logger.Printf("%s shedding %s %s: max-concurrent-requests reached", remoteAddr, req.Method, req.URL.Path)
+		p.Stats.Incr("requests.shed")
+		shed(rw)
+		p.ErrorPage(rw, req, http.StatusServiceUnavailable, "Service Unavailable", overloadedMessage)
+		return
+	}
+	defer p.concurrencyLimit.Release()
+
+	if route.at(stageStatic) {
+		route.handler(p, rw, req)
+		return
+	}
+
+	if p.geoIP != nil {
+		allowed, country, err := p.geoIP.Allowed(p.clientIP(req))
+		if err != nil {
+			logger.Printf("%s %s", remoteAddr, err)
+			if p.enforce(rw, req, 500, "Internal Error", "Error checking client location") {
+				return
+			}
+		} else if !allowed {
+			logger.Printf("%s denied access from country %q", remoteAddr, country)
+			p.auditDenied(req, nil, fmt.Sprintf("country %q not allowed", country))
+			if p.enforce(rw, req, 403, "Permission Denied", "Access is not permitted from your location") {
+				return
+			}
+		}
+	}
+
+	if route.at(stageAdmin) {
+		route.handler(p, rw, req)
+		return
+	}
+
+	if p.skipAuthPreflight && req.Method == "OPTIONS" {
+		next.ServeHTTP(rw, req)
+		return
+	}
+
+	if p.isSkipAuth(req) {
+		next.ServeHTTP(rw, req)
+		return
+	}
+
+	if route.at(stageSignIn) {
+		if route.signIn && p.signInLimiter != nil {
+			// keyed by client IP, as sign in requests have no session
+			if ok, retry := p.signInLimiter.Allow("signin:" + remoteAddr); !ok {
+				logger.Printf("%s rate limiting sign in", remoteAddr)
+				p.tooManyRequests(rw, req, retry)
+				return
+			}
+		}
+		route.handler(p, rw, req)
+		return
+	}
+
+	var cookied bool
+	if !ok {
+		session, ok = p.LoadCookiedSession(rw, req)
+		cookied = ok
+	}
+
+	if !ok {
+		session, ok = p.CheckBearerToken(req)
+	}
+
+	if !ok {
+		session, ok = p.CheckClientCertificate(req)
+	}
+
+	if !ok {
+		session, ok = p.CheckBasicAuth(req)
+	}
+
+	if !ok && p.trustedIPs.Contains(p.clientIP(req)) {
+		if p.trustedIPIdentity == "" {
+			next.ServeHTTP(rw, req)
+			return
+		}
+		session, ok = &SessionState{User: p.trustedIPIdentity}, true
+		if strings.Contains(p.trustedIPIdentity, "@") {
+			session.Email = p.trustedIPIdentity
+			session.User = strings.Split(p.trustedIPIdentity, "@")[0]
+		}
+	}
+
+	if !ok {
+		if p.silentSSO && p.trySilentSSO(rw, req) {
+			return
+		}
+		p.SignInPage(rw, req, 403)
+		return
+	}
+
+	if p.Bans.IsBanned(session.identity()) {
+		logger.Printf("%s rejecting banned user %s", remoteAddr, session.identity())
+		p.auditDenied(req, session, "banned")
+		if !p.shadowMode {
+			p.ClearCookie(rw, req)
+		}
+		if p.enforce(rw, req, 403, "Permission Denied", "Your account has been blocked") {
+			return
+		}
+	}
+
+	if p.rateLimiter != nil {
+		if ok, retry := p.rateLimiter.Allow(session.identity()); !ok {
+			logger.Printf("%s rate limiting %s", remoteAddr, session.identity())
+			p.tooManyRequests(rw, req, retry)
+			return
+		}
+	}
+
+	if p.requiresStepUp(req) && time.Since(session.AuthTime) > p.stepUpMaxAge {
+		if cookied {
+			logger.Printf("%s %s requires a fresh sign in for %s", remoteAddr, session.identity(), req.URL.Path)
+			p.stepUp(rw, req)
+			return
+		}
+		// bearer tokens, client certificates and basic auth aren't sign
+		// ins, so can't be made fresh
+		logger.Printf("%s %s needs to sign in to access %s", remoteAddr, session.identity(), req.URL.Path)
+		p.auditDenied(req, session, "step-up requires signing in")
+		if p.enforce(rw, req, 403, "Permission Denied", "You need to sign in again to access this page") {
+			return
+		}
+	}
+
+	if cookied && p.webauthn.Pending(session) {
+		params := url.Values{"rd": {req.URL.RequestURI()}}
+		http.Redirect(rw, req, webauthnPath+"?"+params.Encode(), 302)
+		return
+	}
+
+	if p.acl != nil {
+		if allowed, rule := p.acl.Allowed(req, session); !allowed {
+			logger.Printf("%s %s denied access to %s by acl rule path=%q", remoteAddr, session.identity(), req.URL.Path, rule.Path)
+			p.auditDenied(req, session, fmt.Sprintf("acl rule path=%q", rule.Path))
+			if p.enforce(rw, req, 403, "Permission Denied", "You are not authorized to access this page") {
+				return
+			}
+		}
+	}
+
+	if p.authz != nil {
+		result, err := p.authz.Authorize(req, session)
+		if err != nil {
+			logger.Errorf("%s error authorizing %s: %s", remoteAddr, session.identity(), err)
+			if p.enforce(rw, req, 500, "Internal Error", "Error authorizing request") {
+				return
+			}
+		} else if !result.Allow {
+			logger.Printf("%s %s denied access to %s by authz", remoteAddr, session.identity(), req.URL.Path)
+			p.auditDenied(req, session, "authz")
+			if p.enforce(rw, req, 403, "Permission Denied", "You are not authorized to access this page") {
+				return
+			}
+		} else {
+			for k, v := range result.Headers {
+				req.Header.Set(k, v)
+			}
+		}
+	}
+
+	// At this point, the user is authenticated. proxy normally
+	if p.PassBasicAuth && !p.passAuthHeader {
+		req.SetBasicAuth(session.User, p.BasicAuthPassword)
+	} else if p.stripAuthHeader {
+		req.Header.Del("Authorization")
+	}
+	if p.PassBasicAuth {
+		if p.userHeader != "" {
+			req.Header.Set(p.userHeader, session.User)
+		}
+		if p.emailHeader != "" {
+			req.Header.Set(p.emailHeader, session.Email)
+		}
+		setIdentityHeader(req, p.groupsHeader, strings.Join(session.Groups, ","))
+		setIdentityHeader(req, p.nameHeader, session.Name)
+		setIdentityHeader(req, p.usernameHeader, session.PreferredUsername)
+	}
+	if p.PassAccessToken {
+		req.Header["X-Forwarded-Access-Token"] = []string{session.AccessToken}
+	}
+	rw.Header().Set("GAP-Auth", session.identity())
+	if p.authHeader != "" {
+		rw.Header().Set(p.authHeader, session.identity())
+	}
+
+	next.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), sessionContextKey, session)))
+}
+
+func (p *OauthProxy) CheckBasicAuth(req *http.Request) (*SessionState, bool) {
+	if p.HtpasswdValidator == nil {
+		return nil, false
+	}
+	s := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(s) != 2 || s[0] != "Basic" {
+		return nil, false
+	}
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return nil, false
+	}
+	pair := strings.SplitN(string(b), ":", 2)
+	if len(pair) != 2 {
+		return nil, false
+	}
+	if p.webauthn != nil && len(p.webauthn.store.Credentials(pair[0])) != 0 {
+		logger.Printf("%s rejecting basic auth of %q, who has a security key", p.clientIP(req), pair[0])
+		p.audit(auditValidationFailed, req, pair[0], "security key required", Fields{"via": "basic_auth"})
+		return nil, false
+	}
+	if u, ok := p.checkPassword(req, pair[0], pair[1], "", "basic_auth"); ok {
+		logger.Printf("authenticated %q via basic auth", pair[0])
+		return &SessionState{User: pair[0], Groups: u.Groups, Name: u.Name}, true
+	}
+	return nil, false
+}
+
+// CheckBearerToken authenticates API clients presenting an "Authorization:
+// Bearer" token: either a JWT from the configured issuer or an opaque token
+// accepted by the introspection endpoint.
+func (p *OauthProxy) CheckBearerToken(req *http.Request) (*SessionState, bool) {
+	if p.jwtVerifier == nil && p.introspector == nil {
+		return nil, false
+	}
+	token, ok := bearerToken(req)
+	if !ok {
+		return nil, false
+	}
+
+	var session *SessionState
+	if p.jwtVerifier != nil && strings.Count(token, ".") == 2 {
+		claims, err := p.jwtVerifier.Verify(token)
+		if err != nil {
+			logger.Printf("%s invalid bearer token: %s", p.clientIP(req), err)
+			p.audit(auditValidationFailed, req, "", "invalid bearer token: "+err.Error(), Fields{"via": "bearer"})
+			return nil, false
+		}
+		if p.requireVerified && (claims.Email == "" || !claims.emailVerified()) {
+			logger.Printf("%s bearer token without a verified email", p.clientIP(req))
+			p.audit(auditValidationFailed, req, claims.Email, "email not verified", Fields{"via": "bearer"})
+			return nil, false
+		}
+		email := claims.Email
+		if email == "" {
+			email = claims.Subject
+		}
+		session = &SessionState{Email: email, Groups: claims.Groups,
+			PreferredUsername: claims.PreferredUsername, Claims: claims}
+	} else if p.introspector != nil {
+		result, err := p.introspector.Introspect(token)
+		if err != nil {
+			logger.Errorf("%s error introspecting bearer token: %s", p.clientIP(req), err)
+			return nil, false
+		}
+		if !result.Active {
+			logger.Printf("%s inactive bearer token", p.clientIP(req))
+			p.audit(auditValidationFailed, req, "", "inactive bearer token", Fields{"via": "bearer"})
+			return nil, false
+		}
+		session = &SessionState{Email: result.Identity(), Groups: result.Groups,
+			PreferredUsername: result.Username}
+	} else {
+		return nil, false
+	}
+
+	session.Email = normalizeEmail(session.Email, p.normalizeEmails)
+	session.User = strings.Split(session.Email, "@")[0]
+	session.AccessToken = token
+	if !p.Validator.Validate(req, session) {
+		p.audit(auditValidationFailed, req, session.Email, "email not allowed", Fields{"via": "bearer"})
+		return nil, false
+	}
+	logger.Printf("authenticated %q via bearer token", session.Email)
+	return session, true
+}
@@ -0,0 +1,939 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bitly/oauth2_proxy/providers"
+)
+
+// Configuration Options that can be set by Command Line Flag, or Config File
+type Options struct {
+	HttpAddress  string `flag:"http-address" cfg:"http_address"`
+	HttpsAddress string `flag:"https-address" cfg:"https_address"`
+	RedirectUrl  string `flag:"redirect-url" cfg:"redirect_url"`
+	ClientID     string `flag:"client-id" cfg:"client_id" env:"OAUTH2_PROXY_CLIENT_ID"`
+	ClientSecret string `flag:"client-secret" cfg:"client_secret" env:"OAUTH2_PROXY_CLIENT_SECRET"`
+
+	AuthenticatedEmailsFile string        `flag:"authenticated-emails-file" cfg:"authenticated_emails_file"`
+	BlockedEmailsFile       string        `flag:"blocked-emails-file" cfg:"blocked_emails_file"`
+	AdminToken              string        `flag:"admin-token" cfg:"admin_token" env:"OAUTH2_PROXY_ADMIN_TOKEN"`
+	GoogleAppsDomains       []string      `flag:"google-apps-domain" cfg:"google_apps_domains"`
+	EmailDomains            []string      `flag:"email-domain" cfg:"email_domains"`
+	NormalizeEmails         bool          `flag:"normalize-emails" cfg:"normalize_emails"`
+	GitHubOrg               string        `flag:"github-org" cfg:"github_org"`
+	GitHubTeam              string        `flag:"github-team" cfg:"github_team"`
+	GitHubRepo              string        `flag:"github-repo" cfg:"github_repo"`
+	GitHubPrivateRepo       bool          `flag:"github-private-repo" cfg:"github_private_repo"`
+	HtpasswdFile            string        `flag:"htpasswd-file" cfg:"htpasswd_file"`
+	HtpasswdProxy           string        `flag:"htpasswd-proxy" cfg:"htpasswd_proxy"`
+	HtpasswdProxyURLs       []string      `flag:"htpasswd-proxy-url" cfg:"htpasswd_proxy_urls"`
+	HtpasswdProxyFailureTTL time.Duration `flag:"htpasswd-proxy-negative-ttl" cfg:"htpasswd_proxy_negative_ttl"`
+	HtpasswdTOTPFile        string        `flag:"htpasswd-totp-file" cfg:"htpasswd_totp_file"`
+	DisplayHtpasswdForm     bool          `flag:"display-htpasswd-form" cfg:"display_htpasswd_form"`
+	CustomTemplatesDir      string        `flag:"custom-templates-dir" cfg:"custom_templates_dir"`
+	TemplatesDevMode        bool          `flag:"templates-dev-mode" cfg:"templates_dev_mode"`
+	ACLFile                 string        `flag:"acl-file" cfg:"acl_file"`
+	AuthzUrl                string        `flag:"authz-url" cfg:"authz_url"`
+	AuthzTimeout            time.Duration `flag:"authz-timeout" cfg:"authz_timeout"`
+
+	// "key=value" pairs given to the sign_in.html and error.html templates
+	// as .Data. Programs embedding the proxy may also add TemplateFuncs for
+	// the templates to call.
+	TemplateData  []string `flag:"template-data" cfg:"template_data"`
+	TemplateFuncs template.FuncMap
+
+	// Shown on the sign in page, rendered as a Go template with the URL the
+	// user asked for, Host and ProviderName.
+	SignInMessage string `flag:"sign-in-message" cfg:"sign_in_message"`
+
+	// HTML shown on the sign in page above the sign in button, such as a
+	// legal notice, and in place of the default footer ("-" hides it).
+	Banner string `flag:"banner" cfg:"banner"`
+	Footer string `flag:"footer" cfg:"footer"`
+
+	// The sign in and error pages are shown in the client's Accept-Language,
+	// if available, or else in DefaultLocale.
+	DefaultLocale string `flag:"default-locale" cfg:"default_locale"`
+
+	TLSCertFile string `flag:"tls-cert-file" cfg:"tls_cert_file"`
+	TLSKeyFile  string `flag:"tls-key-file" cfg:"tls_key_file"`
+
+	// Protocol versions, cipher suites (for TLS 1.2 and earlier) and curves
+	// offered on the TLS listener.
+	TLSMinVersion   string   `flag:"tls-min-version" cfg:"tls_min_version"`
+	TLSCipherSuites []string `flag:"tls-cipher-suite" cfg:"tls_cipher_suites"`
+	TLSCurves       []string `flag:"tls-curve" cfg:"tls_curves"`
+
+	// Client certificates issued by these CAs authenticate requests on the
+	// TLS listener.
+	TLSClientCAFile string `flag:"tls-client-ca-file" cfg:"tls_client_ca_file"`
+
+	// HTTP/2 is offered on the TLS listener.
+	Http2MaxConcurrentStreams int `flag:"http2-max-concurrent-streams" cfg:"http2_max_concurrent_streams"`
+
+	// Certificates for these hosts are obtained from Let's Encrypt instead.
+	LetsEncryptHosts    []string `flag:"letsencrypt-host" cfg:"letsencrypt_hosts"`
+	LetsEncryptCacheDir string   `flag:"letsencrypt-cache-dir" cfg:"letsencrypt_cache_dir"`
+
+	// Secrets read from files (mounted Kubernetes or Docker secrets) so
+	// they don't appear in process arguments.
+	ClientSecretFile string `flag:"client-secret-file" cfg:"client_secret_file"`
+	CookieSecretFile string `flag:"cookie-secret-file" cfg:"cookie_secret_file"`
+	AdminTokenFile   string `flag:"admin-token-file" cfg:"admin_token_file"`
+
+	CookieSecret    string        `flag:"cookie-secret" cfg:"cookie_secret" env:"OAUTH2_PROXY_COOKIE_SECRET"`
+	CookieDomain    string        `flag:"cookie-domain" cfg:"cookie_domain" env:"OAUTH2_PROXY_COOKIE_DOMAIN"`
+	CookieExpire    time.Duration `flag:"cookie-expire" cfg:"cookie_expire" env:"OAUTH2_PROXY_COOKIE_EXPIRE"`
+	CookieRefresh   time.Duration `flag:"cookie-refresh" cfg:"cookie_refresh" env:"OAUTH2_PROXY_COOKIE_REFRESH"`
+	CookieHttpsOnly bool          `flag:"cookie-https-only" cfg:"cookie_https_only"` // deprecated use cookie-secure
+	CookieSecure    bool          `flag:"cookie-secure" cfg:"cookie_secure"`
+	CookieHttpOnly  bool          `flag:"cookie-httponly" cfg:"cookie_httponly"`
+
+	// The sessions decoded from this many of the most recently used
+	// cookies are kept in memory; 0 decodes the cookie on every request.
+	SessionCacheSize int `flag:"session-cache-size" cfg:"session_cache_size"`
+
+	// Access tokens the provider has validated when refreshing a cookie
+	// aren't validated again for this long.
+	ValidateTokenCacheTTL time.Duration `flag:"validate-token-cache-ttl" cfg:"validate_token_cache_ttl"`
+
+	// Session cookies issued before this RFC3339 time are rejected.
+	RejectSessionsBefore string `flag:"reject-sessions-before" cfg:"reject_sessions_before"`
+
+	// Session cookies are only accepted from the client IP network and/or
+	// User-Agent they were issued to.
+	SessionBinding           []string `flag:"session-binding" cfg:"session_binding"`
+	SessionBindingIPv4Prefix int      `flag:"session-binding-ipv4-prefix" cfg:"session_binding_ipv4_prefix"`
+	SessionBindingIPv6Prefix int      `flag:"session-binding-ipv6-prefix" cfg:"session_binding_ipv6_prefix"`
+
+	Upstreams         []string `flag:"upstream" cfg:"upstreams"`
+	CanaryUpstreams   []string `flag:"canary-upstream" cfg:"canary_upstreams"`
+	CanaryPercent     int      `flag:"canary-percent" cfg:"canary_percent"`
+	SkipAuthRegex     []string `flag:"skip-auth-regex" cfg:"skip_auth_regex"`
+	SkipAuthPreflight bool     `flag:"skip-auth-preflight" cfg:"skip_auth_preflight"`
+	TrustedIPs        []string `flag:"trusted-ip" cfg:"trusted_ips"`
+	TrustedIPIdentity string   `flag:"trusted-ip-identity" cfg:"trusted_ip_identity"`
+	TrustedProxyCIDRs []string `flag:"trusted-proxy-cidrs" cfg:"trusted_proxy_cidrs"`
+	ClientIPHeader    string   `flag:"real-client-ip-header" cfg:"real_client_ip_header"`
+	PassBasicAuth     bool     `flag:"pass-basic-auth" cfg:"pass_basic_auth"`
+	PassAccessToken   bool     `flag:"pass-access-token" cfg:"pass_access_token"`
+	PassHostHeader    bool     `flag:"pass-host-header" cfg:"pass_host_header"`
+
+	// Password sent with the user name by PassBasicAuth, for upstreams that
+	// require one.
+	BasicAuthPassword string `flag:"basic-auth-password" cfg:"basic_auth_password" env:"OAUTH2_PROXY_BASIC_AUTH_PASSWORD"`
+
+	// The client's Authorization header is replaced by PassBasicAuth, or
+	// else proxied as is, unless one of these changes that.
+	StripAuthorizationHeader bool `flag:"strip-authorization-header" cfg:"strip_authorization_header"`
+	PassAuthorizationHeader  bool `flag:"pass-authorization-header" cfg:"pass_authorization_header"`
+
+	// Names of the headers carrying the identity to upstreams and, for
+	// response headers, to the client; empty names aren't sent.
+	UserHeader              string `flag:"user-header" cfg:"user_header"`
+	EmailHeader             string `flag:"email-header" cfg:"email_header"`
+	GroupsHeader            string `flag:"groups-header" cfg:"groups_header"`
+	NameHeader              string `flag:"name-header" cfg:"name_header"`
+	PreferredUsernameHeader string `flag:"preferred-username-header" cfg:"preferred_username_header"`
+	AuthResponseHeader      string `flag:"auth-response-header" cfg:"auth_response_header"`
+	UpstreamAddressHeader   string `flag:"upstream-address-header" cfg:"upstream_address_header"`
+
+	UpstreamBreakerThreshold int           `flag:"upstream-breaker-threshold" cfg:"upstream_breaker_threshold"`
+	UpstreamBreakerCooldown  time.Duration `flag:"upstream-breaker-cooldown" cfg:"upstream_breaker_cooldown"`
+
+	// Upstream hostnames are looked up again in the background once their
+	// cached addresses are this old; 0 resolves them on each connection.
+	UpstreamDNSRefresh time.Duration `flag:"upstream-dns-refresh" cfg:"upstream_dns_refresh"`
+
+	// Requests beyond this many in flight at once, in all or to one
+	// upstream, get a 503 response; 0 for no limit.
+	MaxConcurrentRequests         int `flag:"max-concurrent-requests" cfg:"max_concurrent_requests"`
+	UpstreamMaxConcurrentRequests int `flag:"upstream-max-concurrent-requests" cfg:"upstream_max_concurrent_requests"`
+
+	// Sign ins beyond RedeemMaxConcurrent redeeming their code with the
+	// provider at once wait up to RedeemQueueTimeout for their turn; 0 for
+	// no limit.
+	RedeemMaxConcurrent int           `flag:"redeem-max-concurrent" cfg:"redeem_max_concurrent"`
+	RedeemQueueTimeout  time.Duration `flag:"redeem-queue-timeout" cfg:"redeem_queue_timeout"`
+
+	// Responses are streamed from upstreams through buffers of
+	// UpstreamBufferSize bytes, flushed to the client every
+	// UpstreamFlushInterval (after every write if negative).
+	UpstreamBufferSize    int           `flag:"upstream-buffer-size" cfg:"upstream_buffer_size"`
+	UpstreamFlushInterval time.Duration `flag:"upstream-flush-interval" cfg:"upstream_flush_interval"`
+
+	// Responses of upstreams marked static are cached in up to
+	// StaticCacheSize megabytes of memory for each, and revalidated with
+	// the upstream once they are StaticCacheTTL old.
+	StaticCacheSize int           `flag:"static-cache-size" cfg:"static_cache_size"`
+	StaticCacheTTL  time.Duration `flag:"static-cache-ttl" cfg:"static_cache_ttl"`
+
+	// Log access check failures but proxy the request anyway.
+	ShadowMode bool `flag:"shadow-mode" cfg:"shadow_mode"`
+
+	// Requests are allowed or denied by the country of the client IP.
+	GeoIPDatabase       string   `flag:"geoip-database" cfg:"geoip_database"`
+	GeoIPAllowCountries []string `flag:"geoip-allow-country" cfg:"geoip_allow_countries"`
+	GeoIPDenyCountries  []string `flag:"geoip-deny-country" cfg:"geoip_deny_countries"`
+
+	// Structured upstreams, which can only be set in a YAML config file.
+	UpstreamConfigs []Upstream
+
+	// Per-user token bucket; RateLimitRedis shares buckets across instances.
+	RateLimit      int    `flag:"rate-limit" cfg:"rate_limit"`
+	RateLimitBurst int    `flag:"rate-limit-burst" cfg:"rate_limit_burst"`
+	RateLimitRedis string `flag:"rate-limit-redis" cfg:"rate_limit_redis"`
+
+	// Lock out a user from a client IP after this many failed passwords in a
+	// row, for HtpasswdLockout, doubling with each further failure.
+	HtpasswdMaxFailures int           `flag:"htpasswd-max-failures" cfg:"htpasswd_max_failures"`
+	HtpasswdLockout     time.Duration `flag:"htpasswd-lockout" cfg:"htpasswd_lockout"`
+
+	// An htpasswd proxy isn't asked for HtpasswdProxyBreakerCooldown after
+	// this many failed requests in a row; HtpasswdProxyFailOpen accepts
+	// passwords while none can be asked, instead of rejecting them.
+	HtpasswdProxyTimeout          time.Duration `flag:"htpasswd-proxy-timeout" cfg:"htpasswd_proxy_timeout"`
+	HtpasswdProxyBreakerThreshold int           `flag:"htpasswd-proxy-breaker-threshold" cfg:"htpasswd_proxy_breaker_threshold"`
+	HtpasswdProxyBreakerCooldown  time.Duration `flag:"htpasswd-proxy-breaker-cooldown" cfg:"htpasswd_proxy_breaker_cooldown"`
+	HtpasswdProxyFailOpen         bool          `flag:"htpasswd-proxy-fail-open" cfg:"htpasswd_proxy_fail_open"`
+	HtpasswdProxyProtocol         string        `flag:"htpasswd-proxy-protocol" cfg:"htpasswd_proxy_protocol"`
+	HtpasswdProxyParallel         bool          `flag:"htpasswd-proxy-parallel" cfg:"htpasswd_proxy_parallel"`
+
+	// TLS settings and "Name: value" headers for HtpasswdProxy requests.
+	HtpasswdProxyCAFile     string   `flag:"htpasswd-proxy-ca-file" cfg:"htpasswd_proxy_ca_file"`
+	HtpasswdProxyCertFile   string   `flag:"htpasswd-proxy-cert-file" cfg:"htpasswd_proxy_cert_file"`
+	HtpasswdProxyKeyFile    string   `flag:"htpasswd-proxy-key-file" cfg:"htpasswd_proxy_key_file"`
+	HtpasswdProxyServerName string   `flag:"htpasswd-proxy-server-name" cfg:"htpasswd_proxy_server_name"`
+	HtpasswdProxyHeaders    []string `flag:"htpasswd-proxy-header" cfg:"htpasswd_proxy_headers"`
+
+	// Security keys registered in WebAuthnCredentialsFile are asked for
+	// after signing in; WebAuthnRequired makes users register one.
+	WebAuthnRPID            string `flag:"webauthn-rp-id" cfg:"webauthn_rp_id"`
+	WebAuthnCredentialsFile string `flag:"webauthn-credentials-file" cfg:"webauthn_credentials_file"`
+	WebAuthnRequired        bool   `flag:"webauthn-required" cfg:"webauthn_required"`
+
+	// A reCAPTCHA or hCaptcha widget shown on the sign in form.
+	CaptchaProvider string `flag:"captcha-provider" cfg:"captcha_provider"`
+	CaptchaSiteKey  string `flag:"captcha-site-key" cfg:"captcha_site_key"`
+	CaptchaSecret   string `flag:"captcha-secret" cfg:"captcha_secret" env:"OAUTH2_PROXY_CAPTCHA_SECRET"`
+
+	// Per-client IP token bucket, per minute, for the sign in endpoints.
+	SignInRateLimit      int `flag:"sign-in-rate-limit" cfg:"sign_in_rate_limit"`
+	SignInRateLimitBurst int `flag:"sign-in-rate-limit-burst" cfg:"sign_in_rate_limit_burst"`
+
+	// Paths that require the user to have signed in within StepUpMaxAge.
+	StepUpRegex  []string      `flag:"step-up-regex" cfg:"step_up_regex"`
+	StepUpMaxAge time.Duration `flag:"step-up-max-age" cfg:"step_up_max_age"`
+
+	// Unauthenticated browsers are first sent to the provider with
+	// prompt=none, and only shown the sign in page if that fails.
+	SilentSSO bool `flag:"silent-sso" cfg:"silent_sso"`
+
+	// These options allow for other providers besides Google, with
+	// potential overrides.
+	Provider    string `flag:"provider" cfg:"provider"`
+	LoginUrl    string `flag:"login-url" cfg:"login_url"`
+	RedeemUrl   string `flag:"redeem-url" cfg:"redeem_url"`
+	ProfileUrl  string `flag:"profile-url" cfg:"profile_url"`
+	ValidateUrl string `flag:"validate-url" cfg:"validate_url"`
+	Scope       string `flag:"scope" cfg:"scope"`
+
+	// Requests to the provider are given up after ProviderTimeout, keep up
+	// to ProviderMaxIdleConns connections to it open for reuse, and go
+	// through ProviderProxy if set.
+	ProviderTimeout      time.Duration `flag:"provider-timeout" cfg:"provider_timeout"`
+	ProviderMaxIdleConns int           `flag:"provider-max-idle-conns" cfg:"provider_max_idle_conns"`
+	ProviderProxy        string        `flag:"provider-proxy" cfg:"provider_proxy"`
+
+	// Sign in anyone with a fake provider instead, for load tests; the
+	// client id and secret aren't needed.
+	MockProvider bool `flag:"mock-provider" cfg:"mock_provider"`
+
+	RequireVerifiedEmail bool     `flag:"require-verified-email" cfg:"require_verified_email"`
+	RequireMFA           bool     `flag:"require-mfa" cfg:"require_mfa"`
+	MFAACRValues         []string `flag:"mfa-acr-value" cfg:"mfa_acr_values"`
+
+	// Bearer JWTs signed by this issuer are accepted in place of a cookie.
+	JWTIssuer   string `flag:"jwt-issuer" cfg:"jwt_issuer"`
+	JWTJWKSUrl  string `flag:"jwt-jwks-url" cfg:"jwt_jwks_url"`
+	JWTAudience string `flag:"jwt-audience" cfg:"jwt_audience"`
+	// The keys are fetched again once they are this old, and when a token
+	// names an unknown key.
+	JWTJWKSRefresh time.Duration `flag:"jwt-jwks-refresh" cfg:"jwt_jwks_refresh"`
+
+	// Opaque bearer tokens are validated with an RFC 7662 endpoint.
+	IntrospectionUrl      string        `flag:"introspection-url" cfg:"introspection_url"`
+	IntrospectionAudience string        `flag:"introspection-audience" cfg:"introspection_audience"`
+	IntrospectionCacheTTL time.Duration `flag:"introspection-cache-ttl" cfg:"introspection_cache_ttl"`
+
+	RequestLogging bool `flag:"request-logging" cfg:"request_logging"`
+
+	// Application and request logs go to LogFile instead of stderr and
+	// stdout when it is set.
+	LogFile           string        `flag:"log-file" cfg:"log_file"`
+	LogFileMaxSize    int           `flag:"log-file-max-size" cfg:"log_file_max_size"`
+	LogFileMaxAge     time.Duration `flag:"log-file-max-age" cfg:"log_file_max_age"`
+	LogFileMaxBackups int           `flag:"log-file-max-backups" cfg:"log_file_max_backups"`
+
+	// Auth event counters and upstream latency timers are sent to statsd.
+	StatsDAddress string   `flag:"statsd-address" cfg:"statsd_address"`
+	StatsDPrefix  string   `flag:"statsd-prefix" cfg:"statsd_prefix"`
+	StatsDTags    []string `flag:"statsd-tag" cfg:"statsd_tags"`
+
+	// Request, provider and upstream spans are exported over OTLP/HTTP to an
+	// OpenTelemetry collector at OTelEndpoint (host:port).
+	OTelEndpoint    string `flag:"otel-exporter-endpoint" cfg:"otel_exporter_endpoint"`
+	OTelInsecure    bool   `flag:"otel-exporter-insecure" cfg:"otel_exporter_insecure"`
+	OTelServiceName string `flag:"otel-service-name" cfg:"otel_service_name"`
+
+	// Authentication events are written as JSON to this file, or to stdout
+	// tagged "log":"audit" when "stdout".
+	AuditLog string `flag:"audit-log" cfg:"audit_log"`
+
+	// "text" or "json" for both the application and request logs; text
+	// request logs use the RequestLoggingFormat template.
+	LogFormat            string `flag:"log-format" cfg:"log_format"`
+	RequestLoggingFormat string `flag:"request-logging-format" cfg:"request_logging_format"`
+
+	// Requests for these paths, or matching these regexes, aren't logged.
+	LoggingExcludePaths []string `flag:"logging-exclude-paths" cfg:"logging_exclude_paths"`
+	LoggingExcludeRegex []string `flag:"logging-exclude-regex" cfg:"logging_exclude_regex"`
+
+	// Besides paths on the current host, users may be redirected after
+	// signing in to these domains; ".example.com" includes subdomains.
+	WhitelistDomains []string `flag:"whitelist-domain" cfg:"whitelist_domains"`
+
+	// "pages" adds HSTS, X-Content-Type-Options, X-Frame-Options,
+	// frame-ancestors and Referrer-Policy headers to the proxy's own pages,
+	// and "all" to proxied responses too.
+	SecurityHeaders string `flag:"security-headers" cfg:"security_headers"`
+
+	// Reload when the config, emails or htpasswd files change, as well as
+	// on SIGHUP.
+	WatchConfig bool `flag:"watch-config" cfg:"watch_config"`
+
+	// How long SIGTERM waits for in-flight requests before exiting.
+	ShutdownTimeout time.Duration `flag:"shutdown-timeout" cfg:"shutdown_timeout"`
+
+	// On SIGUSR2, goroutine stacks and heap and CPU profiles, the CPU
+	// profiled for ProfileCPUDuration, are written to ProfileDir.
+	ProfileDir         string        `flag:"profile-dir" cfg:"profile_dir"`
+	ProfileCPUDuration time.Duration `flag:"profile-cpu-duration" cfg:"profile_cpu_duration"`
+
+	// internal values that are set after config validation
+	redirectUrl   *url.URL
+	proxyUrls     []*url.URL
+	canaryUrls    []*url.URL
+	CompiledRegex []*regexp.Regexp
+	// skipAuthMethods[i] limits CompiledRegex[i] to these methods, if any
+	skipAuthMethods [][]string
+	stepUpRegex     []*regexp.Regexp
+	// upstreamConfigs maps proxyUrls paths to their structured definition
+	upstreamConfigs map[string]*Upstream
+	acl             *ACL
+	trustedIPs      IPRanges
+	trustedProxies  IPRanges
+	provider        providers.Provider
+	// requestLogTemplate is nil when request logs are JSON
+	requestLogTemplate *template.Template
+	requestLogExclude  []*regexp.Regexp
+	// rejectSessionsBefore is zero when RejectSessionsBefore is unset
+	rejectSessionsBefore time.Time
+	tlsPolicy            *tlsPolicy
+	clientCAs            *x509.CertPool
+	htpasswdProxyTLS     *tls.Config
+	htpasswdProxyHeaders http.Header
+	templateData         map[string]string
+}
+
+func NewOptions() *Options {
+	return &Options{
+		HttpAddress:             "127.0.0.1:4180",
+		DisplayHtpasswdForm:     true,
+		CookieHttpsOnly:         true,
+		CookieSecure:            true,
+		CookieHttpOnly:          true,
+		CookieExpire:            time.Duration(168) * time.Hour,
+		CookieRefresh:           time.Duration(0),
+		ValidateTokenCacheTTL:   time.Duration(30) * time.Second,
+		SessionCacheSize:        1000,
+		PassBasicAuth:           true,
+		PassAccessToken:         false,
+		PassHostHeader:          true,
+		UserHeader:              "X-Forwarded-User",
+		EmailHeader:             "X-Forwarded-Email",
+		GroupsHeader:            "X-Forwarded-Groups",
+		NameHeader:              "X-Forwarded-Name",
+		PreferredUsernameHeader: "X-Forwarded-Preferred-Username",
+		ClientIPHeader:          "X-Forwarded-For",
+		HtpasswdMaxFailures:     5,
+		HtpasswdLockout:         time.Duration(1) * time.Minute,
+		HtpasswdProxyFailureTTL: time.Duration(5) * time.Second,
+		HtpasswdProxyTimeout:    time.Duration(5) * time.Second,
+		UpstreamBreakerCooldown: time.Duration(30) * time.Second,
+		UpstreamBufferSize:      32 * 1024,
+		RedeemQueueTimeout:      time.Duration(10) * time.Second,
+		StaticCacheSize:         64,
+		StaticCacheTTL:          time.Duration(1) * time.Minute,
+		StepUpMaxAge:            time.Duration(5) * time.Minute,
+		RequestLogging:          true,
+		LogFormat:               "text",
+		StatsDPrefix:            "oauth2_proxy.",
+		OTelServiceName:         "oauth2_proxy",
+		SecurityHeaders:         "off",
+		RequestLoggingFormat:    DefaultRequestLogFormat,
+		ShutdownTimeout:         time.Duration(30) * time.Second,
+		ProfileCPUDuration:      time.Duration(30) * time.Second,
+		ProviderTimeout:         time.Duration(10) * time.Second,
+		ProviderMaxIdleConns:    16,
+		DefaultLocale:           "en",
+
+		Http2MaxConcurrentStreams: 250,
+		TLSMinVersion:             "1.2",
+		JWTJWKSRefresh:            time.Duration(1) * time.Hour,
+		SessionBindingIPv4Prefix:  24,
+		SessionBindingIPv6Prefix:  64,
+
+		HtpasswdProxyBreakerThreshold: 5,
+		HtpasswdProxyProtocol:         "basic",
+		HtpasswdProxyBreakerCooldown:  time.Duration(30) * time.Second,
+	}
+}
+
+// htpasswdProxies returns the htpasswd proxy URLs, HtpasswdProxy first.
+func (o *Options) htpasswdProxies() []string {
+	var urls []string
+	if o.HtpasswdProxy != "" {
+		urls = append(urls, o.HtpasswdProxy)
+	}
+	return append(urls, o.HtpasswdProxyURLs...)
+}
+
+func (o *Options) validateUpstreamConfigs(msgs []string) []string {
+	o.upstreamConfigs = make(map[string]*Upstream)
+	for i, up := range o.UpstreamConfigs {
+		up := up
+		if up.URL == "" {
+			msgs = append(msgs, fmt.Sprintf("upstreams[%d]: missing url", i))
+			continue
+		}
+		upstreamUrl, err := url.Parse(up.URL)
+		if err != nil || upstreamUrl.Scheme == "" || upstreamUrl.Host == "" {
+			msgs = append(msgs, fmt.Sprintf(
+				"upstreams[%d]: url %q is not an absolute URL", i, up.URL))
+			continue
+		}
+		if up.Path == "" {
+			up.Path = upstreamUrl.Path
+		}
+		if up.Path == "" {
+			up.Path = "/"
+		}
+		if !strings.HasPrefix(up.Path, "/") {
+			msgs = append(msgs, fmt.Sprintf(
+				"upstreams[%d]: path %q must start with \"/\"", i, up.Path))
+			continue
+		}
+		if up.Rewrite != "" && !strings.HasPrefix(up.Rewrite, "/") {
+			msgs = append(msgs, fmt.Sprintf(
+				"upstreams[%d]: rewrite %q must start with \"/\"", i, up.Rewrite))
+		}
+		if _, ok := o.upstreamConfigs[up.Path]; ok {
+			msgs = append(msgs, fmt.Sprintf(
+				"upstreams[%d]: path %q is already routed to another upstream", i, up.Path))
+			continue
+		}
+		upstreamUrl.Path = up.Path
+		o.proxyUrls = append(o.proxyUrls, upstreamUrl)
+		o.upstreamConfigs[up.Path] = &up
+		if up.SkipAuth {
+			o.CompiledRegex = append(o.CompiledRegex,
+				regexp.MustCompile("^"+regexp.QuoteMeta(up.Path)))
+			o.skipAuthMethods = append(o.skipAuthMethods, nil)
+		}
+	}
+	return msgs
+}
+
+func parseUrl(to_parse string, urltype string, msgs []string) (*url.URL, []string) {
+	parsed, err := url.Parse(to_parse)
+	if err != nil {
+		return nil, append(msgs, fmt.Sprintf(
+			"error parsing %s-url=%q %s", urltype, to_parse, err))
+	}
+	return parsed, msgs
+}
+
+// readSecretFile sets secret to the contents of file, without a trailing
+// newline, unless file is empty.
+func readSecretFile(secret *string, file, name string, msgs []string) []string {
+	if file == "" {
+		return msgs
+	}
+	if *secret != "" {
+		return append(msgs, fmt.Sprintf(
+			"cannot set both %s and %s-file", name, name))
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return append(msgs, fmt.Sprintf(
+			"error reading %s-file=%q %s", name, file, err))
+	}
+	*secret = strings.TrimRight(string(contents), "\r\n")
+	return msgs
+}
+
+func (o *Options) Validate() error {
+	msgs := make([]string, 0)
+	msgs = readSecretFile(&o.ClientSecret, o.ClientSecretFile, "client-secret", msgs)
+	msgs = readSecretFile(&o.CookieSecret, o.CookieSecretFile, "cookie-secret", msgs)
+	msgs = readSecretFile(&o.AdminToken, o.AdminTokenFile, "admin-token", msgs)
+	msgs = resolveAWSSecret(&o.ClientSecret, "client-secret", msgs)
+	msgs = resolveAWSSecret(&o.CookieSecret, "cookie-secret", msgs)
+	msgs = resolveAWSSecret(&o.AdminToken, "admin-token", msgs)
+	msgs = resolveAWSSecret(&o.BasicAuthPassword, "basic-auth-password", msgs)
+	msgs = resolveAWSSecret(&o.CaptchaSecret, "captcha-secret", msgs)
+	if len(o.Upstreams) < 1 && len(o.UpstreamConfigs) < 1 {
+		msgs = append(msgs, "missing setting: upstream")
+	}
+	if o.HttpAddress == "" && o.HttpsAddress == "" {
+		msgs = append(msgs, "missing setting: http-address or https-address")
+	}
+	if o.LogFileMaxSize < 0 || o.LogFileMaxAge < 0 || o.LogFileMaxBackups < 0 {
+		msgs = append(msgs, "log-file-max-size, log-file-max-age and log-file-max-backups must not be negative")
+	}
+	if o.ProfileCPUDuration < 0 {
+		msgs = append(msgs, fmt.Sprintf(
+			"profile-cpu-duration=%s must not be negative", o.ProfileCPUDuration))
+	}
+	if o.LogFormat != "text" && o.LogFormat != "json" {
+		msgs = append(msgs, fmt.Sprintf(
+			"log-format=%q must be \"text\" or \"json\"", o.LogFormat))
+	}
+	if o.LogFormat != "json" {
+		var err error
+		o.requestLogTemplate, err = parseRequestLogFormat(o.RequestLoggingFormat)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"error parsing request-logging-format %s", err))
+		}
+	}
+	if _, err := parseSignInMessage(o.SignInMessage); err != nil {
+		msgs = append(msgs, fmt.Sprintf("error parsing sign-in-message %s", err))
+	}
+	for _, paths := range o.LoggingExcludePaths {
+		for _, path := range strings.Split(paths, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				o.requestLogExclude = append(o.requestLogExclude,
+					regexp.MustCompile("^"+regexp.QuoteMeta(path)+"$"))
+			}
+		}
+	}
+	for _, r := range o.LoggingExcludeRegex {
+		compiled, err := regexp.Compile(r)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"error compiling logging-exclude-regex=%q %s", r, err))
+			continue
+		}
+		o.requestLogExclude = append(o.requestLogExclude, compiled)
+	}
+	if o.Http2MaxConcurrentStreams < 1 {
+		msgs = append(msgs, fmt.Sprintf(
+			"http2-max-concurrent-streams (%d) must be at least 1",
+			o.Http2MaxConcurrentStreams))
+	}
+	if policy, err := parseTLSPolicy(o.TLSMinVersion, o.TLSCipherSuites, o.TLSCurves); err != nil {
+		msgs = append(msgs, fmt.Sprintf("error parsing tls-min-version, tls-cipher-suite or tls-curve: %s", err))
+	} else {
+		o.tlsPolicy = policy
+	}
+	if o.TLSClientCAFile != "" {
+		if o.HttpsAddress == "" {
+			msgs = append(msgs, "missing setting: https-address is required with tls-client-ca-file")
+		}
+		var err error
+		if o.clientCAs, err = loadClientCAs(o.TLSClientCAFile); err != nil {
+			msgs = append(msgs, fmt.Sprintf("error loading tls-client-ca-file=%q %s", o.TLSClientCAFile, err))
+		}
+	}
+	if len(o.LetsEncryptHosts) > 0 {
+		if o.HttpsAddress == "" {
+			msgs = append(msgs, "missing setting: https-address is required with letsencrypt-host")
+		}
+		if o.LetsEncryptCacheDir == "" {
+			msgs = append(msgs, "missing setting: letsencrypt-cache-dir is required with letsencrypt-host")
+		}
+		if o.TLSCertFile != "" || o.TLSKeyFile != "" {
+			msgs = append(msgs, "cannot use tls-cert-file or tls-key-file with letsencrypt-host")
+		}
+	} else if o.HttpsAddress != "" && (o.TLSCertFile == "" || o.TLSKeyFile == "") {
+		msgs = append(msgs, "missing setting: tls-cert-file and tls-key-file (or letsencrypt-host) are required with https-address")
+	}
+	if o.CookieSecret == "" {
+		msgs = append(msgs, "missing setting: cookie-secret")
+	}
+	if o.ClientID == "" && !o.MockProvider {
+		msgs = append(msgs, "missing setting: client-id")
+	}
+	if o.ClientSecret == "" && !o.MockProvider {
+		msgs = append(msgs, "missing setting: client-secret")
+	}
+
+	o.redirectUrl, msgs = parseUrl(o.RedirectUrl, "redirect", msgs)
+
+	for _, u := range o.Upstreams {
+		upstreamUrl, err := url.Parse(u)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"error parsing upstream=%q %s",
+				upstreamUrl, err))
+		}
+		if upstreamUrl.Path == "" {
+			upstreamUrl.Path = "/"
+		}
+		o.proxyUrls = append(o.proxyUrls, upstreamUrl)
+	}
+	msgs = o.validateUpstreamConfigs(msgs)
+
+	for _, u := range o.CanaryUpstreams {
+		canaryUrl, err := url.Parse(u)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"error parsing canary-upstream=%q %s", u, err))
+			continue
+		}
+		if canaryUrl.Path == "" {
+			canaryUrl.Path = "/"
+		}
+		found := false
+		for _, p := range o.proxyUrls {
+			found = found || p.Path == canaryUrl.Path
+		}
+		if !found {
+			msgs = append(msgs, fmt.Sprintf(
+				"canary-upstream=%q has no upstream for path %q",
+				u, canaryUrl.Path))
+		}
+		o.canaryUrls = append(o.canaryUrls, canaryUrl)
+	}
+	if o.CanaryPercent < 0 || o.CanaryPercent > 100 {
+		msgs = append(msgs, fmt.Sprintf(
+			"canary_percent (%d) must be between 0 and 100",
+			o.CanaryPercent))
+	}
+
+	for _, u := range o.SkipAuthRegex {
+		methods, u := parseSkipAuthMethods(u)
+		CompiledRegex, err := regexp.Compile(u)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"error compiling regex=%q %s", u, err))
+		}
+		o.CompiledRegex = append(o.CompiledRegex, CompiledRegex)
+		o.skipAuthMethods = append(o.skipAuthMethods, methods)
+	}
+	if o.GeoIPDatabase == "" && (len(o.GeoIPAllowCountries) != 0 || len(o.GeoIPDenyCountries) != 0) {
+		msgs = append(msgs, "missing setting: geoip-database is required with geoip-allow-country or geoip-deny-country")
+	}
+
+	if o.RateLimit < 0 {
+		msgs = append(msgs, fmt.Sprintf(
+			"rate_limit (%d) must not be negative", o.RateLimit))
+	}
+	if o.RateLimit > 0 && o.RateLimitBurst < 1 {
+		o.RateLimitBurst = o.RateLimit
+	}
+	if o.HtpasswdMaxFailures < 0 || o.HtpasswdLockout < 0 {
+		msgs = append(msgs, "htpasswd-max-failures and htpasswd-lockout must not be negative")
+	}
+	if o.HtpasswdProxyFailureTTL < 0 {
+		msgs = append(msgs, "htpasswd-proxy-negative-ttl must not be negative")
+	}
+	if o.HtpasswdProxyBreakerThreshold < 0 {
+		msgs = append(msgs, "htpasswd-proxy-breaker-threshold must not be negative")
+	}
+	if o.HtpasswdProxyProtocol != "basic" && o.HtpasswdProxyProtocol != "json" {
+		msgs = append(msgs, fmt.Sprintf("htpasswd-proxy-protocol=%q must be \"basic\" or \"json\"", o.HtpasswdProxyProtocol))
+	}
+	if (o.HtpasswdProxyCertFile == "") != (o.HtpasswdProxyKeyFile == "") {
+		msgs = append(msgs, "htpasswd-proxy-cert-file and htpasswd-proxy-key-file must be set together")
+	} else if config, err := newHtpasswdProxyTLSConfig(o.HtpasswdProxyCAFile, o.HtpasswdProxyCertFile,
+		o.HtpasswdProxyKeyFile, o.HtpasswdProxyServerName); err != nil {
+		msgs = append(msgs, fmt.Sprintf("error loading htpasswd-proxy TLS settings: %s", err))
+	} else {
+		o.htpasswdProxyTLS = config
+	}
+	if headers, err := parseHeaders(o.HtpasswdProxyHeaders); err != nil {
+		msgs = append(msgs, fmt.Sprintf("invalid htpasswd-proxy-header: %s", err))
+	} else {
+		o.htpasswdProxyHeaders = headers
+	}
+	o.templateData = make(map[string]string)
+	for _, kv := range o.TemplateData {
+		i := strings.Index(kv, "=")
+		if i < 1 {
+			msgs = append(msgs, fmt.Sprintf("template-data %q must be of the form key=value", kv))
+			continue
+		}
+		o.templateData[kv[:i]] = kv[i+1:]
+	}
+	if o.HtpasswdTOTPFile != "" && o.HtpasswdFile == "" && len(o.htpasswdProxies()) == 0 {
+		msgs = append(msgs, "htpasswd-totp-file requires htpasswd-file or htpasswd-proxy")
+	}
+	if o.TemplatesDevMode && o.CustomTemplatesDir == "" {
+		msgs = append(msgs, "templates-dev-mode requires custom-templates-dir")
+	}
+	if o.WebAuthnRPID != "" && o.WebAuthnCredentialsFile == "" {
+		msgs = append(msgs, "webauthn-rp-id requires webauthn-credentials-file")
+	}
+	if o.WebAuthnRequired && o.WebAuthnRPID == "" {
+		msgs = append(msgs, "webauthn-required requires webauthn-rp-id")
+	}
+	if o.CaptchaProvider != "" {
+		if _, ok := captchaProviders[o.CaptchaProvider]; !ok {
+			msgs = append(msgs, fmt.Sprintf(
+				"captcha-provider=%q must be \"recaptcha\" or \"hcaptcha\"", o.CaptchaProvider))
+		}
+		if o.CaptchaSiteKey == "" || o.CaptchaSecret == "" {
+			msgs = append(msgs, "captcha-provider requires captcha-site-key and captcha-secret")
+		}
+	}
+	switch o.SecurityHeaders {
+	case "off", "pages", "all":
+	default:
+		msgs = append(msgs, fmt.Sprintf(
+			"security-headers=%q must be \"off\", \"pages\" or \"all\"", o.SecurityHeaders))
+	}
+	if o.RejectSessionsBefore != "" {
+		var err error
+		o.rejectSessionsBefore, err = time.Parse(time.RFC3339, o.RejectSessionsBefore)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"reject-sessions-before=%q must be an RFC3339 time", o.RejectSessionsBefore))
+		}
+	}
+	if _, err := NewSessionBinding(o.CookieSecret, o.SessionBinding, 0, 0); err != nil {
+		msgs = append(msgs, fmt.Sprintf("error parsing session-binding: %s", err))
+	}
+	if o.SessionBindingIPv4Prefix < 0 || o.SessionBindingIPv4Prefix > 32 ||
+		o.SessionBindingIPv6Prefix < 0 || o.SessionBindingIPv6Prefix > 128 {
+		msgs = append(msgs, "session-binding-ipv4-prefix must be 0 to 32 and session-binding-ipv6-prefix 0 to 128")
+	}
+	if o.StripAuthorizationHeader && o.PassAuthorizationHeader {
+		msgs = append(msgs, "strip-authorization-header and pass-authorization-header can't both be set")
+	}
+	for _, h := range [][2]string{
+		{"user-header", o.UserHeader},
+		{"email-header", o.EmailHeader},
+		{"groups-header", o.GroupsHeader},
+		{"name-header", o.NameHeader},
+		{"preferred-username-header", o.PreferredUsernameHeader},
+		{"auth-response-header", o.AuthResponseHeader},
+		{"upstream-address-header", o.UpstreamAddressHeader},
+	} {
+		if h[1] == "" {
+			continue
+		}
+		if strings.ContainsAny(h[1], " \t\r\n:") {
+			msgs = append(msgs, fmt.Sprintf("%s=%q is not a valid header name", h[0], h[1]))
+		} else if strings.HasPrefix(strings.ToUpper(h[1]), "GAP-") {
+			// GAP-* response headers are removed by LoggingHandler, and
+			// request headers by stripIdentityHeaders
+			msgs = append(msgs, fmt.Sprintf("%s=%q must not start with GAP-", h[0], h[1]))
+		}
+	}
+	if o.SignInRateLimit < 0 {
+		msgs = append(msgs, fmt.Sprintf(
+			"sign_in_rate_limit (%d) must not be negative", o.SignInRateLimit))
+	}
+	if o.SignInRateLimit > 0 && o.SignInRateLimitBurst < 1 {
+		o.SignInRateLimitBurst = o.SignInRateLimit
+	}
+
+	for _, u := range o.StepUpRegex {
+		compiled, err := regexp.Compile(u)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"error compiling step-up-regex=%q %s", u, err))
+		}
+		o.stepUpRegex = append(o.stepUpRegex, compiled)
+	}
+	var err error
+	if o.trustedIPs, err = ParseIPRanges(o.TrustedIPs); err != nil {
+		msgs = append(msgs, fmt.Sprintf("error parsing trusted-ip %s", err))
+	}
+	if o.trustedProxies, err = ParseIPRanges(o.TrustedProxyCIDRs); err != nil {
+		msgs = append(msgs, fmt.Sprintf("error parsing trusted-proxy-cidrs %s", err))
+	}
+	if o.ClientIPHeader == "" {
+		msgs = append(msgs, "missing setting: real-client-ip-header")
+	}
+
+	if o.JWTJWKSUrl != "" {
+		_, msgs = parseUrl(o.JWTJWKSUrl, "jwt-jwks", msgs)
+		if o.JWTIssuer == "" {
+			msgs = append(msgs, "missing setting: jwt-issuer is required with jwt-jwks-url")
+		}
+		// the issuer may mint tokens for other clients too
+		if o.JWTAudience == "" {
+			o.JWTAudience = o.ClientID
+		}
+		if o.JWTAudience == "" {
+			msgs = append(msgs, "missing setting: jwt-audience is required with jwt-jwks-url")
+		}
+	}
+
+	if o.IntrospectionUrl != "" {
+		_, msgs = parseUrl(o.IntrospectionUrl, "introspection", msgs)
+		if o.RequireVerifiedEmail {
+			msgs = append(msgs, "require-verified-email can't be checked for "+
+				"introspected bearer tokens (introspection-url)")
+		}
+		if o.IntrospectionAudience == "" {
+			o.IntrospectionAudience = o.ClientID
+		}
+		if o.IntrospectionAudience == "" {
+			msgs = append(msgs, "missing setting: introspection-audience is required with introspection-url")
+		}
+	}
+
+	if o.AuthzUrl != "" {
+		_, msgs = parseUrl(o.AuthzUrl, "authz", msgs)
+	}
+
+	if o.ACLFile != "" {
+		var err error
+		o.acl, err = LoadACLFile(o.ACLFile)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"error loading acl-file=%q %s", o.ACLFile, err))
+		}
+	}
+	msgs = parseProviderInfo(o, msgs)
+
+	if o.PassAccessToken || (o.CookieRefresh != time.Duration(0)) {
+		valid_cookie_secret_size := false
+		for _, i := range []int{16, 24, 32} {
+			if len(o.CookieSecret) == i {
+				valid_cookie_secret_size = true
+			}
+		}
+		if valid_cookie_secret_size == false {
+			msgs = append(msgs, fmt.Sprintf(
+				"cookie_secret must be 16, 24, or 32 bytes "+
+					"to create an AES cipher when "+
+					"pass_access_token == true or "+
+					"cookie_refresh != 0, but is %d bytes",
+				len(o.CookieSecret)))
+		}
+	}
+
+	if o.UpstreamBufferSize < 1 {
+		msgs = append(msgs, fmt.Sprintf(
+			"upstream-buffer-size=%d must be positive", o.UpstreamBufferSize))
+	}
+	if o.StaticCacheSize < 0 || o.StaticCacheTTL < 0 {
+		msgs = append(msgs, "static-cache-size and static-cache-ttl must not be negative")
+	}
+	if o.RedeemMaxConcurrent > 0 && o.RedeemQueueTimeout <= 0 {
+		msgs = append(msgs, fmt.Sprintf(
+			"redeem-queue-timeout=%s must be positive", o.RedeemQueueTimeout))
+	}
+	if o.UpstreamBreakerThreshold < 0 {
+		msgs = append(msgs, fmt.Sprintf(
+			"upstream_breaker_threshold (%d) must not be negative",
+			o.UpstreamBreakerThreshold))
+	}
+
+	if o.CookieRefresh >= o.CookieExpire {
+		msgs = append(msgs, fmt.Sprintf(
+			"cookie_refresh (%s) must be less than "+
+				"cookie_expire (%s)",
+			o.CookieRefresh.String(),
+			o.CookieExpire.String()))
+	}
+
+	if len(msgs) != 0 {
+		return fmt.Errorf("Invalid configuration:\n  %s",
+			strings.Join(msgs, "\n  "))
+	}
+	return nil
+}
+
+var skipAuthMethodsPrefix = regexp.MustCompile(`^([A-Z]+(?:,[A-Z]+)*)=`)
+
+// parseSkipAuthMethods splits an optional "METHOD[,METHOD...]=" prefix from
+// a skip-auth-regex entry, e.g. "GET,HEAD=^/public/".
+func parseSkipAuthMethods(entry string) ([]string, string) {
+	m := skipAuthMethodsPrefix.FindStringSubmatch(entry)
+	if m == nil {
+		return nil, entry
+	}
+	return strings.Split(m[1], ","), entry[len(m[0]):]
+}
+
+func parseProviderInfo(o *Options, msgs []string) []string {
+	p := &providers.ProviderData{Scope: o.Scope, ClientID: o.ClientID, ClientSecret: o.ClientSecret,
+		RequireVerifiedEmail: o.RequireVerifiedEmail,
+		RequireMFA:           o.RequireMFA,
+		MFAACRValues:         o.MFAACRValues}
+	p.LoginUrl, msgs = parseUrl(o.LoginUrl, "login", msgs)
+	p.RedeemUrl, msgs = parseUrl(o.RedeemUrl, "redeem", msgs)
+	p.ProfileUrl, msgs = parseUrl(o.ProfileUrl, "profile", msgs)
+	p.ValidateUrl, msgs = parseUrl(o.ValidateUrl, "validate", msgs)
+
+	if o.ProviderTimeout <= 0 {
+		msgs = append(msgs, fmt.Sprintf(
+			"provider-timeout=%s must be positive", o.ProviderTimeout))
+	}
+	if o.ProviderMaxIdleConns < 0 {
+		msgs = append(msgs, fmt.Sprintf(
+			"provider-max-idle-conns=%d must not be negative", o.ProviderMaxIdleConns))
+	}
+	var proxy *url.URL
+	proxy, msgs = parseProviderProxy(o.ProviderProxy, msgs)
+	p.HTTPClient = newProviderClient(o.ProviderTimeout, o.ProviderMaxIdleConns, proxy)
+
+	if o.MockProvider {
+		o.provider = providers.NewMockProvider(p)
+	} else {
+		o.provider = providers.New(o.Provider, p)
+	}
+	switch p := o.provider.(type) {
+	case *providers.GitHubProvider:
+		p.SetOrgTeam(o.GitHubOrg, o.GitHubTeam)
+		p.SetRepo(o.GitHubRepo, o.GitHubPrivateRepo)
+		if parts := strings.Split(o.GitHubRepo, "/"); o.GitHubRepo != "" &&
+			(len(parts) != 2 || parts[0] == "" || parts[1] == "") {
+			msgs = append(msgs, fmt.Sprintf(
+				"github-repo=%q must be of the form \"owner/name\"", o.GitHubRepo))
+		}
+	}
+	if _, ok := o.provider.(*providers.GoogleProvider); o.RequireMFA && !ok {
+		msgs = append(msgs, "require-mfa is only supported by providers "+
+			"that issue ID tokens (google)")
+	}
+	switch o.provider.(type) {
+	case *providers.GoogleProvider, *providers.GitHubProvider:
+	default:
+		if o.RequireVerifiedEmail {
+			msgs = append(msgs, "require-verified-email is only supported by providers "+
+				"that report it (google, github)")
+		}
+	}
+	if _, ok := o.provider.(providers.AuthTimeProvider); len(o.StepUpRegex) != 0 && !ok {
+		msgs = append(msgs, "step-up-regex is only supported by providers "+
+			"that report when the user authenticated (google)")
+	}
+	return msgs
+}
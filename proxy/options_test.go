@@ -0,0 +1,535 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func testOptions() *Options {
+	o := NewOptions()
+	o.Upstreams = append(o.Upstreams, "http://127.0.0.1:8080/")
+	o.CookieSecret = "foobar"
+	o.ClientID = "bazquux"
+	o.ClientSecret = "xyzzyplugh"
+	return o
+}
+
+func errorMsg(msgs []string) string {
+	result := make([]string, 0)
+	result = append(result, "Invalid configuration:")
+	result = append(result, msgs...)
+	return strings.Join(result, "\n  ")
+}
+
+func TestNewOptions(t *testing.T) {
+	o := NewOptions()
+	err := o.Validate()
+	assert.NotEqual(t, nil, err)
+
+	expected := errorMsg([]string{
+		"missing setting: upstream",
+		"missing setting: cookie-secret",
+		"missing setting: client-id",
+		"missing setting: client-secret"})
+	assert.Equal(t, expected, err.Error())
+}
+
+func TestInitializedOptions(t *testing.T) {
+	o := testOptions()
+	assert.Equal(t, nil, o.Validate())
+}
+
+// Note that it's not worth testing nonparseable URLs, since url.Parse()
+// seems to parse damn near anything.
+func TestRedirectUrl(t *testing.T) {
+	o := testOptions()
+	o.RedirectUrl = "https://myhost.com/oauth2/callback"
+	assert.Equal(t, nil, o.Validate())
+	expected := &url.URL{
+		Scheme: "https", Host: "myhost.com", Path: "/oauth2/callback"}
+	assert.Equal(t, expected, o.redirectUrl)
+}
+
+func TestProxyUrls(t *testing.T) {
+	o := testOptions()
+	o.Upstreams = append(o.Upstreams, "http://127.0.0.1:8081")
+	assert.Equal(t, nil, o.Validate())
+	expected := []*url.URL{
+		&url.URL{Scheme: "http", Host: "127.0.0.1:8080", Path: "/"},
+		// note the '/' was added
+		&url.URL{Scheme: "http", Host: "127.0.0.1:8081", Path: "/"},
+	}
+	assert.Equal(t, expected, o.proxyUrls)
+}
+
+func TestCanaryUrls(t *testing.T) {
+	o := testOptions()
+	o.CanaryUpstreams = []string{"http://127.0.0.1:8081"}
+	o.CanaryPercent = 10
+	assert.Equal(t, nil, o.Validate())
+	expected := []*url.URL{
+		&url.URL{Scheme: "http", Host: "127.0.0.1:8081", Path: "/"},
+	}
+	assert.Equal(t, expected, o.canaryUrls)
+}
+
+func TestCanaryWithoutUpstream(t *testing.T) {
+	o := testOptions()
+	o.CanaryUpstreams = []string{"http://127.0.0.1:8081/foo/"}
+	o.CanaryPercent = 101
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"canary-upstream=\"http://127.0.0.1:8081/foo/\" has no upstream for path \"/foo/\"",
+		"canary_percent (101) must be between 0 and 100"}), err.Error())
+}
+
+func TestCompiledRegex(t *testing.T) {
+	o := testOptions()
+	regexps := []string{"/foo/.*", "/ba[rz]/quux"}
+	o.SkipAuthRegex = regexps
+	assert.Equal(t, nil, o.Validate())
+	actual := make([]string, 0)
+	for _, regex := range o.CompiledRegex {
+		actual = append(actual, regex.String())
+	}
+	assert.Equal(t, regexps, actual)
+}
+
+func TestCompiledRegexWithMethods(t *testing.T) {
+	o := testOptions()
+	o.SkipAuthRegex = []string{"GET,HEAD=^/public/", "/foo=bar", "^/any/"}
+	assert.Equal(t, nil, o.Validate())
+	actual := make([]string, 0)
+	for _, regex := range o.CompiledRegex {
+		actual = append(actual, regex.String())
+	}
+	assert.Equal(t, []string{"^/public/", "/foo=bar", "^/any/"}, actual)
+	assert.Equal(t, [][]string{{"GET", "HEAD"}, nil, nil}, o.skipAuthMethods)
+}
+
+func TestCompiledRegexError(t *testing.T) {
+	o := testOptions()
+	o.SkipAuthRegex = []string{"(foobaz", "barquux)"}
+	err := o.Validate()
+	assert.NotEqual(t, nil, err)
+
+	expected := errorMsg([]string{
+		"error compiling regex=\"(foobaz\" error parsing regexp: " +
+			"missing closing ): `(foobaz`",
+		"error compiling regex=\"barquux)\" error parsing regexp: " +
+			"unexpected ): `barquux)`"})
+	assert.Equal(t, expected, err.Error())
+}
+
+func TestDefaultProviderApiSettings(t *testing.T) {
+	o := testOptions()
+	assert.Equal(t, nil, o.Validate())
+	p := o.provider.Data()
+	assert.Equal(t, "https://accounts.google.com/o/oauth2/auth",
+		p.LoginUrl.String())
+	assert.Equal(t, "https://accounts.google.com/o/oauth2/token",
+		p.RedeemUrl.String())
+	assert.Equal(t, "", p.ProfileUrl.String())
+	assert.Equal(t, "profile email", p.Scope)
+}
+
+func TestPassAccessTokenRequiresSpecificCookieSecretLengths(t *testing.T) {
+	o := testOptions()
+	assert.Equal(t, nil, o.Validate())
+
+	assert.Equal(t, false, o.PassAccessToken)
+	o.PassAccessToken = true
+	o.CookieSecret = "cookie of invalid length-"
+	assert.NotEqual(t, nil, o.Validate())
+
+	o.PassAccessToken = false
+	o.CookieRefresh = time.Duration(24) * time.Hour
+	assert.NotEqual(t, nil, o.Validate())
+
+	o.CookieSecret = "16 bytes AES-128"
+	assert.Equal(t, nil, o.Validate())
+
+	o.CookieSecret = "24 byte secret AES-192--"
+	assert.Equal(t, nil, o.Validate())
+
+	o.CookieSecret = "32 byte secret for AES-256------"
+	assert.Equal(t, nil, o.Validate())
+}
+
+func TestCookieRefreshMustBeLessThanCookieExpire(t *testing.T) {
+	o := testOptions()
+	assert.Equal(t, nil, o.Validate())
+
+	o.CookieSecret = "0123456789abcdef"
+	o.CookieRefresh = o.CookieExpire
+	assert.NotEqual(t, nil, o.Validate())
+
+	o.CookieRefresh -= time.Duration(1)
+	assert.Equal(t, nil, o.Validate())
+}
+
+func TestRequireMFAUnsupportedProvider(t *testing.T) {
+	o := testOptions()
+	o.RequireMFA = true
+	assert.Equal(t, nil, o.Validate())
+
+	o = testOptions()
+	o.Provider = "github"
+	o.RequireMFA = true
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"require-mfa is only supported by providers that issue ID tokens (google)"}),
+		err.Error())
+}
+
+func TestMockProviderNeedsNoClient(t *testing.T) {
+	o := testOptions()
+	o.ClientID, o.ClientSecret = "", ""
+	o.MockProvider = true
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, "Mock", o.provider.Data().ProviderName)
+}
+
+func TestStepUpNeedsAuthTime(t *testing.T) {
+	o := testOptions()
+	o.StepUpRegex = []string{"^/admin/"}
+	assert.Equal(t, nil, o.Validate())
+
+	o = testOptions()
+	o.StepUpRegex = []string{"^/admin/"}
+	o.Provider = "github"
+	assert.Equal(t, errorMsg([]string{
+		"step-up-regex is only supported by providers that report when the user authenticated (google)"}),
+		o.Validate().Error())
+}
+
+func TestRateLimitBurstDefaultsToRate(t *testing.T) {
+	o := testOptions()
+	o.RateLimit = 5
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, 5, o.RateLimitBurst)
+
+	o = testOptions()
+	o.RateLimit = -1
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"rate_limit (-1) must not be negative"}), err.Error())
+}
+
+func TestSignInRateLimitBurstDefaultsToRate(t *testing.T) {
+	o := testOptions()
+	o.SignInRateLimit = 10
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, 10, o.SignInRateLimitBurst)
+
+	o = testOptions()
+	o.SignInRateLimit = -1
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"sign_in_rate_limit (-1) must not be negative"}), err.Error())
+}
+
+func TestGitHubRepo(t *testing.T) {
+	o := testOptions()
+	o.Provider = "github"
+	o.GitHubRepo = "bitly/oauth2_proxy"
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, "user:email", o.provider.Data().Scope)
+
+	o = testOptions()
+	o.Provider = "github"
+	o.GitHubRepo = "bitly/oauth2_proxy"
+	o.GitHubPrivateRepo = true
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, "user:email repo", o.provider.Data().Scope)
+
+	o = testOptions()
+	o.Provider = "github"
+	o.GitHubRepo = "oauth2_proxy"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"github-repo=\"oauth2_proxy\" must be of the form \"owner/name\""}),
+		err.Error())
+}
+
+func TestGeoIPCountriesRequireDatabase(t *testing.T) {
+	o := testOptions()
+	o.GeoIPDenyCountries = []string{"KP"}
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"missing setting: geoip-database is required with geoip-allow-country or geoip-deny-country"}),
+		err.Error())
+}
+
+func TestUpstreamConfigs(t *testing.T) {
+	o := testOptions()
+	o.UpstreamConfigs = []Upstream{
+		{Path: "/api/", URL: "http://127.0.0.1:8081", Rewrite: "/v1/"},
+		{URL: "http://127.0.0.1:8082/static/", SkipAuth: true},
+	}
+	assert.Equal(t, nil, o.Validate())
+	expected := []*url.URL{
+		&url.URL{Scheme: "http", Host: "127.0.0.1:8080", Path: "/"},
+		&url.URL{Scheme: "http", Host: "127.0.0.1:8081", Path: "/api/"},
+		&url.URL{Scheme: "http", Host: "127.0.0.1:8082", Path: "/static/"},
+	}
+	assert.Equal(t, expected, o.proxyUrls)
+	assert.Equal(t, "/v1/", o.upstreamConfigs["/api/"].Rewrite)
+	assert.Equal(t, 1, len(o.CompiledRegex))
+	assert.Equal(t, "^/static/", o.CompiledRegex[0].String())
+}
+
+func TestUpstreamConfigErrors(t *testing.T) {
+	o := testOptions()
+	o.UpstreamConfigs = []Upstream{
+		{Path: "/api/"},
+		{URL: "127.0.0.1:8081"},
+		{Path: "api", URL: "http://127.0.0.1:8081"},
+		{Path: "/api/", URL: "http://127.0.0.1:8081", Rewrite: "v1"},
+		{Path: "/api/", URL: "http://127.0.0.1:8082"},
+	}
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"upstreams[0]: missing url",
+		"upstreams[1]: url \"127.0.0.1:8081\" is not an absolute URL",
+		"upstreams[2]: path \"api\" must start with \"/\"",
+		"upstreams[3]: rewrite \"v1\" must start with \"/\"",
+		"upstreams[4]: path \"/api/\" is already routed to another upstream"}),
+		err.Error())
+}
+
+func TestSecretFiles(t *testing.T) {
+	f, err := ioutil.TempFile("", "test_client_secret_")
+	if err != nil {
+		t.Fatal("failed to create temp file: " + err.Error())
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("file-secret\n")
+	f.Close()
+
+	o := testOptions()
+	o.ClientSecret = ""
+	o.ClientSecretFile = f.Name()
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, "file-secret", o.ClientSecret)
+
+	o = testOptions()
+	o.CookieSecretFile = f.Name()
+	err = o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"cannot set both cookie-secret and cookie-secret-file"}), err.Error())
+
+	o = testOptions()
+	o.AdminTokenFile = f.Name() + ".missing"
+	err = o.Validate()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), "error reading admin-token-file="))
+}
+
+func TestHttpsAddressRequiresCertificate(t *testing.T) {
+	o := testOptions()
+	o.HttpAddress = ""
+	o.HttpsAddress = ":443"
+	o.TLSCertFile = "cert.pem"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"missing setting: tls-cert-file and tls-key-file (or letsencrypt-host) are required with https-address"}),
+		err.Error())
+
+	o.TLSKeyFile = "key.pem"
+	assert.Equal(t, nil, o.Validate())
+
+	o.HttpsAddress = ""
+	err = o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"missing setting: http-address or https-address"}), err.Error())
+}
+
+func TestLetsEncryptHosts(t *testing.T) {
+	o := testOptions()
+	o.LetsEncryptHosts = []string{"proxy.example.com"}
+	o.TLSCertFile = "cert.pem"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"missing setting: https-address is required with letsencrypt-host",
+		"missing setting: letsencrypt-cache-dir is required with letsencrypt-host",
+		"cannot use tls-cert-file or tls-key-file with letsencrypt-host"}),
+		err.Error())
+
+	o = testOptions()
+	o.HttpsAddress = ":443"
+	o.LetsEncryptHosts = []string{"proxy.example.com"}
+	o.LetsEncryptCacheDir = "/var/cache/oauth2_proxy"
+	assert.Equal(t, nil, o.Validate())
+}
+
+func TestTLSPolicy(t *testing.T) {
+	o := testOptions()
+	o.TLSMinVersion = "1.3"
+	o.TLSCurves = []string{"X25519"}
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, uint16(tls.VersionTLS13), o.tlsPolicy.MinVersion)
+
+	o = testOptions()
+	o.TLSCipherSuites = []string{"TLS_RSA_WITH_3DES_EDE_CBC_SHA"}
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"error parsing tls-min-version, tls-cipher-suite or tls-curve: unknown or insecure cipher suite \"TLS_RSA_WITH_3DES_EDE_CBC_SHA\""}),
+		err.Error())
+}
+
+func TestTLSClientCAFile(t *testing.T) {
+	o := testOptions()
+	o.TLSClientCAFile = "/nonexistent/ca.pem"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"missing setting: https-address is required with tls-client-ca-file",
+		"error loading tls-client-ca-file=\"/nonexistent/ca.pem\" open /nonexistent/ca.pem: no such file or directory"}),
+		err.Error())
+}
+
+func TestHttp2MaxConcurrentStreams(t *testing.T) {
+	o := testOptions()
+	o.Http2MaxConcurrentStreams = 0
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"http2-max-concurrent-streams (0) must be at least 1"}), err.Error())
+}
+
+func TestRequestLoggingFormat(t *testing.T) {
+	o := testOptions()
+	assert.Equal(t, nil, o.Validate())
+	assert.NotEqual(t, (*template.Template)(nil), o.requestLogTemplate)
+
+	o = testOptions()
+	o.LogFormat = "json"
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, (*template.Template)(nil), o.requestLogTemplate)
+
+	o = testOptions()
+	o.RequestLoggingFormat = "{{.Nope}}"
+	err := o.Validate()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), "error parsing request-logging-format"))
+}
+
+func TestLoggingExcludeRegexError(t *testing.T) {
+	o := testOptions()
+	o.LoggingExcludeRegex = []string{"("}
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"error compiling logging-exclude-regex=\"(\" error parsing regexp: missing closing ): `(`"}),
+		err.Error())
+}
+
+func TestRejectSessionsBefore(t *testing.T) {
+	o := testOptions()
+	o.RejectSessionsBefore = "2015-03-19T21:20:19Z"
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, int64(1426800019), o.rejectSessionsBefore.Unix())
+
+	o = testOptions()
+	o.RejectSessionsBefore = "yesterday"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"reject-sessions-before=\"yesterday\" must be an RFC3339 time"}),
+		err.Error())
+}
+
+func TestSessionBindingOptions(t *testing.T) {
+	o := testOptions()
+	o.SessionBinding = []string{"ip", "user-agent"}
+	assert.Equal(t, nil, o.Validate())
+
+	o = testOptions()
+	o.SessionBinding = []string{"cookie"}
+	o.SessionBindingIPv4Prefix = 33
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"error parsing session-binding: unknown session binding \"cookie\"",
+		"session-binding-ipv4-prefix must be 0 to 32 and session-binding-ipv6-prefix 0 to 128"}),
+		err.Error())
+}
+
+func TestAuthorizationHeaderOptionsConflict(t *testing.T) {
+	o := testOptions()
+	o.StripAuthorizationHeader = true
+	o.PassAuthorizationHeader = true
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"strip-authorization-header and pass-authorization-header can't both be set"}),
+		err.Error())
+}
+
+func TestIdentityHeaderNameErrors(t *testing.T) {
+	o := testOptions()
+	o.UserHeader = ""
+	o.AuthResponseHeader = "X-Auth-Request-User"
+	assert.Equal(t, nil, o.Validate())
+
+	o = testOptions()
+	o.EmailHeader = "X Email"
+	o.UpstreamAddressHeader = "GAP-Upstream"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"email-header=\"X Email\" is not a valid header name",
+		"upstream-address-header=\"GAP-Upstream\" must not start with GAP-"}),
+		err.Error())
+}
+
+func TestCaptchaOptions(t *testing.T) {
+	o := testOptions()
+	o.CaptchaProvider = "other"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		`captcha-provider="other" must be "recaptcha" or "hcaptcha"`,
+		"captcha-provider requires captcha-site-key and captcha-secret"}), err.Error())
+}
+
+func TestJWTAudienceDefaultsToClientID(t *testing.T) {
+	o := testOptions()
+	o.JWTIssuer = "https://issuer.example.com"
+	o.JWTJWKSUrl = "https://issuer.example.com/keys"
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, "bazquux", o.JWTAudience)
+
+	o = testOptions()
+	o.ClientID, o.ClientSecret = "", ""
+	o.JWTIssuer = "https://issuer.example.com"
+	o.JWTJWKSUrl = "https://issuer.example.com/keys"
+	assert.Equal(t, errorMsg([]string{
+		"missing setting: client-id",
+		"missing setting: client-secret",
+		"missing setting: jwt-audience is required with jwt-jwks-url"}), o.Validate().Error())
+}
+
+func TestIntrospectionAudienceDefaultsToClientID(t *testing.T) {
+	o := testOptions()
+	o.IntrospectionUrl = "https://issuer.example.com/introspect"
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, "bazquux", o.IntrospectionAudience)
+}
+
+func TestRequireVerifiedEmailIsSupported(t *testing.T) {
+	o := testOptions()
+	o.RequireVerifiedEmail = true
+	o.Provider = "github"
+	assert.Equal(t, nil, o.Validate())
+
+	o = testOptions()
+	o.RequireVerifiedEmail = true
+	o.Provider = "linkedin"
+	o.IntrospectionUrl = "https://issuer.example.com/introspect"
+	assert.Equal(t, errorMsg([]string{
+		"require-verified-email can't be checked for introspected bearer tokens (introspection-url)",
+		"require-verified-email is only supported by providers that report it (google, github)"}),
+		o.Validate().Error())
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/pprof"
+	"time"
+)
+
+// profiler writes the goroutine stacks, a heap profile and a CPU profile of
+// the running proxy to dir, to diagnose hangs and leaks in production, such
+// as requests stuck on an upstream, without restarting it.
+type profiler struct {
+	dir         string
+	cpuDuration time.Duration
+	now         func() time.Time
+}
+
+func newProfiler(dir string, cpuDuration time.Duration) *profiler {
+	return &profiler{dir: dir, cpuDuration: cpuDuration, now: time.Now}
+}
+
+// Dump writes goroutines-<time>.txt and heap-<time>.pprof, then profiles
+// the CPU for cpuDuration, if it isn't 0, into cpu-<time>.pprof.
+func (p *profiler) Dump() error {
+	if err := os.MkdirAll(p.dir, 0700); err != nil {
+		return err
+	}
+	stamp := p.now().UTC().Format("20060102T150405Z")
+	if err := p.write("goroutines-"+stamp+".txt", func(f *os.File) error {
+		return pprof.Lookup("goroutine").WriteTo(f, 2)
+	}); err != nil {
+		return err
+	}
+	if err := p.write("heap-"+stamp+".pprof", func(f *os.File) error {
+		return pprof.Lookup("heap").WriteTo(f, 0)
+	}); err != nil {
+		return err
+	}
+	if p.cpuDuration == 0 {
+		return nil
+	}
+	return p.write("cpu-"+stamp+".pprof", func(f *os.File) error {
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		time.Sleep(p.cpuDuration)
+		pprof.StopCPUProfile()
+		return nil
+	})
+}
+
+func (p *profiler) write(name string, profile func(*os.File) error) error {
+	path := filepath.Join(p.dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := profile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %s", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	logger.Printf("wrote %s", path)
+	return nil
+}
+
+// DumpOnSignal calls Dump whenever one of sigs is received. Signals received
+// while a dump is in progress are coalesced into one more dump.
+func (p *profiler) DumpOnSignal(sigs ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		for range c {
+			if err := p.Dump(); err != nil {
+				logger.Errorf("writing profiles to %s: %s", p.dir, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestProfilerDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := newProfiler(filepath.Join(dir, "profiles"), 10*time.Millisecond)
+	p.now = func() time.Time { return time.Date(2026, 10, 17, 15, 4, 5, 0, time.UTC) }
+	assert.Equal(t, nil, p.Dump())
+
+	stacks, err := ioutil.ReadFile(filepath.Join(dir, "profiles", "goroutines-20261017T150405Z.txt"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, strings.Contains(string(stacks), "TestProfilerDump"))
+	for _, name := range []string{"heap-20261017T150405Z.pprof", "cpu-20261017T150405Z.pprof"} {
+		info, err := os.Stat(filepath.Join(dir, "profiles", name))
+		assert.Equal(t, nil, err)
+		assert.NotEqual(t, int64(0), info.Size())
+	}
+
+	// an earlier dump isn't overwritten
+	assert.NotEqual(t, nil, p.Dump())
+}
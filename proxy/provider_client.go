@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// newProviderClient returns the client for requests to the provider:
+// redeeming codes, fetching profiles and validating tokens. Each request,
+// reading the response included, is given up after timeout, so a stalled
+// provider can't hold up the requests waiting on it indefinitely. Up to
+// maxIdleConns connections are kept open to each provider host for reuse,
+// and requests go through proxy if set, or else the proxy of the
+// HTTPS_PROXY/HTTP_PROXY environment variables.
+func newProviderClient(timeout time.Duration, maxIdleConns int, proxy *url.URL) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdleConns
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// parseProviderProxy parses provider-proxy, an http, https or socks5 URL.
+func parseProviderProxy(proxy string, msgs []string) (*url.URL, []string) {
+	if proxy == "" {
+		return nil, msgs
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, append(msgs, fmt.Sprintf("error parsing provider-proxy=%q %s", proxy, err))
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, append(msgs, fmt.Sprintf(
+			"provider-proxy=%q must be an http, https or socks5 URL", proxy))
+	}
+	return u, msgs
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestProviderClientTimeout(t *testing.T) {
+	release := make(chan bool)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer provider.Close()
+	defer close(release)
+
+	client := newProviderClient(50*time.Millisecond, 1, nil)
+	start := time.Now()
+	_, err := client.Get(provider.URL)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, time.Since(start) < 5*time.Second)
+}
+
+func TestProviderClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := newProviderClient(time.Second, 1, proxyURL)
+	resp, err := client.Get("http://provider.example.com/token")
+	assert.Equal(t, nil, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "http://provider.example.com/token", proxied)
+}
+
+func TestProviderClientOptions(t *testing.T) {
+	o := testOptions()
+	o.ProviderProxy = "socks5://127.0.0.1:1080"
+	assert.Equal(t, nil, o.Validate())
+	assert.Equal(t, 10*time.Second, o.provider.Data().HTTPClient.Timeout)
+
+	o = testOptions()
+	o.ProviderTimeout = 0
+	o.ProviderProxy = "ftp://proxy"
+	err := o.Validate()
+	assert.Equal(t, errorMsg([]string{
+		"provider-timeout=0s must be positive",
+		`provider-proxy="ftp://proxy" must be an http, https or socks5 URL`}),
+		err.Error())
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// RateLimiter is a per-key token bucket.
+type RateLimiter interface {
+	// Allow takes a token from key's bucket. When the bucket is empty it
+	// returns false and how long until a token is available.
+	Allow(key string) (bool, time.Duration)
+}
+
+// maxRateLimitBuckets bounds the memory used by a MemoryRateLimiter; full
+// buckets are pruned once it is exceeded.
+const maxRateLimitBuckets = 10000
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryRateLimiter keeps its buckets in process, so each instance of the
+// proxy enforces its own limit.
+type MemoryRateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewMemoryRateLimiter allows rate requests per second per key, with bursts
+// of up to burst requests.
+func NewMemoryRateLimiter(rate float64, burst int) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (l *MemoryRateLimiter) Allow(key string) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.prune(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// prune drops buckets that have refilled, since they are equivalent to a
+// new bucket.
+func (l *MemoryRateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// redisTokenBucket atomically refills and takes from the bucket stored at
+// KEYS[1], returning 0 if a token was taken or else the milliseconds until
+// one is available. ARGV is rate (per second), burst and the current time
+// in milliseconds.
+var redisTokenBucket = redis.NewScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate))
+return wait
+`)
+
+// RedisRateLimiter keeps its buckets in Redis so that the limit is shared
+// by every instance of the proxy. If Redis is unavailable requests are
+// allowed.
+type RedisRateLimiter struct {
+	rate  float64
+	burst int
+	pool  *redis.Pool
+}
+
+func NewRedisRateLimiter(address string, rate float64, burst int) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		rate:  rate,
+		burst: burst,
+		pool: &redis.Pool{
+			MaxIdle:     16,
+			IdleTimeout: time.Duration(4) * time.Minute,
+			Dial: func() (redis.Conn, error) {
+				timeout := time.Duration(1) * time.Second
+				return redis.DialTimeout("tcp", address, timeout, timeout, timeout)
+			},
+		},
+	}
+}
+
+func (l *RedisRateLimiter) Allow(key string) (bool, time.Duration) {
+	c := l.pool.Get()
+	defer c.Close()
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	wait, err := redis.Int64(redisTokenBucket.Do(c,
+		"oauth2_proxy:ratelimit:"+key, l.rate, l.burst, now))
+	if err != nil {
+		logger.Errorf("error checking rate limit for %s: %s", key, err)
+		return true, 0
+	}
+	return wait == 0, time.Duration(wait) * time.Millisecond
+}
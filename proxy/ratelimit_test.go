@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	now := time.Unix(1431007200, 0)
+	l := NewMemoryRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("michael.bland@gsa.gov")
+		assert.Equal(t, true, ok)
+	}
+	ok, wait := l.Allow("michael.bland@gsa.gov")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, time.Duration(500)*time.Millisecond, wait)
+
+	// other users have their own bucket
+	ok, _ = l.Allow("someone.else@gsa.gov")
+	assert.Equal(t, true, ok)
+
+	now = now.Add(time.Duration(500) * time.Millisecond)
+	ok, _ = l.Allow("michael.bland@gsa.gov")
+	assert.Equal(t, true, ok)
+	ok, _ = l.Allow("michael.bland@gsa.gov")
+	assert.Equal(t, false, ok)
+
+	// an idle bucket refills to burst, not beyond
+	now = now.Add(time.Duration(1) * time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("michael.bland@gsa.gov")
+		assert.Equal(t, true, ok)
+	}
+	ok, _ = l.Allow("michael.bland@gsa.gov")
+	assert.Equal(t, false, ok)
+}
+
+func TestMemoryRateLimiterPrunesFullBuckets(t *testing.T) {
+	now := time.Unix(1431007200, 0)
+	l := NewMemoryRateLimiter(1, 1)
+	l.now = func() time.Time { return now }
+	l.buckets["idle@gsa.gov"] = &tokenBucket{tokens: 0, last: now.Add(-time.Duration(1) * time.Minute)}
+	l.buckets["busy@gsa.gov"] = &tokenBucket{tokens: 0, last: now}
+
+	l.prune(now)
+	_, idle := l.buckets["idle@gsa.gov"]
+	_, busy := l.buckets["busy@gsa.gov"]
+	assert.Equal(t, false, idle)
+	assert.Equal(t, true, busy)
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minRedactedSecret is the shortest secret value Redactor masks; shorter
+// values would mask unrelated text.
+const minRedactedSecret = 6
+
+// redactPatterns mask credentials wherever they appear: authorization
+// header values, token, code and password parameters in URLs, form bodies
+// and JSON, and session cookies.
+var redactPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`\b(Bearer|Basic) [A-Za-z0-9._~+/-]{8,}=*`), "$1 " + redacted},
+	{regexp.MustCompile(`(?i)((?:^|[?&\s"'])(?:access_token|id_token|refresh_token|client_secret|code|token|password)=)[^&\s"']+`), "$1" + redacted},
+	{regexp.MustCompile(`(?i)("(?:access_token|id_token|refresh_token|client_secret|password)"\s*:\s*)"[^"]*"`), `$1"` + redacted + `"`},
+	{regexp.MustCompile(`\b(_oauthproxy[A-Za-z0-9_]*=)[^;\s]+`), "$1" + redacted},
+}
+
+// Redactor masks secrets in log lines and error pages: the values of the
+// secret options, and credentials matching redactPatterns.
+type Redactor struct {
+	sync.RWMutex
+	secrets []string
+}
+
+// redactor is the process wide Redactor used by the logger and error pages.
+var redactor = &Redactor{}
+
+// Add registers secret values to mask. Values are never removed, so secrets
+// replaced by a reload stay masked.
+func (r *Redactor) Add(secrets ...string) {
+	r.Lock()
+	defer r.Unlock()
+	for _, s := range secrets {
+		if len(s) < minRedactedSecret || r.has(s) {
+			continue
+		}
+		r.secrets = append(r.secrets, s)
+	}
+	// longest first, so a secret containing another is masked whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+func (r *Redactor) has(secret string) bool {
+	for _, s := range r.secrets {
+		if s == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// AddOptions registers the values of the secretOptions in opts.
+func (r *Redactor) AddOptions(opts *Options) {
+	v := reflect.ValueOf(opts).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if secretOptions[v.Type().Field(i).Tag.Get("cfg")] {
+			r.Add(v.Field(i).String())
+		}
+	}
+}
+
+// Redact returns s with secrets masked.
+func (r *Redactor) Redact(s string) string {
+	r.RLock()
+	for _, secret := range r.secrets {
+		s = strings.Replace(s, secret, redacted, -1)
+	}
+	r.RUnlock()
+	for _, p := range redactPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// redactWriter masks secrets in each write to w, which must be whole lines,
+// as written by the log package and LoggingHandler.
+type redactWriter struct {
+	w io.Writer
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
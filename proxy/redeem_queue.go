@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// errRedeemBusy is returned for a sign in that waited redeem-queue-timeout
+// without its code being redeemed.
+var errRedeemBusy = errors.New("too many sign ins in progress")
+
+// redeemQueue bounds how many codes are redeemed with the provider at once,
+// so a stampede of sign ins, such as after many sessions expire together,
+// queues on the proxy instead of opening a connection each to the provider
+// and tripping its rate limits. A nil queue allows any number.
+type redeemQueue struct {
+	slots   chan struct{}
+	timeout time.Duration
+	waiting int64
+}
+
+func newRedeemQueue(n int, timeout time.Duration) *redeemQueue {
+	if n <= 0 {
+		return nil
+	}
+	return &redeemQueue{slots: make(chan struct{}, n), timeout: timeout}
+}
+
+// Acquire waits up to the queue timeout, or until ctx is done, for a
+// redemption to finish if there are already as many as allowed in progress.
+// Once it returns nil the caller must call Release when done.
+func (q *redeemQueue) Acquire(ctx context.Context, stats *StatsD) error {
+	if q == nil {
+		return nil
+	}
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	start := time.Now()
+	stats.Gauge("redeem.queue", atomic.AddInt64(&q.waiting, 1))
+	defer func() {
+		stats.Gauge("redeem.queue", atomic.AddInt64(&q.waiting, -1))
+		stats.Timing("redeem.wait", time.Since(start))
+	}()
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		stats.Incr("redeem.busy")
+		return errRedeemBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *redeemQueue) Release() {
+	if q != nil {
+		<-q.slots
+	}
+}
+
+// Waiting is the number of sign ins queued for a redemption to finish.
+func (q *redeemQueue) Waiting() int64 {
+	if q == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&q.waiting)
+}
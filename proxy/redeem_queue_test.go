@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRedeemQueue(t *testing.T) {
+	q := newRedeemQueue(1, 20*time.Millisecond)
+	assert.Equal(t, nil, q.Acquire(context.Background(), nil))
+
+	// a full queue times out
+	assert.Equal(t, errRedeemBusy, q.Acquire(context.Background(), nil))
+	assert.Equal(t, int64(0), q.Waiting())
+
+	// or lets a waiting sign in through once a redemption finishes
+	q.timeout = time.Minute
+	acquired := make(chan error)
+	go func() { acquired <- q.Acquire(context.Background(), nil) }()
+	for q.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	q.Release()
+	assert.Equal(t, nil, <-acquired)
+	assert.Equal(t, int64(0), q.Waiting())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, q.Acquire(ctx, nil))
+	q.Release()
+
+	var unlimited *redeemQueue
+	assert.Equal(t, nil, unlimited.Acquire(context.Background(), nil))
+	unlimited.Release()
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// validRedirect returns redirect if it is safe to send a user to after
+// signing in, or "/" otherwise. Safe targets are paths on the current host
+// (but not protocol-relative "//host" URLs) and absolute http(s) URLs on
+// host or one of the whitelisted domains.
+func validRedirect(redirect, host string, whitelist []string) string {
+	if isRelativeRedirect(redirect) {
+		return redirect
+	}
+	u, err := url.Parse(redirect)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "/"
+	}
+	if strings.EqualFold(u.Host, host) || whitelistedDomain(u.Hostname(), redirectPort(u), whitelist) {
+		return u.String()
+	}
+	return "/"
+}
+
+// isRelativeRedirect reports whether redirect is a path on the current
+// host. Browsers treat "\" like "/", so "/\evil.com" is rejected along with
+// "//evil.com".
+func isRelativeRedirect(redirect string) bool {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") ||
+		strings.HasPrefix(redirect, "/\\") {
+		return false
+	}
+	return !strings.ContainsAny(redirect, "\r\n\t")
+}
+
+// redirectPort returns the port of u, or the default port of its scheme.
+func redirectPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// whitelistedDomain reports whether hostname is one of domains, or a
+// subdomain of one given with a leading ".", as in ".example.com". A domain
+// given with a port, as in ".example.com:8443", only matches that port.
+func whitelistedDomain(hostname, port string, domains []string) bool {
+	hostname = strings.ToLower(hostname)
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if h, p, err := net.SplitHostPort(domain); err == nil {
+			if p != port {
+				continue
+			}
+			domain = h
+		}
+		if hostname == strings.TrimPrefix(domain, ".") {
+			return true
+		}
+		if strings.HasPrefix(domain, ".") && strings.HasSuffix(hostname, domain) {
+			return true
+		}
+	}
+	return false
+}
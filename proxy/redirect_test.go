@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestValidRedirect(t *testing.T) {
+	whitelist := []string{"other.example.com", ".example.net:8443"}
+	for redirect, expected := range map[string]string{
+		"":                                 "/",
+		"/":                                "/",
+		"/foo?bar=baz":                     "/foo?bar=baz",
+		"//evil.com":                       "/",
+		"/\\evil.com":                      "/",
+		"/foo\r\nSet-Cookie: x=y":          "/",
+		"evil.com":                         "/",
+		"javascript:alert(1)":              "/",
+		"https://app.example.com/foo":      "https://app.example.com/foo",
+		"https://APP.example.com/foo":      "https://APP.example.com/foo",
+		"https://app.example.com.evil.com": "/",
+		"https://other.example.com/":       "https://other.example.com/",
+		"https://sub.other.example.com/":   "/",
+		"https://example.net:8443/":        "https://example.net:8443/",
+		"https://a.b.example.net:8443/":    "https://a.b.example.net:8443/",
+		"http://example.net/":              "/",
+		"https://a.b.example.net/":         "/",
+		"http://a.b.example.net:8080/":     "/",
+		"https://other.example.com:8443/":  "https://other.example.com:8443/",
+		"http://evilexample.net/":          "/",
+		"https://user@app.example.com/":    "/",
+		"ftp://app.example.com/":           "/",
+	} {
+		assert.Equal(t, expected, validRedirect(redirect, "app.example.com", whitelist), redirect)
+	}
+}
+
+func TestOpenRedirect(t *testing.T) {
+	opts := testOptions()
+	opts.WhitelistDomains = []string{".example.com"}
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+
+	start := func(rd string) string {
+		req, _ := http.NewRequest("GET", "/oauth2/start?rd="+url.QueryEscape(rd), nil)
+		req.Host = "app.example.com"
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		assert.Equal(t, 302, rw.Code)
+		login, _ := url.Parse(rw.Header().Get("Location"))
+		return login.Query().Get("state")
+	}
+	assert.Equal(t, "/", start("//evil.com/"))
+	assert.Equal(t, "/", start("https://evil.com/"))
+	assert.Equal(t, "https://wiki.example.com/page", start("https://wiki.example.com/page"))
+	assert.Equal(t, "/page", start("/page"))
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import "sync"
+
+// refreshGroup runs one refresh at a time per session, so that when many
+// requests cross the cookie-refresh threshold together, the provider is
+// asked once and only one response sets the refreshed cookie.
+type refreshGroup struct {
+	sync.Mutex
+	calls map[string]*refreshCall
+}
+
+type refreshCall struct {
+	done chan struct{}
+	ok   bool
+}
+
+// Do calls refresh for the session key and returns its result, with leader
+// true. If a refresh of key is already running, Do waits for it instead and
+// returns its result with leader false.
+func (g *refreshGroup) Do(key string, refresh func() bool) (ok, leader bool) {
+	g.Lock()
+	if c, running := g.calls[key]; running {
+		g.Unlock()
+		<-c.done
+		return c.ok, false
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*refreshCall)
+	}
+	c := &refreshCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.Unlock()
+
+	defer func() {
+		g.Lock()
+		delete(g.calls, key)
+		g.Unlock()
+		close(c.done)
+	}()
+	c.ok = refresh()
+	return c.ok, true
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+type blockingTokenProvider struct {
+	*TestProvider
+	calls   int32
+	entered chan bool
+	release chan bool
+}
+
+func (p *blockingTokenProvider) ValidateToken(access_token string) bool {
+	atomic.AddInt32(&p.calls, 1)
+	p.entered <- true
+	<-p.release
+	return p.TestProvider.ValidateToken(access_token)
+}
+
+func TestConcurrentRefreshesShareOneValidation(t *testing.T) {
+	pc_test := NewProcessCookieTestWithDefaults()
+	provider := &blockingTokenProvider{
+		TestProvider: pc_test.proxy.provider.(*TestProvider),
+		entered:      make(chan bool, 10),
+		release:      make(chan bool),
+	}
+	pc_test.proxy.provider = provider
+	pc_test.proxy.tokenCache = nil
+	pc_test.proxy.CookieExpire = time.Duration(23) * time.Hour
+	pc_test.proxy.CookieRefresh = time.Duration(24) * time.Hour
+	cookie := pc_test.MakeCookie("michael.bland@gsa.gov", "my_access_token")
+
+	const n = 5
+	recorders := make([]*httptest.ResponseRecorder, n)
+	results := make([]bool, n)
+	var wg sync.WaitGroup
+	process := func(i int) {
+		defer wg.Done()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		recorders[i] = httptest.NewRecorder()
+		_, results[i] = pc_test.proxy.LoadCookiedSession(recorders[i], req)
+	}
+	wg.Add(n)
+	go process(0)
+	<-provider.entered
+	for i := 1; i < n; i++ {
+		go process(i)
+	}
+	// let the others join the refresh in progress
+	time.Sleep(50 * time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&provider.calls))
+	setCookies := 0
+	for i := 0; i < n; i++ {
+		assert.Equal(t, true, results[i])
+		if recorders[i].Header().Get("Set-Cookie") != "" {
+			setCookies++
+		}
+	}
+	assert.Equal(t, 1, setCookies)
+}
+
+func TestRefreshGroupRunsAgainAfterFinishing(t *testing.T) {
+	var g refreshGroup
+	calls := 0
+	for i := 0; i < 2; i++ {
+		ok, leader := g.Do("session", func() bool {
+			calls++
+			return true
+		})
+		assert.Equal(t, true, ok)
+		assert.Equal(t, true, leader)
+	}
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 0, len(g.calls))
+}
@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+// loadOptions resolves the options from the config file, environment and
+// command line flags, and validates them.
+func loadOptions(flagSet *flag.FlagSet, config string) (*Options, error) {
+	opts := NewOptions()
+
+	cfg := make(EnvOptions)
+	if strings.HasSuffix(config, ".yaml") || strings.HasSuffix(config, ".yml") {
+		var err error
+		opts.UpstreamConfigs, err = LoadYAMLConfig(config, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config file %s - %s", config, err)
+		}
+	} else if config != "" {
+		_, err := toml.DecodeFile(config, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config file %s - %s", config, err)
+		}
+	}
+	cfg.LoadEnvForStruct(opts)
+	cfg.LoadFlagsForStruct(opts, flagSet)
+	cfg.Resolve(opts, flagSet)
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	redactor.AddOptions(opts)
+	return opts, nil
+}
+
+// BuildOauthProxy creates an OauthProxy, with its emails and htpasswd
+// files, from validated options. Closing done stops watching the files.
+// Unlike NewOauthProxy it returns errors, so a program embedding the proxy
+// can handle them.
+func BuildOauthProxy(opts *Options, done <-chan bool) (*OauthProxy, error) {
+	return buildOauthProxy(opts, nil, done)
+}
+
+// buildOauthProxy is BuildOauthProxy, authorizing users with validator
+// instead of the emails file and domains if it isn't nil.
+func buildOauthProxy(opts *Options, validator Validator, done <-chan bool) (*OauthProxy, error) {
+	var err error
+	if validator == nil {
+		users, err := loadUserMap(opts.AuthenticatedEmailsFile, done, func() {})
+		if err != nil {
+			return nil, fmt.Errorf("failed loading emails file %q, %s", opts.AuthenticatedEmailsFile, err)
+		}
+		domains := append(opts.GoogleAppsDomains, opts.EmailDomains...)
+		validator = newUserMapValidator(domains, users)
+	}
+	var blocked *UserMap
+	if opts.BlockedEmailsFile != "" {
+		blocked, err = loadUserMap(opts.BlockedEmailsFile, done, func() {})
+		if err != nil {
+			return nil, fmt.Errorf("failed loading emails file %q, %s", opts.BlockedEmailsFile, err)
+		}
+	}
+
+	bans := newBanList(blocked)
+	oauthproxy, err := newOauthProxy(opts, NewBlockingValidator(bans, validator))
+	if err != nil {
+		return nil, err
+	}
+	oauthproxy.Bans = bans
+	go func() {
+		<-done
+		oauthproxy.Stats.Close()
+	}()
+
+	if opts.AuditLog != "" {
+		audit, err := OpenAuditLog(opts.AuditLog, opts.provider.Data().ProviderName)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit-log %s %s", opts.AuditLog, err)
+		}
+		oauthproxy.Audit = audit
+		go func() {
+			<-done
+			audit.Close()
+		}()
+	}
+
+	if opts.SignInMessage == "" && len(opts.GoogleAppsDomains) != 0 && opts.AuthenticatedEmailsFile == "" {
+		if len(opts.GoogleAppsDomains) > 1 {
+			oauthproxy.SignInMessage = fmt.Sprintf("Authenticate using one of the following domains: %v", strings.Join(opts.GoogleAppsDomains, ", "))
+		} else {
+			oauthproxy.SignInMessage = fmt.Sprintf("Authenticate using %v", opts.GoogleAppsDomains[0])
+		}
+	}
+
+	htpasswdProxies := opts.htpasswdProxies()
+	if opts.HtpasswdFile != "" && len(htpasswdProxies) != 0 {
+		return nil, errors.New("can't use htpasswd file and proxy together")
+	}
+
+	if opts.HtpasswdFile != "" {
+		logger.Printf("using htpasswd file %s", opts.HtpasswdFile)
+		htpasswd, err := loadHtpasswdFile(opts.HtpasswdFile, done, func() {})
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s %s", opts.HtpasswdFile, err)
+		}
+		oauthproxy.DisplayHtpasswdForm = opts.DisplayHtpasswdForm
+		oauthproxy.HtpasswdValidator = passwordOnly(htpasswd.Validate)
+	}
+
+	if opts.HtpasswdTOTPFile != "" {
+		totp, err := NewTOTPSecretsFromFile(opts.HtpasswdTOTPFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s %s", opts.HtpasswdTOTPFile, err)
+		}
+		oauthproxy.HtpasswdTOTP = totp
+	}
+
+	if len(htpasswdProxies) != 0 {
+		logger.Printf("using htpasswd proxy %s", strings.Join(htpasswdProxies, ", "))
+		htpasswd, err := NewHtpasswdProxy(htpasswdProxies, opts.HtpasswdProxyTimeout, opts.HtpasswdProxyFailureTTL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s %s", strings.Join(htpasswdProxies, ", "), err)
+		}
+		if opts.HtpasswdProxyBreakerThreshold > 0 {
+			htpasswd.SetBreaker(opts.HtpasswdProxyBreakerThreshold, opts.HtpasswdProxyBreakerCooldown)
+		}
+		htpasswd.parallel = opts.HtpasswdProxyParallel
+		htpasswd.failOpen = opts.HtpasswdProxyFailOpen
+		htpasswd.headers = opts.htpasswdProxyHeaders
+		htpasswd.protocol = opts.HtpasswdProxyProtocol
+		htpasswd.stats = oauthproxy.Stats
+		if opts.htpasswdProxyTLS != nil {
+			htpasswd.SetTLSConfig(opts.htpasswdProxyTLS)
+		}
+		oauthproxy.DisplayHtpasswdForm = opts.DisplayHtpasswdForm
+		oauthproxy.HtpasswdValidator = htpasswd.Authenticate
+	}
+	return oauthproxy, nil
+}
+
+// ReloadingHandler serves requests with the current OauthProxy, which Reload
+// replaces with a freshly loaded one. Requests already being served finish
+// with the proxy they started with, and sessions stay valid as long as the
+// cookie secret is unchanged.
+type ReloadingHandler struct {
+	load func(done <-chan bool) (*OauthProxy, error)
+
+	sync.RWMutex
+	proxy *OauthProxy
+	done  chan bool
+}
+
+// NewReloadingHandler serves with proxy, whose file watchers stop when done
+// is closed, until Reload calls load for a replacement.
+func NewReloadingHandler(proxy *OauthProxy, done chan bool,
+	load func(done <-chan bool) (*OauthProxy, error)) *ReloadingHandler {
+	return &ReloadingHandler{load: load, proxy: proxy, done: done}
+}
+
+func (h *ReloadingHandler) current() *OauthProxy {
+	h.RLock()
+	defer h.RUnlock()
+	return h.proxy
+}
+
+func (h *ReloadingHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	h.current().ServeHTTP(rw, req)
+}
+
+// Reload loads a new OauthProxy and swaps it in. Users banned at runtime
+// stay banned, and sessions rejected at runtime stay rejected. If loading fails the current proxy is kept.
+func (h *ReloadingHandler) Reload() error {
+	done := make(chan bool)
+	proxy, err := h.load(done)
+	if err != nil {
+		close(done)
+		return err
+	}
+
+	h.Lock()
+	old, oldDone := h.proxy, h.done
+	proxy.Bans.inherit(old.Bans)
+	proxy.SessionCutoff.inherit(old.SessionCutoff)
+	h.proxy, h.done = proxy, done
+	h.Unlock()
+
+	close(oldDone)
+	return nil
+}
+
+// reloadAndLog calls Reload, logging the outcome.
+func (h *ReloadingHandler) reloadAndLog() {
+	if err := h.Reload(); err != nil {
+		logger.Errorf("reload failed, keeping the current configuration: %s", err)
+		return
+	}
+	logger.Printf("reloaded configuration")
+}
+
+// ReloadOnSignal calls Reload whenever one of sigs is received.
+func (h *ReloadingHandler) ReloadOnSignal(sigs ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		for sig := range c {
+			logger.Printf("reloading configuration on %s", sig)
+			h.reloadAndLog()
+		}
+	}()
+}
+
+// ReloadOnFileChange calls Reload whenever the contents of one of files
+// change.
+func (h *ReloadingHandler) ReloadOnFileChange(files []string) {
+	WatchFilesForChanges(files, nil, func() {
+		logger.Printf("reloading configuration after a change to %s", files)
+		h.reloadAndLog()
+	})
+}
+
+// fingerprintFiles summarises the contents of files, so that a change to
+// any of them changes the result. Missing files are summarised as empty.
+func fingerprintFiles(files []string) string {
+	h := sha256.New()
+	for _, filename := range files {
+		contents, _ := ioutil.ReadFile(filename)
+		sum := sha256.Sum256(contents)
+		h.Write(sum[:])
+	}
+	return string(h.Sum(nil))
+}
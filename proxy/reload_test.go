@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestReloadingHandler(t *testing.T) {
+	upstream := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+	}
+	first, second := upstream("first"), upstream("second")
+	defer first.Close()
+	defer second.Close()
+
+	upstreamURL := first.URL
+	load := func(done <-chan bool) (*OauthProxy, error) {
+		opts := NewOptions()
+		opts.Upstreams = append(opts.Upstreams, upstreamURL)
+		opts.ClientID = "bazquux"
+		opts.ClientSecret = "foobar"
+		opts.CookieSecret = "xyzzyplugh"
+		opts.EmailDomains = []string{"*"}
+		if upstreamURL == "" {
+			opts.Upstreams = nil
+		}
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
+		return BuildOauthProxy(opts, done)
+	}
+	done := make(chan bool)
+	proxy, err := load(done)
+	assert.Equal(t, nil, err)
+	handler := NewReloadingHandler(proxy, done, load)
+
+	get := func() string {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(handler.current().MakeCookie(req, "michael.bland@gsa.gov", proxy.CookieExpire))
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw.Body.String()
+	}
+	assert.Equal(t, "first", get())
+	proxy.Bans.Ban("banned@example.com")
+
+	upstreamURL = second.URL
+	assert.Equal(t, nil, handler.Reload())
+	assert.Equal(t, "second", get())
+	assert.Equal(t, true, handler.current().Bans.IsBanned("banned@example.com"))
+	select {
+	case <-done:
+	default:
+		t.Error("the replaced proxy should stop watching its files")
+	}
+
+	upstreamURL = ""
+	assert.NotEqual(t, nil, handler.Reload())
+	assert.Equal(t, "second", get())
+}
+
+func TestReloadingHandlerKeepsProxyOnError(t *testing.T) {
+	proxy := &OauthProxy{}
+	handler := NewReloadingHandler(proxy, make(chan bool),
+		func(done <-chan bool) (*OauthProxy, error) {
+			return nil, errors.New("bad config")
+		})
+	assert.Equal(t, errors.New("bad config"), handler.Reload())
+	assert.Equal(t, proxy, handler.current())
+}
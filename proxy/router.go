@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+)
+
+// routeStage is how far serve gets through its checks before a control
+// endpoint handles the request.
+type routeStage int
+
+const (
+	// before load shedding, so health checks always get through
+	stageUnlimited routeStage = iota
+	// before the geoip check: the assets of the proxy's own pages
+	stageStatic
+	// after the geoip check, before skip-auth
+	stageAdmin
+	// after skip-auth
+	stageSignIn
+)
+
+// route is a control endpoint of the proxy, handled by handler once serve
+// reaches stage.
+type route struct {
+	stage routeStage
+	// signIn routes are limited by sign-in-rate-limit
+	signIn  bool
+	handler func(p *OauthProxy, rw http.ResponseWriter, req *http.Request)
+}
+
+// at reports whether r is handled at stage; r may be nil.
+func (r *route) at(stage routeStage) bool {
+	return r != nil && r.stage == stage
+}
+
+// controlRoutes are the endpoints the proxy serves itself.
+var controlRoutes = newRouter(map[string]*route{
+	robotsPath: {stage: stageUnlimited, handler: func(p *OauthProxy, rw http.ResponseWriter, req *http.Request) {
+		p.RobotsTxt(rw)
+	}},
+	pingPath: {stage: stageUnlimited, handler: func(p *OauthProxy, rw http.ResponseWriter, req *http.Request) {
+		p.PingPage(rw)
+	}},
+	stylePath: {stage: stageStatic, handler: func(p *OauthProxy, rw http.ResponseWriter, req *http.Request) {
+		p.StylePage(rw)
+	}},
+	webauthnScriptPath: {stage: stageStatic, handler: func(p *OauthProxy, rw http.ResponseWriter, req *http.Request) {
+		p.WebAuthnScript(rw)
+	}},
+	adminPathPrefix:    {stage: stageAdmin, handler: (*OauthProxy).AdminPage},
+	webauthnPath:       {stage: stageSignIn, handler: (*OauthProxy).WebAuthnPage},
+	webauthnPath + "/": {stage: stageSignIn, handler: (*OauthProxy).WebAuthnPage},
+	signOutPath:        {stage: stageSignIn, handler: (*OauthProxy).SignOut},
+	signInPath:         {stage: stageSignIn, signIn: true, handler: (*OauthProxy).SignIn},
+	oauthStartPath:     {stage: stageSignIn, signIn: true, handler: (*OauthProxy).OAuthStart},
+	oauthCallbackPath:  {stage: stageSignIn, signIn: true, handler: (*OauthProxy).OAuthCallback},
+})
+
+// router finds the route for a path: the route of that exact path, or else
+// the one of the longest path ending in "/" that it starts with.
+type router struct {
+	exact    map[string]*route
+	subtrees prefixTrie
+	routes   []*route
+}
+
+func newRouter(routes map[string]*route) *router {
+	r := &router{exact: routes}
+	for path, rt := range routes {
+		if path[len(path)-1] == '/' {
+			r.subtrees.insert(path, len(r.routes))
+			r.routes = append(r.routes, rt)
+		}
+	}
+	return r
+}
+
+// match returns the route for path, or nil if there is none.
+func (r *router) match(path string) *route {
+	if rt, ok := r.exact[path]; ok {
+		return rt
+	}
+	var rt *route
+	r.subtrees.walk(path, func(i int) bool {
+		rt = r.routes[i]
+		return false
+	})
+	return rt
+}
+
+// prefixTrie finds the values stored under each prefix of a string, so
+// that matching against many prefixes takes a single pass over it.
+type prefixTrie struct {
+	values   []int
+	children map[byte]*prefixTrie
+}
+
+func (t *prefixTrie) insert(prefix string, value int) {
+	for i := 0; i < len(prefix); i++ {
+		if t.children == nil {
+			t.children = make(map[byte]*prefixTrie)
+		}
+		child, ok := t.children[prefix[i]]
+		if !ok {
+			child = &prefixTrie{}
+			t.children[prefix[i]] = child
+		}
+		t = child
+	}
+	t.values = append(t.values, value)
+}
+
+// walk calls visit with the values stored under each prefix of s, shortest
+// first, until visit returns true. It reports whether visit did.
+func (t *prefixTrie) walk(s string, visit func(int) bool) bool {
+	for i := 0; ; i++ {
+		for _, v := range t.values {
+			if visit(v) {
+				return true
+			}
+		}
+		if i == len(s) {
+			return false
+		}
+		if t = t.children[s[i]]; t == nil {
+			return false
+		}
+	}
+}
+
+// skipAuthRules matches requests against the skip-auth regexes. A regex
+// anchored with "^" is only tried on paths starting with the literal text
+// that follows it, found with a prefixTrie, so a request is checked against
+// few of many rules such as "^/static/" and "^/api/health$".
+type skipAuthRules struct {
+	regexes  []*regexp.Regexp
+	methods  [][]string
+	prefixes prefixTrie
+}
+
+// newSkipAuthRules matches with regexes, each only for the methods at the
+// same index of methods, if there are any.
+func newSkipAuthRules(regexes []*regexp.Regexp, methods [][]string) *skipAuthRules {
+	s := &skipAuthRules{regexes: regexes, methods: methods}
+	for i, re := range regexes {
+		s.prefixes.insert(anchoredPrefix(re.String()), i)
+	}
+	return s
+}
+
+// Match reports whether a request for path with method skips
+// authentication.
+func (s *skipAuthRules) Match(method, path string) bool {
+	return s.prefixes.walk(path, func(i int) bool {
+		if !s.regexes[i].MatchString(path) {
+			return false
+		}
+		if i >= len(s.methods) || len(s.methods[i]) == 0 {
+			return true
+		}
+		for _, m := range s.methods[i] {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// anchoredPrefix returns the literal text any match of expr must start
+// with, if expr is anchored at the start of the text, or else "".
+func anchoredPrefix(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil || re.Op != syntax.OpConcat || re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	var prefix []rune
+	for _, sub := range re.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix = append(prefix, sub.Rune...)
+	}
+	return string(prefix)
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestControlRoutes(t *testing.T) {
+	for path, stage := range map[string]routeStage{
+		"/ping":                      stageUnlimited,
+		"/robots.txt":                stageUnlimited,
+		"/oauth2/static/style.css":   stageStatic,
+		"/oauth2/static/webauthn.js": stageStatic,
+		"/oauth2/admin/bans":         stageAdmin,
+		"/oauth2/admin/":             stageAdmin,
+		"/oauth2/webauthn":           stageSignIn,
+		"/oauth2/webauthn/verify":    stageSignIn,
+		"/oauth2/sign_in":            stageSignIn,
+		"/oauth2/callback":           stageSignIn,
+	} {
+		route := controlRoutes.match(path)
+		assert.Equal(t, true, route.at(stage))
+	}
+	assert.Equal(t, true, controlRoutes.match("/oauth2/start").signIn)
+	assert.Equal(t, false, controlRoutes.match("/oauth2/sign_out").signIn)
+
+	for _, path := range []string{"/", "/pingx", "/oauth2/admin", "/oauth2/webauthnx", "/oauth2/static/other.css"} {
+		assert.Equal(t, (*route)(nil), controlRoutes.match(path))
+	}
+}
+
+func TestRouterLongestPrefix(t *testing.T) {
+	a, b := &route{stage: stageAdmin}, &route{stage: stageSignIn}
+	r := newRouter(map[string]*route{"/a/": a, "/a/b/": b})
+	assert.Equal(t, a, r.match("/a/x"))
+	assert.Equal(t, b, r.match("/a/b/x"))
+	assert.Equal(t, a, r.match("/a/b"))
+	assert.Equal(t, (*route)(nil), r.match("/b/"))
+}
+
+func TestRouteHandlers(t *testing.T) {
+	opts := testOptions()
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth2/start?rd=/foo", nil)
+	controlRoutes.match(req.URL.Path).handler(proxy, rw, req)
+	assert.Equal(t, 302, rw.Code)
+
+	rw = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/oauth2/callback?error=access_denied", nil)
+	controlRoutes.match(req.URL.Path).handler(proxy, rw, req)
+	assert.Equal(t, 403, rw.Code)
+}
+
+func TestAnchoredPrefix(t *testing.T) {
+	for expr, prefix := range map[string]string{
+		"^/public/":          "/public/",
+		"^/static/.*\\.css$": "/static/",
+		"^/api/(v1|v2)/":     "/api/",
+		"^/ping$":            "/ping",
+		"^(?i)/foo":          "",
+		"/foo":               "",
+		"^/a|/b":             "",
+		"(?m)^/x":            "",
+	} {
+		assert.Equal(t, prefix, anchoredPrefix(expr))
+	}
+}
+
+func TestSkipAuthRulesMatchLikeRegexes(t *testing.T) {
+	exprs := []string{"^/public/", "^/static/.*\\.css$", "health$", "^/api/(v1|v2)/status", "^(?i)/ASSETS/", "^/$"}
+	var regexes []*regexp.Regexp
+	for _, e := range exprs {
+		regexes = append(regexes, regexp.MustCompile(e))
+	}
+	rules := newSkipAuthRules(regexes, [][]string{nil, nil, nil, {"GET"}, nil, nil})
+
+	for _, path := range []string{"/", "/public/x", "/publi", "/static/a.css", "/static/a.js", "/x/health",
+		"/api/v1/status", "/api/v3/status", "/assets/logo.png", "/other"} {
+		want := false
+		for _, re := range regexes {
+			want = want || re.MatchString(path)
+		}
+		if got := rules.Match("GET", path); got != want {
+			t.Errorf("GET %s: got %v, want %v", path, got, want)
+		}
+	}
+	assert.Equal(t, false, rules.Match("POST", "/api/v1/status"))
+}
+
+func BenchmarkSkipAuthRules(b *testing.B) {
+	var regexes []*regexp.Regexp
+	for i := 0; i < 200; i++ {
+		regexes = append(regexes, regexp.MustCompile(fmt.Sprintf("^/app%d/public/", i)))
+	}
+	rules := newSkipAuthRules(regexes, nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rules.Match("GET", "/app199/private/page")
+	}
+}
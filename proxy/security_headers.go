@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+)
+
+// frameAncestors lets the proxy's pages be framed by their own origin only,
+// like X-Frame-Options: SAMEORIGIN. The Content-Security-Policy of the
+// built-in pages uses it too, so they get the same policy whether or not
+// security-headers is set.
+const frameAncestors = "frame-ancestors 'self'"
+
+// securityHeaders are added to responses when security-headers is set,
+// unless the response already has them.
+var securityHeaders = [][2]string{
+	{"Strict-Transport-Security", "max-age=31536000"},
+	{"X-Content-Type-Options", "nosniff"},
+	{"X-Frame-Options", "SAMEORIGIN"},
+	{"Content-Security-Policy", frameAncestors},
+	{"Referrer-Policy", "strict-origin-when-cross-origin"},
+}
+
+// securityHeadersWriter adds securityHeaders to the response to a request
+// when its headers are written: always for the proxy's own pages, and for
+// proxied responses only if upstream is set.
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	upstream    bool
+	wroteHeader bool
+}
+
+func (w *securityHeadersWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		// UpstreamProxy marks proxied responses with GAP-Upstream-Address
+		if w.upstream || h.Get("GAP-Upstream-Address") == "" {
+			for _, header := range securityHeaders {
+				if h.Get(header[0]) == "" {
+					h.Set(header[0], header[1])
+				}
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *securityHeadersWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter,
+// for example to hijack the connection of an upgraded request.
+func (w *securityHeadersWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *securityHeadersWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Write([]byte("response"))
+	}))
+	defer upstream.Close()
+
+	get := func(mode, path string) http.Header {
+		opts := testOptions()
+		opts.Upstreams = []string{upstream.URL}
+		opts.SkipAuthRegex = []string{"^/public"}
+		opts.SecurityHeaders = mode
+		assert.Equal(t, nil, opts.Validate())
+		proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+		req, _ := http.NewRequest("GET", path, nil)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Header()
+	}
+
+	h := get("off", "/oauth2/sign_in")
+	assert.Equal(t, "", h.Get("X-Content-Type-Options"))
+
+	h = get("pages", "/oauth2/sign_in")
+	assert.Equal(t, "max-age=31536000", h.Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+	assert.Equal(t, "SAMEORIGIN", h.Get("X-Frame-Options"))
+	// the sign in page's own policy, with the same frame-ancestors
+	assert.Equal(t, "default-src 'none'; style-src 'self'; frame-ancestors 'self'; base-uri 'none'", h.Get("Content-Security-Policy"))
+	assert.Equal(t, "strict-origin-when-cross-origin", h.Get("Referrer-Policy"))
+
+	h = get("pages", "/public")
+	assert.Equal(t, "", h.Get("X-Content-Type-Options"))
+
+	// upstream headers take precedence
+	h = get("all", "/public")
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", h.Get("X-Frame-Options"))
+
+	opts := testOptions()
+	opts.SecurityHeaders = "on"
+	assert.Equal(t, errorMsg([]string{
+		`security-headers="on" must be "off", "pages" or "all"`}), opts.Validate().Error())
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// boundServer is an http.Server with the listener it serves on. TLS servers
+// take their certificates from server.TLSConfig.
+type boundServer struct {
+	server   *http.Server
+	listener net.Listener
+	tls      bool
+}
+
+// listen listens on an address of the form [http://]<addr>:<port> or
+// unix://<path>.
+func listen(address string) (net.Listener, error) {
+	networkType, listenAddr := "tcp", address
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %#v: %v", address, err)
+		}
+		switch u.Scheme {
+		case "http", "https":
+		default:
+			networkType = u.Scheme
+		}
+		listenAddr = strings.TrimPrefix(u.String(), u.Scheme+"://")
+	}
+
+	listener, err := net.Listen(networkType, listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen (%s, %s) failed - %s", networkType, listenAddr, err)
+	}
+	logger.Printf("listening on %s", listenAddr)
+	return listener, nil
+}
+
+// newTLSServer returns a server for a TLS listener that offers HTTP/2,
+// allowing each client connection up to maxStreams concurrent requests.
+func newTLSServer(handler http.Handler, tlsConfig *tls.Config, maxStreams uint32) (*http.Server, error) {
+	server := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+	err := http2.ConfigureServer(server, &http2.Server{MaxConcurrentStreams: maxStreams})
+	if err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// serve serves on every listener until a signal arrives on stop, then stops
+// accepting connections and waits up to timeout for in-flight requests to
+// finish before closing the rest.
+func serve(servers []boundServer, stop <-chan os.Signal, timeout time.Duration) error {
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s boundServer) {
+			if s.tls {
+				errc <- s.server.ServeTLS(s.listener, "", "")
+			} else {
+				errc <- s.server.Serve(s.listener)
+			}
+		}(s)
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-stop:
+		logger.Printf("shutting down on %s; waiting up to %s for in-flight requests", sig, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	shutdown := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(server *http.Server) {
+			err := server.Shutdown(ctx)
+			if err != nil {
+				server.Close()
+			}
+			shutdown <- err
+		}(s.server)
+	}
+	var err error
+	for range servers {
+		if e := <-shutdown; e != nil {
+			err = fmt.Errorf("in-flight requests did not finish: %s", e)
+		}
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func startServe(t *testing.T, handler http.HandlerFunc, timeout time.Duration) (string, chan os.Signal, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen failed: " + err.Error())
+	}
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve([]boundServer{{server: &http.Server{Handler: handler}, listener: listener}},
+			stop, timeout)
+	}()
+	return "http://" + listener.Addr().String(), stop, errc
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan bool)
+	addr, stop, errc := startServe(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}, time.Second)
+
+	body := make(chan string)
+	go func() {
+		resp, err := http.Get(addr)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	<-started
+	stop <- syscall.SIGTERM
+
+	assert.Equal(t, "done", <-body)
+	assert.Equal(t, nil, <-errc)
+	_, err := http.Get(addr)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	defer close(release)
+	addr, stop, errc := startServe(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+	}, 50*time.Millisecond)
+
+	go http.Get(addr)
+	<-started
+	stop <- syscall.SIGTERM
+	assert.NotEqual(t, nil, <-errc)
+}
+
+func TestServeHTTPAndHTTPS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	cert := ts.TLS.Certificates[0]
+	client := ts.Client()
+	ts.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Write([]byte("https"))
+		} else {
+			w.Write([]byte("http"))
+		}
+	})
+	var servers []boundServer
+	for _, secure := range []bool{false, true} {
+		listener, err := listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &http.Server{Handler: handler}
+		if secure {
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+		servers = append(servers, boundServer{server: server, listener: listener, tls: secure})
+	}
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(servers, stop, time.Second)
+	}()
+
+	get := func(url string) string {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err.Error()
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+	assert.Equal(t, "http", get("http://"+servers[0].listener.Addr().String()))
+	assert.Equal(t, "https", get("https://"+servers[1].listener.Addr().String()))
+
+	stop <- syscall.SIGTERM
+	assert.Equal(t, nil, <-errc)
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_listen_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, address := range []string{"127.0.0.1:0", "http://127.0.0.1:0", "unix://" + dir + "/sock"} {
+		listener, err := listen(address)
+		if err != nil {
+			t.Errorf("listen(%q): %s", address, err)
+			continue
+		}
+		listener.Close()
+	}
+}
+
+func TestServeHTTP2(t *testing.T) {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	cert := ts.TLS.Certificates[0]
+	client := ts.Client()
+	ts.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	server, err := newTLSServer(handler, &tls.Config{Certificates: []tls.Certificate{cert}}, 10)
+	assert.Equal(t, nil, err)
+	listener, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve([]boundServer{{server: server, listener: listener, tls: true}}, stop, time.Second)
+	}()
+
+	resp, err := client.Get("https://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "HTTP/2.0", string(body))
+
+	stop <- syscall.SIGTERM
+	assert.Equal(t, nil, <-errc)
+}
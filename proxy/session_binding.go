@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// SessionBinding ties session cookies to the client they were issued to,
+// by an HMAC of the client IP network and/or User-Agent stored in the
+// session, so a stolen cookie is rejected when replayed from elsewhere.
+type SessionBinding struct {
+	seed       string
+	ip         bool
+	userAgent  bool
+	ipv4Prefix int
+	ipv6Prefix int
+}
+
+// NewSessionBinding binds sessions by components, which may hold "ip" and
+// "user-agent". Client IPs are compared by their ipv4Prefix or ipv6Prefix
+// bit network, so that a client moving between addresses of one network
+// keeps its session.
+func NewSessionBinding(seed string, components []string, ipv4Prefix, ipv6Prefix int) (*SessionBinding, error) {
+	b := &SessionBinding{seed: seed, ipv4Prefix: ipv4Prefix, ipv6Prefix: ipv6Prefix}
+	for _, c := range components {
+		switch c {
+		case "ip":
+			b.ip = true
+		case "user-agent":
+			b.userAgent = true
+		default:
+			return nil, fmt.Errorf("unknown session binding %q", c)
+		}
+	}
+	return b, nil
+}
+
+// Fingerprint returns the binding of a session issued to a client at ip
+// with userAgent.
+func (b *SessionBinding) Fingerprint(ip net.IP, userAgent string) string {
+	h := hmac.New(sha256.New, []byte(b.seed))
+	if b.ip && ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4.Mask(net.CIDRMask(b.ipv4Prefix, 32))
+		} else {
+			ip = ip.Mask(net.CIDRMask(b.ipv6Prefix, 128))
+		}
+		fmt.Fprintf(h, "ip=%s\n", ip)
+	}
+	if b.userAgent {
+		fmt.Fprintf(h, "user-agent=%s\n", userAgent)
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
+
+// bindSession records the client of req in session, if sessions are bound.
+func (p *OauthProxy) bindSession(session *SessionState, req *http.Request) {
+	if p.sessionBinding != nil {
+		session.Binding = p.sessionBinding.Fingerprint(p.clientIP(req), req.UserAgent())
+	}
+}
+
+// checkSessionBinding reports whether session was issued to the client of
+// req, or sessions aren't bound.
+func (p *OauthProxy) checkSessionBinding(session *SessionState, req *http.Request) bool {
+	if p.sessionBinding == nil {
+		return true
+	}
+	fingerprint := p.sessionBinding.Fingerprint(p.clientIP(req), req.UserAgent())
+	return hmac.Equal([]byte(session.Binding), []byte(fingerprint))
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestSessionBindingFingerprint(t *testing.T) {
+	b, err := NewSessionBinding("secret", []string{"ip", "user-agent"}, 24, 64)
+	assert.Equal(t, nil, err)
+	fp := b.Fingerprint(net.ParseIP("10.1.2.3"), "Mozilla/5.0")
+	assert.Equal(t, fp, b.Fingerprint(net.ParseIP("10.1.2.200"), "Mozilla/5.0"))
+	assert.NotEqual(t, fp, b.Fingerprint(net.ParseIP("10.1.3.3"), "Mozilla/5.0"))
+	assert.NotEqual(t, fp, b.Fingerprint(net.ParseIP("10.1.2.3"), "curl/7.0"))
+
+	v6 := b.Fingerprint(net.ParseIP("2001:db8::1"), "Mozilla/5.0")
+	assert.Equal(t, v6, b.Fingerprint(net.ParseIP("2001:db8::ffff"), "Mozilla/5.0"))
+	assert.NotEqual(t, v6, b.Fingerprint(net.ParseIP("2001:db8:0:1::1"), "Mozilla/5.0"))
+
+	b, _ = NewSessionBinding("secret", []string{"user-agent"}, 24, 64)
+	assert.Equal(t, b.Fingerprint(net.ParseIP("10.1.2.3"), "Mozilla/5.0"),
+		b.Fingerprint(net.ParseIP("192.168.1.1"), "Mozilla/5.0"))
+
+	_, err = NewSessionBinding("secret", []string{"tls"}, 24, 64)
+	assert.Equal(t, "unknown session binding \"tls\"", err.Error())
+}
+
+func TestSessionBindingRejectsOtherClients(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer upstream.Close()
+
+	opts := NewOptions()
+	opts.Upstreams = append(opts.Upstreams, upstream.URL)
+	opts.ClientID = "bazquux"
+	opts.ClientSecret = "foobar"
+	opts.CookieSecret = "xyzzyplugh"
+	opts.SessionBinding = []string{"ip", "user-agent"}
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+
+	issued, _ := http.NewRequest("GET", "/", nil)
+	issued.RemoteAddr = "10.1.2.3:1234"
+	issued.Header.Set("User-Agent", "Mozilla/5.0")
+	session := &SessionState{Email: "michael.bland@gsa.gov"}
+	proxy.bindSession(session, issued)
+	value, _ := buildSessionValue(session, nil)
+	cookie := proxy.MakeCookie(issued, value, opts.CookieExpire)
+
+	get := func(remoteAddr, userAgent string) int {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("User-Agent", userAgent)
+		req.AddCookie(cookie)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	assert.Equal(t, 200, get("10.1.2.3:1234", "Mozilla/5.0"))
+	assert.Equal(t, 200, get("10.1.2.99:1234", "Mozilla/5.0"))
+	assert.Equal(t, 403, get("192.168.1.1:1234", "Mozilla/5.0"))
+	assert.Equal(t, 403, get("10.1.2.3:1234", "curl/7.0"))
+
+	// sessions issued without a binding are rejected too
+	unbound, _ := buildSessionValue(&SessionState{Email: "michael.bland@gsa.gov"}, nil)
+	cookie = proxy.MakeCookie(issued, unbound, opts.CookieExpire)
+	assert.Equal(t, 403, get("10.1.2.3:1234", "Mozilla/5.0"))
+}
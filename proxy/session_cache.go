@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sessionCookieMaxAge is how old a session cookie validateCookie accepts.
+const sessionCookieMaxAge = time.Duration(24) * 7 * time.Hour
+
+type sessionCacheEntry struct {
+	key       string
+	value     string
+	timestamp time.Time
+	session   *SessionState
+}
+
+// sessionCache maps session cookie values to the sessions decoded from
+// them, so a busy client's cookie is checked and decrypted once rather than
+// on every request. It holds up to size of the most recently used cookies.
+// Entries last as long as their cookie is accepted; the checks that depend
+// on the request or on the proxy's state, such as session-binding and
+// reject-sessions-before, are still made on every request.
+type sessionCache struct {
+	sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+// newSessionCache returns a cache of size sessions, or nil, which caches
+// nothing, if size isn't positive.
+func newSessionCache(size int) *sessionCache {
+	if size <= 0 {
+		return nil
+	}
+	return &sessionCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get returns the entry for the cookie value key, if it hasn't expired.
+func (c *sessionCache) Get(key string) (*sessionCacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*sessionCacheEntry)
+	if !c.now().Before(e.timestamp.Add(sessionCookieMaxAge)) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e, true
+}
+
+// Put caches the value, timestamp and session decoded from the cookie value
+// key.
+func (c *sessionCache) Put(key, value string, timestamp time.Time, session *SessionState) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&sessionCacheEntry{key: key, value: value, timestamp: timestamp, session: session})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *sessionCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*sessionCacheEntry).key)
+}
+
+// decodeSessionCookie checks the signature of the session cookie and
+// decrypts the session in it, or takes them from the session cache. The
+// session returned is the caller's to change.
+func (p *OauthProxy) decodeSessionCookie(cookie *http.Cookie) (value string, timestamp time.Time, session *SessionState, ok bool, err error) {
+	if e, hit := p.sessionCache.Get(cookie.Value); hit {
+		return e.value, e.timestamp, e.session.clone(), true, nil
+	}
+	value, timestamp, ok = validateCookie(cookie, p.CookieSeed)
+	if !ok {
+		return
+	}
+	session, err = parseSessionValue(value, p.AesCipher)
+	if err == nil {
+		p.sessionCache.Put(cookie.Value, value, timestamp, session.clone())
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestSessionCache(t *testing.T) {
+	c := newSessionCache(2)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	c.Put("a", "value a", now, &SessionState{Email: "a@example.com"})
+	c.Put("b", "value b", now.Add(-sessionCookieMaxAge+time.Minute), &SessionState{Email: "b@example.com"})
+
+	e, ok := c.Get("a")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "value a", e.value)
+	assert.Equal(t, "a@example.com", e.session.Email)
+
+	// the least recently used is evicted
+	c.Put("c", "value c", now, &SessionState{})
+	_, ok = c.Get("b")
+	assert.Equal(t, false, ok)
+	_, ok = c.Get("a")
+	assert.Equal(t, true, ok)
+
+	// entries expire with their cookie
+	c.Put("b", "value b", now.Add(-sessionCookieMaxAge+time.Minute), &SessionState{})
+	now = now.Add(time.Minute)
+	_, ok = c.Get("b")
+	assert.Equal(t, false, ok)
+
+	var disabled *sessionCache
+	disabled.Put("a", "value a", now, &SessionState{})
+	_, ok = disabled.Get("a")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, (*sessionCache)(nil), newSessionCache(0))
+}
+
+func TestLoadCookiedSessionCachesSessions(t *testing.T) {
+	opts := testOptions()
+	opts.SessionCacheSize = 10
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.AddCookie(proxy.MakeCookie(req, "michael.bland@gsa.gov", proxy.CookieExpire))
+
+	session, ok := proxy.LoadCookiedSession(nil, req)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "michael.bland@gsa.gov", session.Email)
+	assert.Equal(t, 1, proxy.sessionCache.lru.Len())
+
+	// changes to a session don't leak into the cache
+	session.Groups = append(session.Groups, "admins")
+	session, ok = proxy.LoadCookiedSession(nil, req)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 0, len(session.Groups))
+
+	// sessions issued before reject-sessions-before are still rejected
+	proxy.SessionCutoff.Set(time.Now().Add(time.Minute))
+	_, ok = proxy.LoadCookiedSession(nil, req)
+	assert.Equal(t, false, ok)
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SessionCutoff rejects session cookies issued before a moment, set by
+// reject-sessions-before or at runtime through the admin API, so that all
+// sessions can be revoked at once, for example after a cookie-secret leak.
+type SessionCutoff struct {
+	sync.RWMutex
+	before time.Time
+}
+
+func NewSessionCutoff(before time.Time) *SessionCutoff {
+	return &SessionCutoff{before: before}
+}
+
+// Before returns the cutoff, which is zero if none is set.
+func (c *SessionCutoff) Before() time.Time {
+	c.RLock()
+	defer c.RUnlock()
+	return c.before
+}
+
+func (c *SessionCutoff) Set(before time.Time) {
+	c.Lock()
+	c.before = before
+	c.Unlock()
+}
+
+// Rejects reports whether a cookie issued at issued is no longer valid.
+func (c *SessionCutoff) Rejects(issued time.Time) bool {
+	return issued.Before(c.Before())
+}
+
+// inherit keeps the cutoff of old, which is being replaced by c, if it is
+// later, so that a reload doesn't revive sessions revoked at runtime.
+func (c *SessionCutoff) inherit(old *SessionCutoff) {
+	if before := old.Before(); before.After(c.Before()) {
+		c.Set(before)
+	}
+}
+
+// parseSessionCutoff parses an RFC3339 time, or "now".
+func parseSessionCutoff(value string) (time.Time, error) {
+	if value == "now" {
+		return time.Now(), nil
+	}
+	before, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC3339 time or \"now\"", value)
+	}
+	return before, nil
+}
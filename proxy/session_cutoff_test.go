@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestSessionCutoff(t *testing.T) {
+	now := time.Now()
+	c := NewSessionCutoff(time.Time{})
+	assert.Equal(t, false, c.Rejects(now.Add(-time.Hour)))
+
+	c.Set(now)
+	assert.Equal(t, true, c.Rejects(now.Add(-time.Hour)))
+	assert.Equal(t, false, c.Rejects(now))
+
+	// a reload keeps the later cutoff
+	reloaded := NewSessionCutoff(now.Add(-time.Minute))
+	reloaded.inherit(c)
+	assert.Equal(t, now, reloaded.Before())
+	reloaded = NewSessionCutoff(now.Add(time.Minute))
+	reloaded.inherit(c)
+	assert.Equal(t, now.Add(time.Minute), reloaded.Before())
+}
+
+func TestRejectSessionsBeforeAdminAPI(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer upstream.Close()
+
+	opts := NewOptions()
+	opts.Upstreams = append(opts.Upstreams, upstream.URL)
+	opts.ClientID = "bazquux"
+	opts.ClientSecret = "foobar"
+	opts.CookieSecret = "xyzzyplugh"
+	opts.AdminToken = "admin-secret"
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+
+	get := func() int {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(proxy.MakeCookie(req, "michael.bland@gsa.gov", opts.CookieExpire))
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	admin := func(method, before string) *httptest.ResponseRecorder {
+		form := url.Values{"before": {before}}
+		req, _ := http.NewRequest(method, "/oauth2/admin/reject-sessions-before", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+
+	assert.Equal(t, 200, get())
+	assert.Equal(t, 400, admin("POST", "yesterday").Code)
+	assert.Equal(t, 200, admin("POST", "2015-03-19T21:20:19Z").Code)
+	assert.Equal(t, 200, get())
+	assert.Equal(t, "2015-03-19T21:20:19Z\n", admin("GET", "").Body.String())
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	assert.Equal(t, 200, admin("POST", future).Code)
+	assert.Equal(t, 403, get())
+}
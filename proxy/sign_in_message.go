@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+)
+
+// signInMessageData holds the fields available to sign-in-message templates.
+type signInMessageData struct {
+	// URL is the page the user asked for, which they are sent to once
+	// signed in.
+	URL          string
+	Host         string
+	ProviderName string
+}
+
+// parseSignInMessage parses a sign-in-message, a Go template such as
+// "Sign in to access {{.Host}}".
+func parseSignInMessage(message string) (*template.Template, error) {
+	return template.New("sign-in-message").Parse(message)
+}
+
+// renderSignInMessage executes the sign in message with data, or returns it
+// as is if it isn't a template or fails.
+func renderSignInMessage(message string, data signInMessageData) string {
+	if !strings.Contains(message, "{{") {
+		return message
+	}
+	t, err := parseSignInMessage(message)
+	if err == nil {
+		var b bytes.Buffer
+		if err = t.Execute(&b, data); err == nil {
+			return b.String()
+		}
+	}
+	logger.Errorf("error rendering sign in message: %s", err)
+	return message
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRenderSignInMessage(t *testing.T) {
+	data := signInMessageData{URL: "/page?a=b", Host: "wiki.corp.com", ProviderName: "Google"}
+	assert.Equal(t, "Sign in to access wiki.corp.com with Google",
+		renderSignInMessage("Sign in to access {{.Host}} with {{.ProviderName}}", data))
+	assert.Equal(t, "Going to /page?a=b", renderSignInMessage("Going to {{.URL}}", data))
+	assert.Equal(t, "Authenticate using example.com", renderSignInMessage("Authenticate using example.com", data))
+	assert.Equal(t, "{{.Missing}}", renderSignInMessage("{{.Missing}}", data))
+}
+
+func TestSignInMessageOption(t *testing.T) {
+	opts := testOptions()
+	opts.SignInMessage = "Sign in to access {{.Host}}"
+	assert.Equal(t, nil, opts.Validate())
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+
+	req, _ := http.NewRequest("GET", "http://wiki.corp.com/oauth2/sign_in", nil)
+	rw := httptest.NewRecorder()
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), "<p>Sign in to access wiki.corp.com</p>"))
+
+	opts = testOptions()
+	opts.SignInMessage = "{{.Host"
+	assert.NotEqual(t, nil, opts.Validate())
+}
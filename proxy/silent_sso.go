@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// silentSSOCookieExpire is how long after a silent sign in attempt the
+// sign in page is shown instead of trying again.
+const silentSSOCookieExpire = time.Duration(5) * time.Minute
+
+// silentSSOCookieName is the cookie marking a recent silent sign in
+// attempt.
+func (p *OauthProxy) silentSSOCookieName() string {
+	return p.CookieKey + "_sso"
+}
+
+// trySilentSSO redirects an unauthenticated browser page request to the
+// provider with prompt=none, so that users already signed in there don't
+// see the sign in page, unless that was tried recently. It returns whether
+// it redirected.
+func (p *OauthProxy) trySilentSSO(rw http.ResponseWriter, req *http.Request) bool {
+	if req.Method != "GET" || !strings.Contains(req.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	if _, err := req.Cookie(p.silentSSOCookieName()); err == nil {
+		return false
+	}
+	http.SetCookie(rw, &http.Cookie{
+		Name:     p.silentSSOCookieName(),
+		Value:    "1",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   p.CookieSecure,
+		Expires:  time.Now().Add(silentSSOCookieExpire),
+	})
+	http.Redirect(rw, req, p.getLoginURL(req.Host, req.URL.RequestURI(), "none"), 302)
+	return true
+}
+
+// silentSSOFailed reports whether the error of an OAuth callback means the
+// provider needs to interact with the user to sign them in, after a
+// prompt=none request.
+func silentSSOFailed(errorString string) bool {
+	switch errorString {
+	case "login_required", "interaction_required", "consent_required", "account_selection_required":
+		return true
+	}
+	return false
+}
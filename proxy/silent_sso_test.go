@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestSilentSSO(t *testing.T) {
+	opts := testOptions()
+	opts.SilentSSO = true
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	get := func(path, accept string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+	const html = "text/html,application/xhtml+xml,*/*;q=0.8"
+
+	rw := get("/wiki/page", html)
+	assert.Equal(t, 302, rw.Code)
+	location, _ := url.Parse(rw.Header().Get("Location"))
+	assert.Equal(t, "none", location.Query().Get("prompt"))
+	assert.Equal(t, "", location.Query().Get("approval_prompt"))
+	assert.Equal(t, "/wiki/page", location.Query().Get("state"))
+	marker := rw.Result().Cookies()[0]
+	assert.Equal(t, "_oauthproxy_sso", marker.Name)
+
+	// tried recently, or not a browser page request
+	assert.Equal(t, 403, get("/wiki/page", html, marker).Code)
+	assert.Equal(t, 403, get("/api/data", "application/json").Code)
+
+	rw = get("/oauth2/callback?error=login_required&state=/wiki/page", html)
+	assert.Equal(t, 403, rw.Code)
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), `name="rd" value="/wiki/page"`))
+
+	rw = get("/oauth2/callback?error=access_denied", html)
+	assert.Equal(t, 403, rw.Code)
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), "access_denied"))
+}
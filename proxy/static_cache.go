@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticCache is the transport of an upstream marked static, such as a
+// documentation site, keeping its GET responses in memory so that assets
+// aren't fetched from it for every request. Responses are shared by all
+// users. They are served from memory for ttl, then revalidated with the
+// upstream using their ETag or Last-Modified, and clients' own conditional
+// requests are answered from the cache. Once the bodies cached add up to
+// more than size bytes, the least recently used are evicted; a body larger
+// than an eighth of size isn't cached at all.
+type staticCache struct {
+	transport http.RoundTripper
+	size      int64
+	ttl       time.Duration
+	stats     *StatsD
+	upstream  string
+	now       func() time.Time
+
+	sync.Mutex
+	used    int64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type staticCacheEntry struct {
+	key          string
+	header       http.Header
+	body         []byte
+	etag         string
+	lastModified string
+	validated    time.Time
+}
+
+func newStaticCache(transport http.RoundTripper, size int64, ttl time.Duration, stats *StatsD, upstream string) *staticCache {
+	return &staticCache{
+		transport: transport,
+		size:      size,
+		ttl:       ttl,
+		stats:     stats,
+		upstream:  upstream,
+		now:       time.Now,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+func (c *staticCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || req.Header.Get("Range") != "" {
+		return c.transport.RoundTrip(req)
+	}
+	// the encoding the client accepts picks the upstream's response
+	key := req.URL.String() + "\x00" + req.Header.Get("Accept-Encoding")
+	e := c.get(key)
+	if e != nil && c.now().Sub(e.validated) < c.ttl {
+		c.stats.Incr("upstream.cache", "upstream:"+c.upstream, "result:hit")
+		return e.response(req), nil
+	}
+
+	upstreamReq := req.Clone(req.Context())
+	upstreamReq.Header.Del("If-None-Match")
+	upstreamReq.Header.Del("If-Modified-Since")
+	if e != nil {
+		if e.etag != "" {
+			upstreamReq.Header.Set("If-None-Match", e.etag)
+		}
+		if e.lastModified != "" {
+			upstreamReq.Header.Set("If-Modified-Since", e.lastModified)
+		}
+	}
+	resp, err := c.transport.RoundTrip(upstreamReq)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		c.revalidated(e)
+		c.stats.Incr("upstream.cache", "upstream:"+c.upstream, "result:revalidated")
+		return e.response(req), nil
+	}
+	c.stats.Incr("upstream.cache", "upstream:"+c.upstream, "result:miss")
+	if !cacheable(resp) || resp.ContentLength > c.size/8 {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, c.size/8+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > c.size/8 {
+		// too large: pass it on without caching it
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	e = &staticCacheEntry{
+		key:          key,
+		header:       resp.Header.Clone(),
+		body:         body,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		validated:    c.now(),
+	}
+	c.put(e)
+	return e.response(req), nil
+}
+
+// cacheable reports whether resp may be shared between users.
+func cacheable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, v := range resp.Header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if f := strings.TrimSpace(field); f != "" && !strings.EqualFold(f, "Accept-Encoding") {
+				return false
+			}
+		}
+	}
+	for _, v := range resp.Header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-store", "no-cache", "private":
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// response answers req with e: 304 Not Modified if req is conditional and
+// e matches it, or else the body.
+func (e *staticCacheEntry) response(req *http.Request) *http.Response {
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     e.header.Clone(),
+		Request:    req,
+	}
+	if e.notModified(req) {
+		resp.Status, resp.StatusCode = "304 Not Modified", http.StatusNotModified
+		resp.Header.Del("Content-Length")
+		resp.Body = http.NoBody
+		return resp
+	}
+	resp.ContentLength = int64(len(e.body))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(e.body))
+	return resp
+}
+
+func (e *staticCacheEntry) notModified(req *http.Request) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if e.etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(e.etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := req.Header.Get("If-Modified-Since"); ims != "" && e.lastModified != "" {
+		since, err := http.ParseTime(ims)
+		modified, err2 := http.ParseTime(e.lastModified)
+		return err == nil && err2 == nil && !modified.After(since)
+	}
+	return false
+}
+
+func (c *staticCache) get(key string) *staticCacheEntry {
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*staticCacheEntry)
+}
+
+func (c *staticCache) revalidated(e *staticCacheEntry) {
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[e.key]; ok && el.Value == e {
+		// entries are shared with responses being served, so they are
+		// replaced rather than changed
+		updated := *e
+		updated.validated = c.now()
+		el.Value = &updated
+	}
+}
+
+func (c *staticCache) put(e *staticCacheEntry) {
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.used += int64(len(e.body))
+	for c.used > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *staticCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*staticCacheEntry)
+	delete(c.entries, e.key)
+	c.used -= int64(len(e.body))
+}
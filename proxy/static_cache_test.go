@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func newStaticCacheTest(t *testing.T, handler http.HandlerFunc) (*staticCache, *int32, func(path string, header http.Header) *http.Response) {
+	var requests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(upstream.Close)
+	cache := newStaticCache(http.DefaultTransport, 1024, time.Minute, nil, "upstream")
+	get := func(path string, header http.Header) *http.Response {
+		req, _ := http.NewRequest("GET", upstream.URL+path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := cache.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	return cache, &requests, get
+}
+
+func readBody(resp *http.Response) string {
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return string(body)
+}
+
+func TestStaticCacheServesFromMemory(t *testing.T) {
+	cache, requests, get := newStaticCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("asset " + r.URL.Path))
+	})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	assert.Equal(t, "asset /app.css", readBody(get("/app.css", nil)))
+	assert.Equal(t, "asset /app.css", readBody(get("/app.css", nil)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// clients' conditional requests are answered from the cache
+	resp := get("/app.css", http.Header{"If-None-Match": {`"v1"`}})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// once stale, the upstream is asked whether it changed
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, "asset /app.css", readBody(get("/app.css", nil)))
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+	assert.Equal(t, "asset /app.css", readBody(get("/app.css", nil)))
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestStaticCacheSkipsUncacheableResponses(t *testing.T) {
+	_, requests, get := newStaticCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/vary":
+			w.Header().Set("Vary", "Cookie")
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/large":
+			w.Write([]byte(strings.Repeat("x", 200)))
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	for _, path := range []string{"/private", "/vary", "/missing"} {
+		get(path, nil).Body.Close()
+		get(path, nil).Body.Close()
+	}
+	assert.Equal(t, int32(6), atomic.LoadInt32(requests))
+
+	// larger than an eighth of the cache: passed on whole, but not kept
+	assert.Equal(t, strings.Repeat("x", 200), readBody(get("/large", nil)))
+	assert.Equal(t, strings.Repeat("x", 200), readBody(get("/large", nil)))
+	assert.Equal(t, int32(8), atomic.LoadInt32(requests))
+}
+
+func TestStaticCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, requests, get := newStaticCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	})
+	for _, path := range []string{"/1", "/2", "/3", "/4", "/5", "/6", "/7", "/8", "/9", "/10", "/11"} {
+		readBody(get(path, nil))
+		readBody(get("/1", nil))
+	}
+	assert.Equal(t, int64(1000), cache.used)
+	assert.Equal(t, int32(11), atomic.LoadInt32(requests))
+
+	// /2 was evicted, /1 kept
+	readBody(get("/1", nil))
+	assert.Equal(t, int32(11), atomic.LoadInt32(requests))
+	readBody(get("/2", nil))
+	assert.Equal(t, int32(12), atomic.LoadInt32(requests))
+}
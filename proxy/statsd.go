@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// StatsD sends counters and timers to a statsd server over UDP. Tags use
+// the DogStatsD "|#key:value" extension. A nil *StatsD discards metrics.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+// NewStatsD sends metrics named prefix+name to address, adding tags to
+// every metric.
+func NewStatsD(address, prefix string, tags []string) (*StatsD, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsD{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// Incr increments the counter name.
+func (s *StatsD) Incr(name string, tags ...string) {
+	s.send(name, "1|c", tags)
+}
+
+// Timing records d, in milliseconds, for the timer name.
+func (s *StatsD) Timing(name string, d time.Duration, tags ...string) {
+	s.send(name, fmt.Sprintf("%d|ms", d/time.Millisecond), tags)
+}
+
+// Gauge sets the gauge name to value.
+func (s *StatsD) Gauge(name string, value int64, tags ...string) {
+	s.send(name, fmt.Sprintf("%d|g", value), tags)
+}
+
+func (s *StatsD) send(name, value string, tags []string) {
+	if s == nil {
+		return
+	}
+	metric := s.prefix + name + ":" + value
+	if all := append(append([]string{}, s.tags...), tags...); len(all) != 0 {
+		metric += "|#" + strings.Join(all, ",")
+	}
+	// statsd is best effort: a lost packet or an absent server is ignored
+	s.conn.Write([]byte(metric))
+}
+
+func (s *StatsD) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// statusClass returns "2xx" for 200 and so on.
+func statusClass(status int) string {
+	return fmt.Sprintf("%dxx", status/100)
+}
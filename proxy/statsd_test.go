@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+func newTestStatsD(t *testing.T, tags []string) (*StatsD, func() string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := NewStatsD(conn.LocalAddr().String(), "oauth2_proxy.", tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() string {
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err.Error()
+		}
+		return string(buf[:n])
+	}
+	return stats, read
+}
+
+func TestStatsD(t *testing.T) {
+	stats, read := newTestStatsD(t, []string{"env:test"})
+	defer stats.Close()
+
+	stats.Incr("auth.sign_in", "via:oauth")
+	assert.Equal(t, "oauth2_proxy.auth.sign_in:1|c|#env:test,via:oauth", read())
+	stats.Timing("upstream.latency", 1500*time.Millisecond)
+	assert.Equal(t, "oauth2_proxy.upstream.latency:1500|ms|#env:test", read())
+	stats.Gauge("redeem.queue", 3)
+	assert.Equal(t, "oauth2_proxy.redeem.queue:3|g|#env:test", read())
+
+	stats.tags = nil
+	stats.Incr("auth.denied")
+	assert.Equal(t, "oauth2_proxy.auth.denied:1|c", read())
+
+	var nilStats *StatsD
+	nilStats.Incr("auth.denied")
+	assert.Equal(t, nil, nilStats.Close())
+}
+
+func TestUpstreamProxyLatency(t *testing.T) {
+	stats, read := newTestStatsD(t, nil)
+	defer stats.Close()
+
+	upstream := &UpstreamProxy{
+		upstream: "127.0.0.1:8080",
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}),
+		stats: stats,
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	upstream.ServeHTTP(httptest.NewRecorder(), req)
+	metric := read()
+	assert.Equal(t, true, strings.HasPrefix(metric, "oauth2_proxy.upstream.latency:"))
+	assert.Equal(t, true, strings.HasSuffix(metric, "|ms|#upstream:127.0.0.1:8080,status:5xx"))
+}
+
+func TestHtpasswdProxyMetrics(t *testing.T) {
+	stats, read := newTestStatsD(t, nil)
+	defer stats.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pass, _ := r.BasicAuth(); pass != "asdf" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	h, err := NewHtpasswdProxy([]string{server.URL}, time.Second, 0)
+	assert.Equal(t, nil, err)
+	h.stats = stats
+	h.SetBreaker(1, time.Minute)
+	backend := "backend:" + strings.TrimPrefix(server.URL, "http://")
+
+	h.Validate("testuser", "asdf")
+	assert.Equal(t, "oauth2_proxy.htpasswd.cache:1|c|#result:miss", read())
+	metric := read()
+	assert.Equal(t, true, strings.HasPrefix(metric, "oauth2_proxy.htpasswd.latency:"))
+	assert.Equal(t, true, strings.HasSuffix(metric, "|ms|#"+backend+",result:accepted"))
+	h.Validate("testuser", "asdf")
+	assert.Equal(t, "oauth2_proxy.htpasswd.cache:1|c|#result:hit", read())
+
+	h.Validate("testuser", "wrong")
+	read()
+	assert.Equal(t, true, strings.HasSuffix(read(), "|ms|#"+backend+",result:failed"))
+	h.Validate("testuser", "wrong")
+	read()
+	assert.Equal(t, "oauth2_proxy.htpasswd.unavailable:1|c|#"+backend, read())
+}
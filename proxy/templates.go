@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// stylePath serves the stylesheet of the built-in pages.
+const stylePath = "/oauth2/static/style.css"
+
+// assets holds the built-in templates, stylesheet and webauthn script. A
+// file of the same name in custom-templates-dir replaces any of them but the
+// script.
+//
+//go:embed assets
+var assets embed.FS
+
+// templateNames are the pages' templates, in assets or custom-templates-dir.
+var templateNames = []string{"sign_in.html", "error.html", "webauthn.html"}
+
+// templateStyle is the built-in stylesheet.
+var templateStyle = readAsset("style.css")
+
+// webauthnScript runs the security key ceremony of the webauthn page: it
+// asks the browser to create or get a credential with the options in the
+// form's data attributes, and posts the response to the form's action.
+var webauthnScript = readAsset("webauthn.js")
+
+func readAsset(name string) string {
+	b, err := assets.ReadFile("assets/" + name)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// builtinCSP is the Content-Security-Policy of the built-in pages. They load
+// no scripts and only stylePath, so it is strict, apart from the origins of
+// the captcha widget on the sign in page.
+const builtinCSP = `{{define "csp"}}default-src 'none'; style-src 'self'{{with .Captcha}} {{.Origins}}; ` +
+	`script-src {{.Origins}}; frame-src {{.Origins}}; connect-src {{.Origins}}{{end}}; ` + frameAncestors + `; base-uri 'none'{{end}}`
+
+// setTemplateCSP sets the Content-Security-Policy header given by the "csp"
+// template, if there is one, executed with the page's data.
+func setTemplateCSP(templates *template.Template, rw http.ResponseWriter, data interface{}) {
+	if templates.Lookup("csp") == nil {
+		return
+	}
+	var csp bytes.Buffer
+	if err := templates.ExecuteTemplate(&csp, "csp", data); err == nil {
+		rw.Header().Set("Content-Security-Policy", csp.String())
+	}
+}
+
+// loadTemplates parses the built-in templates with the extra functions
+// funcs, replacing those that have a file of the same name in dir, if it is
+// set. Custom templates may have variants for other locales, such as
+// sign_in.de.html. The built-in Content-Security-Policy is dropped once the
+// sign in or error page is replaced, as it would likely block what they load;
+// a custom template may define its own "csp".
+func loadTemplates(dir string, funcs template.FuncMap) *template.Template {
+	if dir != "" {
+		logger.Printf("using custom template directory %q", dir)
+	}
+	t, err := parseTemplates(dir, funcs)
+	if err != nil {
+		logger.Fatalf("failed parsing template %s", err)
+	}
+	return t
+}
+
+// parseTemplates is loadTemplates, returning the error of a template that
+// fails to parse.
+func parseTemplates(dir string, funcs template.FuncMap) (*template.Template, error) {
+	t := template.New("").Funcs(template.FuncMap{"tr": translate}).Funcs(funcs)
+	custom := false
+	for _, name := range templateNames {
+		var err error
+		if file := path.Join(dir, name); dir != "" && fileExists(file) {
+			_, err = t.ParseFiles(file)
+			custom = custom || name != "webauthn.html"
+		} else {
+			_, err = t.ParseFS(assets, "assets/"+name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !custom {
+		if _, err := t.Parse(builtinCSP); err != nil {
+			return nil, err
+		}
+	}
+	if dir == "" {
+		return t, nil
+	}
+	var files []string
+	for _, pattern := range []string{"sign_in.*.html", "error.*.html"} {
+		matches, _ := filepath.Glob(path.Join(dir, pattern))
+		for _, m := range matches {
+			if localizedTemplateName.MatchString(filepath.Base(m)) {
+				files = append(files, m)
+			}
+		}
+	}
+	if len(files) != 0 {
+		if _, err := t.ParseFiles(files...); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// loadStyle returns the stylesheet in dir, if it is set and has a style.css,
+// or else the built-in one.
+func loadStyle(dir string) string {
+	if dir != "" {
+		if b, err := ioutil.ReadFile(path.Join(dir, "style.css")); err == nil {
+			return string(b)
+		}
+	}
+	return templateStyle
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"html/template"
+	"sync"
+)
+
+// templateReloader implements templates-dev-mode: it parses the templates in
+// custom-templates-dir again for every page, so edits show up on the next
+// request. If they fail to parse, the error is logged and the last templates
+// that did parse are used until it is fixed.
+type templateReloader struct {
+	dir   string
+	funcs template.FuncMap
+
+	sync.Mutex
+	templates *template.Template
+	locales   *localeSet
+}
+
+func newTemplateReloader(dir string, funcs template.FuncMap, templates *template.Template, locales *localeSet) *templateReloader {
+	return &templateReloader{dir: dir, funcs: funcs, templates: templates, locales: locales}
+}
+
+// load parses the templates, returning them and the languages they are
+// available in, or the last good ones on error.
+func (r *templateReloader) load() (*template.Template, *localeSet) {
+	t, err := parseTemplates(r.dir, r.funcs)
+	r.Lock()
+	defer r.Unlock()
+	if err != nil {
+		logger.Errorf("templates-dev-mode: keeping the last good templates: %s", err)
+		return r.templates, r.locales
+	}
+	r.templates, r.locales = t, newLocaleSet(t, r.locales.fallback)
+	return r.templates, r.locales
+}
+
+// pageTemplates returns the templates to render a page with, and the
+// languages they are available in.
+func (p *OauthProxy) pageTemplates() (*template.Template, *localeSet) {
+	if p.templateReloader != nil {
+		return p.templateReloader.load()
+	}
+	return p.templates, p.locales
+}
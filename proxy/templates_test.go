@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestTemplatesCompile(t *testing.T) {
+	templates := loadTemplates("", nil)
+	assert.NotEqual(t, templates, nil)
+}
+
+func TestTemplatesContentSecurityPolicy(t *testing.T) {
+	opts := testOptions()
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+	const csp = "default-src 'none'; style-src 'self'; frame-ancestors 'self'; base-uri 'none'"
+
+	rw := get("/oauth2/sign_in")
+	assert.Equal(t, csp, rw.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, false, strings.Contains(rw.Body.String(), "<style"))
+	assert.Equal(t, false, strings.Contains(rw.Body.String(), "<script"))
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), `href="/oauth2/static/style.css"`))
+
+	rw = get("/oauth2/callback?error=access_denied")
+	assert.Equal(t, 403, rw.Code)
+	assert.Equal(t, csp, rw.Header().Get("Content-Security-Policy"))
+
+	rw = get("/oauth2/static/style.css")
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "text/css; charset=utf-8", rw.Header().Get("Content-Type"))
+	assert.Equal(t, templateStyle, rw.Body.String())
+
+	// custom templates don't get a policy unless they define one
+	dir, err := ioutil.TempDir("", "test_templates_")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "sign_in.html"), []byte(`{{define "sign_in.html"}}<style></style>{{end}}`), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{define "error.html"}}{{.Title}}{{end}}`), 0600)
+	rw = httptest.NewRecorder()
+	setTemplateCSP(loadTemplates(dir, nil), rw, nil)
+	assert.Equal(t, "", rw.Header().Get("Content-Security-Policy"))
+
+	ioutil.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{define "error.html"}}{{.Title}}{{end}}`+
+		`{{define "csp"}}default-src 'self'{{end}}`), 0600)
+	rw = httptest.NewRecorder()
+	setTemplateCSP(loadTemplates(dir, nil), rw, nil)
+	assert.Equal(t, "default-src 'self'", rw.Header().Get("Content-Security-Policy"))
+}
+
+func TestTemplatesDataAndFuncs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_templates_")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "sign_in.html"), []byte(`{{define "sign_in.html"}}`+
+		`{{shout .Data.company}} {{.Data.support}}{{end}}`), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{define "error.html"}}`+
+		`{{.Title}} {{.Data.support}}{{end}}`), 0600)
+
+	opts := testOptions()
+	opts.CustomTemplatesDir = dir
+	opts.TemplateData = []string{"company=Acme", "support=help@acme.example"}
+	opts.TemplateFuncs = template.FuncMap{"shout": strings.ToUpper}
+	assert.Equal(t, nil, opts.Validate())
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth2/sign_in", nil)
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, "ACME help@acme.example", rw.Body.String())
+
+	rw = httptest.NewRecorder()
+	proxy.ErrorPage(rw, req, 403, "Permission Denied", "")
+	assert.Equal(t, "403 Permission Denied help@acme.example", rw.Body.String())
+
+	opts = testOptions()
+	opts.TemplateData = []string{"company"}
+	err = opts.Validate()
+	assert.Equal(t, errorMsg([]string{`template-data "company" must be of the form key=value`}), err.Error())
+}
+
+func TestTemplatesBannerAndFooter(t *testing.T) {
+	signIn := func(banner, footer string) string {
+		opts := testOptions()
+		opts.Banner = banner
+		opts.Footer = footer
+		opts.Validate()
+		proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+		req, _ := http.NewRequest("GET", "/oauth2/sign_in", nil)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Body.String()
+	}
+
+	body := signIn("", "")
+	assert.Equal(t, false, strings.Contains(body, `class="banner"`))
+	assert.Equal(t, true, strings.Contains(body, "Secured with"))
+
+	body = signIn("<b>Authorized use only</b>", "<a href=\"/help\">Help</a>")
+	assert.Equal(t, true, strings.Contains(body, `<div class="banner"><b>Authorized use only</b></div>`))
+	assert.Equal(t, true, strings.Contains(body, `<footer><a href="/help">Help</a></footer>`))
+	assert.Equal(t, false, strings.Contains(body, "Secured with"))
+
+	body = signIn("", "-")
+	assert.Equal(t, false, strings.Contains(body, "<footer>"))
+	assert.Equal(t, false, strings.Contains(body, "Secured with"))
+}
+
+func TestTemplatesOverrideIndividualFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_templates_")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{.Title}}: {{.Message}}`), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "style.css"), []byte(`body { color: red; }`), 0600)
+
+	opts := testOptions()
+	opts.CustomTemplatesDir = dir
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := get("/oauth2/sign_in")
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, true, strings.Contains(rw.Body.String(), "Sign in with a Google Account"))
+
+	rw = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	proxy.ErrorPage(rw, req, 403, "Permission Denied", "go away")
+	assert.Equal(t, "403 Permission Denied: go away", rw.Body.String())
+	assert.Equal(t, "", rw.Header().Get("Content-Security-Policy"))
+
+	rw = get("/oauth2/static/style.css")
+	assert.Equal(t, "body { color: red; }", rw.Body.String())
+}
+
+func TestTemplatesDevMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_templates_")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	signIn := filepath.Join(dir, "sign_in.html")
+	ioutil.WriteFile(signIn, []byte(`v1`), 0600)
+
+	opts := testOptions()
+	opts.CustomTemplatesDir = dir
+	opts.TemplatesDevMode = true
+	assert.Equal(t, nil, opts.Validate())
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+	assert.Equal(t, "v1", get("/oauth2/sign_in").Body.String())
+
+	ioutil.WriteFile(signIn, []byte(`v2`), 0600)
+	assert.Equal(t, "v2", get("/oauth2/sign_in").Body.String())
+
+	// a template that doesn't parse leaves the last good one in place
+	ioutil.WriteFile(signIn, []byte(`{{ if }}`), 0600)
+	assert.Equal(t, "v2", get("/oauth2/sign_in").Body.String())
+
+	ioutil.WriteFile(filepath.Join(dir, "style.css"), []byte(`body {}`), 0600)
+	rw := get("/oauth2/static/style.css")
+	assert.Equal(t, "body {}", rw.Body.String())
+	assert.Equal(t, "no-cache", rw.Header().Get("Cache-Control"))
+
+	opts = testOptions()
+	opts.TemplatesDevMode = true
+	err = opts.Validate()
+	assert.Equal(t, errorMsg([]string{"templates-dev-mode requires custom-templates-dir"}), err.Error())
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certificate is a TLS key pair that can be reloaded from its files, so a
+// renewed certificate is served without a restart.
+type certificate struct {
+	certFile string
+	keyFile  string
+
+	sync.RWMutex
+	cert *tls.Certificate
+}
+
+func loadCertificate(certFile, keyFile string) (*certificate, error) {
+	c := &certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the key pair again. If that fails the current one is kept.
+func (c *certificate) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	c.cert = &cert
+	c.Unlock()
+	return nil
+}
+
+// ReloadOnSignal calls Reload whenever one of sigs is received.
+func (c *certificate) ReloadOnSignal(sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	go func() {
+		for range ch {
+			if err := c.Reload(); err != nil {
+				logger.Errorf("reloading tls certificate %s, keeping the current one: %s", c.certFile, err)
+				continue
+			}
+			logger.Printf("reloaded tls certificate %s", c.certFile)
+		}
+	}()
+}
+
+func (c *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.cert, nil
+}
+
+// TLSConfig returns a server configuration that serves the current
+// certificate.
+func (c *certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
+
+// tlsPolicy restricts the protocol versions, cipher suites and key exchange
+// curves offered on the HTTPS listener.
+type tlsPolicy struct {
+	MinVersion       uint16
+	CipherSuites     []uint16
+	CurvePreferences []tls.CurveID
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// parseTLSPolicy parses a minimum version such as "1.2", cipher suite names
+// as in crypto/tls (such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) and curve
+// names (X25519, P256, P384 or P521). Suites crypto/tls considers insecure
+// are refused. Empty lists leave the crypto/tls defaults.
+func parseTLSPolicy(minVersion string, suites []string, curves []string) (*tlsPolicy, error) {
+	p := &tlsPolicy{}
+	var ok bool
+	if p.MinVersion, ok = tlsVersions[minVersion]; !ok {
+		return nil, fmt.Errorf("unknown TLS version %q", minVersion)
+	}
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+	for _, name := range suites {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		p.CipherSuites = append(p.CipherSuites, id)
+	}
+	for _, name := range curves {
+		id, ok := tlsCurves[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q", name)
+		}
+		p.CurvePreferences = append(p.CurvePreferences, id)
+	}
+	return p, nil
+}
+
+// Apply restricts config to the policy.
+func (p *tlsPolicy) Apply(config *tls.Config) {
+	config.MinVersion = p.MinVersion
+	if len(p.CipherSuites) != 0 {
+		config.CipherSuites = p.CipherSuites
+	}
+	if len(p.CurvePreferences) != 0 {
+		config.CurvePreferences = p.CurvePreferences
+	}
+}
+
+// newAutocertManager obtains and renews certificates from Let's Encrypt for
+// hosts, caching them in cacheDir so restarts don't hit the rate limits.
+func newAutocertManager(hosts []string, cacheDir string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+}
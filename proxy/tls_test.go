@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func writeTestCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_tls_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	commonName := func(c *certificate) string {
+		cert, _ := c.GetCertificate(nil)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Subject.CommonName
+	}
+
+	_, err = loadCertificate(certFile, keyFile)
+	assert.NotEqual(t, nil, err)
+
+	writeTestCertificate(t, certFile, keyFile, "first")
+	c, err := loadCertificate(certFile, keyFile)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "first", commonName(c))
+
+	writeTestCertificate(t, certFile, keyFile, "second")
+	assert.Equal(t, nil, c.Reload())
+	assert.Equal(t, "second", commonName(c))
+
+	ioutil.WriteFile(keyFile, []byte("not a key"), 0600)
+	assert.NotEqual(t, nil, c.Reload())
+	assert.Equal(t, "second", commonName(c))
+}
+
+func TestAutocertManagerHostWhitelist(t *testing.T) {
+	m := newAutocertManager([]string{"proxy.example.com"}, "/tmp/certs")
+	assert.Equal(t, nil, m.HostPolicy(nil, "proxy.example.com"))
+	assert.NotEqual(t, nil, m.HostPolicy(nil, "other.example.com"))
+	assert.Equal(t, autocert.DirCache("/tmp/certs"), m.Cache)
+}
+
+func TestParseTLSPolicy(t *testing.T) {
+	p, err := parseTLSPolicy("1.2", nil, nil)
+	assert.Equal(t, nil, err)
+	config := &tls.Config{}
+	p.Apply(config)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, 0, len(config.CipherSuites))
+	assert.Equal(t, 0, len(config.CurvePreferences))
+
+	p, err = parseTLSPolicy("1.3",
+		[]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+		[]string{"X25519", "P256"})
+	assert.Equal(t, nil, err)
+	p.Apply(config)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, config.CipherSuites)
+	assert.Equal(t, []tls.CurveID{tls.X25519, tls.CurveP256}, config.CurvePreferences)
+
+	_, err = parseTLSPolicy("1.4", nil, nil)
+	assert.Equal(t, "unknown TLS version \"1.4\"", err.Error())
+	_, err = parseTLSPolicy("1.2", []string{"TLS_RSA_WITH_RC4_128_SHA"}, nil)
+	assert.Equal(t, "unknown or insecure cipher suite \"TLS_RSA_WITH_RC4_128_SHA\"", err.Error())
+	_, err = parseTLSPolicy("1.2", nil, []string{"P224"})
+	assert.Equal(t, "unknown curve \"P224\"", err.Error())
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const maxTokenCacheSize = 10000
+
+// tokenCache remembers the access tokens the provider has recently said are
+// valid, so sessions refreshed within cookie-refresh of expiring don't ask
+// it again on every request. Only valid tokens are cached, so a revoked
+// token is rejected once its entry expires.
+type tokenCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	sync.Mutex
+	m map[[sha256.Size]byte]time.Time
+}
+
+func newTokenCache(ttl time.Duration) *tokenCache {
+	return &tokenCache{ttl: ttl, now: time.Now, m: make(map[[sha256.Size]byte]time.Time)}
+}
+
+// Valid reports whether token was stored less than ttl ago.
+func (c *tokenCache) Valid(token string) bool {
+	key := sha256.Sum256([]byte(token))
+	c.Lock()
+	defer c.Unlock()
+	expires, ok := c.m[key]
+	if !ok {
+		return false
+	}
+	if !c.now().Before(expires) {
+		delete(c.m, key)
+		return false
+	}
+	return true
+}
+
+// Store records that the provider has just validated token.
+func (c *tokenCache) Store(token string) {
+	now := c.now()
+	c.Lock()
+	defer c.Unlock()
+	if len(c.m) >= maxTokenCacheSize {
+		for k, expires := range c.m {
+			if !now.Before(expires) {
+				delete(c.m, k)
+			}
+		}
+		if len(c.m) >= maxTokenCacheSize {
+			c.m = make(map[[sha256.Size]byte]time.Time)
+		}
+	}
+	c.m[sha256.Sum256([]byte(token))] = now.Add(c.ttl)
+}
+
+// validateToken asks the provider whether access_token is still valid,
+// unless it said so within validate-token-cache-ttl.
+func (p *OauthProxy) validateToken(access_token string) bool {
+	if p.tokenCache != nil && p.tokenCache.Valid(access_token) {
+		return true
+	}
+	ok := p.provider.ValidateToken(access_token)
+	if ok && p.tokenCache != nil {
+		p.tokenCache.Store(access_token)
+	}
+	return ok
+}
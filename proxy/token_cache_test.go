@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+type countingTokenProvider struct {
+	*TestProvider
+	calls int
+}
+
+func (p *countingTokenProvider) ValidateToken(access_token string) bool {
+	p.calls++
+	return p.TestProvider.ValidateToken(access_token)
+}
+
+func TestValidateTokenCache(t *testing.T) {
+	for _, valid := range []bool{true, false} {
+		pc_test := NewProcessCookieTest(ProcessCookieTestOpts{provider_validate_cookie_response: valid})
+		provider := &countingTokenProvider{TestProvider: pc_test.proxy.provider.(*TestProvider)}
+		pc_test.proxy.provider = provider
+		now := time.Now()
+		pc_test.proxy.tokenCache.now = func() time.Time { return now }
+		pc_test.proxy.CookieExpire = time.Duration(23) * time.Hour
+		pc_test.proxy.CookieRefresh = time.Duration(24) * time.Hour
+		pc_test.AddCookie("michael.bland@gsa.gov", "my_access_token")
+
+		for i := 0; i < 3; i++ {
+			pc_test.rw = httptest.NewRecorder()
+			_, _, _, ok := pc_test.ProcessCookie()
+			assert.Equal(t, valid, ok)
+		}
+		if valid {
+			assert.Equal(t, 1, provider.calls)
+		} else {
+			// rejections aren't cached
+			assert.Equal(t, 3, provider.calls)
+		}
+
+		now = now.Add(pc_test.opts.ValidateTokenCacheTTL)
+		pc_test.ProcessCookie()
+		if valid {
+			assert.Equal(t, 2, provider.calls)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// totpStep is the RFC 6238 time step; codes from one step either side of
+// the current one are accepted to allow for clock skew.
+const totpStep = 30
+
+// TOTPSecrets holds the base32 TOTP secrets of htpasswd users, one
+// "user:secret" entry per line, as shown by authenticator apps. Each code is
+// only accepted once. A nil *TOTPSecrets has no users.
+type TOTPSecrets struct {
+	secrets map[string][]byte
+	now     func() time.Time
+
+	sync.Mutex
+	used map[string]int64
+}
+
+func NewTOTPSecretsFromFile(path string) (*TOTPSecrets, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return NewTOTPSecrets(r)
+}
+
+func NewTOTPSecrets(file io.Reader) (*TOTPSecrets, error) {
+	csv_reader := csv.NewReader(file)
+	csv_reader.Comma = ':'
+	csv_reader.Comment = '#'
+	csv_reader.TrimLeadingSpace = true
+	csv_reader.FieldsPerRecord = 2
+
+	records, err := csv_reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	t := &TOTPSecrets{
+		secrets: make(map[string][]byte),
+		now:     time.Now,
+		used:    make(map[string]int64),
+	}
+	for _, record := range records {
+		secret := strings.ToUpper(strings.Replace(strings.TrimSpace(record[1]), " ", "", -1))
+		key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("invalid TOTP secret for %s", record[0])
+		}
+		t.secrets[record[0]] = key
+	}
+	return t, nil
+}
+
+// Has reports whether user must give a TOTP code.
+func (t *TOTPSecrets) Has(user string) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.secrets[user]
+	return ok
+}
+
+// Validate checks a 6 digit code for user, rejecting codes that were already
+// used.
+func (t *TOTPSecrets) Validate(user, code string) bool {
+	if t == nil || len(code) != 6 {
+		return false
+	}
+	key, ok := t.secrets[user]
+	if !ok {
+		return false
+	}
+	t.Lock()
+	defer t.Unlock()
+	counter := t.now().Unix() / totpStep
+	for c := counter - 1; c <= counter+1; c++ {
+		if c <= t.used[user] {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, c)), []byte(code)) {
+			t.used[user] = c
+			return true
+		}
+	}
+	return false
+}
+
+// totpCode is the RFC 4226 HOTP code of key for counter.
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+// The RFC 6238 SHA-1 test secret, "12345678901234567890".
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	assert.Equal(t, "287082", totpCode(key, 59/totpStep))
+	assert.Equal(t, "081804", totpCode(key, 1111111109/totpStep))
+	assert.Equal(t, "005924", totpCode(key, 1234567890/totpStep))
+}
+
+func TestTOTPSecrets(t *testing.T) {
+	secrets, err := NewTOTPSecrets(bytes.NewBufferString("# comment\nbob: " + strings.ToLower(testTOTPSecret) + "\n"))
+	assert.Equal(t, nil, err)
+	secrets.now = func() time.Time { return time.Unix(1111111109, 0) }
+
+	assert.Equal(t, true, secrets.Has("bob"))
+	assert.Equal(t, false, secrets.Has("alice"))
+	assert.Equal(t, false, secrets.Validate("alice", "081804"))
+	assert.Equal(t, false, secrets.Validate("bob", "000000"))
+	assert.Equal(t, true, secrets.Validate("bob", "081804"))
+	// each code is only accepted once
+	assert.Equal(t, false, secrets.Validate("bob", "081804"))
+	// the next step is accepted for clock skew, but not older ones
+	key := secrets.secrets["bob"]
+	assert.Equal(t, false, secrets.Validate("bob", totpCode(key, 1111111109/totpStep-1)))
+	assert.Equal(t, true, secrets.Validate("bob", totpCode(key, 1111111109/totpStep+1)))
+
+	var nilSecrets *TOTPSecrets
+	assert.Equal(t, false, nilSecrets.Has("bob"))
+
+	_, err = NewTOTPSecrets(bytes.NewBufferString("bob:not base32!\n"))
+	assert.Equal(t, "invalid TOTP secret for bob", err.Error())
+}
+
+func TestTOTPSignIn(t *testing.T) {
+	opts := testOptions()
+	opts.Validate()
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	proxy.serveMux = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response"))
+	})
+	proxy.HtpasswdValidator = passwordOnly(func(user, password string) bool { return password == "secret" })
+	proxy.HtpasswdTOTP, _ = NewTOTPSecrets(bytes.NewBufferString("bob:" + testTOTPSecret + "\n"))
+	proxy.HtpasswdTOTP.now = func() time.Time { return time.Unix(1111111109, 0) }
+	var buf bytes.Buffer
+	proxy.Audit = NewAuditLog(&buf, "Google")
+
+	signIn := func(user, code string) int {
+		form := url.Values{"username": {user}, "password": {"secret"}, "totp": {code}}
+		req, _ := http.NewRequest("POST", "/oauth2/sign_in", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	assert.Equal(t, 200, signIn("bob", ""))
+	assert.Equal(t, true, strings.Contains(buf.String(), `"reason":"invalid totp code"`))
+	assert.Equal(t, 302, signIn("bob", "081804"))
+	assert.Equal(t, 302, signIn("alice", ""))
+
+	// users with a secret can't use basic auth
+	basicAuth := func(user string) int {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(user, "secret")
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	assert.Equal(t, 403, basicAuth("bob"))
+	assert.Equal(t, 200, basicAuth("alice"))
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records spans with the global TracerProvider, which does nothing
+// unless setupTracing was called.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/bitly/oauth2_proxy")
+}
+
+// setupTracing exports spans for serviceName to an OpenTelemetry collector
+// at endpoint (host:port) with OTLP over HTTP, and propagates W3C trace
+// context. The returned func flushes pending spans and stops exporting.
+func setupTracing(endpoint, serviceName string, insecure bool) (func(context.Context) error, error) {
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// TracingHandler records a server span for each request, continuing the
+// trace of an incoming traceparent header.
+func TracingHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer().Start(ctx, "oauth2_proxy "+req.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", req.Method),
+				attribute.String("http.host", req.Host),
+				attribute.String("http.target", req.URL.Path),
+			))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, req.WithContext(ctx))
+		endSpanWithStatus(span, rec.status)
+	})
+}
+
+// startUpstreamSpan starts a client span for proxying req to upstream and
+// adds its traceparent to the request headers.
+func startUpstreamSpan(req *http.Request, upstream string) (*http.Request, trace.Span) {
+	ctx, span := tracer().Start(req.Context(), "upstream "+upstream,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("net.peer.name", upstream),
+		))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req.WithContext(ctx), span
+}
+
+// endSpanWithStatus records the response status of span, treating server
+// errors as failures.
+func endSpanWithStatus(span trace.Span, status int) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// traceError marks span as failed with err, if err isn't nil.
+func traceError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmizerany/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupTestTracing(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+	return recorder
+}
+
+func TestTracingPropagatesToUpstream(t *testing.T) {
+	recorder := setupTestTracing(t)
+
+	var traceparent string
+	upstream := &UpstreamProxy{
+		upstream: "127.0.0.1:8080",
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceparent = r.Header.Get("traceparent")
+			w.WriteHeader(http.StatusBadGateway)
+		}),
+	}
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("GET", "/foo", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rw := httptest.NewRecorder()
+	TracingHandler(upstream).ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusBadGateway, rw.Code)
+
+	spans := recorder.Ended()
+	assert.Equal(t, 2, len(spans))
+	client, server := spans[0], spans[1]
+	assert.Equal(t, "upstream 127.0.0.1:8080", client.Name())
+	assert.Equal(t, "oauth2_proxy GET", server.Name())
+	assert.Equal(t, traceID, server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, server.SpanContext().SpanID(), client.Parent().SpanID())
+	assert.Equal(t, "Error", client.Status().Code.String())
+
+	// the upstream continues the trace from the client span
+	assert.Equal(t, "00-"+traceID+"-"+client.SpanContext().SpanID().String()+"-01", traceparent)
+}
+
+func TestTracingDisabled(t *testing.T) {
+	var traceparent string
+	upstream := &UpstreamProxy{
+		upstream: "127.0.0.1:8080",
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceparent = r.Header.Get("traceparent")
+		}),
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	upstream.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceparent)
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPRanges is a list of networks parsed from IP addresses or CIDR ranges.
+type IPRanges []*net.IPNet
+
+func ParseIPRanges(entries []string) (IPRanges, error) {
+	var ranges IPRanges
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+func (r IPRanges) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range r {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that sent req. The direct peer
+// is used unless it is one of the trusted proxies, in which case the address
+// comes from header. An X-Forwarded-For header is walked from the right,
+// skipping trusted proxies, so a client can't pick its own address by
+// sending a forged header; any other header, such as X-Real-IP, must hold a
+// single address set by the trusted proxy.
+func clientIP(req *http.Request, trustedProxies IPRanges, header string) net.IP {
+	ip := peerIP(req)
+	if !trustedProxies.Contains(ip) {
+		return ip
+	}
+	header = http.CanonicalHeaderKey(header)
+	if header != "X-Forwarded-For" {
+		if real := net.ParseIP(strings.TrimSpace(req.Header.Get(header))); real != nil {
+			return real
+		}
+		return ip
+	}
+	hops := strings.Split(strings.Join(req.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !trustedProxies.Contains(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// peerIP returns the address of the direct peer that sent req.
+func peerIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// identityHeaders are the default names of the headers set by the proxy to
+// tell upstreams who the user is; the configured names are removed too.
+var identityHeaders = []string{
+	"X-Forwarded-User",
+	"X-Forwarded-Email",
+	"X-Forwarded-Groups",
+	"X-Forwarded-Name",
+	"X-Forwarded-Preferred-Username",
+	"X-Forwarded-Access-Token",
+}
+
+// stripIdentityHeaders removes identityHeaders, extra and GAP-* headers from
+// req unless its direct peer is one of the trusted proxies, so a client
+// can't pass an identity of its choosing to upstreams that trust these
+// headers.
+func stripIdentityHeaders(req *http.Request, trustedProxies IPRanges, extra ...string) {
+	if trustedProxies.Contains(peerIP(req)) {
+		return
+	}
+	for _, header := range append(identityHeaders, extra...) {
+		if header != "" {
+			req.Header.Del(header)
+		}
+	}
+	for header := range req.Header {
+		if strings.HasPrefix(strings.ToUpper(header), "GAP-") {
+			delete(req.Header, header)
+		}
+	}
+}
+
+// setIdentityHeader sets header to value, or removes it when value is empty,
+// as requests from trusted proxies keep the identity headers their clients
+// sent. Nothing is sent for an empty header name.
+func setIdentityHeader(req *http.Request, header, value string) {
+	if header == "" {
+		return
+	}
+	if value == "" {
+		req.Header.Del(header)
+		return
+	}
+	req.Header.Set(header, value)
+}
+
+// clientIP returns the address of the client that sent req, taking the
+// real-client-ip-header from trusted proxies.
+func (p *OauthProxy) clientIP(req *http.Request) net.IP {
+	return clientIP(req, p.trustedProxies, p.clientIPHeader)
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestParseIPRanges(t *testing.T) {
+	r, err := ParseIPRanges([]string{"10.0.0.0/8", "192.168.1.5", "::1"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, r.Contains(net.ParseIP("10.1.2.3")))
+	assert.Equal(t, true, r.Contains(net.ParseIP("192.168.1.5")))
+	assert.Equal(t, false, r.Contains(net.ParseIP("192.168.1.6")))
+	assert.Equal(t, true, r.Contains(net.ParseIP("::1")))
+	assert.Equal(t, false, r.Contains(nil))
+
+	_, err = ParseIPRanges([]string{"not-an-ip"})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := ParseIPRanges([]string{"10.0.0.0/8"})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+	req.Header.Set("X-Forwarded-For", "10.9.9.9")
+	assert.Equal(t, "1.2.3.4", clientIP(req, proxies, "X-Forwarded-For").String())
+
+	req.RemoteAddr = "10.0.0.1:5678"
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 1.2.3.4, 10.0.0.2")
+	assert.Equal(t, "1.2.3.4", clientIP(req, proxies, "X-Forwarded-For").String())
+
+	req.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.1", clientIP(req, proxies, "X-Forwarded-For").String())
+}
+
+func TestClientIPFromRealIPHeader(t *testing.T) {
+	proxies, _ := ParseIPRanges([]string{"10.0.0.0/8"})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+	req.Header.Set("X-Real-IP", "6.6.6.6")
+	assert.Equal(t, "1.2.3.4", clientIP(req, proxies, "x-real-ip").String())
+
+	req.RemoteAddr = "10.0.0.1:5678"
+	assert.Equal(t, "6.6.6.6", clientIP(req, proxies, "x-real-ip").String())
+
+	// X-Forwarded-For is ignored when another header is configured
+	req.Header.Set("X-Forwarded-For", "5.5.5.5")
+	assert.Equal(t, "6.6.6.6", clientIP(req, proxies, "X-Real-IP").String())
+
+	req.Header.Set("X-Real-IP", "garbage")
+	assert.Equal(t, "10.0.0.1", clientIP(req, proxies, "X-Real-IP").String())
+}
+
+func TestStripIdentityHeaders(t *testing.T) {
+	proxies, _ := ParseIPRanges([]string{"10.0.0.0/8"})
+	newRequest := func(remoteAddr string) *http.Request {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-User", "admin")
+		req.Header.Set("X-Forwarded-Email", "admin@example.com")
+		req.Header.Set("X-Forwarded-Groups", "admins")
+		req.Header.Set("X-Forwarded-Access-Token", "token")
+		req.Header.Set("GAP-Auth", "admin@example.com")
+		req.Header["gap-lowercase"] = []string{"x"}
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		return req
+	}
+
+	req := newRequest("1.2.3.4:5678")
+	stripIdentityHeaders(req, proxies)
+	assert.Equal(t, http.Header{"X-Forwarded-For": {"1.2.3.4"}}, req.Header)
+
+	req = newRequest("10.0.0.1:5678")
+	stripIdentityHeaders(req, proxies)
+	assert.Equal(t, "admin", req.Header.Get("X-Forwarded-User"))
+	assert.Equal(t, "admin@example.com", req.Header.Get("GAP-Auth"))
+	assert.Equal(t, 7, len(req.Header))
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/bitly/oauth2_proxy/providers"
+)
+
+// validateConfig loads the configuration the way serving would, and reports
+// every problem that would stop it starting or make it insecure. With
+// checkProvider it also checks that the provider endpoints respond.
+func validateConfig(flagSet *flag.FlagSet, config string, checkProvider bool) []string {
+	opts, err := loadOptions(flagSet, config)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	msgs := checkCookieSecret(opts.CookieSecret, nil)
+
+	done := make(chan bool)
+	defer close(done)
+	if _, err := BuildOauthProxy(opts, done); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+	if opts.HttpsAddress != "" && len(opts.LetsEncryptHosts) == 0 {
+		if _, err := loadCertificate(opts.TLSCertFile, opts.TLSKeyFile); err != nil {
+			msgs = append(msgs, fmt.Sprintf("error loading tls-cert-file=%q tls-key-file=%q %s",
+				opts.TLSCertFile, opts.TLSKeyFile, err))
+		}
+	}
+
+	if checkProvider {
+		client := &http.Client{Timeout: time.Duration(10) * time.Second}
+		msgs = checkProviderEndpoints(client, opts.provider.Data(), msgs)
+	}
+	return msgs
+}
+
+// runValidate implements the validate subcommand, returning the exit status.
+func runValidate(flagSet *flag.FlagSet, config string, checkProvider bool) int {
+	msgs := validateConfig(flagSet, config, checkProvider)
+	if len(msgs) != 0 {
+		for _, msg := range msgs {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		return 1
+	}
+	fmt.Println("configuration OK")
+	return 0
+}
+
+// minCookieSecretBits is the least estimated entropy accepted for
+// cookie-secret.
+const minCookieSecretBits = 64
+
+// checkCookieSecret rejects secrets that are too short or too repetitive to
+// resist guessing.
+func checkCookieSecret(secret string, msgs []string) []string {
+	if len(secret) < 16 {
+		return append(msgs, fmt.Sprintf(
+			"cookie-secret is %d bytes; use at least 16 random bytes", len(secret)))
+	}
+	if bits := secretEntropy(secret); bits < minCookieSecretBits {
+		msgs = append(msgs, fmt.Sprintf(
+			"cookie-secret has about %d bits of entropy; use at least %d "+
+				"(e.g. 16 random bytes, base64 encoded)", int(bits), minCookieSecretBits))
+	}
+	return msgs
+}
+
+// secretEntropy estimates the entropy of secret in bits from the frequency
+// of its bytes.
+func secretEntropy(secret string) float64 {
+	counts := make(map[byte]int)
+	for i := 0; i < len(secret); i++ {
+		counts[secret[i]]++
+	}
+	var perByte float64
+	for _, n := range counts {
+		p := float64(n) / float64(len(secret))
+		perByte -= p * math.Log2(p)
+	}
+	return perByte * float64(len(secret))
+}
+
+// checkProviderEndpoints requests each of the provider's endpoints. They
+// aren't called with valid parameters, so only connection errors and server
+// errors are reported.
+func checkProviderEndpoints(client *http.Client, p *providers.ProviderData, msgs []string) []string {
+	endpoints := []struct {
+		name string
+		url  *url.URL
+	}{
+		{"login-url", p.LoginUrl},
+		{"redeem-url", p.RedeemUrl},
+		{"profile-url", p.ProfileUrl},
+		{"validate-url", p.ValidateUrl},
+	}
+	for _, e := range endpoints {
+		if e.url == nil || e.url.Host == "" {
+			continue
+		}
+		resp, err := client.Get(e.url.String())
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s %s: %s", e.name, e.url, err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			msgs = append(msgs, fmt.Sprintf("%s %s: %s", e.name, e.url, resp.Status))
+		}
+	}
+	return msgs
+}
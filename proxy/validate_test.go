@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bitly/oauth2_proxy/providers"
+	"github.com/bmizerany/assert"
+)
+
+func TestCheckCookieSecret(t *testing.T) {
+	assert.Equal(t, []string{"cookie-secret is 6 bytes; use at least 16 random bytes"},
+		checkCookieSecret("foobar", nil))
+	assert.Equal(t, []string{"cookie-secret has about 0 bits of entropy; use at least 64 " +
+		"(e.g. 16 random bytes, base64 encoded)"},
+		checkCookieSecret("aaaaaaaaaaaaaaaaaaaaaaaa", nil))
+	assert.Equal(t, 0, len(checkCookieSecret("OQINaROshtE9TcZkNAm-5Zs2Pv3xaWytBmc5W7sPX7w=", nil)))
+}
+
+func TestCheckProviderEndpoints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	defer server.Close()
+
+	parse := func(s string) *url.URL {
+		u, _ := url.Parse(s)
+		return u
+	}
+	p := &providers.ProviderData{
+		LoginUrl:    parse(server.URL + "/login"),
+		RedeemUrl:   parse(server.URL + "/broken"),
+		ProfileUrl:  &url.URL{},
+		ValidateUrl: parse(closed.URL + "/validate"),
+	}
+	msgs := checkProviderEndpoints(http.DefaultClient, p, nil)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, "redeem-url "+server.URL+"/broken: 502 Bad Gateway", msgs[0])
+	assert.Equal(t, true, strings.HasPrefix(msgs[1], "validate-url "+closed.URL+"/validate: "))
+}
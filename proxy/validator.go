@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+type UserMap struct {
+	usersFile string
+	m         unsafe.Pointer
+}
+
+func NewUserMap(usersFile string, done <-chan bool, onUpdate func()) *UserMap {
+	um, err := loadUserMap(usersFile, done, onUpdate)
+	if err != nil {
+		logger.Fatalf("failed loading emails file %q, %s", usersFile, err)
+	}
+	return um
+}
+
+// loadUserMap is NewUserMap, but returns an error if the emails file can't
+// be loaded. The file is only watched once it has loaded.
+func loadUserMap(usersFile string, done <-chan bool, onUpdate func()) (*UserMap, error) {
+	um := &UserMap{usersFile: usersFile}
+	m := make(map[string]bool)
+	atomic.StorePointer(&um.m, unsafe.Pointer(&m))
+	if usersFile != "" {
+		logger.Printf("using emails file %s", usersFile)
+		if err := um.loadAuthenticatedEmailsFile(); err != nil {
+			return nil, err
+		}
+		WatchForUpdates(usersFile, done, func() {
+			um.LoadAuthenticatedEmailsFile()
+			onUpdate()
+		})
+	}
+	return um, nil
+}
+
+func (um *UserMap) IsValid(email string) (result bool) {
+	m := *(*map[string]bool)(atomic.LoadPointer(&um.m))
+	_, result = m[email]
+	return
+}
+
+// LoadAuthenticatedEmailsFile re-reads the emails file and atomically swaps
+// in the new set. If the file can't be read the current set is kept, so a
+// half-written or briefly missing file never locks everyone out.
+func (um *UserMap) LoadAuthenticatedEmailsFile() {
+	if err := um.loadAuthenticatedEmailsFile(); err != nil {
+		logger.Errorf("error reloading emails file %q, keeping %d existing entries: %s",
+			um.usersFile, um.Len(), err)
+	}
+}
+
+func (um *UserMap) loadAuthenticatedEmailsFile() error {
+	r, err := os.Open(um.usersFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	csv_reader := csv.NewReader(r)
+	csv_reader.Comma = ','
+	csv_reader.Comment = '#'
+	csv_reader.TrimLeadingSpace = true
+	records, err := csv_reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	updated := make(map[string]bool)
+	for _, r := range records {
+		updated[strings.ToLower(r[0])] = true
+	}
+	atomic.StorePointer(&um.m, unsafe.Pointer(&updated))
+	logger.Printf("loaded %d entries from emails file %q", len(updated), um.usersFile)
+	return nil
+}
+
+func (um *UserMap) Len() int {
+	m := *(*map[string]bool)(atomic.LoadPointer(&um.m))
+	return len(m)
+}
+
+// normalizeEmail lowercases an email address. If stripAliases is set it
+// also drops any "+suffix" from the local part and, for Gmail addresses,
+// its dots, so that "First.Last+test@gmail.com" becomes
+// "firstlast@gmail.com".
+func normalizeEmail(email string, stripAliases bool) string {
+	email = strings.ToLower(email)
+	at := strings.LastIndex(email, "@")
+	if !stripAliases || at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.Replace(local, ".", "", -1)
+	}
+	return local + "@" + domain
+}
+
+// domainMatcher reports whether an email address belongs to one of a set
+// of domains. A domain of "*" matches every address and "*.example.com"
+// matches any subdomain of example.com (but not example.com itself).
+type domainMatcher struct {
+	all      bool
+	suffixes []string
+}
+
+func newDomainMatcher(domains []string) *domainMatcher {
+	m := &domainMatcher{}
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		switch {
+		case domain == "*":
+			m.all = true
+		case strings.HasPrefix(domain, "*."):
+			m.suffixes = append(m.suffixes, domain[1:])
+		default:
+			m.suffixes = append(m.suffixes, fmt.Sprintf("@%s", domain))
+		}
+	}
+	return m
+}
+
+func (m *domainMatcher) Match(email string) bool {
+	if m.all {
+		return strings.Contains(email, "@")
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	for _, suffix := range m.suffixes {
+		if suffix[0] == '@' {
+			if email[at:] == suffix {
+				return true
+			}
+		} else if strings.HasSuffix(email[at+1:], suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// A Validator decides whether an authenticated session may use the proxy.
+// It is given the whole session (email, user, groups and, for JWT bearer
+// tokens, the claims) and the request, so that embedders can plug in their
+// own authorization, such as a database or entitlement service lookup.
+//
+// A cookie session is validated when the user signs in and again each time
+// it is refreshed (see cookie-refresh), not on every request, so a user who
+// is no longer allowed keeps access until then. Bearer tokens and client
+// certificates are validated on every request.
+type Validator interface {
+	Validate(req *http.Request, session *SessionState) bool
+}
+
+// The ValidatorFunc type is an adapter to allow the use of ordinary
+// functions as Validators.
+type ValidatorFunc func(req *http.Request, session *SessionState) bool
+
+// Validate calls f(req, session).
+func (f ValidatorFunc) Validate(req *http.Request, session *SessionState) bool {
+	return f(req, session)
+}
+
+// The EmailValidator type is an adapter to allow the use of functions of
+// the session's email alone, like those returned by NewValidator, as
+// Validators.
+type EmailValidator func(email string) bool
+
+// Validate calls f(session.Email).
+func (f EmailValidator) Validate(req *http.Request, session *SessionState) bool {
+	return f(session.Email)
+}
+
+func newValidatorImpl(domains []string, usersFile string,
+	done <-chan bool, onUpdate func()) EmailValidator {
+	return newUserMapValidator(domains, NewUserMap(usersFile, done, onUpdate))
+}
+
+func newUserMapValidator(domains []string, validUsers *UserMap) EmailValidator {
+	validDomains := newDomainMatcher(domains)
+
+	validator := func(email string) bool {
+		email = strings.ToLower(email)
+		valid := validDomains.Match(email)
+		if !valid {
+			valid = validUsers.IsValid(email)
+		}
+		logger.Printf("validating: is %s valid? %v", email, valid)
+		return valid
+	}
+	return validator
+}
+
+func NewValidator(domains []string, usersFile string) EmailValidator {
+	return newValidatorImpl(domains, usersFile, nil, func() {})
+}
@@ -1,4 +1,4 @@
-package main
+package proxy
 
 import (
 	"io/ioutil"
@@ -30,7 +30,7 @@ func (vt *ValidatorTest) TearDown() {
 }
 
 func (vt *ValidatorTest) NewValidator(domains []string,
-	updated chan<- bool) func(string) bool {
+	updated chan<- bool) EmailValidator {
 	return newValidatorImpl(domains, vt.auth_email_file.Name(),
 		vt.done, func() {
 			if vt.update_seen == false {
@@ -147,3 +147,88 @@ func TestValidatorComparisonsAreCaseInsensitive(t *testing.T) {
 		t.Error("validated domains are not lower-cased")
 	}
 }
+
+func TestValidatorWildcardSubdomain(t *testing.T) {
+	vt := NewValidatorTest(t)
+	defer vt.TearDown()
+
+	vt.WriteEmails(t, []string(nil))
+	domains := []string{"*.corp.example.com", "example.org"}
+	validator := vt.NewValidator(domains, nil)
+
+	if !validator("foo.bar@eng.corp.example.com") {
+		t.Error("email from a subdomain should validate")
+	}
+	if !validator("foo.bar@a.b.Corp.Example.com") {
+		t.Error("email from a nested subdomain should validate")
+	}
+	if validator("foo.bar@corp.example.com") {
+		t.Error("wildcard should not match the bare domain")
+	}
+	if validator("foo.bar@evilcorp.example.com") {
+		t.Error("wildcard should only match whole labels")
+	}
+	if validator("foo.bar@sub.example.org") {
+		t.Error("plain domains should not match subdomains")
+	}
+}
+
+func TestValidatorAnyDomain(t *testing.T) {
+	vt := NewValidatorTest(t)
+	defer vt.TearDown()
+
+	vt.WriteEmails(t, []string(nil))
+	domains := []string{"*"}
+	validator := vt.NewValidator(domains, nil)
+
+	if !validator("foo.bar@example.com") {
+		t.Error("any email should validate")
+	}
+	if validator("foo.bar") {
+		t.Error("a value without a domain should not validate")
+	}
+}
+
+func TestUserMapKeepsEntriesWhenReloadFails(t *testing.T) {
+	f, err := ioutil.TempFile("", "test_auth_emails_")
+	if err != nil {
+		t.Fatal("failed to create temp file: " + err.Error())
+	}
+	f.WriteString("xyzzy@example.com\n")
+	f.Close()
+
+	um := &UserMap{usersFile: f.Name()}
+	um.LoadAuthenticatedEmailsFile()
+	if !um.IsValid("xyzzy@example.com") {
+		t.Error("email should validate")
+	}
+
+	os.Remove(f.Name())
+	um.LoadAuthenticatedEmailsFile()
+	if !um.IsValid("xyzzy@example.com") {
+		t.Error("email should still validate after a failed reload")
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email        string
+		stripAliases bool
+		expected     string
+	}{
+		{"User+test@Corp.com", false, "user+test@corp.com"},
+		{"First.Last@gmail.com", false, "first.last@gmail.com"},
+		{"User+test@Corp.com", true, "user@corp.com"},
+		{"First.Last@corp.com", true, "first.last@corp.com"},
+		{"First.Last+spam@GMail.com", true, "firstlast@gmail.com"},
+		{"first.last@googlemail.com", true, "firstlast@googlemail.com"},
+		{"+user@corp.com", true, "+user@corp.com"},
+		{"Not-An-Email", true, "not-an-email"},
+	}
+	for _, tt := range tests {
+		if actual := normalizeEmail(tt.email, tt.stripAliases); actual != tt.expected {
+			t.Errorf("normalizeEmail(%q, %v) = %q, expected %q",
+				tt.email, tt.stripAliases, actual, tt.expected)
+		}
+	}
+}
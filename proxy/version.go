@@ -1,3 +1,3 @@
-package main
+package proxy
 
 const VERSION = "1.1.1"
@@ -0,0 +1,117 @@
+// +build go1.3,!plan9,!solaris
+
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/fsnotify.v1"
+)
+
+func WaitForReplacement(filename string, op fsnotify.Op,
+	watcher *fsnotify.Watcher) {
+	const sleep_interval = 50 * time.Millisecond
+
+	// Avoid a race when fsnofity.Remove is preceded by fsnotify.Chmod.
+	if op&fsnotify.Chmod != 0 {
+		time.Sleep(sleep_interval)
+	}
+	for {
+		if _, err := os.Stat(filename); err == nil {
+			if err := watcher.Add(filename); err == nil {
+				logger.Printf("watching resumed for %s", filename)
+				return
+			}
+		}
+		time.Sleep(sleep_interval)
+	}
+}
+
+func WatchForUpdates(filename string, done <-chan bool, action func()) {
+	filename = filepath.Clean(filename)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Fatalf("failed to create watcher for %s: %s", filename, err)
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case _ = <-done:
+				logger.Printf("Shutting down watcher for: %s",
+					filename)
+				return
+			case event := <-watcher.Events:
+				// On Arch Linux, it appears Chmod events precede Remove events,
+				// which causes a race between action() and the coming Remove event.
+				// If the Remove wins, the action() (which calls
+				// UserMap.LoadAuthenticatedEmailsFile()) crashes when the file
+				// can't be opened.
+				if event.Op&(fsnotify.Remove|fsnotify.Rename|fsnotify.Chmod) != 0 {
+					logger.Printf("watching interrupted on event: %s", event)
+					watcher.Remove(filename)
+					WaitForReplacement(filename, event.Op, watcher)
+				}
+				logger.Printf("reloading after event: %s", event)
+				action()
+			case err := <-watcher.Errors:
+				logger.Errorf("error watching %s: %s", filename, err)
+			}
+		}
+	}()
+	if err = watcher.Add(filename); err != nil {
+		logger.Fatalf("failed to add %s to watcher: %s", filename, err)
+	}
+	logger.Printf("watching %s for updates", filename)
+}
+
+// WatchFilesForChanges calls action when the contents of any of files
+// change. It watches the directories holding the files rather than the
+// files themselves, so that a file replaced by renaming over it, or reached
+// through a symlink that is swapped (as Kubernetes does to update ConfigMap
+// and Secret volumes), is noticed too.
+func WatchFilesForChanges(files []string, done <-chan bool, action func()) {
+	// let a burst of events, such as a ConfigMap update, finish
+	const settle_interval = 100 * time.Millisecond
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Fatalf("failed to create watcher for %s: %s", files, err)
+	}
+	dirs := make(map[string]bool)
+	for _, filename := range files {
+		dir := filepath.Dir(filepath.Clean(filename))
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err = watcher.Add(dir); err != nil {
+			logger.Fatalf("failed to add %s to watcher: %s", dir, err)
+		}
+	}
+	last := fingerprintFiles(files)
+	go func() {
+		defer watcher.Close()
+		var settle <-chan time.Time
+		for {
+			select {
+			case _ = <-done:
+				logger.Printf("Shutting down watcher for: %s", files)
+				return
+			case <-watcher.Events:
+				settle = time.After(settle_interval)
+			case <-settle:
+				settle = nil
+				if fingerprint := fingerprintFiles(files); fingerprint != last {
+					last = fingerprint
+					action()
+				}
+			case err := <-watcher.Errors:
+				logger.Errorf("error watching %s: %s", files, err)
+			}
+		}
+	}()
+	logger.Printf("watching %s for changes", files)
+}
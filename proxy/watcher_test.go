@@ -0,0 +1,70 @@
+// +build go1.3,!plan9,!solaris
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfigMap lays out dir the way Kubernetes mounts a ConfigMap: name
+// is a symlink to ..data/name, and ..data a symlink to the current version,
+// which an update swaps atomically.
+func writeConfigMap(t *testing.T, dir, version, name, contents string) {
+	if err := os.Mkdir(filepath.Join(dir, version), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, version, name), []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(version, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name))
+}
+
+func TestWatchFilesForChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_watch_files_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeConfigMap(t, dir, "..v1", "oauth2_proxy.cfg", "a")
+	other := filepath.Join(dir, "emails")
+	ioutil.WriteFile(other, []byte("a@example.com\n"), 0600)
+
+	changes := make(chan bool, 10)
+	done := make(chan bool)
+	defer close(done)
+	WatchFilesForChanges([]string{filepath.Join(dir, "oauth2_proxy.cfg"), other}, done,
+		func() { changes <- true })
+	expect := func(changed bool) {
+		select {
+		case <-changes:
+			if !changed {
+				t.Error("unexpected change")
+			}
+		case <-time.After(500 * time.Millisecond):
+			if changed {
+				t.Error("expected a change")
+			}
+		}
+	}
+
+	writeConfigMap(t, dir, "..v2", "oauth2_proxy.cfg", "b")
+	expect(true)
+
+	// unchanged contents don't trigger the action
+	writeConfigMap(t, dir, "..v3", "oauth2_proxy.cfg", "b")
+	expect(false)
+
+	ioutil.WriteFile(other, []byte("b@example.com\n"), 0600)
+	expect(true)
+}
@@ -0,0 +1,64 @@
+// +build !go1.3 plan9 solaris
+
+package proxy
+
+import (
+	"os"
+	"time"
+)
+
+// WatchForUpdates falls back to polling the file's modification time on
+// platforms without fsnotify support.
+func WatchForUpdates(filename string, done <-chan bool, action func()) {
+	const poll_interval = 5 * time.Second
+
+	var last time.Time
+	if info, err := os.Stat(filename); err == nil {
+		last = info.ModTime()
+	}
+	go func() {
+		ticker := time.NewTicker(poll_interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case _ = <-done:
+				logger.Printf("Shutting down watcher for: %s", filename)
+				return
+			case <-ticker.C:
+				info, err := os.Stat(filename)
+				if err != nil || info.ModTime().Equal(last) {
+					continue
+				}
+				last = info.ModTime()
+				logger.Printf("reloading %s after modification", filename)
+				action()
+			}
+		}
+	}()
+	logger.Printf("polling %s for updates every %s", filename, poll_interval)
+}
+
+// WatchFilesForChanges falls back to polling the contents of files on
+// platforms without fsnotify support.
+func WatchFilesForChanges(files []string, done <-chan bool, action func()) {
+	const poll_interval = 5 * time.Second
+
+	last := fingerprintFiles(files)
+	go func() {
+		ticker := time.NewTicker(poll_interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case _ = <-done:
+				logger.Printf("Shutting down watcher for: %s", files)
+				return
+			case <-ticker.C:
+				if fingerprint := fingerprintFiles(files); fingerprint != last {
+					last = fingerprint
+					action()
+				}
+			}
+		}
+	}()
+	logger.Printf("polling %s for changes every %s", files, poll_interval)
+}
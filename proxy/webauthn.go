@@ -0,0 +1,491 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	webauthnPath         = "/oauth2/webauthn"
+	webauthnRegisterPath = "/oauth2/webauthn/register"
+	webauthnVerifyPath   = "/oauth2/webauthn/verify"
+	webauthnScriptPath   = "/oauth2/static/webauthn.js"
+
+	// webauthnChallengeTTL is how long the user has to use their security
+	// key after loading the webauthn page.
+	webauthnChallengeTTL = time.Duration(5) * time.Minute
+
+	// COSE algorithm identifiers of the supported public keys.
+	coseES256 = -7
+	coseRS256 = -257
+)
+
+// webauthnCSP allows the webauthn page to run webauthnScript, which posts
+// the security key's response back to the proxy.
+const webauthnCSP = "default-src 'none'; style-src 'self'; script-src 'self'; connect-src 'self'; " + frameAncestors + "; base-uri 'none'"
+
+type webauthnCredential struct {
+	ID        string    `json:"id"`
+	PublicKey []byte    `json:"public_key"`
+	Algorithm int       `json:"algorithm"`
+	SignCount uint32    `json:"sign_count"`
+	Created   time.Time `json:"created"`
+}
+
+// WebAuthnStore keeps the security keys registered by each user in a JSON
+// file, which is rewritten whenever a key is added or used.
+type WebAuthnStore struct {
+	path string
+
+	sync.Mutex
+	users map[string][]webauthnCredential
+}
+
+// NewWebAuthnStore loads the credentials in path, which need not exist yet.
+func NewWebAuthnStore(path string) (*WebAuthnStore, error) {
+	s := &WebAuthnStore{path: path, users: make(map[string][]webauthnCredential)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.users); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err)
+	}
+	return s, nil
+}
+
+// Credentials returns the keys registered by user.
+func (s *WebAuthnStore) Credentials(user string) []webauthnCredential {
+	s.Lock()
+	defer s.Unlock()
+	return append([]webauthnCredential(nil), s.users[user]...)
+}
+
+// Add registers a new key for user.
+func (s *WebAuthnStore) Add(user string, c webauthnCredential) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, credentials := range s.users {
+		for _, existing := range credentials {
+			if existing.ID == c.ID {
+				return errors.New("security key is already registered")
+			}
+		}
+	}
+	s.users[user] = append(s.users[user], c)
+	return s.save()
+}
+
+// Use records the signature counter of a key after it was used, rejecting
+// a counter that didn't increase, which suggests the key was cloned.
+func (s *WebAuthnStore) Use(user, id string, signCount uint32) error {
+	s.Lock()
+	defer s.Unlock()
+	for i, c := range s.users[user] {
+		if c.ID != id {
+			continue
+		}
+		if (signCount != 0 || c.SignCount != 0) && signCount <= c.SignCount {
+			return fmt.Errorf("signature counter went from %d to %d", c.SignCount, signCount)
+		}
+		s.users[user][i].SignCount = signCount
+		return s.save()
+	}
+	return errors.New("unknown security key")
+}
+
+func (s *WebAuthnStore) save() error {
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// WebAuthn asks users who signed in with OAuth or the htpasswd form to also
+// use a registered security key. Users without a key are only made to
+// register one when it is required.
+type WebAuthn struct {
+	rpID     string
+	required bool
+	store    *WebAuthnStore
+
+	sync.Mutex
+	used map[string]time.Time
+}
+
+func NewWebAuthn(rpID, credentialsFile string, required bool) (*WebAuthn, error) {
+	store, err := NewWebAuthnStore(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthn{rpID: rpID, required: required, store: store, used: make(map[string]time.Time)}, nil
+}
+
+// consume reports whether challenge, issued at issued, wasn't used before,
+// and remembers it until it expires.
+func (w *WebAuthn) consume(challenge string, issued time.Time) bool {
+	w.Lock()
+	defer w.Unlock()
+	now := time.Now()
+	for c, expires := range w.used {
+		if now.After(expires) {
+			delete(w.used, c)
+		}
+	}
+	if _, ok := w.used[challenge]; ok {
+		return false
+	}
+	w.used[challenge] = issued.Add(webauthnChallengeTTL)
+	return true
+}
+
+// Pending reports whether session still needs to use, or register, a
+// security key. A nil *WebAuthn never asks for one.
+func (w *WebAuthn) Pending(session *SessionState) bool {
+	if w == nil || session.SecondFactor == "webauthn" {
+		return false
+	}
+	return w.required || len(w.store.Credentials(session.identity())) != 0
+}
+
+type webauthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// checkClientData checks the client data signed by the security key is for
+// the ceremony typ, challenge and an origin within the relying party.
+func (w *WebAuthn) checkClientData(raw []byte, typ, challenge string) error {
+	var c webauthnClientData
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return err
+	}
+	if c.Type != typ {
+		return fmt.Errorf("unexpected client data type %q", c.Type)
+	}
+	if c.Challenge != challenge {
+		return errors.New("challenge mismatch")
+	}
+	origin, err := url.Parse(c.Origin)
+	if err != nil {
+		return err
+	}
+	host := origin.Hostname()
+	if host != w.rpID && !strings.HasSuffix(host, "."+w.rpID) {
+		return fmt.Errorf("origin %q is not within %s", c.Origin, w.rpID)
+	}
+	if origin.Scheme != "https" && host != "localhost" {
+		return fmt.Errorf("origin %q is not https", c.Origin)
+	}
+	return nil
+}
+
+// checkAuthenticatorData checks the authenticator data is for the relying
+// party and the user was present, returning the signature counter.
+func (w *WebAuthn) checkAuthenticatorData(data []byte) (uint32, error) {
+	if len(data) < 37 {
+		return 0, errors.New("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(w.rpID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return 0, errors.New("authenticator data is for another relying party")
+	}
+	if data[32]&0x01 == 0 {
+		return 0, errors.New("user not present")
+	}
+	return binary.BigEndian.Uint32(data[33:37]), nil
+}
+
+// verifyAssertion checks an assertion signature made by credential c.
+func verifyAssertion(c webauthnCredential, authData, clientDataJSON, signature []byte) error {
+	key, err := x509.ParsePKIXPublicKey(c.PublicKey)
+	if err != nil {
+		return err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if c.Algorithm == coseES256 && ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if c.Algorithm == coseRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+	return errors.New("invalid signature")
+}
+
+// webauthnResponse is a security key's response as posted by
+// webauthnScript, with binary fields in unpadded base64url.
+type webauthnResponse struct {
+	ID                 string `json:"id"`
+	ClientDataJSON     string `json:"clientDataJSON"`
+	AuthenticatorData  string `json:"authenticatorData"`
+	PublicKey          string `json:"publicKey"`
+	PublicKeyAlgorithm int    `json:"publicKeyAlgorithm"`
+	Signature          string `json:"signature"`
+}
+
+func (p *OauthProxy) webauthnCookieName() string {
+	return p.CookieKey + "_webauthn"
+}
+
+// setWebAuthnChallenge issues a new challenge for the user, remembered in a
+// signed cookie until it is used.
+func (p *OauthProxy) setWebAuthnChallenge(rw http.ResponseWriter, user string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(rw, &http.Cookie{
+		Name:     p.webauthnCookieName(),
+		Value:    signedCookieValue(p.CookieSeed, p.webauthnCookieName(), challenge+"|"+user),
+		Path:     webauthnPath,
+		HttpOnly: true,
+		Secure:   p.CookieSecure,
+		Expires:  time.Now().Add(webauthnChallengeTTL),
+	})
+	return challenge, nil
+}
+
+// webauthnChallenge returns the unexpired challenge issued to user, and
+// clears it so that it can't be used again.
+func (p *OauthProxy) webauthnChallenge(rw http.ResponseWriter, req *http.Request, user string) (string, bool) {
+	cookie, err := req.Cookie(p.webauthnCookieName())
+	if err != nil {
+		return "", false
+	}
+	http.SetCookie(rw, &http.Cookie{
+		Name:    p.webauthnCookieName(),
+		Path:    webauthnPath,
+		Expires: time.Now().Add(time.Duration(1) * time.Hour * -1),
+	})
+	value, timestamp, ok := validateCookie(cookie, p.CookieSeed)
+	if !ok || time.Since(timestamp) > webauthnChallengeTTL {
+		return "", false
+	}
+	parts := strings.SplitN(value, "|", 2)
+	if len(parts) != 2 || parts[1] != user || !p.webauthn.consume(parts[0], timestamp) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// WebAuthnPage serves the page where signed in users register or use their
+// security key, and the endpoints its script posts the key's response to.
+func (p *OauthProxy) WebAuthnPage(rw http.ResponseWriter, req *http.Request) {
+	if p.webauthn == nil {
+		http.NotFound(rw, req)
+		return
+	}
+	session, ok := p.LoadCookiedSession(rw, req)
+	if !ok {
+		p.SignInPage(rw, req, 403)
+		return
+	}
+	user := session.identity()
+	verified := session.SecondFactor == "webauthn"
+	registered := len(p.webauthn.store.Credentials(user)) != 0
+
+	switch {
+	case req.URL.Path == webauthnPath && req.Method == "GET":
+		p.webauthnForm(rw, req, user, registered && !verified)
+	case req.URL.Path == webauthnRegisterPath && req.Method == "POST":
+		if registered && !verified {
+			p.webauthnError(rw, 403, "use a registered security key before adding another")
+			return
+		}
+		p.webauthnFinish(rw, req, session, p.webauthnRegister)
+	case req.URL.Path == webauthnVerifyPath && req.Method == "POST":
+		p.webauthnFinish(rw, req, session, p.webauthnVerify)
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+func (p *OauthProxy) webauthnForm(rw http.ResponseWriter, req *http.Request, user string, verify bool) {
+	challenge, err := p.setWebAuthnChallenge(rw, user)
+	if err != nil {
+		p.ErrorPage(rw, req, 500, "Internal Error", err.Error())
+		return
+	}
+	var ids []string
+	for _, c := range p.webauthn.store.Credentials(user) {
+		ids = append(ids, c.ID)
+	}
+	userID := sha256.Sum256([]byte(user))
+	t := struct {
+		Verify      bool
+		Action      string
+		Redirect    string
+		RPID        string
+		User        string
+		UserID      string
+		Challenge   string
+		Credentials string
+		Version     string
+	}{
+		Verify:      verify,
+		Action:      webauthnRegisterPath,
+		Redirect:    validRedirect(req.URL.Query().Get("rd"), req.Host, p.whitelistDomains),
+		RPID:        p.webauthn.rpID,
+		User:        user,
+		UserID:      base64.RawURLEncoding.EncodeToString(userID[:]),
+		Challenge:   challenge,
+		Credentials: strings.Join(ids, ","),
+		Version:     VERSION,
+	}
+	if verify {
+		t.Action = webauthnVerifyPath
+	}
+	rw.Header().Set("Content-Security-Policy", webauthnCSP)
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+	templates, _ := p.pageTemplates()
+	templates.ExecuteTemplate(rw, "webauthn.html", t)
+}
+
+// webauthnFinish checks a posted security key response with check, then
+// marks the session as having used a security key.
+func (p *OauthProxy) webauthnFinish(rw http.ResponseWriter, req *http.Request, session *SessionState,
+	check func(user, challenge string, r *webauthnResponse) error) {
+	user := session.identity()
+	var r webauthnResponse
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, 64*1024)).Decode(&r); err != nil {
+		p.webauthnError(rw, 400, "invalid request")
+		return
+	}
+	challenge, ok := p.webauthnChallenge(rw, req, user)
+	if !ok {
+		p.webauthnError(rw, 400, "the challenge expired, please reload the page")
+		return
+	}
+	if err := check(user, challenge, &r); err != nil {
+		logger.Printf("%s rejecting security key of %s: %s", p.clientIP(req), user, err)
+		p.audit(auditSignInFailed, req, user, "security key: "+err.Error(), Fields{"via": "webauthn"})
+		p.webauthnError(rw, 403, err.Error())
+		return
+	}
+	session.SecondFactor = "webauthn"
+	value, err := buildSessionValue(session, p.AesCipher)
+	if err != nil {
+		logger.Errorf("%s", err)
+	}
+	p.SetCookie(rw, req, value)
+	p.audit(auditSignIn, req, user, "", Fields{"via": "webauthn"})
+	writeJSON(rw, http.StatusOK, jsonRedirect{Redirect: validRedirect(req.URL.Query().Get("rd"), req.Host, p.whitelistDomains)})
+}
+
+func (p *OauthProxy) webauthnError(rw http.ResponseWriter, code int, message string) {
+	writeJSON(rw, code, map[string]string{"error": message})
+}
+
+func (p *OauthProxy) webauthnRegister(user, challenge string, r *webauthnResponse) error {
+	clientData, err1 := base64.RawURLEncoding.DecodeString(r.ClientDataJSON)
+	authData, err2 := base64.RawURLEncoding.DecodeString(r.AuthenticatorData)
+	publicKey, err3 := base64.RawURLEncoding.DecodeString(r.PublicKey)
+	if err1 != nil || err2 != nil || err3 != nil || r.ID == "" {
+		return errors.New("malformed response")
+	}
+	if err := p.webauthn.checkClientData(clientData, "webauthn.create", challenge); err != nil {
+		return err
+	}
+	signCount, err := p.webauthn.checkAuthenticatorData(authData)
+	if err != nil {
+		return err
+	}
+	if r.PublicKeyAlgorithm != coseES256 && r.PublicKeyAlgorithm != coseRS256 {
+		return fmt.Errorf("unsupported key algorithm %d", r.PublicKeyAlgorithm)
+	}
+	if _, err := x509.ParsePKIXPublicKey(publicKey); err != nil {
+		return err
+	}
+	logger.Printf("registering a security key for %s", user)
+	return p.webauthn.store.Add(user, webauthnCredential{
+		ID:        r.ID,
+		PublicKey: publicKey,
+		Algorithm: r.PublicKeyAlgorithm,
+		SignCount: signCount,
+		Created:   time.Now(),
+	})
+}
+
+func (p *OauthProxy) webauthnVerify(user, challenge string, r *webauthnResponse) error {
+	clientData, err1 := base64.RawURLEncoding.DecodeString(r.ClientDataJSON)
+	authData, err2 := base64.RawURLEncoding.DecodeString(r.AuthenticatorData)
+	signature, err3 := base64.RawURLEncoding.DecodeString(r.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return errors.New("malformed response")
+	}
+	var credential *webauthnCredential
+	for _, c := range p.webauthn.store.Credentials(user) {
+		if c.ID == r.ID {
+			credential = &c
+			break
+		}
+	}
+	if credential == nil {
+		return errors.New("unknown security key")
+	}
+	if err := p.webauthn.checkClientData(clientData, "webauthn.get", challenge); err != nil {
+		return err
+	}
+	signCount, err := p.webauthn.checkAuthenticatorData(authData)
+	if err != nil {
+		return err
+	}
+	if err := verifyAssertion(*credential, authData, clientData, signature); err != nil {
+		return err
+	}
+	return p.webauthn.store.Use(user, r.ID, signCount)
+}
+
+// WebAuthnScript serves webauthnScript, which runs the security key
+// ceremony of the webauthn page.
+func (p *OauthProxy) WebAuthnScript(rw http.ResponseWriter) {
+	rw.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	rw.Header().Set("Cache-Control", "public, max-age=3600")
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprint(rw, webauthnScript)
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+// testAuthenticator plays the part of a browser and security key.
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	rpID      string
+	origin    string
+	signCount uint32
+}
+
+func (a *testAuthenticator) authData() []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], 0x01, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+	return data
+}
+
+func (a *testAuthenticator) clientData(typ, challenge string) []byte {
+	b, _ := json.Marshal(webauthnClientData{Type: typ, Challenge: challenge, Origin: a.origin})
+	return b
+}
+
+func (a *testAuthenticator) register(challenge string) *webauthnResponse {
+	publicKey, _ := x509.MarshalPKIXPublicKey(&a.key.PublicKey)
+	return &webauthnResponse{
+		ID:                 "credential-id",
+		ClientDataJSON:     base64.RawURLEncoding.EncodeToString(a.clientData("webauthn.create", challenge)),
+		AuthenticatorData:  base64.RawURLEncoding.EncodeToString(a.authData()),
+		PublicKey:          base64.RawURLEncoding.EncodeToString(publicKey),
+		PublicKeyAlgorithm: coseES256,
+	}
+}
+
+func (a *testAuthenticator) assert(challenge string) *webauthnResponse {
+	a.signCount++
+	authData := a.authData()
+	clientData := a.clientData("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	return &webauthnResponse{
+		ID:                "credential-id",
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientData),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+		Signature:         base64.RawURLEncoding.EncodeToString(signature),
+	}
+}
+
+func TestWebAuthn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_webauthn_")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	opts := testOptions()
+	opts.WebAuthnRPID = "example.com"
+	opts.WebAuthnCredentialsFile = filepath.Join(dir, "credentials.json")
+	opts.WebAuthnRequired = true
+	assert.Equal(t, nil, opts.Validate())
+	proxy := NewOauthProxy(opts, EmailValidator(func(string) bool { return true }))
+	proxy.serveMux = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response"))
+	})
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	authenticator := &testAuthenticator{key: key, rpID: "example.com", origin: "https://app.example.com"}
+
+	session := &http.Cookie{}
+	serve := func(method, path string, body *webauthnResponse, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		json.NewEncoder(&b).Encode(body)
+		req, _ := http.NewRequest(method, "https://app.example.com"+path, &b)
+		req.AddCookie(session)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		for _, c := range (&http.Response{Header: rw.Header()}).Cookies() {
+			if c.Name == proxy.CookieKey {
+				session = c
+			}
+		}
+		return rw
+	}
+	req, _ := http.NewRequest("GET", "https://app.example.com/", nil)
+	session = proxy.MakeCookie(req, "michael.bland@gsa.gov", opts.CookieExpire)
+	challengeRe := regexp.MustCompile(`data-challenge="([^"]+)"`)
+	challenge := func(path string) (string, *http.Cookie) {
+		rw := serve("GET", path, nil)
+		assert.Equal(t, 200, rw.Code)
+		assert.Equal(t, webauthnCSP, rw.Header().Get("Content-Security-Policy"))
+		match := challengeRe.FindStringSubmatch(rw.Body.String())
+		for _, c := range (&http.Response{Header: rw.Header()}).Cookies() {
+			if c.Name == proxy.webauthnCookieName() {
+				return match[1], c
+			}
+		}
+		t.Fatal("no challenge cookie")
+		return "", nil
+	}
+
+	// users without a key must register one first
+	rw := serve("GET", "/foo", nil)
+	assert.Equal(t, 302, rw.Code)
+	assert.Equal(t, "/oauth2/webauthn?rd=%2Ffoo", rw.Header().Get("Location"))
+
+	c, cookie := challenge("/oauth2/webauthn?rd=%2Ffoo")
+	rw = serve("POST", "/oauth2/webauthn/register?rd=%2Ffoo", authenticator.register("wrong"), cookie)
+	assert.Equal(t, 403, rw.Code)
+	// each challenge can only be used once
+	rw = serve("POST", "/oauth2/webauthn/register?rd=%2Ffoo", authenticator.register(c), cookie)
+	assert.Equal(t, 400, rw.Code)
+
+	c, cookie = challenge("/oauth2/webauthn?rd=%2Ffoo")
+	rw = serve("POST", "/oauth2/webauthn/register?rd=%2Ffoo", authenticator.register(c), cookie)
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "{\"redirect\":\"/foo\"}\n", rw.Body.String())
+	assert.Equal(t, 200, serve("GET", "/foo", nil).Code)
+	assert.Equal(t, 1, len(proxy.webauthn.store.Credentials("michael.bland@gsa.gov")))
+
+	// a new session must use the registered key
+	session = proxy.MakeCookie(req, "michael.bland@gsa.gov", opts.CookieExpire)
+	assert.Equal(t, 302, serve("GET", "/foo", nil).Code)
+	c, cookie = challenge("/oauth2/webauthn")
+	rw = serve("POST", "/oauth2/webauthn/register", authenticator.register(c), cookie)
+	assert.Equal(t, 403, rw.Code)
+
+	c, cookie = challenge("/oauth2/webauthn")
+	other := &testAuthenticator{rpID: "example.com", origin: "https://app.example.com"}
+	other.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rw = serve("POST", "/oauth2/webauthn/verify", other.assert(c), cookie)
+	assert.Equal(t, 403, rw.Code)
+
+	c, cookie = challenge("/oauth2/webauthn")
+	rw = serve("POST", "/oauth2/webauthn/verify", authenticator.assert(c), cookie)
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, 200, serve("GET", "/foo", nil).Code)
+
+	// the credentials are kept in the file
+	store, err := NewWebAuthnStore(opts.WebAuthnCredentialsFile)
+	assert.Equal(t, nil, err)
+	credentials := store.Credentials("michael.bland@gsa.gov")
+	assert.Equal(t, 1, len(credentials))
+	assert.Equal(t, uint32(1), credentials[0].SignCount)
+	// a counter that doesn't increase suggests a cloned key
+	assert.NotEqual(t, nil, store.Use("michael.bland@gsa.gov", "credential-id", 1))
+}
+
+func TestWebAuthnCheckClientData(t *testing.T) {
+	w := &WebAuthn{rpID: "example.com"}
+	check := func(origin string) error {
+		b, _ := json.Marshal(webauthnClientData{Type: "webauthn.get", Challenge: "c", Origin: origin})
+		return w.checkClientData(b, "webauthn.get", "c")
+	}
+	assert.Equal(t, nil, check("https://example.com"))
+	assert.Equal(t, nil, check("https://app.example.com:8443"))
+	assert.Equal(t, `origin "https://evilexample.com" is not within example.com`, check("https://evilexample.com").Error())
+	assert.Equal(t, `origin "http://example.com" is not https`, check("http://example.com").Error())
+}